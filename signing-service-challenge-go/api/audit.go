@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+func (s *Server) Audits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.AuditDevice(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+type AuditFindingResponse struct {
+	SignatureID       string `json:"signature_id"`
+	Counter           int    `json:"counter"`
+	SecuredDataFormat string `json:"secured_data_format"`
+	Problem           string `json:"problem"`
+}
+
+type AuditResponse struct {
+	DeviceID        string                 `json:"device_id"`
+	SignaturesCount int                    `json:"signatures_count"`
+	Valid           bool                   `json:"valid"`
+	Findings        []AuditFindingResponse `json:"findings"`
+}
+
+// AuditDevice verifies the whole signature chain of a device.
+// Failing signatures are reported in the response, not as an error status.
+func (s *Server) AuditDevice(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	query, err := queries.NewAuditDeviceQuery(chi.URLParam(r, "deviceID"))
+	if err != nil {
+		logger.Info("Invalid device audit query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	report, err := s.auditDeviceQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device to audit not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted device audit", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to audit a device", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	if !report.Valid() {
+		logger.Warn("Device audit failed",
+			slog.String("device_id", report.DeviceID),
+			slog.Int("findings", len(report.Findings)),
+		)
+	}
+
+	response := AuditResponse{
+		DeviceID:        report.DeviceID,
+		SignaturesCount: report.SignaturesCount,
+		Valid:           report.Valid(),
+		Findings:        make([]AuditFindingResponse, 0, len(report.Findings)),
+	}
+	for _, finding := range report.Findings {
+		response.Findings = append(response.Findings, AuditFindingResponse{
+			SignatureID:       finding.SignatureID,
+			Counter:           finding.Counter,
+			SecuredDataFormat: string(finding.Version),
+			Problem:           finding.Err.Error(),
+		})
+	}
+	WriteAPIResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+const (
+	MediaTypeJSON                = "application/json"
+	MediaTypePEMCertificateChain = "application/pem-certificate-chain"
+	MediaTypePKIXCertificate     = "application/pkix-cert"
+	MediaTypePKCS10              = "application/pkcs10"
+)
+
+var errNoCertificate = errors.New("no PEM certificate found")
+
+func (s *Server) Certificates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if s.getDeviceQueryHandler != nil {
+			s.GetDeviceCertificate(w, r)
+			return
+		}
+	case http.MethodPut:
+		if s.importCertificateCommandHandler != nil {
+			s.ImportDeviceCertificate(w, r)
+			return
+		}
+	}
+	WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+		http.StatusText(http.StatusMethodNotAllowed),
+	})
+}
+
+type CertificateResponse struct {
+	DeviceID string `json:"device_id"`
+	// Certificate is the PEM encoded device certificate.
+	Certificate string `json:"certificate"`
+	// DER is the DER encoded device certificate.
+	DER []byte `json:"der"`
+	// Chain holds the PEM encoded issuers of the certificate, starting with the direct one.
+	Chain []string `json:"chain"`
+}
+
+// GetDeviceCertificate serves the certificate of a device as JSON, as a PEM chain
+// (application/pem-certificate-chain) or as a DER certificate (application/pkix-cert).
+func (s *Server) GetDeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	mediaType, ok := negotiateContentType(r, MediaTypeJSON, MediaTypePEMCertificateChain, MediaTypePKIXCertificate)
+	if !ok {
+		WriteErrorResponse(w, http.StatusNotAcceptable, []string{
+			http.StatusText(http.StatusNotAcceptable),
+		})
+		return
+	}
+
+	query, err := queries.NewGetDeviceQuery(chi.URLParam(r, "deviceID"))
+	if err != nil {
+		logger.Info("Invalid device certificate query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	device, err := s.getDeviceQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device of the certificate not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted device certificate query", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to get a device certificate", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+	if !device.Certified() {
+		WriteErrorResponse(w, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+			"device is not certified",
+		})
+		return
+	}
+
+	switch mediaType {
+	case MediaTypePKIXCertificate:
+		w.Header().Set("Content-Type", MediaTypePKIXCertificate)
+		w.Write(device.Certificate())
+	case MediaTypePEMCertificateChain:
+		w.Header().Set("Content-Type", MediaTypePEMCertificateChain)
+		w.Write(encodeCertificate(device.Certificate()))
+		for _, certificate := range device.CertificateChain() {
+			w.Write(encodeCertificate(certificate))
+		}
+	default:
+		WriteAPIResponse(w, http.StatusOK, newCertificateResponse(device))
+	}
+}
+
+// ImportCertificateRequest holds a certificate issued by an external CA, sent either as
+// JSON, as a PEM chain (application/pem-certificate-chain) or as DER (application/pkix-cert).
+type ImportCertificateRequest struct {
+	// Certificate is the PEM encoded device certificate.
+	Certificate string `json:"certificate"`
+	// Chain holds the PEM encoded issuers of the certificate, starting with the direct one.
+	Chain []string `json:"chain,omitempty"`
+}
+
+// ImportDeviceCertificate certifies a device with a certificate of its public key issued by an external CA.
+func (s *Server) ImportDeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	certificate, chain, err := readCertificates(r)
+	if err != nil {
+		logger.Info("Invalid certificate import request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	cmd, err := commands.NewImportCertificateCommand(chi.URLParam(r, "deviceID"), certificate, chain)
+	if err != nil {
+		logger.Info("Invalid certificate import command", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	device, err := s.importCertificateCommandHandler.Handle(r.Context(), cmd)
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device of the certificate not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if errors.Is(err, commands.ErrValidation) {
+			logger.Info("Rejected device certificate", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusBadRequest, []string{
+				http.StatusText(http.StatusBadRequest),
+				err.Error(),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted certificate import", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to import a device certificate", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, newCertificateResponse(device))
+}
+
+// readCertificates decodes the DER certificate and chain sent in a certificate import request.
+func readCertificates(r *http.Request) ([]byte, [][]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case MediaTypePKIXCertificate:
+		certificate, err := io.ReadAll(r.Body)
+		return certificate, nil, err
+	case MediaTypePEMCertificateChain:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		certificates, err := decodeCertificates(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		return certificates[0], certificates[1:], nil
+	}
+
+	var request ImportCertificateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, nil, err
+	}
+	certificates, err := decodeCertificates([]byte(request.Certificate))
+	if err != nil {
+		return nil, nil, err
+	}
+	chain := make([][]byte, 0, len(request.Chain))
+	for _, encoded := range request.Chain {
+		issuers, err := decodeCertificates([]byte(encoded))
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, issuers...)
+	}
+	return certificates[0], append(certificates[1:], chain...), nil
+}
+
+// decodeCertificates returns the DER bytes of the PEM certificates in data, at least one.
+func decodeCertificates(data []byte) ([][]byte, error) {
+	var certificates [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certificates = append(certificates, block.Bytes)
+		}
+	}
+	if len(certificates) == 0 {
+		return nil, errNoCertificate
+	}
+	return certificates, nil
+}
+
+func newCertificateResponse(device domain.Device) CertificateResponse {
+	response := CertificateResponse{
+		DeviceID:    device.ID(),
+		Certificate: string(encodeCertificate(device.Certificate())),
+		DER:         device.Certificate(),
+		Chain:       make([]string, 0, len(device.CertificateChain())),
+	}
+	for _, certificate := range device.CertificateChain() {
+		response.Chain = append(response.Chain, string(encodeCertificate(certificate)))
+	}
+	return response
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
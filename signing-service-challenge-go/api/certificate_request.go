@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+func (s *Server) CertificateRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.CreateCertificateRequest(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+type CertificateRequestResponse struct {
+	DeviceID string `json:"device_id"`
+	// CSR is the PEM encoded PKCS #10 certificate request.
+	CSR string `json:"csr"`
+}
+
+// CreateCertificateRequest creates a certificate request for the device key, served as JSON
+// or as DER (application/pkcs10). It is signed by the device.
+func (s *Server) CreateCertificateRequest(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	mediaType, ok := negotiateContentType(r, MediaTypeJSON, MediaTypePKCS10)
+	if !ok {
+		WriteErrorResponse(w, http.StatusNotAcceptable, []string{
+			http.StatusText(http.StatusNotAcceptable),
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	cmd, err := commands.NewCreateCertificateRequestCommand(deviceID)
+	if err != nil {
+		logger.Info("Invalid certificate request command", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	request, err := s.createCertificateRequestCommandHandler.Handle(r.Context(), cmd)
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device of the certificate request not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted certificate request creation", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to create a certificate request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	if mediaType == MediaTypePKCS10 {
+		w.Header().Set("Content-Type", MediaTypePKCS10)
+		w.Write(request)
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, CertificateRequestResponse{
+		DeviceID: deviceID,
+		CSR:      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request})),
+	})
+}
@@ -0,0 +1,208 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+)
+
+func newCertificateServer(t *testing.T) (http.Handler, string) {
+	return newPKIServer(t, false)
+}
+
+// newPKIServer serves a device, certified by the internal CA unless externalCertificate is set.
+func newPKIServer(t *testing.T, externalCertificate bool) (http.Handler, string) {
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	repository := persistence.NewInMemoryDeviceRepository()
+	createDeviceCommandHandler := commands.CreateDeviceCommandHandler{
+		DeviceRepository: repository,
+		KeyProviderResolver: map[string]crypto.Provider{
+			"ecdsa": &crypto.ECDSAProvider{ECCGenerator: crypto.ECCGenerator{Curve: elliptic.P256()}},
+		},
+		CertificateIssuer: authority,
+	}
+	cmd, err := commands.NewCreateDeviceCommand("ecdsa", "Till 1", "", "", "", externalCertificate)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := createDeviceCommandHandler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := api.NewServer("", logger, createDeviceCommandHandler, commands.CreateSignatureCommandHandler{},
+		api.WithGetDeviceQueryHandler(&queries.GetDeviceQueryHandler{DeviceRepository: repository}),
+		api.WithExternalCertification(
+			&commands.CreateCertificateRequestCommandHandler{
+				DeviceRepository: repository,
+				SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+					domain.SigningAlgorithmECDSA: &crypto.ECDSASignerFactory{},
+				},
+			},
+			&commands.ImportCertificateCommandHandler{DeviceRepository: repository},
+		),
+	)
+	return server.Routes(), device.ID()
+}
+
+func getCertificate(handler http.Handler, deviceID string, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+deviceID+"/certificate", nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_GetDeviceCertificate_DER(t *testing.T) {
+	handler, deviceID := newCertificateServer(t)
+
+	response := getCertificate(handler, deviceID, api.MediaTypePKIXCertificate)
+	if response.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", response.Code)
+	}
+	certificate, err := x509.ParseCertificate(response.Body.Bytes())
+	if err != nil {
+		t.Fatal("Expected a DER certificate, got", err)
+	}
+	if certificate.Subject.SerialNumber != deviceID {
+		t.Fatal("Expected serial number", deviceID, "got", certificate.Subject.SerialNumber)
+	}
+}
+
+func Test_GetDeviceCertificate_PEMChain(t *testing.T) {
+	handler, deviceID := newCertificateServer(t)
+
+	response := getCertificate(handler, deviceID, "application/pem-certificate-chain, application/json;q=0.5")
+	if response.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", response.Code)
+	}
+	var blocks int
+	for rest := response.Body.Bytes(); ; blocks++ {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+	}
+	if blocks != 2 {
+		t.Fatal("Expected the certificate and the CA certificate, got", blocks, "PEM blocks")
+	}
+}
+
+func Test_GetDeviceCertificate_NotAcceptable(t *testing.T) {
+	handler, deviceID := newCertificateServer(t)
+
+	response := getCertificate(handler, deviceID, "text/html")
+	if response.Code != http.StatusNotAcceptable {
+		t.Fatal("Expected status", http.StatusNotAcceptable, "got", response.Code)
+	}
+}
+
+func Test_ExternalCertification(t *testing.T) {
+	handler, deviceID := newPKIServer(t, true)
+
+	if response := getCertificate(handler, deviceID, ""); response.Code != http.StatusNotFound {
+		t.Fatal("Expected an uncertified device, got status", response.Code)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/"+deviceID+"/csr", nil)
+	request.Header.Set("Accept", api.MediaTypePKCS10)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", response.Code)
+	}
+	certificateRequest, err := x509.ParseCertificateRequest(response.Body.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	// The external CA certifies the key in the request
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Regulator CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caCertificate, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      certificateRequest.Subject,
+		NotBefore:    caTemplate.NotBefore,
+		NotAfter:     caTemplate.NotAfter,
+	}, caTemplate, certificateRequest.PublicKey, caKey)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	body := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCertificate})...)
+	request = httptest.NewRequest(http.MethodPut, "/api/v0/devices/"+deviceID+"/certificate", bytes.NewReader(body))
+	request.Header.Set("Content-Type", api.MediaTypePEMCertificateChain)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", response.Code, response.Body.String())
+	}
+
+	response = getCertificate(handler, deviceID, api.MediaTypePKIXCertificate)
+	if response.Code != http.StatusOK || !bytes.Equal(response.Body.Bytes(), certificate) {
+		t.Fatal("Expected the imported certificate, got status", response.Code)
+	}
+}
+
+func Test_ImportDeviceCertificate_KeyMismatch(t *testing.T) {
+	handler, deviceID := newPKIServer(t, true)
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	// The CA certificate doesn't certify the device key
+	request := httptest.NewRequest(http.MethodPut, "/api/v0/devices/"+deviceID+"/certificate", bytes.NewReader(authority.Certificate().Raw))
+	request.Header.Set("Content-Type", api.MediaTypePKIXCertificate)
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Fatal("Expected status", http.StatusBadRequest, "got", response.Code)
+	}
+	if response := getCertificate(handler, deviceID, ""); response.Code != http.StatusNotFound {
+		t.Fatal("Expected the device to stay uncertified, got status", response.Code)
+	}
+}
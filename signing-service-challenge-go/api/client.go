@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+func (s *Server) Clients(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.ListDeviceClients(w, r)
+	case http.MethodPost:
+		s.RegisterDeviceClient(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+func (s *Server) Client(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodDelete:
+		s.DeregisterDeviceClient(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+type RegisterDeviceClientRequest struct {
+	// SerialNumber identifies the client, e.g. a cash register, among those of the device.
+	SerialNumber string `json:"serial_number"`
+}
+
+type ClientResponse struct {
+	DeviceID     string `json:"device_id"`
+	ID           string `json:"id"`
+	SerialNumber string `json:"serial_number"`
+	State        string `json:"state"`
+	RegisteredAt string `json:"registered_at"`
+	// DeregisteredAt is set for deregistered clients only.
+	DeregisteredAt string `json:"deregistered_at,omitempty"`
+}
+
+type ClientListResponse struct {
+	DeviceID string           `json:"device_id"`
+	Clients  []ClientResponse `json:"clients"`
+}
+
+// RegisterDeviceClient registers a client allowed to request signatures from a device.
+func (s *Server) RegisterDeviceClient(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var request RegisterDeviceClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Info("Invalid client registration request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	deviceID := chi.URLParam(r, "deviceID")
+	cmd, err := commands.NewRegisterClientCommand(deviceID, request.SerialNumber)
+	if err != nil {
+		logger.Info("Invalid client registration command", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	client, err := s.registerClientCommandHandler.Handle(r.Context(), cmd)
+	if err != nil {
+		writeClientError(w, logger, "register", err)
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, newClientResponse(deviceID, client))
+}
+
+// DeregisterDeviceClient refuses further signatures requested by a client of a device.
+func (s *Server) DeregisterDeviceClient(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	deviceID := chi.URLParam(r, "deviceID")
+	cmd, err := commands.NewDeregisterClientCommand(deviceID, chi.URLParam(r, "clientID"))
+	if err != nil {
+		logger.Info("Invalid client deregistration command", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	client, err := s.deregisterClientCommandHandler.Handle(r.Context(), cmd)
+	if err != nil {
+		writeClientError(w, logger, "deregister", err)
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, newClientResponse(deviceID, client))
+}
+
+// ListDeviceClients serves the clients of a device, filtered by the state query parameter if given.
+func (s *Server) ListDeviceClients(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	deviceID := chi.URLParam(r, "deviceID")
+	query, err := queries.NewListClientsQuery(deviceID, r.URL.Query().Get("state"))
+	if err != nil {
+		logger.Info("Invalid client list query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	clients, err := s.listClientsQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		writeClientError(w, logger, "list", err)
+		return
+	}
+	response := ClientListResponse{
+		DeviceID: deviceID,
+		Clients:  make([]ClientResponse, 0, len(clients)),
+	}
+	for _, client := range clients {
+		response.Clients = append(response.Clients, newClientResponse(deviceID, client))
+	}
+	WriteAPIResponse(w, http.StatusOK, response)
+}
+
+// writeClientError writes the response of a failed client operation.
+func writeClientError(w http.ResponseWriter, logger *slog.Logger, operation string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrDeviceNotFound), errors.Is(err, domain.ErrClientNotFound):
+		logger.Info("Client or device not found", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+	case errors.Is(err, domain.ErrClientAlreadyRegistered), errors.Is(err, domain.ErrClientNotRegistered):
+		logger.Info("Client registration conflict", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusConflict, []string{
+			http.StatusText(http.StatusConflict),
+			clientConflict(err).Error(),
+		})
+	case errors.Is(err, commands.ErrValidation), errors.Is(err, queries.ErrValidation):
+		logger.Info("Invalid client command", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+	default:
+		if WriteContextError(w, err) {
+			logger.Info("Aborted client operation", slog.String("operation", operation), slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed client operation", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+	}
+}
+
+// clientConflict is the domain error of a client registration conflict, without internal details.
+func clientConflict(err error) error {
+	if errors.Is(err, domain.ErrClientAlreadyRegistered) {
+		return domain.ErrClientAlreadyRegistered
+	}
+	return domain.ErrClientNotRegistered
+}
+
+func newClientResponse(deviceID string, client domain.Client) ClientResponse {
+	response := ClientResponse{
+		DeviceID:     deviceID,
+		ID:           client.ID(),
+		SerialNumber: client.SerialNumber(),
+		State:        string(client.State()),
+		RegisteredAt: client.RegisteredAt().UTC().Format(time.RFC3339Nano),
+	}
+	if !client.Registered() {
+		response.DeregisteredAt = client.DeregisteredAt().UTC().Format(time.RFC3339Nano)
+	}
+	return response
+}
@@ -0,0 +1,74 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+func serveClient(handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_DeviceClients_Lifecycle(t *testing.T) {
+	handler, _ := newTestServer(t, func(repository domain.DeviceRepository, _ *commands.CreateSignatureCommandHandler) []api.ServerOption {
+		return []api.ServerOption{api.WithClients(
+			&commands.RegisterClientCommandHandler{DeviceRepository: repository},
+			&commands.DeregisterClientCommandHandler{DeviceRepository: repository},
+			&queries.ListClientsQueryHandler{DeviceRepository: repository},
+		)}
+	})
+
+	recorder := serveClient(handler, http.MethodPost, "/api/v0/devices", `{"algorithm":"ed25519","secured_data_format":"v4"}`)
+	var device struct {
+		Data api.DeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &device); err != nil || recorder.Code != http.StatusOK {
+		t.Fatal("Expected a v4 device, got", recorder.Code, recorder.Body.String())
+	}
+	clients := "/api/v0/devices/" + device.Data.ID + "/clients"
+
+	recorder = serveClient(handler, http.MethodPost, clients, `{"serial_number":"register_0"}`)
+	var registered struct {
+		Data api.ClientResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &registered); err != nil || registered.Data.State != "registered" {
+		t.Fatal("Expected a registered client, got", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serveClient(handler, http.MethodPost, clients, `{"serial_number":"register_0"}`); recorder.Code != http.StatusConflict {
+		t.Fatal("Expected status", http.StatusConflict, "got", recorder.Code)
+	}
+
+	recorder = postSignature(handler, device.Data.ID, `{"data":"tx_0","client_id":"`+registered.Data.ID+`"}`, "")
+	var signature struct {
+		Data api.SignatureResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &signature); err != nil || signature.Data.ClientID != registered.Data.ID {
+		t.Fatal("Expected a signature of the client, got", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := serveClient(handler, http.MethodDelete, clients+"/"+registered.Data.ID, ""); recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	if recorder := postSignature(handler, device.Data.ID, `{"data":"tx_1","client_id":"`+registered.Data.ID+`"}`, ""); recorder.Code != http.StatusBadRequest {
+		t.Fatal("Expected status", http.StatusBadRequest, "got", recorder.Code)
+	}
+
+	recorder = serveClient(handler, http.MethodGet, clients+"?state=deregistered", "")
+	var list struct {
+		Data api.ClientListResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil || len(list.Data.Clients) != 1 || list.Data.Clients[0].DeregisteredAt == "" {
+		t.Fatal("Expected the deregistered client, got", recorder.Body.String())
+	}
+}
@@ -1,13 +1,13 @@
 package api
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
 )
 
 func (s *Server) Devices(w http.ResponseWriter, r *http.Request) {
@@ -24,21 +24,41 @@ func (s *Server) Devices(w http.ResponseWriter, r *http.Request) {
 type CreateDeviceRequest struct {
 	Algorithm string `json:"algorithm"`
 	Label     string `json:"label"`
+	// SecuredDataFormat is the version of the format of the signed data ("v1", "v2", "v3", "v4" or "rksv").
+	// RKSV devices sign Austrian cash register receipts and must use ECDSA and raw signatures.
+	SecuredDataFormat string `json:"secured_data_format,omitempty"`
+	// SignatureFormat is the default format of the signatures ("raw", "jws", "cms" or "cose").
+	SignatureFormat string `json:"signature_format,omitempty"`
+	// ChainingMode is how the signatures are chained to the previous one ("signature" or "hash").
+	ChainingMode string `json:"chaining_mode,omitempty"`
+	// ExternalCertificate leaves the device uncertified until a certificate issued
+	// by an external CA is imported, instead of issuing one with the internal CA.
+	ExternalCertificate bool `json:"external_certificate,omitempty"`
 }
 
 type DeviceResponse struct {
-	ID              string `json:"id"`
-	Algorithm       string `json:"algorithm"`
-	Label           string `json:"label"`
-	PublicKey       []byte `json:"public_key"`
-	SignaturesCount int    `json:"signatures_count"`
+	ID                string `json:"id"`
+	Algorithm         string `json:"algorithm"`
+	Label             string `json:"label"`
+	PublicKey         string `json:"public_key"`
+	SecuredDataFormat string `json:"secured_data_format"`
+	SignatureFormat   string `json:"signature_format"`
+	ChainingMode      string `json:"chaining_mode"`
+	KeyID             string `json:"key_id"`
+	Certified         bool   `json:"certified"`
+	SignaturesCount   int    `json:"signatures_count"`
+	// TurnoverKey is the AES-256 key encrypting the turnover counters of RKSV devices, to be
+	// registered with the tax authority. Only returned when the device is created.
+	TurnoverKey []byte `json:"turnover_key,omitempty"`
 }
 
 func (s *Server) CreateDevice(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
 	var request CreateDeviceRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		s.logger.Info("Invalid device creation request", slog.String("error", err.Error()))
+		logger.Info("Invalid device creation request", slog.String("error", err.Error()))
 		WriteErrorResponse(w, http.StatusBadRequest, []string{
 			http.StatusText(http.StatusBadRequest),
 			err.Error(),
@@ -46,9 +66,9 @@ func (s *Server) CreateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd, err := commands.NewCreateDeviceCommand(request.Algorithm, request.Label)
+	cmd, err := commands.NewCreateDeviceCommand(request.Algorithm, request.Label, request.SecuredDataFormat, request.SignatureFormat, request.ChainingMode, request.ExternalCertificate)
 	if err != nil {
-		s.logger.Info("Invalid device creation command", slog.String("error", err.Error()))
+		logger.Info("Invalid device creation command", slog.String("error", err.Error()))
 		WriteErrorResponse(w, http.StatusBadRequest, []string{
 			http.StatusText(http.StatusBadRequest),
 			err.Error(),
@@ -56,17 +76,21 @@ func (s *Server) CreateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	device, err := s.createDeviceCommandHandler.Handle(context.Background(), cmd)
+	device, err := s.createDeviceCommandHandler.Handle(r.Context(), cmd)
 	if err != nil {
 		if errors.Is(err, commands.ErrValidation) {
-			s.logger.Info("Invalid device creation command", slog.String("error", err.Error()))
+			logger.Info("Invalid device creation command", slog.String("error", err.Error()))
 			WriteErrorResponse(w, http.StatusBadRequest, []string{
 				http.StatusText(http.StatusBadRequest),
 				err.Error(),
 			})
 			return
 		}
-		s.logger.Error("Failed to create a device", slog.String("error", err.Error()))
+		if WriteContextError(w, err) {
+			logger.Info("Aborted device creation", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to create a device", slog.String("error", err.Error()))
 		WriteErrorResponse(w, http.StatusInternalServerError, []string{
 			// Avoid propagating internal errors traces to the clients
 			http.StatusText(http.StatusInternalServerError),
@@ -74,12 +98,20 @@ func (s *Server) CreateDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	annotateAccessLog(r.Context(), slog.String("device_id", device.ID()))
+
 	response := DeviceResponse{
-		ID:              device.ID(),
-		Algorithm:       string(device.Algorithm()),
-		Label:           device.Label(),
-		PublicKey:       device.PublicKey(),
-		SignaturesCount: device.SignaturesCount(),
+		ID:                device.ID(),
+		Algorithm:         string(device.Algorithm()),
+		Label:             device.Label(),
+		PublicKey:         string(device.PublicKey()),
+		SecuredDataFormat: string(device.SecuredDataFormat().Version()),
+		SignatureFormat:   string(device.SignatureFormat()),
+		ChainingMode:      string(device.ChainingMode()),
+		KeyID:             device.KeyID(),
+		Certified:         device.Certified(),
+		SignaturesCount:   device.SignaturesCount(),
+		TurnoverKey:       device.TurnoverKey(),
 	}
 	WriteAPIResponse(w, http.StatusOK, response)
 }
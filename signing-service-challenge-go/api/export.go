@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/export"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+const MediaTypeTAR = "application/x-tar"
+
+// ExportStatusTrailer is the trailer telling whether an export archive is complete,
+// as its status is sent before it's written: ExportStatusComplete or ExportStatusTruncated.
+const ExportStatusTrailer = "Export-Status"
+
+const (
+	ExportStatusComplete  = "complete"
+	ExportStatusTruncated = "truncated"
+)
+
+func (s *Server) Exports(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.ExportDevice(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+// ExportDevice streams the TAR archive of the signature logs of a device. The from and to
+// query parameters (RFC 3339) bound the creation time of the exported signatures, and the
+// counter_from and counter_to ones their counters, all inclusive. Only the preparation of
+// the export is bounded by deviceExportTimeout, streaming takes as long as the archive needs.
+func (s *Server) ExportDevice(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	signatures, err := exportRange(r)
+	if err != nil {
+		logger.Info("Invalid export range", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	query, err := queries.NewExportDeviceQuery(chi.URLParam(r, "deviceID"), signatures)
+	if err != nil {
+		logger.Info("Invalid export query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), deviceExportTimeout)
+	deviceExport, err := s.exportDeviceQueryHandler.Handle(ctx, query)
+	cancel()
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted device export", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to export device", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	// Lift the write timeout of the server, which would cut long archives short
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.Warn("Failed to lift the write deadline of the export", slog.String("error", err.Error()))
+	}
+
+	w.Header().Set("Content-Type", MediaTypeTAR)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_%d.tar"`,
+		deviceExport.DeviceID(), deviceExport.ExportedAt().Unix()))
+	w.Header().Set("Trailer", ExportStatusTrailer)
+	w.WriteHeader(http.StatusOK)
+	// The status is already sent, a failing export leaves a truncated archive without a signed index
+	if err := deviceExport.Stream(r.Context(), w); err != nil {
+		logger.Error("Failed to stream device export", slog.String("error", err.Error()))
+		w.Header().Set(ExportStatusTrailer, ExportStatusTruncated)
+		return
+	}
+	w.Header().Set(ExportStatusTrailer, ExportStatusComplete)
+}
+
+// exportRange reads the range of the signatures to export from the query parameters.
+func exportRange(r *http.Request) (export.Range, error) {
+	var signatures export.Range
+	values := r.URL.Query()
+	for name, bound := range map[string]**time.Time{"from": &signatures.From, "to": &signatures.To} {
+		if value := values.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return export.Range{}, fmt.Errorf("%w: %s must be an RFC 3339 time", export.ErrInvalidExportRange, name)
+			}
+			*bound = &parsed
+		}
+	}
+	for name, bound := range map[string]**int{"counter_from": &signatures.CounterFrom, "counter_to": &signatures.CounterTo} {
+		if value := values.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return export.Range{}, fmt.Errorf("%w: %s must be an integer", export.ErrInvalidExportRange, name)
+			}
+			*bound = &parsed
+		}
+	}
+	return signatures, nil
+}
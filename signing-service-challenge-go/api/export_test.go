@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/export"
+)
+
+func Test_ExportDevice_CounterRange(t *testing.T) {
+	handler, deviceID := newTestServer(t, func(repository domain.DeviceRepository, signatureHandler *commands.CreateSignatureCommandHandler) []api.ServerOption {
+		return []api.ServerOption{api.WithExportDeviceQueryHandler(&queries.ExportDeviceQueryHandler{
+			DeviceRepository:      repository,
+			SignatureRepository:   repository.(domain.SignatureRepository),
+			SignerFactoryResolver: signatureHandler.SignerFactoryResolver,
+			// Read the signatures over several pages
+			PageSize: 1,
+		})}
+	})
+	for _, data := range []string{"tx_0", "tx_1", "tx_2"} {
+		if recorder := postSignature(handler, deviceID, `{"data":"`+data+`"}`, ""); recorder.Code != http.StatusOK {
+			t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v0/devices/"+deviceID+"/export?counter_from=1", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != api.MediaTypeTAR {
+		t.Fatal("Expected a TAR archive, got", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	var names []string
+	reader := tar.NewReader(recorder.Body)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		names = append(names, header.Name)
+	}
+	if len(names) != 5 || !strings.HasSuffix(names[0], "_Sig-1_Log.json") || !strings.HasSuffix(names[1], "_Sig-2_Log.json") {
+		t.Fatal("Expected the logs of signatures 1 and 2, the public key and the signed index, got", names)
+	}
+	if names[3] != export.IndexName || names[4] != export.IndexSignatureName {
+		t.Fatal("Expected the archive to end with the signed index, got", names)
+	}
+	if status := recorder.Result().Trailer.Get(api.ExportStatusTrailer); status != api.ExportStatusComplete {
+		t.Fatal("Expected a", api.ExportStatusComplete, "archive, got", status)
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/api/v0/devices/" + deviceID + "/export?counter_from=2&counter_to=1", http.StatusBadRequest},
+		{"/api/v0/devices/" + deviceID + "/export?from=yesterday", http.StatusBadRequest},
+		{"/api/v0/devices/unknown/export", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != test.expected {
+			t.Fatal("Expected status", test.expected, "for", test.path, "got", recorder.Code)
+		}
+	}
+}
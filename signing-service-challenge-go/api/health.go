@@ -1,13 +1,13 @@
 package api
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
 
-type HealthResponse struct {
-	Status  string `json:"status"`
-	Version string `json:"version"`
-}
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/health"
+)
 
-// Health evaluates the health of the service and writes a standardized response.
+// Health reports whether the service is alive, regardless of the components it depends on.
 func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodGet {
 		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
@@ -16,10 +16,37 @@ func (s *Server) Health(response http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	health := HealthResponse{
-		Status:  "pass",
-		Version: "v0",
+	WriteHealthResponse(response, s.healthChecker.Live())
+}
+
+// Readiness reports whether the service and all the components it depends on are able to serve requests.
+func (s *Server) Readiness(response http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		WriteErrorResponse(response, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	WriteHealthResponse(response, s.healthChecker.Ready(request.Context()))
+}
+
+// WriteHealthResponse writes a health check response following the application/health+json draft.
+// Unlike the other API responses it isn't wrapped in a data container.
+func WriteHealthResponse(w http.ResponseWriter, response health.Response) {
+	code := http.StatusOK
+	if response.Status == health.StatusFail {
+		code = http.StatusServiceUnavailable
+	}
+
+	bytes, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		WriteInternalError(w)
+		return
 	}
 
-	WriteAPIResponse(response, http.StatusOK, health)
+	w.Header().Set("Content-Type", health.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(bytes)
 }
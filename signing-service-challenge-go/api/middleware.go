@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	ClientIDHeader  = "X-Client-ID"
+
+	maxRequestIDLength = 128
+)
+
+type accessLogKey struct{}
+
+// accessLogEntry collects the attributes handlers want to add to the access log.
+type accessLogEntry struct {
+	attrs []slog.Attr
+}
+
+// annotateAccessLog adds attributes to the access log entry of the current request, if any.
+func annotateAccessLog(ctx context.Context, attrs ...slog.Attr) {
+	if entry, ok := ctx.Value(accessLogKey{}).(*accessLogEntry); ok {
+		entry.attrs = append(entry.attrs, attrs...)
+	}
+}
+
+// RequestLogging accepts or creates a request ID, scopes a logger carrying it
+// to the request context and writes an access log once the request has been served.
+func (s *Server) RequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		logger := s.logger.With(slog.String("request_id", requestID))
+		entry := &accessLogEntry{}
+		ctx := logging.WithLogger(r.Context(), logger)
+		ctx = context.WithValue(ctx, accessLogKey{}, entry)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", routePattern(r)),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client", ClientIdentity(r)),
+		}
+		if clientID := r.Header.Get(ClientIDHeader); clientID != "" {
+			attrs = append(attrs, slog.String("client_id", clientID))
+		}
+		if deviceID := chi.URLParam(r, "deviceID"); deviceID != "" {
+			attrs = append(attrs, slog.String("device_id", deviceID))
+		}
+		attrs = append(attrs, entry.attrs...)
+
+		logger.LogAttrs(ctx, slog.LevelInfo, "HTTP request served", attrs...)
+	})
+}
+
+// ClientIdentity identifies the client performing the request: the common name of a verified
+// TLS client certificate, or else the remote IP. The self-declared X-Client-ID header is left
+// out, a client could otherwise pose as a new one on every request, e.g. to escape rate limits.
+func ClientIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return "cn:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func routePattern(r *http.Request) string {
+	if routeContext := chi.RouteContext(r.Context()); routeContext != nil && routeContext.RoutePattern() != "" {
+		return routeContext.RoutePattern()
+	}
+	return "unmatched"
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		// Printable ASCII only, so the ID can't be used to forge log lines
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package api_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/ratelimit"
+)
+
+func newRequestLoggingHandler(t *testing.T, output *bytes.Buffer) http.Handler {
+	logger, err := logging.New(output, logging.FormatText, "info")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	server := api.NewServer("", logger, commands.CreateDeviceCommandHandler{}, commands.CreateSignatureCommandHandler{})
+	return server.RequestLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("handled")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+}
+
+func Test_RequestLogging_KeepsIncomingRequestID(t *testing.T) {
+	var output bytes.Buffer
+	handler := newRequestLoggingHandler(t, &output)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(api.RequestIDHeader, "request_id_0")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if recorder.Header().Get(api.RequestIDHeader) != "request_id_0" {
+		t.Fatal("Expected request id to be request_id_0, got", recorder.Header().Get(api.RequestIDHeader))
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal("Expected a handler log and an access log, got", lines)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=request_id_0") {
+			t.Fatal("Expected log line to carry the request id, got", line)
+		}
+	}
+	if !strings.Contains(lines[1], "status=418") {
+		t.Fatal("Expected access log to carry the status, got", lines[1])
+	}
+}
+
+func Test_RequestLogging_ReplacesInvalidRequestID(t *testing.T) {
+	var output bytes.Buffer
+	handler := newRequestLoggingHandler(t, &output)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(api.RequestIDHeader, "forged\nline")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	requestID := recorder.Header().Get(api.RequestIDHeader)
+	if requestID == "" || requestID == "forged\nline" {
+		t.Fatal("Expected a generated request id, got", requestID)
+	}
+}
+
+func Test_ClientRateLimit_IgnoresClientIDHeader(t *testing.T) {
+	server := api.NewServer("", slog.New(slog.NewTextHandler(io.Discard, nil)), commands.CreateDeviceCommandHandler{}, commands.CreateSignatureCommandHandler{},
+		api.WithRateLimiters(ratelimit.NewInMemoryLimiter(0.001, 1), ratelimit.NewInMemoryLimiter(0.001, 1)),
+	)
+	handler := server.ClientRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// A new X-Client-ID on every request doesn't get a new bucket
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set(api.ClientIDHeader, "client_id_"+strconv.Itoa(i))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != expected {
+			t.Fatal("Expected status", expected, "got", recorder.Code)
+		}
+	}
+}
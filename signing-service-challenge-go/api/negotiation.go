@@ -0,0 +1,62 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiateContentType picks the offered media type the client prefers according to its
+// Accept header, the first offer winning ties. It returns false when none is acceptable.
+func negotiateContentType(r *http.Request, offers ...string) (string, bool) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return offers[0], true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality := acceptQuality(accept, offer)
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// acceptQuality is the quality given to mediaType by the most specific matching range of an Accept header.
+func acceptQuality(accept string, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, accepted := range strings.Split(accept, ",") {
+		acceptedType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		var rangeSpecificity int
+		switch {
+		case acceptedType == mediaType:
+			rangeSpecificity = 2
+		case acceptedType == mainType+"/*":
+			rangeSpecificity = 1
+		case acceptedType == "*/*":
+			rangeSpecificity = 0
+		default:
+			continue
+		}
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		quality, specificity = q, rangeSpecificity
+	}
+	return quality
+}
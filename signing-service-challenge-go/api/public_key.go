@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+const (
+	MediaTypePEM              = "application/x-pem-file"
+	MediaTypeDER              = "application/octet-stream"
+	MediaTypeJWK              = "application/jwk+json"
+	MediaTypeJWKSet           = "application/jwk-set+json"
+	MediaTypeOpenSSHPublicKey = "application/x-ssh-public-key"
+)
+
+func (s *Server) PublicKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetDevicePublicKey(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+type PublicKeyResponse struct {
+	DeviceID  string `json:"device_id"`
+	Algorithm string `json:"algorithm"`
+	// PEM is the PEM encoded SubjectPublicKeyInfo.
+	PEM string `json:"pem"`
+	// DER is the DER encoded SubjectPublicKeyInfo.
+	DER     []byte     `json:"der"`
+	JWK     crypto.JWK `json:"jwk"`
+	OpenSSH string     `json:"openssh"`
+}
+
+// GetDevicePublicKey serves the public key of a device as JSON, PEM (application/x-pem-file),
+// DER (application/octet-stream), JWK (application/jwk+json) or in the authorized_keys format
+// of OpenSSH (application/x-ssh-public-key).
+func (s *Server) GetDevicePublicKey(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	mediaType, ok := negotiateContentType(r, MediaTypeJSON, MediaTypePEM, MediaTypeDER, MediaTypeJWK, MediaTypeOpenSSHPublicKey)
+	if !ok {
+		WriteErrorResponse(w, http.StatusNotAcceptable, []string{
+			http.StatusText(http.StatusNotAcceptable),
+		})
+		return
+	}
+
+	query, err := queries.NewGetDeviceQuery(chi.URLParam(r, "deviceID"))
+	if err != nil {
+		logger.Info("Invalid device public key query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	device, err := s.getDeviceQueryHandler.Handle(r.Context(), query)
+	if err == nil {
+		var response PublicKeyResponse
+		response, err = newPublicKeyResponse(device)
+		if err == nil {
+			writePublicKey(w, mediaType, response)
+			return
+		}
+	}
+
+	if errors.Is(err, domain.ErrDeviceNotFound) {
+		logger.Info("Device of the public key not found", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+		return
+	}
+	if WriteContextError(w, err) {
+		logger.Info("Aborted device public key query", slog.String("error", err.Error()))
+		return
+	}
+	logger.Error("Failed to get a device public key", slog.String("error", err.Error()))
+	WriteErrorResponse(w, http.StatusInternalServerError, []string{
+		// Avoid propagating internal errors traces to the clients
+		http.StatusText(http.StatusInternalServerError),
+	})
+}
+
+func writePublicKey(w http.ResponseWriter, mediaType string, response PublicKeyResponse) {
+	switch mediaType {
+	case MediaTypePEM:
+		w.Header().Set("Content-Type", MediaTypePEM)
+		w.Write([]byte(response.PEM))
+	case MediaTypeDER:
+		w.Header().Set("Content-Type", MediaTypeDER)
+		w.Write(response.DER)
+	case MediaTypeJWK:
+		writeJOSE(w, MediaTypeJWK, response.JWK)
+	case MediaTypeOpenSSHPublicKey:
+		w.Header().Set("Content-Type", MediaTypeOpenSSHPublicKey)
+		w.Write([]byte(response.OpenSSH))
+	default:
+		WriteAPIResponse(w, http.StatusOK, response)
+	}
+}
+
+func newPublicKeyResponse(device domain.Device) (PublicKeyResponse, error) {
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+	encodedPEM, err := crypto.MarshalPublicKeyPEM(publicKey)
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+	block, _ := pem.Decode(encodedPEM)
+	jwk, err := deviceJWK(device)
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+	openSSH, err := crypto.MarshalOpenSSHPublicKey(publicKey, device.ID())
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+
+	return PublicKeyResponse{
+		DeviceID:  device.ID(),
+		Algorithm: string(device.Algorithm()),
+		PEM:       string(encodedPEM),
+		DER:       block.Bytes,
+		JWK:       jwk,
+		OpenSSH:   string(openSSH),
+	}, nil
+}
+
+// deviceJWK is the JWK of the device public key, identified by the device key ID as the
+// JWS signatures of the device. It carries the certificate chain of the device, if certified.
+func deviceJWK(device domain.Device) (crypto.JWK, error) {
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+	algorithm, err := jose.AlgorithmOf(device.Algorithm(), publicKey)
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+	jwk, err := crypto.NewJWK(publicKey, device.KeyID(), algorithm)
+	if err != nil {
+		return crypto.JWK{}, err
+	}
+	if device.Certified() {
+		jwk = jwk.WithCertificateChain(append([][]byte{device.Certificate()}, device.CertificateChain()...)...)
+	}
+	return jwk, nil
+}
+
+// GetJWKSet serves the public keys of all the devices as a JSON Web Key Set.
+func (s *Server) GetJWKSet(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	if r.Method != http.MethodGet {
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+
+	devices, err := s.listDevicesQueryHandler.Handle(r.Context())
+	if err != nil {
+		if WriteContextError(w, err) {
+			logger.Info("Aborted JWK set query", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to list the devices", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	set := crypto.JWKSet{Keys: make([]crypto.JWK, 0, len(devices))}
+	for _, device := range devices {
+		jwk, err := deviceJWK(device)
+		if err != nil {
+			logger.Error("Skipping a device public key from the JWK set",
+				slog.String("device_id", device.ID()),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	writeJOSE(w, MediaTypeJWKSet, set)
+}
+
+// writeJOSE writes JOSE objects as is, rather than in the API response container, for
+// JOSE libraries to consume them directly.
+func writeJOSE(w http.ResponseWriter, mediaType string, object interface{}) {
+	bytes, err := json.Marshal(object)
+	if err != nil {
+		WriteInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Write(bytes)
+}
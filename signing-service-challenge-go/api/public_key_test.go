@@ -0,0 +1,181 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+func newPublicKeyServer(t *testing.T) (http.Handler, string) {
+	return newTestServer(t, func(repository domain.DeviceRepository, _ *commands.CreateSignatureCommandHandler) []api.ServerOption {
+		return []api.ServerOption{
+			api.WithGetDeviceQueryHandler(&queries.GetDeviceQueryHandler{DeviceRepository: repository}),
+			api.WithListDevicesQueryHandler(&queries.ListDevicesQueryHandler{DeviceRepository: repository}),
+		}
+	})
+}
+
+func getAccepting(handler http.Handler, path string, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_GetDevicePublicKey_Negotiation(t *testing.T) {
+	handler, deviceID := newPublicKeyServer(t)
+	path := "/api/v0/devices/" + deviceID + "/public-key"
+
+	recorder := getAccepting(handler, path, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var response struct {
+		Data api.PublicKeyResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(response.Data.DER)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, ok := publicKey.(ed25519.PublicKey); !ok {
+		t.Fatal("Expected an Ed25519 key, got", publicKey)
+	}
+
+	testCases := map[string]struct {
+		accept      string
+		contentType string
+		check       func(t *testing.T, body []byte)
+	}{
+		"pem": {
+			accept:      api.MediaTypePEM,
+			contentType: api.MediaTypePEM,
+			check: func(t *testing.T, body []byte) {
+				block, _ := pem.Decode(body)
+				if block == nil || block.Type != "PUBLIC KEY" {
+					t.Fatal("Expected a PUBLIC KEY PEM block, got", string(body))
+				}
+				if !bytes.Equal(block.Bytes, response.Data.DER) {
+					t.Fatal("Expected the PEM key to be the DER key")
+				}
+			},
+		},
+		"der": {
+			accept:      api.MediaTypeDER,
+			contentType: api.MediaTypeDER,
+			check: func(t *testing.T, body []byte) {
+				if !bytes.Equal(body, response.Data.DER) {
+					t.Fatal("Expected the DER key, got", body)
+				}
+			},
+		},
+		"jwk": {
+			accept:      api.MediaTypeJWK,
+			contentType: api.MediaTypeJWK,
+			check: func(t *testing.T, body []byte) {
+				var jwk crypto.JWK
+				if err := json.Unmarshal(body, &jwk); err != nil {
+					t.Fatal("Expected no error, got", err)
+				}
+				if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.KeyID != deviceID+":1" {
+					t.Fatal("Expected an Ed25519 JWK identified by the device key ID, got", jwk)
+				}
+				if jwk.X != response.Data.JWK.X {
+					t.Fatal("Expected the JWK key to be", response.Data.JWK.X, "got", jwk.X)
+				}
+			},
+		},
+		"openssh": {
+			accept:      api.MediaTypeOpenSSHPublicKey,
+			contentType: api.MediaTypeOpenSSHPublicKey,
+			check: func(t *testing.T, body []byte) {
+				if !strings.HasPrefix(string(body), "ssh-ed25519 ") || !strings.Contains(string(body), deviceID) {
+					t.Fatal("Expected an ssh-ed25519 authorized_keys line commented with the device ID, got", string(body))
+				}
+			},
+		},
+		"preferred": {
+			accept:      "application/json;q=0.5, application/x-pem-file",
+			contentType: api.MediaTypePEM,
+			check: func(t *testing.T, body []byte) {
+				if block, _ := pem.Decode(body); block == nil {
+					t.Fatal("Expected a PEM block, got", string(body))
+				}
+			},
+		},
+	}
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			recorder := getAccepting(handler, path, testCase.accept)
+			if recorder.Code != http.StatusOK {
+				t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != testCase.contentType {
+				t.Fatal("Expected content type", testCase.contentType, "got", contentType)
+			}
+			testCase.check(t, recorder.Body.Bytes())
+		})
+	}
+
+	recorder = getAccepting(handler, path, "text/html")
+	if recorder.Code != http.StatusNotAcceptable {
+		t.Fatal("Expected status", http.StatusNotAcceptable, "got", recorder.Code)
+	}
+}
+
+func Test_GetJWKSet(t *testing.T) {
+	handler, deviceID := newPublicKeyServer(t)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices", strings.NewReader(`{"algorithm":"ed25519"}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var created struct {
+		Data api.DeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	recorder = getAccepting(handler, "/.well-known/jwks.json", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != api.MediaTypeJWKSet {
+		t.Fatal("Expected content type", api.MediaTypeJWKSet, "got", contentType)
+	}
+	var set crypto.JWKSet
+	if err := json.Unmarshal(recorder.Body.Bytes(), &set); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	keyIDs := map[string]bool{}
+	for _, key := range set.Keys {
+		if key.KeyType != "OKP" || key.Use != "sig" || key.Algorithm != "EdDSA" {
+			t.Fatal("Expected an EdDSA signing key, got", key)
+		}
+		keyIDs[key.KeyID] = true
+	}
+	if len(set.Keys) != 2 || !keyIDs[deviceID+":1"] || !keyIDs[created.Data.KeyID] {
+		t.Fatal("Expected the keys of both devices, got", set.Keys)
+	}
+}
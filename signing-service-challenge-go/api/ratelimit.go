@@ -0,0 +1,79 @@
+package api
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/ratelimit"
+	"github.com/go-chi/chi"
+)
+
+// ClientRateLimit limits the requests of every client identity, when a client limiter is configured.
+func (s *Server) ClientRateLimit(next http.Handler) http.Handler {
+	if s.clientLimiter == nil {
+		return next
+	}
+	return rateLimit(s.clientLimiter, "client", ClientIdentity, next)
+}
+
+// DeviceRateLimit limits the requests targeting every device, when a device limiter is configured.
+// It must wrap a route with a deviceID parameter.
+func (s *Server) DeviceRateLimit(next http.Handler) http.Handler {
+	if s.deviceLimiter == nil {
+		return next
+	}
+	return rateLimit(s.deviceLimiter, "device", func(r *http.Request) string {
+		return chi.URLParam(r, "deviceID")
+	}, next)
+}
+
+func rateLimit(limiter ratelimit.Limiter, scope string, key func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := key(r)
+		decision, err := limiter.Allow(r.Context(), k)
+		if err != nil {
+			// Fail open, an unavailable limiter must not take the service down
+			logging.FromContext(r.Context()).Warn("Rate limiter unavailable",
+				slog.String("scope", scope),
+				slog.String("error", err.Error()),
+			)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writeRateLimitHeaders(w, decision)
+		if !decision.Allowed {
+			logging.FromContext(r.Context()).Info("Rate limit exceeded",
+				slog.String("scope", scope),
+				slog.String("key", k),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+			WriteErrorResponse(w, http.StatusTooManyRequests, []string{
+				http.StatusText(http.StatusTooManyRequests),
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeRateLimitHeaders writes the RateLimit-* headers of the IETF draft.
+// When several limits apply, the most restrictive one is reported.
+func writeRateLimitHeaders(w http.ResponseWriter, decision ratelimit.Decision) {
+	if remaining := w.Header().Get("RateLimit-Remaining"); remaining != "" {
+		if current, err := strconv.Atoi(remaining); err == nil && current <= decision.Remaining {
+			return
+		}
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/qr"
+	"github.com/go-chi/chi"
+)
+
+const (
+	MediaTypePNG  = "image/png"
+	MediaTypeSVG  = "image/svg+xml"
+	MediaTypeText = "text/plain"
+)
+
+const (
+	defaultQRScale = 4
+	maxQRScale     = 32
+)
+
+var ErrInvalidQRScale = fmt.Errorf("scale must be an integer between 1 and %d", maxQRScale)
+
+func (s *Server) SignatureReceipts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetSignatureReceipt(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+type SignatureReceiptResponse struct {
+	DeviceID    string `json:"device_id"`
+	SignatureID string `json:"signature_id"`
+	Template    string `json:"template"`
+	// Payload is the text encoded in the QR code.
+	Payload string `json:"payload"`
+	PNG     []byte `json:"png"`
+	SVG     string `json:"svg"`
+}
+
+// GetSignatureReceipt serves the QR code of a signature as JSON, PNG (image/png), SVG (image/svg+xml)
+// or its bare payload (text/plain). The template query parameter picks the payload layout, and
+// the scale one the pixels per module of PNG images.
+func (s *Server) GetSignatureReceipt(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	mediaType, ok := negotiateContentType(r, MediaTypeJSON, MediaTypePNG, MediaTypeSVG, MediaTypeText)
+	if !ok {
+		WriteErrorResponse(w, http.StatusNotAcceptable, []string{
+			http.StatusText(http.StatusNotAcceptable),
+		})
+		return
+	}
+
+	scale, err := qrScale(r)
+	if err != nil {
+		logger.Info("Invalid signature receipt scale", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	query, err := queries.NewGetSignatureReceiptQuery(
+		chi.URLParam(r, "deviceID"),
+		chi.URLParam(r, "signatureID"),
+		r.URL.Query().Get("template"),
+	)
+	if err != nil {
+		logger.Info("Invalid signature receipt query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	receipt, err := s.signatureReceiptQueryHandler.Handle(r.Context(), query)
+	if err == nil {
+		err = s.writeSignatureReceipt(w, mediaType, scale, receipt)
+		if err == nil {
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, queries.ErrValidation):
+		logger.Info("Invalid signature receipt query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+	case errors.Is(err, domain.ErrDeviceNotFound), errors.Is(err, domain.ErrSignatureNotFound):
+		logger.Info("Signature of the receipt not found", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+	case errors.Is(err, queries.ErrTemplateNotApplicable), errors.Is(err, qr.ErrDataTooLong):
+		logger.Info("Receipt payload not encodable", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusUnprocessableEntity, []string{
+			http.StatusText(http.StatusUnprocessableEntity),
+			err.Error(),
+		})
+	default:
+		if WriteContextError(w, err) {
+			logger.Info("Aborted signature receipt query", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to get a signature receipt", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+	}
+}
+
+func (s *Server) writeSignatureReceipt(w http.ResponseWriter, mediaType string, scale int, receipt queries.Receipt) error {
+	if mediaType == MediaTypeText {
+		w.Header().Set("Content-Type", MediaTypeText+"; charset=utf-8")
+		w.Write([]byte(receipt.Payload))
+		return nil
+	}
+
+	code, err := qr.Encode([]byte(receipt.Payload), s.receiptErrorCorrection)
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case MediaTypePNG:
+		image, err := code.PNG(scale)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", MediaTypePNG)
+		w.Write(image)
+	case MediaTypeSVG:
+		w.Header().Set("Content-Type", MediaTypeSVG)
+		w.Write(code.SVG())
+	default:
+		image, err := code.PNG(scale)
+		if err != nil {
+			return err
+		}
+		WriteAPIResponse(w, http.StatusOK, SignatureReceiptResponse{
+			DeviceID:    receipt.DeviceID,
+			SignatureID: receipt.SignatureID,
+			Template:    receipt.Template,
+			Payload:     receipt.Payload,
+			PNG:         image,
+			SVG:         string(code.SVG()),
+		})
+	}
+	return nil
+}
+
+func qrScale(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("scale")
+	if value == "" {
+		return defaultQRScale, nil
+	}
+	scale, err := strconv.Atoi(value)
+	if err != nil || scale < 1 || scale > maxQRScale {
+		return 0, ErrInvalidQRScale
+	}
+	return scale, nil
+}
@@ -0,0 +1,131 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/qr"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/receipt"
+)
+
+func getReceipt(handler http.Handler, path string, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_GetSignatureReceipt(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	createDeviceCommandHandler := commands.CreateDeviceCommandHandler{
+		DeviceRepository:    repository,
+		KeyProviderResolver: map[string]crypto.Provider{"ed25519": &crypto.Ed25519Provider{}},
+	}
+	cmd, err := commands.NewCreateDeviceCommand("ed25519", "", "", "", "", false)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := createDeviceCommandHandler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := api.NewServer("", logger, createDeviceCommandHandler, commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmEd25519: &crypto.Ed25519SignerFactory{},
+		},
+	}, api.WithSignatureReceiptQueryHandler(&queries.GetSignatureReceiptQueryHandler{
+		DeviceRepository: repository,
+		TemplateResolver: map[string]receipt.Template{
+			receipt.DefaultTemplateName: receipt.DefaultTemplate,
+			receipt.RKSVTemplateName:    receipt.RKSVTemplate,
+		},
+	}, qr.LevelM))
+	handler := server.Routes()
+
+	recorder := postSignature(handler, device.ID(), `{"data":"tx_0"}`, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var signature struct {
+		Data api.SignatureResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	path := "/api/v0/devices/" + device.ID() + "/signatures/" + signature.Data.ID + "/qr"
+
+	recorder = getReceipt(handler, path, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var response struct {
+		Data api.SignatureReceiptResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !strings.HasPrefix(response.Data.Payload, "V1;"+device.ID()+";") {
+		t.Fatal("Expected the default payload of the device, got", response.Data.Payload)
+	}
+	image, err := png.Decode(bytes.NewReader(response.Data.PNG))
+	if err != nil {
+		t.Fatal("Expected a PNG image, got", err)
+	}
+	if payload, err := qr.Decode(image); err != nil || string(payload) != response.Data.Payload {
+		t.Fatal("Expected a QR code of the payload", response.Data.Payload, "got", string(payload), err)
+	}
+	if !strings.HasPrefix(response.Data.SVG, "<svg") {
+		t.Fatal("Expected an SVG image, got", response.Data.SVG)
+	}
+
+	recorder = getReceipt(handler, path+"?scale=2", "image/png")
+	if contentType := recorder.Header().Get("Content-Type"); recorder.Code != http.StatusOK || contentType != "image/png" {
+		t.Fatal("Expected a PNG image, got", recorder.Code, contentType)
+	}
+	image, err = png.Decode(recorder.Body)
+	if err != nil {
+		t.Fatal("Expected a PNG image, got", err)
+	}
+	if payload, err := qr.Decode(image); err != nil || string(payload) != response.Data.Payload {
+		t.Fatal("Expected a QR code of the payload", response.Data.Payload, "got", string(payload), err)
+	}
+	recorder = getReceipt(handler, path, "text/plain")
+	if recorder.Body.String() != response.Data.Payload {
+		t.Fatal("Expected the payload", response.Data.Payload, "got", recorder.Body.String())
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{path + "?scale=0", http.StatusBadRequest},
+		{path + "?template=unknown", http.StatusBadRequest},
+		// The RKSV layout doesn't apply to signatures of other formats
+		{path + "?template=rksv", http.StatusUnprocessableEntity},
+		{"/api/v0/devices/" + device.ID() + "/signatures/unknown/qr", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if recorder := getReceipt(handler, test.path, ""); recorder.Code != test.expected {
+			t.Fatal("Expected status", test.expected, "for", test.path, "got", recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func Test_CreateDeviceSignature_RKSV(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	kek, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := api.NewServer("", logger,
+		commands.CreateDeviceCommandHandler{
+			DeviceRepository: repository,
+			// RKSV devices get P-256 keys whatever the curve of the ECDSA provider
+			KeyProviderResolver: map[string]crypto.Provider{"ecdsa": &crypto.ECDSAProvider{}},
+			KEK:                 kek,
+		},
+		commands.CreateSignatureCommandHandler{
+			DeviceRepository: repository,
+			SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+				domain.SigningAlgorithmECDSA: &crypto.ECDSASignerFactory{},
+			},
+			TurnoverKeys: kek,
+		},
+	).Routes()
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices", strings.NewReader(`{"algorithm":"ecdsa","secured_data_format":"rksv"}`))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var device struct {
+		Data api.DeviceResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if len(device.Data.TurnoverKey) != domain.TurnoverKeySize {
+		t.Fatal("Expected a turnover key, got", device.Data.TurnoverKey)
+	}
+	// The turnover key is only disclosed on creation, it's stored wrapped by the KEK
+	stored, err := repository.FindByID(context.Background(), device.Data.ID)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if unwrapped, err := kek.Unwrap(stored.TurnoverKey()); err != nil || !bytes.Equal(unwrapped, device.Data.TurnoverKey) {
+		t.Fatal("Expected the stored turnover key to be wrapped, got", stored.TurnoverKey(), err)
+	}
+
+	recorder = postSignature(handler, device.Data.ID, `{"json":{"normal":1990,"reduced_1":450}}`, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var signature struct {
+		Data api.SignatureResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !strings.HasPrefix(signature.Data.MachineReadableCode, "_R1-AT0_"+device.Data.ID+"_0_") {
+		t.Fatal("Expected an RKSV machine-readable code, got", signature.Data.MachineReadableCode)
+	}
+
+	tests := []string{
+		`{"data":"tx_0"}`,
+		`{"json":{"normal":100,"tip":50}}`,
+		`{"json":{"normal":100},"signature_format":"jws"}`,
+	}
+	for _, body := range tests {
+		if recorder := postSignature(handler, device.Data.ID, body, ""); recorder.Code != http.StatusBadRequest {
+			t.Fatal("Expected status", http.StatusBadRequest, "for", body, "got", recorder.Code)
+		}
+	}
+}
@@ -1,12 +1,20 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/health"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/qr"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/ratelimit"
 	"github.com/go-chi/chi"
 )
 
@@ -20,35 +28,346 @@ type ErrorResponse struct {
 	Errors []string `json:"errors"`
 }
 
+// Timeouts are the server-wide limits protecting against slow or idle clients.
+type Timeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+var defaultTimeouts = Timeouts{
+	ReadHeader: 5 * time.Second,
+	Read:       10 * time.Second,
+	Write:      40 * time.Second,
+	Idle:       120 * time.Second,
+}
+
+const (
+	// Per-route deadlines applied to the request context.
+	healthTimeout          = 1 * time.Second
+	readinessTimeout       = 5 * time.Second
+	devicesTimeout         = 30 * time.Second // RSA key generation can be slow
+	deviceSignatureTimeout = 10 * time.Second
+	// Batches of RSA signatures take long, this must stay below the write timeout.
+	deviceSignatureBatchTimeout = 35 * time.Second
+	deviceAuditTimeout          = 35 * time.Second
+	deviceCertificateTimeout    = 5 * time.Second
+	devicePublicKeyTimeout      = 5 * time.Second
+	jwkSetTimeout               = 10 * time.Second
+	deviceTransactionTimeout    = 10 * time.Second
+	deviceReceiptTimeout        = 5 * time.Second
+	deviceClientTimeout         = 5 * time.Second
+	deviceExportTimeout         = 10 * time.Second // Only the preparation, see ExportDevice
+	transparencyLogTimeout      = 5 * time.Second
+)
+
+// shutdownTimeout is how long the requests in flight are given to finish on shutdown.
+const shutdownTimeout = 30 * time.Second
+
 // Server manages HTTP requests and dispatches them to the appropriate services.
 type Server struct {
 	listenAddress                 string
 	logger                        *slog.Logger
 	createDeviceCommandHandler    commands.CreateDeviceCommandHandler
 	createSignatureCommandHandler commands.CreateSignatureCommandHandler
+	auditDeviceQueryHandler       *queries.AuditDeviceQueryHandler
+	exportDeviceQueryHandler      *queries.ExportDeviceQueryHandler
+	getDeviceQueryHandler         *queries.GetDeviceQueryHandler
+	listDevicesQueryHandler       *queries.ListDevicesQueryHandler
+	verifySignatureQueryHandler   *queries.VerifySignatureQueryHandler
+	signatureReceiptQueryHandler  *queries.GetSignatureReceiptQueryHandler
+	// Handlers of the transactions of the devices
+	startTransactionCommandHandler *commands.StartTransactionCommandHandler
+	transactionStepCommandHandler  *commands.TransactionStepCommandHandler
+	getTransactionQueryHandler     *queries.GetTransactionQueryHandler
+	listTransactionsQueryHandler   *queries.ListTransactionsQueryHandler
+	receiptErrorCorrection         qr.Level
+	// Handlers of the clients of the devices
+	registerClientCommandHandler   *commands.RegisterClientCommandHandler
+	deregisterClientCommandHandler *commands.DeregisterClientCommandHandler
+	listClientsQueryHandler        *queries.ListClientsQueryHandler
+	// Handlers of the external certification of the devices
+	createCertificateRequestCommandHandler *commands.CreateCertificateRequestCommandHandler
+	importCertificateCommandHandler        *commands.ImportCertificateCommandHandler
+	// Handlers of the transparency log of all the signatures
+	getTreeHeadQueryHandler         *queries.GetTreeHeadQueryHandler
+	getInclusionProofQueryHandler   *queries.GetInclusionProofQueryHandler
+	getConsistencyProofQueryHandler *queries.GetConsistencyProofQueryHandler
+	middlewares                     []func(http.Handler) http.Handler
+	metricsHandler                  http.Handler
+	timeouts                        Timeouts
+	tlsConfig                       *tls.Config
+	healthChecker                   *health.Checker
+	clientLimiter                   ratelimit.Limiter
+	deviceLimiter                   ratelimit.Limiter
+}
+
+// ServerOption configures optional Server features.
+type ServerOption func(*Server)
+
+// WithMiddleware adds middlewares wrapping every route of the Server.
+func WithMiddleware(middlewares ...func(http.Handler) http.Handler) ServerOption {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
+
+// WithMetricsHandler exposes the given handler on /metrics.
+func WithMetricsHandler(handler http.Handler) ServerOption {
+	return func(s *Server) {
+		s.metricsHandler = handler
+	}
+}
+
+// WithTimeouts overrides the default server-wide timeouts.
+func WithTimeouts(timeouts Timeouts) ServerOption {
+	return func(s *Server) {
+		s.timeouts = timeouts
+	}
+}
+
+// WithTLSConfig makes the Server accept HTTPS connections only.
+// The certificates must be part of the given configuration.
+func WithTLSConfig(tlsConfig *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = tlsConfig
+	}
+}
+
+// WithHealthChecker sets the checker evaluating the liveness and readiness of the service.
+func WithHealthChecker(healthChecker *health.Checker) ServerOption {
+	return func(s *Server) {
+		s.healthChecker = healthChecker
+	}
+}
+
+// WithRateLimiters limits the requests per client identity and per device.
+// Either limiter can be nil to disable the corresponding limit.
+func WithRateLimiters(clientLimiter, deviceLimiter ratelimit.Limiter) ServerOption {
+	return func(s *Server) {
+		s.clientLimiter = clientLimiter
+		s.deviceLimiter = deviceLimiter
+	}
+}
+
+// WithAuditDeviceQueryHandler exposes the audit of the device signature chains.
+func WithAuditDeviceQueryHandler(handler *queries.AuditDeviceQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.auditDeviceQueryHandler = handler
+	}
+}
+
+// WithExportDeviceQueryHandler exposes the TAR exports of the device signature logs.
+func WithExportDeviceQueryHandler(handler *queries.ExportDeviceQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.exportDeviceQueryHandler = handler
+	}
+}
+
+// WithGetDeviceQueryHandler exposes the routes reading the devices, e.g. their certificates and public keys.
+func WithGetDeviceQueryHandler(handler *queries.GetDeviceQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.getDeviceQueryHandler = handler
+	}
+}
+
+// WithVerifySignatureQueryHandler exposes the verification of signatures, raw or JWS.
+func WithVerifySignatureQueryHandler(handler *queries.VerifySignatureQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.verifySignatureQueryHandler = handler
+	}
+}
+
+// WithSignatureReceiptQueryHandler exposes the QR codes of the signatures, encoded with the given error correction level.
+func WithSignatureReceiptQueryHandler(handler *queries.GetSignatureReceiptQueryHandler, errorCorrection qr.Level) ServerOption {
+	return func(s *Server) {
+		s.signatureReceiptQueryHandler = handler
+		s.receiptErrorCorrection = errorCorrection
+	}
+}
+
+// WithTransactions exposes the lifecycle of the transactions of the devices: their start,
+// updates and finish, along with the routes reading them.
+func WithTransactions(startTransactionCommandHandler *commands.StartTransactionCommandHandler, transactionStepCommandHandler *commands.TransactionStepCommandHandler, getTransactionQueryHandler *queries.GetTransactionQueryHandler, listTransactionsQueryHandler *queries.ListTransactionsQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.startTransactionCommandHandler = startTransactionCommandHandler
+		s.transactionStepCommandHandler = transactionStepCommandHandler
+		s.getTransactionQueryHandler = getTransactionQueryHandler
+		s.listTransactionsQueryHandler = listTransactionsQueryHandler
+	}
+}
+
+// WithClients exposes the registration of the clients of the devices, their listing and deregistration.
+func WithClients(registerClientCommandHandler *commands.RegisterClientCommandHandler, deregisterClientCommandHandler *commands.DeregisterClientCommandHandler, listClientsQueryHandler *queries.ListClientsQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.registerClientCommandHandler = registerClientCommandHandler
+		s.deregisterClientCommandHandler = deregisterClientCommandHandler
+		s.listClientsQueryHandler = listClientsQueryHandler
+	}
+}
+
+// WithListDevicesQueryHandler exposes the JWK set of all the devices on /.well-known/jwks.json.
+func WithListDevicesQueryHandler(handler *queries.ListDevicesQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.listDevicesQueryHandler = handler
+	}
+}
+
+// WithExternalCertification exposes the routes certifying the devices through an external CA:
+// the creation of certificate requests and the import of the issued certificates.
+func WithExternalCertification(createCertificateRequestCommandHandler *commands.CreateCertificateRequestCommandHandler, importCertificateCommandHandler *commands.ImportCertificateCommandHandler) ServerOption {
+	return func(s *Server) {
+		s.createCertificateRequestCommandHandler = createCertificateRequestCommandHandler
+		s.importCertificateCommandHandler = importCertificateCommandHandler
+	}
+}
+
+// WithTransparencyLog exposes the signed tree heads of the transparency log of all the
+// signatures, along with its inclusion and consistency proofs.
+func WithTransparencyLog(getTreeHeadQueryHandler *queries.GetTreeHeadQueryHandler, getInclusionProofQueryHandler *queries.GetInclusionProofQueryHandler, getConsistencyProofQueryHandler *queries.GetConsistencyProofQueryHandler) ServerOption {
+	return func(s *Server) {
+		s.getTreeHeadQueryHandler = getTreeHeadQueryHandler
+		s.getInclusionProofQueryHandler = getInclusionProofQueryHandler
+		s.getConsistencyProofQueryHandler = getConsistencyProofQueryHandler
+	}
 }
 
 // NewServer is a factory to instantiate a new Server.
-func NewServer(listenAddress string, logger *slog.Logger, createDeviceCommandHandler commands.CreateDeviceCommandHandler, createSignatureCommandHandler commands.CreateSignatureCommandHandler) *Server {
-	return &Server{
+func NewServer(listenAddress string, logger *slog.Logger, createDeviceCommandHandler commands.CreateDeviceCommandHandler, createSignatureCommandHandler commands.CreateSignatureCommandHandler, options ...ServerOption) *Server {
+	s := &Server{
 		listenAddress:                 listenAddress,
 		logger:                        logger,
 		createDeviceCommandHandler:    createDeviceCommandHandler,
 		createSignatureCommandHandler: createSignatureCommandHandler,
+		timeouts:                      defaultTimeouts,
+		healthChecker:                 health.NewChecker("signing-service", health.BuildVersion("")),
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
-// Run registers all HandlerFuncs for the existing HTTP routes and starts the Server.
-func (s *Server) Run() error {
+// Routes registers all HandlerFuncs for the existing HTTP routes.
+func (s *Server) Routes() http.Handler {
 	router := chi.NewRouter()
+	router.Use(s.RequestLogging)
+	router.Use(s.middlewares...)
+	if s.metricsHandler != nil {
+		router.Handle("/metrics", s.metricsHandler)
+	}
+	if s.listDevicesQueryHandler != nil {
+		router.With(s.ClientRateLimit).Handle("/.well-known/jwks.json", withTimeout(jwkSetTimeout, http.HandlerFunc(s.GetJWKSet)))
+	}
 	router.Route("/api/v0", func(r chi.Router) {
-		r.Handle("/health", http.HandlerFunc(s.Health))
-		r.Handle("/devices", http.HandlerFunc(s.Devices))
-		r.Handle("/devices/{deviceID}/signatures", http.HandlerFunc(s.Signatures))
+		r.Handle("/health", withTimeout(healthTimeout, http.HandlerFunc(s.Health)))
+		r.Handle("/health/live", withTimeout(healthTimeout, http.HandlerFunc(s.Health)))
+		r.Handle("/health/ready", withTimeout(readinessTimeout, http.HandlerFunc(s.Readiness)))
+		r.Group(func(r chi.Router) {
+			r.Use(s.ClientRateLimit)
+			r.Handle("/devices", withTimeout(devicesTimeout, http.HandlerFunc(s.Devices)))
+			r.With(s.DeviceRateLimit).Handle("/devices/{deviceID}/signatures", withTimeout(deviceSignatureTimeout, http.HandlerFunc(s.Signatures)))
+			r.With(s.DeviceRateLimit).Handle("/devices/{deviceID}/signatures:batch", withTimeout(deviceSignatureBatchTimeout, http.HandlerFunc(s.SignatureBatches)))
+			if s.verifySignatureQueryHandler != nil {
+				r.Handle("/devices/{deviceID}/signatures:verify", withTimeout(deviceSignatureTimeout, http.HandlerFunc(s.SignatureVerifications)))
+			}
+			if s.startTransactionCommandHandler != nil {
+				r.With(s.DeviceRateLimit).Handle("/devices/{deviceID}/transactions", withTimeout(deviceTransactionTimeout, http.HandlerFunc(s.Transactions)))
+				r.Handle("/devices/{deviceID}/transactions/{transactionID}", withTimeout(deviceTransactionTimeout, http.HandlerFunc(s.Transaction)))
+				r.With(s.DeviceRateLimit).Handle("/devices/{deviceID}/transactions/{transactionID}:update", withTimeout(deviceTransactionTimeout, http.HandlerFunc(s.TransactionUpdates)))
+				r.With(s.DeviceRateLimit).Handle("/devices/{deviceID}/transactions/{transactionID}:finish", withTimeout(deviceTransactionTimeout, http.HandlerFunc(s.TransactionFinishes)))
+			}
+			if s.registerClientCommandHandler != nil {
+				r.Handle("/devices/{deviceID}/clients", withTimeout(deviceClientTimeout, http.HandlerFunc(s.Clients)))
+				r.Handle("/devices/{deviceID}/clients/{clientID}", withTimeout(deviceClientTimeout, http.HandlerFunc(s.Client)))
+			}
+			if s.signatureReceiptQueryHandler != nil {
+				r.Handle("/devices/{deviceID}/signatures/{signatureID}/qr", withTimeout(deviceReceiptTimeout, http.HandlerFunc(s.SignatureReceipts)))
+			}
+			if s.auditDeviceQueryHandler != nil {
+				r.Handle("/devices/{deviceID}/audit", withTimeout(deviceAuditTimeout, http.HandlerFunc(s.Audits)))
+			}
+			if s.exportDeviceQueryHandler != nil {
+				r.Handle("/devices/{deviceID}/export", http.HandlerFunc(s.Exports))
+			}
+			if s.getDeviceQueryHandler != nil {
+				r.Handle("/devices/{deviceID}/public-key", withTimeout(devicePublicKeyTimeout, http.HandlerFunc(s.PublicKeys)))
+			}
+			if s.getDeviceQueryHandler != nil || s.importCertificateCommandHandler != nil {
+				r.Handle("/devices/{deviceID}/certificate", withTimeout(deviceCertificateTimeout, http.HandlerFunc(s.Certificates)))
+			}
+			if s.createCertificateRequestCommandHandler != nil {
+				r.Handle("/devices/{deviceID}/csr", withTimeout(deviceCertificateTimeout, http.HandlerFunc(s.CertificateRequests)))
+			}
+			if s.getTreeHeadQueryHandler != nil {
+				r.Handle("/log/sth", withTimeout(transparencyLogTimeout, http.HandlerFunc(s.TreeHeads)))
+				r.Handle("/log/proof/inclusion", withTimeout(transparencyLogTimeout, http.HandlerFunc(s.InclusionProofs)))
+				r.Handle("/log/proof/consistency", withTimeout(transparencyLogTimeout, http.HandlerFunc(s.ConsistencyProofs)))
+			}
+		})
 	})
+	return router
+}
+
+// Run starts the Server with all the HTTP routes registered. It serves until ctx is done,
+// then shuts down gracefully, leaving shutdownTimeout to the requests in flight.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.listenAddress,
+		Handler:           s.Routes(),
+		ReadHeaderTimeout: s.timeouts.ReadHeader,
+		ReadTimeout:       s.timeouts.Read,
+		WriteTimeout:      s.timeouts.Write,
+		IdleTimeout:       s.timeouts.Idle,
+		TLSConfig:         s.tlsConfig,
+	}
 
-	s.logger.Info(fmt.Sprintf("Starting HTTP server listening on %s", s.listenAddress))
-	return http.ListenAndServe(s.listenAddress, router)
+	errs := make(chan error, 1)
+	go func() {
+		if s.tlsConfig != nil {
+			s.logger.Info(fmt.Sprintf("Starting HTTPS server listening on %s", s.listenAddress))
+			errs <- server.ListenAndServeTLS("", "")
+			return
+		}
+		s.logger.Info(fmt.Sprintf("Starting HTTP server listening on %s", s.listenAddress))
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	s.logger.Info("Shutting down the server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// withTimeout bounds the request context of the given handler to the given duration.
+func withTimeout(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WriteContextError writes the HTTP response for a request whose context
+// finished before the work was completed. It reports whether err was such an error.
+func WriteContextError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		WriteErrorResponse(w, http.StatusServiceUnavailable, []string{
+			http.StatusText(http.StatusServiceUnavailable),
+		})
+		return true
+	case errors.Is(err, context.Canceled):
+		// The client is gone, nobody will read the response
+		return true
+	}
+	return false
 }
 
 // WriteInternalError writes a default internal error message as an HTTP response.
@@ -1,15 +1,17 @@
 package api
 
 import (
-	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
 )
 
 func (s *Server) Signatures(w http.ResponseWriter, r *http.Request) {
@@ -24,21 +26,100 @@ func (s *Server) Signatures(w http.ResponseWriter, r *http.Request) {
 }
 
 type CreateDeviceSignatureRequest struct {
-	Data string `json:"data"`
+	// Data is the data_to_be_signed, interpreted according to Encoding.
+	Data string `json:"data,omitempty"`
+	// Encoding is either "text" (default) or "base64" for binary payloads.
+	Encoding string `json:"encoding,omitempty"`
+	// JSON is a JSON payload, signed in its canonical form. Exclusive with Data.
+	JSON json.RawMessage `json:"json,omitempty"`
+	// SignatureFormat overrides the signature format of the device ("raw", "jws", "cms" or "cose").
+	SignatureFormat string `json:"signature_format,omitempty"`
+	// ClientID is the registered client of the device requesting the signature.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+const (
+	EncodingText   = "text"
+	EncodingBase64 = "base64"
+)
+
+const (
+	// MediaTypeCOSE is served as application/cose; cose-type="cose-sign1".
+	MediaTypeCOSE = "application/cose"
+)
+
+var (
+	ErrAmbiguousPayload    = errors.New("data and json are mutually exclusive")
+	ErrCOSEFormat          = errors.New("COSE responses are only available for the cose signature format")
+	ErrItemSignatureFormat = errors.New("the signature format is set for the whole batch")
+	ErrItemClientID        = errors.New("the client is set for the whole batch")
+	ErrUnknownEncoding     = errors.New("unknown data encoding")
+)
+
+func (r CreateDeviceSignatureRequest) payload() (commands.SignaturePayload, error) {
+	if len(r.JSON) > 0 {
+		if r.Data != "" {
+			return commands.SignaturePayload{}, ErrAmbiguousPayload
+		}
+		return commands.SignaturePayload{Type: string(domain.PayloadTypeJSON), Data: r.JSON}, nil
+	}
+
+	switch r.Encoding {
+	case "", EncodingText:
+		return commands.SignaturePayload{Type: string(domain.PayloadTypeText), Data: []byte(r.Data)}, nil
+	case EncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(r.Data)
+		if err != nil {
+			return commands.SignaturePayload{}, err
+		}
+		return commands.SignaturePayload{Type: string(domain.PayloadTypeBinary), Data: data}, nil
+	}
+	return commands.SignaturePayload{}, ErrUnknownEncoding
 }
 
 type SignatureResponse struct {
-	DeviceID   string `json:"device_id"`
-	ID         string `json:"id"`
-	Signature  []byte `json:"signature"`
-	SignedData string `json:"signed_data"`
+	DeviceID            string `json:"device_id"`
+	ID                  string `json:"id"`
+	Counter             int    `json:"counter"`
+	PreviousSignatureID string `json:"previous_signature_id,omitempty"`
+	Algorithm           string `json:"algorithm"`
+	CreatedAt           string `json:"created_at"`
+	Signature           []byte `json:"signature"`
+	SignedData          string `json:"signed_data"`
+	SecuredDataFormat   string `json:"secured_data_format"`
+	ChainingMode        string `json:"chaining_mode"`
+	// TimestampToken is the DER encoded RFC 3161 token over the signature, when timestamping is enabled.
+	TimestampToken  []byte `json:"timestamp_token,omitempty"`
+	SignatureFormat string `json:"signature_format"`
+	// JWS is the JWS compact serialization of the signed data, for the jws signature format.
+	JWS string `json:"jws,omitempty"`
+	// CMS is the DER encoded detached CMS SignedData over the signed data, for the cms signature format.
+	CMS []byte `json:"cms,omitempty"`
+	// COSE is the tagged COSE_Sign1 message of the signed data, for the cose signature format.
+	COSE []byte `json:"cose,omitempty"`
+	// ClientID is the client of the device which requested the signature, if any.
+	ClientID string `json:"client_id,omitempty"`
+	// MachineReadableCode is the code to print on the receipts of RKSV signatures.
+	MachineReadableCode string `json:"machine_readable_code,omitempty"`
 }
 
+// CreateDeviceSignature signs data with a device. Besides JSON, cose signatures can be
+// served as the bare COSE_Sign1 message, the cose format being the default then.
 func (s *Server) CreateDeviceSignature(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	mediaType, ok := negotiateContentType(r, MediaTypeJSON, MediaTypeCOSE)
+	if !ok {
+		WriteErrorResponse(w, http.StatusNotAcceptable, []string{
+			http.StatusText(http.StatusNotAcceptable),
+		})
+		return
+	}
+
 	var request CreateDeviceSignatureRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		s.logger.Info("Invalid signature creation request", slog.String("error", err.Error()))
+		logger.Info("Invalid signature creation request", slog.String("error", err.Error()))
 		WriteErrorResponse(w, http.StatusBadRequest, []string{
 			http.StatusText(http.StatusBadRequest),
 			err.Error(),
@@ -46,10 +127,34 @@ func (s *Server) CreateDeviceSignature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	payload, err := request.payload()
+	if err != nil {
+		logger.Info("Invalid signature creation request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	if mediaType == MediaTypeCOSE {
+		if request.SignatureFormat == "" {
+			request.SignatureFormat = string(domain.SignatureFormatCOSE)
+		}
+		if request.SignatureFormat != string(domain.SignatureFormatCOSE) {
+			logger.Info("Invalid signature creation request", slog.String("error", ErrCOSEFormat.Error()))
+			WriteErrorResponse(w, http.StatusNotAcceptable, []string{
+				http.StatusText(http.StatusNotAcceptable),
+				ErrCOSEFormat.Error(),
+			})
+			return
+		}
+	}
+
 	deviceID := strings.Split(strings.Split(r.URL.Path, "/devices/")[1], "/signatures")[0]
-	cmd, err := commands.NewCreateSignatureCommand(deviceID, request.Data)
+	cmd, err := commands.NewCreateSignatureCommand(deviceID, request.ClientID, payload, request.SignatureFormat)
 	if err != nil {
-		s.logger.Info("Invalid signature creation command", slog.String("error", err.Error()))
+		logger.Info("Invalid signature creation command", slog.String("error", err.Error()))
 		WriteErrorResponse(w, http.StatusBadRequest, []string{
 			http.StatusText(http.StatusBadRequest),
 			err.Error(),
@@ -57,16 +162,28 @@ func (s *Server) CreateDeviceSignature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	signature, err := s.createSignatureCommandHandler.Handle(context.Background(), cmd)
+	signature, err := s.createSignatureCommandHandler.Handle(r.Context(), cmd)
 	if err != nil {
 		if errors.Is(err, domain.ErrDeviceNotFound) {
-			s.logger.Info("Device for creating a signature not found", slog.String("error", err.Error()))
+			logger.Info("Device for creating a signature not found", slog.String("error", err.Error()))
 			WriteErrorResponse(w, http.StatusNotFound, []string{
 				http.StatusText(http.StatusNotFound),
 			})
 			return
 		}
-		s.logger.Error("Failed to create a signature", slog.String("error", err.Error()))
+		if errors.Is(err, commands.ErrValidation) {
+			logger.Info("Invalid signature creation command", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusBadRequest, []string{
+				http.StatusText(http.StatusBadRequest),
+				err.Error(),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted signature creation", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to create a signature", slog.String("error", err.Error()))
 		WriteErrorResponse(w, http.StatusInternalServerError, []string{
 			// Avoid propagating internal errors traces to the clients
 			http.StatusText(http.StatusInternalServerError),
@@ -74,11 +191,41 @@ func (s *Server) CreateDeviceSignature(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if mediaType == MediaTypeCOSE {
+		w.Header().Set("Content-Type", MediaTypeCOSE+`; cose-type="cose-sign1"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(signature.Envelope())
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, newSignatureResponse(signature))
+}
+
+func newSignatureResponse(signature domain.Signature) SignatureResponse {
 	response := SignatureResponse{
-		DeviceID:   signature.DeviceID(),
-		ID:         signature.ID(),
-		Signature:  signature.Value(),
-		SignedData: signature.RawData(),
+		DeviceID:            signature.DeviceID(),
+		ID:                  signature.ID(),
+		Counter:             signature.Counter(),
+		PreviousSignatureID: signature.PreviousID(),
+		Algorithm:           string(signature.Algorithm()),
+		CreatedAt:           signature.CreatedAt().UTC().Format(time.RFC3339Nano),
+		Signature:           signature.Value(),
+		SignedData:          signature.RawData(),
+		SecuredDataFormat:   string(signature.SecuredDataVersion()),
+		ChainingMode:        string(signature.ChainingMode()),
+		TimestampToken:      signature.TimestampToken(),
+		SignatureFormat:     string(signature.Format()),
+		ClientID:            signature.ClientID(),
+	}
+	switch signature.Format() {
+	case domain.SignatureFormatJWS:
+		response.JWS = string(signature.Envelope())
+	case domain.SignatureFormatCMS:
+		response.CMS = signature.Envelope()
+	case domain.SignatureFormatCOSE:
+		response.COSE = signature.Envelope()
+	}
+	if code, err := signature.MachineReadableCode(); err == nil {
+		response.MachineReadableCode = code
 	}
-	WriteAPIResponse(w, http.StatusOK, response)
+	return response
 }
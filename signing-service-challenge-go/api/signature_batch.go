@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+// maxBatchRequestSize bounds the body of batch requests, which are read at once.
+const maxBatchRequestSize = 32 << 20
+
+func (s *Server) SignatureBatches(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.CreateDeviceSignatureBatch(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+type CreateDeviceSignatureBatchRequest struct {
+	// Data is a shorthand for text-only batches. Exclusive with Items.
+	Data  []string                       `json:"data,omitempty"`
+	Items []CreateDeviceSignatureRequest `json:"items,omitempty"`
+	// SignatureFormat overrides the signature format of the device for all the items.
+	SignatureFormat string `json:"signature_format,omitempty"`
+	// ClientID is the registered client of the device requesting all the items.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+func (r CreateDeviceSignatureBatchRequest) payloads() ([]commands.SignaturePayload, error) {
+	if len(r.Data) > 0 && len(r.Items) > 0 {
+		return nil, ErrAmbiguousPayload
+	}
+
+	payloads := make([]commands.SignaturePayload, 0, len(r.Data)+len(r.Items))
+	for _, data := range r.Data {
+		payloads = append(payloads, commands.SignaturePayload{Type: string(domain.PayloadTypeText), Data: []byte(data)})
+	}
+	for i, item := range r.Items {
+		if item.SignatureFormat != "" {
+			return nil, &commands.BatchItemError{Index: i, Err: ErrItemSignatureFormat}
+		}
+		if item.ClientID != "" {
+			return nil, &commands.BatchItemError{Index: i, Err: ErrItemClientID}
+		}
+		payload, err := item.payload()
+		if err != nil {
+			return nil, &commands.BatchItemError{Index: i, Err: err}
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+type SignatureBatchItemResponse struct {
+	Index int `json:"index"`
+	SignatureResponse
+}
+
+type SignatureBatchResponse struct {
+	DeviceID   string                       `json:"device_id"`
+	Signatures []SignatureBatchItemResponse `json:"signatures"`
+}
+
+type SignatureBatchItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// SignatureBatchErrorResponse is the error response of a failed batch, along with
+// the items that caused it, if any. None of the items of a failed batch is signed.
+type SignatureBatchErrorResponse struct {
+	ErrorResponse
+	Items []SignatureBatchItemError `json:"items,omitempty"`
+}
+
+// writeBatchErrorResponse writes the failure of a batch, listing the failing items of err.
+// Internal errors are not propagated, only the index of the item causing them.
+func writeBatchErrorResponse(w http.ResponseWriter, code int, err error) {
+	response := SignatureBatchErrorResponse{
+		ErrorResponse: ErrorResponse{
+			Errors: []string{http.StatusText(code)},
+		},
+	}
+	if code < http.StatusInternalServerError {
+		response.Errors = append(response.Errors, err.Error())
+	}
+	for _, itemErr := range commands.BatchItemErrors(err) {
+		item := SignatureBatchItemError{Index: itemErr.Index, Error: http.StatusText(code)}
+		if code < http.StatusInternalServerError {
+			item.Error = itemErr.Err.Error()
+		}
+		response.Items = append(response.Items, item)
+	}
+
+	w.WriteHeader(code)
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		WriteInternalError(w)
+	}
+	w.Write(bytes)
+}
+
+// CreateDeviceSignatureBatch signs an ordered list of payloads on a device.
+// The signatures are chained in the given order and committed all at once:
+// on failure none of them is created, and the response lists the items causing it.
+func (s *Server) CreateDeviceSignatureBatch(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var request CreateDeviceSignatureBatchRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchRequestSize)).Decode(&request)
+	if err != nil {
+		logger.Info("Invalid signature batch creation request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	payloads, err := request.payloads()
+	if err != nil {
+		logger.Info("Invalid signature batch creation request", slog.String("error", err.Error()))
+		writeBatchErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cmd, err := commands.NewCreateSignatureBatchCommand(chi.URLParam(r, "deviceID"), request.ClientID, payloads, request.SignatureFormat)
+	if err != nil {
+		logger.Info("Invalid signature batch creation command", slog.String("error", err.Error()))
+		writeBatchErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	signatures, err := s.createSignatureCommandHandler.HandleBatch(r.Context(), cmd)
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device for creating a signature batch not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if errors.Is(err, commands.ErrValidation) {
+			logger.Info("Invalid signature batch creation command", slog.String("error", err.Error()))
+			writeBatchErrorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted signature batch creation", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to create a signature batch", slog.String("error", err.Error()))
+		// Avoid propagating internal errors traces to the clients
+		writeBatchErrorResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := SignatureBatchResponse{
+		DeviceID:   cmd.DeviceID(),
+		Signatures: make([]SignatureBatchItemResponse, 0, len(signatures)),
+	}
+	for i, signature := range signatures {
+		response.Signatures = append(response.Signatures, SignatureBatchItemResponse{
+			Index:             i,
+			SignatureResponse: newSignatureResponse(signature),
+		})
+	}
+	WriteAPIResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func newSignatureServer(t *testing.T) (http.Handler, string) {
+	return newTestServer(t, nil)
+}
+
+// newTestServer serves an Ed25519 device, along with the features enabled by the options
+// built from the device repository and the signature handler.
+func newTestServer(t *testing.T, options func(domain.DeviceRepository, *commands.CreateSignatureCommandHandler) []api.ServerOption) (http.Handler, string) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	createDeviceCommandHandler := commands.CreateDeviceCommandHandler{
+		DeviceRepository:    repository,
+		KeyProviderResolver: map[string]crypto.Provider{"ed25519": &crypto.Ed25519Provider{}},
+	}
+	cmd, err := commands.NewCreateDeviceCommand("ed25519", "", "", "", "", false)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := createDeviceCommandHandler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	createSignatureCommandHandler := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmEd25519: &crypto.Ed25519SignerFactory{},
+		},
+	}
+	var serverOptions []api.ServerOption
+	if options != nil {
+		serverOptions = options(repository, &createSignatureCommandHandler)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	server := api.NewServer("", logger, createDeviceCommandHandler, createSignatureCommandHandler, serverOptions...)
+	return server.Routes(), device.ID()
+}
+
+func postSignature(handler http.Handler, deviceID string, body string, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/"+deviceID+"/signatures", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_CreateDeviceSignature_COSE(t *testing.T) {
+	handler, deviceID := newSignatureServer(t)
+
+	recorder := postSignature(handler, deviceID, `{"data":"tx_0"}`, "application/cose")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != `application/cose; cose-type="cose-sign1"` {
+		t.Fatal("Expected a COSE_Sign1 content type, got", contentType)
+	}
+	message, err := cose.Parse(recorder.Body.Bytes())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if message.Header.Algorithm != cose.AlgorithmEdDSA || message.Header.KeyID != deviceID+":1" {
+		t.Fatal("Expected an EdDSA message of key", deviceID+":1", "got", message.Header)
+	}
+
+	recorder = postSignature(handler, deviceID, `{"data":"tx_1","signature_format":"jws"}`, "application/cose")
+	if recorder.Code != http.StatusNotAcceptable {
+		t.Fatal("Expected status", http.StatusNotAcceptable, "got", recorder.Code)
+	}
+}
+
+func Test_CreateDeviceSignatureBatch_InvalidItem(t *testing.T) {
+	handler, deviceID := newSignatureServer(t)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v0/devices/"+deviceID+"/signatures:batch", strings.NewReader(`{"items":[{"data":"tx_0"},{"data":""},{"data":"tx_2"}]}`))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatal("Expected status", http.StatusBadRequest, "got", recorder.Code, recorder.Body.String())
+	}
+	var response api.SignatureBatchErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if len(response.Items) != 1 || response.Items[0].Index != 1 {
+		t.Fatal("Expected only item 1 to fail, got", response.Items)
+	}
+
+	// None of the items was signed
+	recorder = postSignature(handler, deviceID, `{"data":"tx_0"}`, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	var signature struct {
+		Data api.SignatureResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if signature.Data.Counter != 0 {
+		t.Fatal("Expected counter to be 0, got", signature.Data.Counter)
+	}
+}
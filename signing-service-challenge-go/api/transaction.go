@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+func (s *Server) Transactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.ListDeviceTransactions(w, r)
+	case http.MethodPost:
+		s.StartDeviceTransaction(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+func (s *Server) Transaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetDeviceTransaction(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+func (s *Server) TransactionUpdates(w http.ResponseWriter, r *http.Request) {
+	s.transactionSteps(w, r, domain.TransactionStepUpdate)
+}
+
+func (s *Server) TransactionFinishes(w http.ResponseWriter, r *http.Request) {
+	s.transactionSteps(w, r, domain.TransactionStepFinish)
+}
+
+type TransactionStepResponse struct {
+	Type             string `json:"type"`
+	Revision         int    `json:"revision"`
+	SignatureID      string `json:"signature_id"`
+	SignatureCounter int    `json:"signature_counter"`
+	CreatedAt        string `json:"created_at"`
+}
+
+type TransactionResponse struct {
+	DeviceID  string `json:"device_id"`
+	ID        string `json:"id"`
+	ClientID  string `json:"client_id,omitempty"`
+	Number    int    `json:"number"`
+	State     string `json:"state"`
+	Revision  int    `json:"revision"`
+	StartedAt string `json:"started_at"`
+	UpdatedAt string `json:"updated_at"`
+	// ExpiresAt is when the transaction times out without further steps, for active ones.
+	ExpiresAt string                    `json:"expires_at,omitempty"`
+	Steps     []TransactionStepResponse `json:"steps"`
+}
+
+// TransactionStepResultResponse is the transaction after a step, along with the signature of the step.
+type TransactionStepResultResponse struct {
+	Transaction TransactionResponse `json:"transaction"`
+	Signature   SignatureResponse   `json:"signature"`
+}
+
+type TransactionListResponse struct {
+	DeviceID     string                `json:"device_id"`
+	Transactions []TransactionResponse `json:"transactions"`
+}
+
+// StartDeviceTransaction starts a transaction on a device, signing its start step.
+// The body takes the optional data of the step like signature requests do.
+func (s *Server) StartDeviceTransaction(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	request, payload, err := decodeTransactionStepRequest(r)
+	if err != nil {
+		logger.Info("Invalid transaction start request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	cmd, err := commands.NewStartTransactionCommand(chi.URLParam(r, "deviceID"), request.ClientID, payload, request.SignatureFormat)
+	if err != nil {
+		logger.Info("Invalid transaction start command", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	transaction, signature, err := s.startTransactionCommandHandler.Handle(r.Context(), cmd)
+	if err != nil {
+		writeTransactionError(w, logger, "start", err)
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, TransactionStepResultResponse{
+		Transaction: newTransactionResponse(transaction),
+		Signature:   newSignatureResponse(signature),
+	})
+}
+
+// transactionSteps signs an update or the finish step of an active transaction.
+func (s *Server) transactionSteps(w http.ResponseWriter, r *http.Request, stepType domain.TransactionStepType) {
+	if r.Method != http.MethodPost {
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+		return
+	}
+	logger := logging.FromContext(r.Context())
+
+	request, payload, err := decodeTransactionStepRequest(r)
+	if err != nil {
+		logger.Info("Invalid transaction step request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	cmd, err := commands.NewTransactionStepCommand(chi.URLParam(r, "deviceID"), chi.URLParam(r, "transactionID"), string(stepType), payload, request.SignatureFormat)
+	if err != nil {
+		logger.Info("Invalid transaction step command", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	transaction, signature, err := s.transactionStepCommandHandler.Handle(r.Context(), cmd)
+	if err != nil {
+		writeTransactionError(w, logger, string(stepType), err)
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, TransactionStepResultResponse{
+		Transaction: newTransactionResponse(transaction),
+		Signature:   newSignatureResponse(signature),
+	})
+}
+
+// GetDeviceTransaction serves a transaction of a device along with its steps.
+func (s *Server) GetDeviceTransaction(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	query, err := queries.NewGetTransactionQuery(chi.URLParam(r, "deviceID"), chi.URLParam(r, "transactionID"))
+	if err != nil {
+		logger.Info("Invalid transaction query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	transaction, err := s.getTransactionQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		writeTransactionError(w, logger, "query", err)
+		return
+	}
+	WriteAPIResponse(w, http.StatusOK, newTransactionResponse(transaction))
+}
+
+// ListDeviceTransactions serves the transactions of a device, filtered by the state query parameter if given.
+func (s *Server) ListDeviceTransactions(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	deviceID := chi.URLParam(r, "deviceID")
+	query, err := queries.NewListTransactionsQuery(deviceID, r.URL.Query().Get("state"))
+	if err != nil {
+		logger.Info("Invalid transaction list query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	transactions, err := s.listTransactionsQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		writeTransactionError(w, logger, "list", err)
+		return
+	}
+	response := TransactionListResponse{
+		DeviceID:     deviceID,
+		Transactions: make([]TransactionResponse, 0, len(transactions)),
+	}
+	for _, transaction := range transactions {
+		response.Transactions = append(response.Transactions, newTransactionResponse(transaction))
+	}
+	WriteAPIResponse(w, http.StatusOK, response)
+}
+
+// decodeTransactionStepRequest reads the optional body of a transaction step.
+func decodeTransactionStepRequest(r *http.Request) (CreateDeviceSignatureRequest, commands.SignaturePayload, error) {
+	var request CreateDeviceSignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		return CreateDeviceSignatureRequest{}, commands.SignaturePayload{}, err
+	}
+	payload, err := request.payload()
+	return request, payload, err
+}
+
+// writeTransactionError writes the response of a failed transaction operation.
+func writeTransactionError(w http.ResponseWriter, logger *slog.Logger, operation string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrDeviceNotFound), errors.Is(err, domain.ErrTransactionNotFound):
+		logger.Info("Transaction or device not found", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+		})
+	case errors.Is(err, commands.ErrValidation), errors.Is(err, queries.ErrValidation):
+		logger.Info("Invalid transaction command", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+	case errors.Is(err, domain.ErrTransactionFinished), errors.Is(err, domain.ErrTransactionExpired),
+		errors.Is(err, domain.ErrTransactionVersionMismatch):
+		logger.Info("Transaction closed or concurrently updated", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusConflict, []string{
+			http.StatusText(http.StatusConflict),
+			transactionConflict(err).Error(),
+		})
+	default:
+		if WriteContextError(w, err) {
+			logger.Info("Aborted transaction operation", slog.String("operation", operation), slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed transaction operation", slog.String("operation", operation), slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+	}
+}
+
+func newTransactionResponse(transaction domain.Transaction) TransactionResponse {
+	response := TransactionResponse{
+		DeviceID:  transaction.DeviceID(),
+		ID:        transaction.ID(),
+		ClientID:  transaction.ClientID(),
+		Number:    transaction.Number(),
+		State:     string(transaction.State()),
+		Revision:  transaction.Revision(),
+		StartedAt: transaction.StartedAt().UTC().Format(time.RFC3339Nano),
+		UpdatedAt: transaction.UpdatedAt().UTC().Format(time.RFC3339Nano),
+		Steps:     make([]TransactionStepResponse, 0, len(transaction.Steps())),
+	}
+	if transaction.State() == domain.TransactionStateActive {
+		response.ExpiresAt = transaction.ExpiresAt().UTC().Format(time.RFC3339Nano)
+	}
+	for _, step := range transaction.Steps() {
+		response.Steps = append(response.Steps, TransactionStepResponse{
+			Type:             string(step.Type),
+			Revision:         step.Revision,
+			SignatureID:      step.SignatureID,
+			SignatureCounter: step.SignatureCounter,
+			CreatedAt:        step.At.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return response
+}
+
+// transactionConflict is the domain error of a transaction conflict, without internal details.
+func transactionConflict(err error) error {
+	for _, conflict := range []error{domain.ErrTransactionFinished, domain.ErrTransactionExpired} {
+		if errors.Is(err, conflict) {
+			return conflict
+		}
+	}
+	return domain.ErrTransactionVersionMismatch
+}
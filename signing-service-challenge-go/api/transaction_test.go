@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func newTransactionServer(t *testing.T) (http.Handler, string) {
+	return newTestServer(t, func(repository domain.DeviceRepository, signatureHandler *commands.CreateSignatureCommandHandler) []api.ServerOption {
+		transactions := persistence.NewInMemoryTransactionRepository()
+		return []api.ServerOption{api.WithTransactions(
+			&commands.StartTransactionCommandHandler{TransactionRepository: transactions, SignatureHandler: signatureHandler},
+			&commands.TransactionStepCommandHandler{TransactionRepository: transactions, SignatureHandler: signatureHandler},
+			&queries.GetTransactionQueryHandler{TransactionRepository: transactions},
+			&queries.ListTransactionsQueryHandler{DeviceRepository: repository, TransactionRepository: transactions},
+		)}
+	})
+}
+
+func serveTransaction(handler http.Handler, method string, path string, body string) (*httptest.ResponseRecorder, api.TransactionStepResultResponse) {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	var response struct {
+		Data api.TransactionStepResultResponse `json:"data"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response.Data
+}
+
+func Test_DeviceTransactions_Lifecycle(t *testing.T) {
+	handler, deviceID := newTransactionServer(t)
+	transactions := "/api/v0/devices/" + deviceID + "/transactions"
+
+	recorder, started := serveTransaction(handler, http.MethodPost, transactions, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", recorder.Code, recorder.Body.String())
+	}
+	if started.Transaction.Number != 1 || started.Transaction.State != "active" || started.Signature.Counter != 0 {
+		t.Fatal("Expected the active transaction 1 signed with counter 0, got", started)
+	}
+	transaction := transactions + "/" + started.Transaction.ID
+
+	recorder, updated := serveTransaction(handler, http.MethodPost, transaction+":update", `{"data":"item_0"}`)
+	if recorder.Code != http.StatusOK || updated.Signature.PreviousSignatureID != started.Signature.ID {
+		t.Fatal("Expected the update to be chained to the start, got", recorder.Code, recorder.Body.String())
+	}
+	recorder, finished := serveTransaction(handler, http.MethodPost, transaction+":finish", `{"data":"total","signature_format":"jws"}`)
+	if recorder.Code != http.StatusOK || finished.Transaction.State != "finished" || finished.Signature.JWS == "" {
+		t.Fatal("Expected a finished transaction with a JWS, got", recorder.Code, recorder.Body.String())
+	}
+	if len(finished.Transaction.Steps) != 3 || finished.Transaction.ExpiresAt != "" {
+		t.Fatal("Expected 3 steps and no timeout, got", finished.Transaction)
+	}
+
+	recorder, _ = serveTransaction(handler, http.MethodPost, transaction+":update", "")
+	if recorder.Code != http.StatusConflict {
+		t.Fatal("Expected status", http.StatusConflict, "got", recorder.Code)
+	}
+
+	recorder, _ = serveTransaction(handler, http.MethodGet, transactions+"?state=active", "")
+	var list struct {
+		Data api.TransactionListResponse `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &list); err != nil || len(list.Data.Transactions) != 0 {
+		t.Fatal("Expected no active transaction, got", recorder.Body.String())
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{http.MethodGet, transaction, http.StatusOK},
+		{http.MethodGet, transactions + "/unknown", http.StatusNotFound},
+		{http.MethodPost, transactions + "/unknown:finish", http.StatusNotFound},
+		{http.MethodGet, transactions + "?state=unknown", http.StatusBadRequest},
+		{http.MethodGet, "/api/v0/devices/unknown/transactions", http.StatusNotFound},
+		{http.MethodPost, "/api/v0/devices/unknown/transactions", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if recorder, _ := serveTransaction(handler, test.method, test.path, ""); recorder.Code != test.expected {
+			t.Fatal("Expected status", test.expected, "for", test.method, test.path, "got", recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+)
+
+func (s *Server) TreeHeads(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetTreeHead(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+func (s *Server) InclusionProofs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetInclusionProof(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+func (s *Server) ConsistencyProofs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.GetConsistencyProof(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+// TreeHeadResponse is a signed tree head of the transparency log. The signature covers
+// the TreeHeadSignature structure of RFC 6962, see transparency.SignedTreeHead.SigningInput.
+type TreeHeadResponse struct {
+	TreeSize int `json:"tree_size"`
+	// Timestamp in milliseconds since the epoch.
+	Timestamp         int64  `json:"timestamp"`
+	RootHash          []byte `json:"sha256_root_hash"`
+	TreeHeadSignature []byte `json:"tree_head_signature"`
+	// LogID is the SHA-256 digest of the DER encoded public key of the log.
+	LogID []byte `json:"log_id"`
+	// PublicKey is the PEM encoded public key verifying the tree heads.
+	PublicKey string `json:"public_key"`
+}
+
+type InclusionProofResponse struct {
+	SignatureID string   `json:"signature_id"`
+	LeafIndex   int      `json:"leaf_index"`
+	TreeSize    int      `json:"tree_size"`
+	LeafHash    []byte   `json:"leaf_hash"`
+	RootHash    []byte   `json:"sha256_root_hash"`
+	AuditPath   [][]byte `json:"audit_path"`
+}
+
+type ConsistencyProofResponse struct {
+	First       int      `json:"first"`
+	Second      int      `json:"second"`
+	Consistency [][]byte `json:"consistency"`
+}
+
+// GetTreeHead serves the latest signed tree head of the transparency log.
+func (s *Server) GetTreeHead(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	head, err := s.getTreeHeadQueryHandler.Handle(r.Context())
+	if err == nil {
+		var response TreeHeadResponse
+		response, err = s.newTreeHeadResponse(head)
+		if err == nil {
+			WriteAPIResponse(w, http.StatusOK, response)
+			return
+		}
+	}
+	writeTransparencyLogError(w, logger, "tree head", err)
+}
+
+func (s *Server) newTreeHeadResponse(head transparency.SignedTreeHead) (TreeHeadResponse, error) {
+	log := s.getTreeHeadQueryHandler.Log
+	logID, err := log.LogID()
+	if err != nil {
+		return TreeHeadResponse{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(log.PublicKey())
+	if err != nil {
+		return TreeHeadResponse{}, err
+	}
+	return TreeHeadResponse{
+		TreeSize:          head.TreeSize,
+		Timestamp:         head.Timestamp.UnixMilli(),
+		RootHash:          head.RootHash,
+		TreeHeadSignature: head.Signature,
+		LogID:             logID,
+		PublicKey:         string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}, nil
+}
+
+// GetInclusionProof serves the audit path of the signature_id query parameter in the tree of
+// the tree_size one, the size of the latest tree head if omitted.
+func (s *Server) GetInclusionProof(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	values := r.URL.Query()
+	treeSize, err := treeSizeParameter(values.Get("tree_size"), "tree_size")
+	if err != nil {
+		writeTransparencyLogError(w, logger, "inclusion proof", err)
+		return
+	}
+	query, err := queries.NewGetInclusionProofQuery(values.Get("signature_id"), treeSize)
+	if err != nil {
+		writeTransparencyLogError(w, logger, "inclusion proof", err)
+		return
+	}
+
+	proof, err := s.getInclusionProofQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		writeTransparencyLogError(w, logger, "inclusion proof", err)
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, InclusionProofResponse{
+		SignatureID: values.Get("signature_id"),
+		LeafIndex:   proof.LeafIndex,
+		TreeSize:    proof.TreeSize,
+		LeafHash:    proof.LeafHash,
+		RootHash:    proof.RootHash,
+		AuditPath:   proof.AuditPath,
+	})
+}
+
+// GetConsistencyProof serves the proof that the tree of the first query parameter is a prefix
+// of the tree of the second one, the size of the latest tree head if omitted.
+func (s *Server) GetConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	values := r.URL.Query()
+	first, err := treeSizeParameter(values.Get("first"), "first")
+	if err != nil {
+		writeTransparencyLogError(w, logger, "consistency proof", err)
+		return
+	}
+	second, err := treeSizeParameter(values.Get("second"), "second")
+	if err != nil {
+		writeTransparencyLogError(w, logger, "consistency proof", err)
+		return
+	}
+	query, err := queries.NewGetConsistencyProofQuery(first, second)
+	if err != nil {
+		writeTransparencyLogError(w, logger, "consistency proof", err)
+		return
+	}
+
+	proof, err := s.getConsistencyProofQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		writeTransparencyLogError(w, logger, "consistency proof", err)
+		return
+	}
+
+	WriteAPIResponse(w, http.StatusOK, ConsistencyProofResponse{
+		First:       proof.First,
+		Second:      proof.Second,
+		Consistency: proof.Proof,
+	})
+}
+
+// treeSizeParameter parses a tree size query parameter, zero when omitted.
+func treeSizeParameter(value string, name string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be an integer", transparency.ErrInvalidTreeSize, name)
+	}
+	return size, nil
+}
+
+// writeTransparencyLogError writes the HTTP response of a failed transparency log query.
+func writeTransparencyLogError(w http.ResponseWriter, logger *slog.Logger, subject string, err error) {
+	switch {
+	case errors.Is(err, transparency.ErrNoTreeHead), errors.Is(err, transparency.ErrSignatureNotLogged), errors.Is(err, transparency.ErrNotYetIncluded):
+		logger.Info("Transparency log "+subject+" not found", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusNotFound, []string{
+			http.StatusText(http.StatusNotFound),
+			err.Error(),
+		})
+	case errors.Is(err, queries.ErrValidation), errors.Is(err, transparency.ErrInvalidTreeSize):
+		logger.Info("Invalid transparency log "+subject+" query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+	default:
+		logger.Error("Failed to get a transparency log "+subject, slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+	}
+}
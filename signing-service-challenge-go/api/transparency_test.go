@@ -0,0 +1,119 @@
+package api_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+)
+
+func getLog(t *testing.T, handler http.Handler, path string, data any) int {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code == http.StatusOK {
+		response := struct {
+			Data any `json:"data"`
+		}{Data: data}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+	return recorder.Code
+}
+
+func Test_TransparencyLog(t *testing.T) {
+	log, err := transparency.GenerateLog()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	handler, deviceID := newTestServer(t, func(_ domain.DeviceRepository, signatureHandler *commands.CreateSignatureCommandHandler) []api.ServerOption {
+		signatureHandler.TransparencyLog = log
+		return []api.ServerOption{api.WithTransparencyLog(
+			&queries.GetTreeHeadQueryHandler{Log: log},
+			&queries.GetInclusionProofQueryHandler{Log: log},
+			&queries.GetConsistencyProofQueryHandler{Log: log},
+		)}
+	})
+	if code := getLog(t, handler, "/api/v0/log/sth", nil); code != http.StatusNotFound {
+		t.Fatal("Expected status", http.StatusNotFound, "got", code)
+	}
+
+	var signatureIDs []string
+	var heads []api.TreeHeadResponse
+	for i := 0; i < 3; i++ {
+		recorder := postSignature(handler, deviceID, `{"data":"data_to_be_signed"}`, "")
+		var signature struct {
+			Data api.SignatureResponse `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signatureIDs = append(signatureIDs, signature.Data.ID)
+		if _, err := log.Publish(); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+
+		var head api.TreeHeadResponse
+		if code := getLog(t, handler, "/api/v0/log/sth", &head); code != http.StatusOK {
+			t.Fatal("Expected status", http.StatusOK, "got", code)
+		}
+		heads = append(heads, head)
+	}
+
+	// The tree head is signed by the published key
+	head := heads[2]
+	block, _ := pem.Decode([]byte(head.PublicKey))
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signedTreeHead := transparency.SignedTreeHead{
+		TreeSize:  head.TreeSize,
+		Timestamp: time.UnixMilli(head.Timestamp),
+		RootHash:  head.RootHash,
+		Signature: head.TreeHeadSignature,
+	}
+	if err := signedTreeHead.Verify(publicKey); err != nil || head.TreeSize != 3 {
+		t.Fatal("Expected a valid tree head of size", 3, "got", head.TreeSize, err)
+	}
+
+	var inclusion api.InclusionProofResponse
+	if code := getLog(t, handler, "/api/v0/log/proof/inclusion?signature_id="+signatureIDs[1], &inclusion); code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", code)
+	}
+	if err := transparency.VerifyInclusion(inclusion.LeafHash, inclusion.LeafIndex, inclusion.TreeSize, inclusion.AuditPath, head.RootHash); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	var consistency api.ConsistencyProofResponse
+	if code := getLog(t, handler, "/api/v0/log/proof/consistency?first=1&second=3", &consistency); code != http.StatusOK {
+		t.Fatal("Expected status", http.StatusOK, "got", code)
+	}
+	if err := transparency.VerifyConsistency(1, 3, consistency.Consistency, heads[0].RootHash, head.RootHash); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	tests := map[string]int{
+		"/api/v0/log/proof/inclusion?signature_id=unknown":                             http.StatusNotFound,
+		"/api/v0/log/proof/inclusion?signature_id=" + signatureIDs[2] + "&tree_size=2": http.StatusNotFound,
+		"/api/v0/log/proof/inclusion?signature_id=" + signatureIDs[0] + "&tree_size=4": http.StatusBadRequest,
+		"/api/v0/log/proof/inclusion?tree_size=1":                                      http.StatusBadRequest,
+		"/api/v0/log/proof/consistency?first=0&second=3":                               http.StatusBadRequest,
+		"/api/v0/log/proof/consistency?first=2&second=x":                               http.StatusBadRequest,
+	}
+	for path, status := range tests {
+		if code := getLog(t, handler, path, nil); code != status {
+			t.Fatal("Expected status", status, "for", path, "got", code)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/go-chi/chi"
+)
+
+func (s *Server) SignatureVerifications(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.VerifyDeviceSignature(w, r)
+	default:
+		WriteErrorResponse(w, http.StatusMethodNotAllowed, []string{
+			http.StatusText(http.StatusMethodNotAllowed),
+		})
+	}
+}
+
+// VerifySignatureRequest holds either a JWS or a COSE_Sign1 message, or a CMS SignedData
+// or a raw signature along with its signed data.
+type VerifySignatureRequest struct {
+	JWS string `json:"jws,omitempty"`
+	// COSE is a tagged or untagged COSE_Sign1 message.
+	COSE []byte `json:"cose,omitempty"`
+	// CMS is a DER encoded detached CMS SignedData.
+	CMS        []byte `json:"cms,omitempty"`
+	SignedData string `json:"signed_data,omitempty"`
+	Signature  []byte `json:"signature,omitempty"`
+	// Previous is the previous signature of the device, to also check the signature is chained to it.
+	Previous *PreviousSignatureRequest `json:"previous,omitempty"`
+}
+
+// PreviousSignatureRequest is a signature as returned on creation: its signed data and raw signature.
+type PreviousSignatureRequest struct {
+	SignedData string `json:"signed_data"`
+	Signature  []byte `json:"signature"`
+}
+
+type VerificationResponse struct {
+	DeviceID        string `json:"device_id"`
+	Valid           bool   `json:"valid"`
+	SignatureFormat string `json:"signature_format"`
+	// Counter and SecuredDataFormat are read from the signed data, when it can be parsed.
+	Counter           *int   `json:"counter,omitempty"`
+	SecuredDataFormat string `json:"secured_data_format,omitempty"`
+	Problem           string `json:"problem,omitempty"`
+}
+
+// VerifyDeviceSignature verifies a signature against the key of a device.
+// Invalid signatures are reported in the response, not as an error status.
+func (s *Server) VerifyDeviceSignature(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+
+	var request VerifySignatureRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		logger.Info("Invalid signature verification request", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	query, err := queries.NewVerifySignatureQuery(chi.URLParam(r, "deviceID"), request.JWS, request.COSE, request.CMS, request.SignedData, request.Signature)
+	if err == nil && request.Previous != nil {
+		query, err = query.WithPreviousSignature(request.Previous.SignedData, request.Previous.Signature)
+	}
+	if err != nil {
+		logger.Info("Invalid signature verification query", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusBadRequest, []string{
+			http.StatusText(http.StatusBadRequest),
+			err.Error(),
+		})
+		return
+	}
+
+	verification, err := s.verifySignatureQueryHandler.Handle(r.Context(), query)
+	if err != nil {
+		if errors.Is(err, domain.ErrDeviceNotFound) {
+			logger.Info("Device of the signature to verify not found", slog.String("error", err.Error()))
+			WriteErrorResponse(w, http.StatusNotFound, []string{
+				http.StatusText(http.StatusNotFound),
+			})
+			return
+		}
+		if WriteContextError(w, err) {
+			logger.Info("Aborted signature verification", slog.String("error", err.Error()))
+			return
+		}
+		logger.Error("Failed to verify a signature", slog.String("error", err.Error()))
+		WriteErrorResponse(w, http.StatusInternalServerError, []string{
+			// Avoid propagating internal errors traces to the clients
+			http.StatusText(http.StatusInternalServerError),
+		})
+		return
+	}
+
+	response := VerificationResponse{
+		DeviceID:        verification.DeviceID,
+		Valid:           verification.Valid(),
+		SignatureFormat: string(verification.Format),
+	}
+	if verification.SecuredData != nil {
+		response.Counter = &verification.SecuredData.Counter
+		response.SecuredDataFormat = string(verification.SecuredData.Version)
+	}
+	if !verification.Valid() {
+		response.Problem = verification.Err.Error()
+	}
+	WriteAPIResponse(w, http.StatusOK, response)
+}
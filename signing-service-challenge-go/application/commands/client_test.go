@@ -0,0 +1,153 @@
+package commands_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func Test_RegisterClientCommandHandler_Handle_SignaturesRecordClient(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	keyPair, err := (&crypto.ECDSAProvider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	format, err := domain.NewSecuredDataFormat("v4")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ecdsa", "device_label_0", keyPair.Public, keyPair.Private, domain.WithSecuredDataFormat(format))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	registerCmd, err := commands.NewRegisterClientCommand(device.ID(), "serial_0")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	client, err := (&commands.RegisterClientCommandHandler{DeviceRepository: repository}).Handle(context.Background(), registerCmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	handler := newCreateSignatureCommandHandler(repository)
+	signCmd, err := commands.NewCreateSignatureCommand(device.ID(), client.ID(), commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := handler.Handle(context.Background(), signCmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if signature.ClientID() != client.ID() {
+		t.Fatal("Expected client ID to be", client.ID(), "got", signature.ClientID())
+	}
+
+	deregisterCmd, err := commands.NewDeregisterClientCommand(device.ID(), client.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := (&commands.DeregisterClientCommandHandler{DeviceRepository: repository}).Handle(context.Background(), deregisterCmd); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	_, err = handler.Handle(context.Background(), signCmd)
+	if !errors.Is(err, commands.ErrValidation) || !errors.Is(err, domain.ErrClientNotRegistered) {
+		t.Fatal("Expected error to be", domain.ErrClientNotRegistered, "got", err)
+	}
+}
+
+func Test_RegisterClientCommandHandler_Handle_DeviceNotFound_Error(t *testing.T) {
+	handler := commands.RegisterClientCommandHandler{DeviceRepository: persistence.NewInMemoryDeviceRepository()}
+
+	cmd, err := commands.NewRegisterClientCommand("device_id_0", "serial_0")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	_, err = handler.Handle(context.Background(), cmd)
+
+	if !errors.Is(err, domain.ErrDeviceNotFound) {
+		t.Fatal("Expected error to be", domain.ErrDeviceNotFound, "got", err)
+	}
+}
+
+// interleavingRepository holds the first reads of devices once armed, until as many
+// commands read them, as if these commands ran in parallel.
+type interleavingRepository struct {
+	domain.DeviceRepository
+	reads *sync.WaitGroup
+}
+
+func (r *interleavingRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	device, err := r.DeviceRepository.FindByID(ctx, id)
+	if r.reads != nil && commands.RetryAttempt(ctx) == 0 {
+		r.reads.Done()
+		r.reads.Wait()
+	}
+	return device, err
+}
+
+func Test_RegisterClientCommandHandler_Handle_Concurrent(t *testing.T) {
+	repository := &interleavingRepository{DeviceRepository: persistence.NewInMemoryDeviceRepository()}
+	device := newTestDevice(t, repository)
+	handler := commands.RegisterClientCommandHandler{DeviceRepository: repository}
+	register := func(serialNumber string) (domain.Client, error) {
+		cmd, err := commands.NewRegisterClientCommand(device.ID(), serialNumber)
+		if err != nil {
+			return domain.Client{}, err
+		}
+		return handler.Handle(context.Background(), cmd)
+	}
+	// Three clients leave room for a fourth one in the slice of the stored device
+	for _, serialNumber := range []string{"serial_0", "serial_1", "serial_2"} {
+		if _, err := register(serialNumber); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+
+	const registrations = 2
+	repository.reads = &sync.WaitGroup{}
+	repository.reads.Add(registrations)
+	type result struct {
+		client domain.Client
+		err    error
+	}
+	results := make(chan result, registrations)
+	for i := 0; i < registrations; i++ {
+		go func(serialNumber string) {
+			client, err := register(serialNumber)
+			results <- result{client, err}
+		}("serial_concurrent_" + strconv.Itoa(i))
+	}
+
+	registered := make([]domain.Client, 0, registrations)
+	for i := 0; i < registrations; i++ {
+		result := <-results
+		if result.err != nil {
+			t.Fatal("Expected no error, got", result.err)
+		}
+		registered = append(registered, result.client)
+	}
+	updated, err := repository.DeviceRepository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if len(updated.Clients()) != 3+registrations {
+		t.Fatal("Expected", 3+registrations, "clients, got", len(updated.Clients()))
+	}
+	for _, client := range registered {
+		if found, err := updated.Client(client.ID()); err != nil || found.SerialNumber() != client.SerialNumber() {
+			t.Fatal("Expected the client", client.ID(), "to be registered, got", found, err)
+		}
+	}
+}
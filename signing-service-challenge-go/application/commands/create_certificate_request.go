@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrCertificateRequestCreation = errors.New("failed to create a certificate request")
+
+type createCertificateRequestCommand struct {
+	deviceID string
+}
+
+func NewCreateCertificateRequestCommand(deviceID string) (createCertificateRequestCommand, error) {
+	cmd := createCertificateRequestCommand{
+		deviceID: deviceID,
+	}
+	return cmd, cmd.validate()
+}
+
+func (c createCertificateRequestCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	return nil
+}
+
+// CreateCertificateRequestCommandHandler creates PKCS #10 requests for external CAs to certify the device keys.
+type CreateCertificateRequestCommandHandler struct {
+	DeviceRepository      domain.DeviceRepository
+	SignerFactoryResolver map[domain.SigningAlgorithm]crypto.SignerFactory
+}
+
+// Handle returns the DER encoded certificate request, signed by the device key.
+func (h *CreateCertificateRequestCommandHandler) Handle(ctx context.Context, cmd createCertificateRequestCommand) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "CreateCertificateRequestCommandHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, cmd.deviceID))
+
+	request, err := h.handle(ctx, cmd)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return request, err
+}
+
+func (h *CreateCertificateRequestCommandHandler) handle(ctx context.Context, cmd createCertificateRequestCommand) ([]byte, error) {
+	device, err := h.DeviceRepository.FindByID(ctx, cmd.deviceID)
+	if err != nil {
+		return nil, errors.Join(ErrFetchingDevice, err)
+	}
+
+	signerFactory, ok := h.SignerFactoryResolver[device.Algorithm()]
+	if !ok {
+		return nil, ErrAlgorithmNotSupported
+	}
+	signer, err := signerFactory.Build(ctx, device.PrivateKey())
+	if err != nil {
+		return nil, errors.Join(ErrBuildingSigner, err)
+	}
+
+	request, err := pki.CreateCertificateRequest(device, signer)
+	if err != nil {
+		return nil, errors.Join(ErrCertificateRequestCreation, err)
+	}
+	return request, nil
+}
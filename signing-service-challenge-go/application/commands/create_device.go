@@ -2,11 +2,17 @@ package commands
 
 import (
 	"context"
+	"crypto/elliptic"
 	"errors"
+	"log/slog"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -14,19 +20,57 @@ var (
 	ErrKeyGeneration        = errors.New("failed to generate keys")
 	ErrDeviceCreation       = errors.New("failed to create a device")
 	ErrMissingAlgorithmName = errors.New("missing algorithm name")
+	ErrCertificateIssuance  = errors.New("failed to issue a certificate")
 )
 
 type createDeviceCommand struct {
-	algorithmName string
-	label         string
+	algorithmName     string
+	label             string
+	securedDataFormat domain.SecuredDataFormat
+	signatureFormat   domain.SignatureFormat
+	chainingMode      domain.ChainingMode
+	// externalCertificate skips the certificate issuance, leaving the device to be certified by an external CA.
+	externalCertificate bool
 }
 
-func NewCreateDeviceCommand(algorithmName string, label string) (createDeviceCommand, error) {
+// NewCreateDeviceCommand creates a device command. Empty secured data and signature formats and chaining
+// mode stand for domain.DefaultSecuredDataVersion, domain.DefaultSignatureFormat and domain.DefaultChainingMode.
+func NewCreateDeviceCommand(algorithmName string, label string, securedDataFormat string, signatureFormat string, chainingMode string, externalCertificate bool) (createDeviceCommand, error) {
 	cmd := createDeviceCommand{
-		algorithmName: algorithmName,
-		label:         label,
+		algorithmName:       algorithmName,
+		label:               label,
+		externalCertificate: externalCertificate,
 	}
-	return cmd, cmd.validate()
+	if err := cmd.validate(); err != nil {
+		return createDeviceCommand{}, err
+	}
+
+	if securedDataFormat == "" {
+		securedDataFormat = string(domain.DefaultSecuredDataVersion)
+	}
+	format, err := domain.NewSecuredDataFormat(securedDataFormat)
+	if err != nil {
+		return createDeviceCommand{}, errors.Join(ErrValidation, err)
+	}
+	cmd.securedDataFormat = format
+
+	if signatureFormat == "" {
+		signatureFormat = string(domain.DefaultSignatureFormat)
+	}
+	cmd.signatureFormat, err = domain.NewSignatureFormat(signatureFormat)
+	if err != nil {
+		return createDeviceCommand{}, errors.Join(ErrValidation, err)
+	}
+
+	if chainingMode == "" {
+		chainingMode = string(domain.DefaultChainingMode)
+	}
+	cmd.chainingMode, err = domain.NewChainingMode(chainingMode)
+	if err != nil {
+		return createDeviceCommand{}, errors.Join(ErrValidation, err)
+	}
+
+	return cmd, nil
 }
 
 func (c createDeviceCommand) validate() error {
@@ -39,12 +83,37 @@ func (c createDeviceCommand) validate() error {
 type CreateDeviceCommandHandler struct {
 	DeviceRepository    domain.DeviceRepository
 	KeyProviderResolver map[string]crypto.Provider
+	// CertificateIssuer is optional. When set, new devices get a certificate of their public key
+	// unless they are to be certified externally.
+	CertificateIssuer pki.Issuer
+	// RKSVKeyProvider is optional, it generates the keys of the devices signing RKSV receipts,
+	// which must be ECDSA P-256 whatever the curve of the ECDSA provider. An ECDSA P-256 provider if unset.
+	RKSVKeyProvider crypto.Provider
+	// KEK is optional. When set, the turnover keys of RKSV devices are stored wrapped by it, like
+	// their private keys, and only returned unwrapped on creation.
+	KEK *crypto.KeyEncryptionKey
 }
 
 // TODO: this should return a DTO instead of a domain entity
 func (h *CreateDeviceCommandHandler) Handle(ctx context.Context, cmd createDeviceCommand) (domain.Device, error) {
 	id := uuid.NewString()
 
+	ctx, span := tracer.Start(ctx, "CreateDeviceCommandHandler.Handle")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String(tracing.AttributeDeviceID, id),
+		attribute.String(tracing.AttributeAlgorithm, cmd.algorithmName),
+	)
+
+	device, err := h.handle(ctx, id, cmd)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return device, err
+}
+
+func (h *CreateDeviceCommandHandler) handle(ctx context.Context, id string, cmd createDeviceCommand) (domain.Device, error) {
+
 	_, err := h.DeviceRepository.FindByID(ctx, id)
 	if err == nil {
 		return domain.Device{}, ErrDeviceIDAlreadyInUse
@@ -54,21 +123,81 @@ func (h *CreateDeviceCommandHandler) Handle(ctx context.Context, cmd createDevic
 	if !ok {
 		return domain.Device{}, errors.Join(ErrValidation, ErrAlgorithmNotSupported)
 	}
+	var options []domain.DeviceOption
+	if cmd.securedDataFormat.Version() == domain.SecuredDataVersionRKSV {
+		if domain.SigningAlgorithm(cmd.algorithmName) != domain.SigningAlgorithmECDSA {
+			return domain.Device{}, errors.Join(ErrValidation, domain.ErrUnsupportedAlgorithmForFormat)
+		}
+		if cmd.signatureFormat != domain.SignatureFormatRaw {
+			return domain.Device{}, errors.Join(ErrValidation, domain.ErrUnsupportedSignatureFormat)
+		}
+		if cmd.chainingMode != domain.ChainingModeSignature {
+			return domain.Device{}, errors.Join(ErrValidation, domain.ErrUnsupportedChainingMode)
+		}
+		keyProvider = h.rksvKeyProvider()
+		turnoverKey, err := crypto.GenerateAESKey()
+		if err != nil {
+			return domain.Device{}, errors.Join(ErrKeyGeneration, err)
+		}
+		if h.KEK != nil {
+			if turnoverKey, err = h.KEK.Wrap(turnoverKey); err != nil {
+				return domain.Device{}, errors.Join(ErrKeyGeneration, err)
+			}
+		}
+		options = append(options, domain.WithTurnoverKey(turnoverKey))
+	}
+	if !cmd.signatureFormat.Supports(domain.SigningAlgorithm(cmd.algorithmName)) {
+		return domain.Device{}, errors.Join(ErrValidation, domain.ErrUnsupportedSignatureFormat)
+	}
+	// CMS signatures embed the device certificate, the device must get one
+	if cmd.signatureFormat == domain.SignatureFormatCMS && h.CertificateIssuer == nil && !cmd.externalCertificate {
+		return domain.Device{}, errors.Join(ErrValidation, domain.ErrMissingCertificate)
+	}
 
-	keyPair, err := keyProvider.Provide()
+	logging.FromContext(ctx).Debug("Generating device keys",
+		slog.String("device_id", id),
+		slog.String("algorithm", cmd.algorithmName),
+	)
+	keyPair, err := keyProvider.Provide(ctx)
 	if err != nil {
 		return domain.Device{}, errors.Join(ErrKeyGeneration, err)
 	}
 
-	device, err := domain.NewDevice(id, cmd.algorithmName, cmd.label, keyPair.Public, keyPair.Private)
+	options = append(options,
+		domain.WithSecuredDataFormat(cmd.securedDataFormat),
+		domain.WithSignatureFormat(cmd.signatureFormat),
+		domain.WithChainingMode(cmd.chainingMode),
+	)
+	device, err := domain.NewDevice(id, cmd.algorithmName, cmd.label, keyPair.Public, keyPair.Private, options...)
 	if err != nil {
 		return domain.Device{}, errors.Join(ErrDeviceCreation, err)
 	}
 
+	if h.CertificateIssuer != nil && !cmd.externalCertificate {
+		certificate, err := h.CertificateIssuer.Issue(ctx, device)
+		if err != nil {
+			return domain.Device{}, errors.Join(ErrCertificateIssuance, err)
+		}
+		if err := device.AttachCertificate(certificate.Leaf, certificate.Chain); err != nil {
+			return domain.Device{}, errors.Join(ErrCertificateIssuance, err)
+		}
+	}
+
 	err = h.DeviceRepository.Save(ctx, device)
 	if err != nil {
 		return domain.Device{}, errors.Join(ErrSavingDevice, err)
 	}
 
+	// The turnover key is disclosed once, to be registered with the tax authority
+	if h.KEK != nil && device.TurnoverKey() != nil {
+		return device.WithPlainTurnoverKey(h.KEK)
+	}
 	return device, nil
 }
+
+func (h *CreateDeviceCommandHandler) rksvKeyProvider() crypto.Provider {
+	if h.RKSVKeyProvider != nil {
+		return h.RKSVKeyProvider
+	}
+	return &crypto.ECDSAProvider{ECCGenerator: crypto.ECCGenerator{Curve: elliptic.P256()}}
+}
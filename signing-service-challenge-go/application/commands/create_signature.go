@@ -2,11 +2,27 @@ package commands
 
 import (
 	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
 	"errors"
+	"log/slog"
+	"sync"
+	"time"
 
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tsa"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -16,27 +32,77 @@ var (
 	ErrMissingDataToSign = errors.New("missing data to sign")
 	ErrMissingDeviceID   = errors.New("missing device ID")
 	ErrSignatureCreation = errors.New("failed to create a signature")
+	ErrTimestamping      = errors.New("failed to timestamp a signature")
 )
 
+const DefaultMaxRetries = 3
+
+// maxConcurrentTimestamps bounds the timestamp tokens requested at once for a batch.
+const maxConcurrentTimestamps = 8
+
+// SignaturePayload is the data_to_be_signed of a signature request, along with its type
+// ("text", "binary" or "json"). An empty type stands for text.
+type SignaturePayload struct {
+	Type string
+	Data []byte
+}
+
+func (p SignaturePayload) toDomain() (domain.Payload, error) {
+	if len(p.Data) == 0 {
+		return domain.Payload{}, ErrMissingDataToSign
+	}
+	payloadType := p.Type
+	if payloadType == "" {
+		payloadType = string(domain.PayloadTypeText)
+	}
+	return domain.NewPayload(payloadType, p.Data)
+}
+
 type createSignatureCommand struct {
 	deviceID string
-	data     string
+	// clientID is the client of the device requesting the signature, if any.
+	clientID string
+	payload  domain.Payload
+	// format overrides the signature format of the device when set.
+	format domain.SignatureFormat
 }
 
-func NewCreateSignatureCommand(deviceID string, data string) (createSignatureCommand, error) {
+// NewCreateSignatureCommand creates a signature command on behalf of a client of the device,
+// empty for none. An empty signature format stands for the signature format of the device.
+func NewCreateSignatureCommand(deviceID string, clientID string, payload SignaturePayload, signatureFormat string) (createSignatureCommand, error) {
+	p, err := payload.toDomain()
+	if err != nil {
+		return createSignatureCommand{}, errors.Join(ErrValidation, err)
+	}
+	format, err := toSignatureFormat(signatureFormat)
+	if err != nil {
+		return createSignatureCommand{}, err
+	}
+
 	cmd := createSignatureCommand{
 		deviceID: deviceID,
-		data:     data,
+		clientID: clientID,
+		payload:  p,
+		format:   format,
 	}
 
 	return cmd, cmd.validate()
 
 }
 
-func (c createSignatureCommand) validate() error {
-	if c.data == "" {
-		return errors.Join(ErrValidation, ErrMissingDataToSign)
+// toSignatureFormat validates a requested signature format, empty when not requested.
+func toSignatureFormat(signatureFormat string) (domain.SignatureFormat, error) {
+	if signatureFormat == "" {
+		return "", nil
+	}
+	format, err := domain.NewSignatureFormat(signatureFormat)
+	if err != nil {
+		return "", errors.Join(ErrValidation, err)
 	}
+	return format, nil
+}
+
+func (c createSignatureCommand) validate() error {
 	if c.deviceID == "" {
 		return errors.Join(ErrValidation, ErrMissingDeviceID)
 	}
@@ -46,50 +112,374 @@ func (c createSignatureCommand) validate() error {
 type CreateSignatureCommandHandler struct {
 	DeviceRepository      domain.DeviceRepository
 	SignerFactoryResolver map[domain.SigningAlgorithm]crypto.SignerFactory
+	// MaxRetries bounds the attempts made on concurrent updates, DefaultMaxRetries if unset.
+	MaxRetries int
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+	// TimestampAuthority is optional. When set, the signatures get a timestamp token over their value
+	// once persisted. Signatures whose token can't be obtained are kept without one, the failure is logged.
+	TimestampAuthority tsa.Authority
+	// TransparencyLog is optional. When set, every persisted signature is appended to it.
+	TransparencyLog transparency.Appender
+	// Observer is optional. When set, it's told about the signatures created and the retries.
+	Observer Observer
+	// TurnoverKeys is optional, it unwraps the turnover keys of RKSV devices, see
+	// CreateDeviceCommandHandler.KEK. The keys are used as stored if unset.
+	TurnoverKeys domain.KeyUnwrapper
 }
 
 // TODO: this should return a DTO instead of a domain entity
 func (h *CreateSignatureCommandHandler) Handle(ctx context.Context, cmd createSignatureCommand) (domain.Signature, error) {
+	ctx, span := tracer.Start(ctx, "CreateSignatureCommandHandler.Handle")
+	defer span.End()
+
+	signatures, err := h.sign(ctx, cmd.deviceID, cmd.clientID, fixedPayloads(cmd.payload), cmd.format)
+	if err != nil {
+		return domain.Signature{}, withoutItemIndex(err)
+	}
+	return signatures[0], nil
+}
+
+// payloadsFunc returns the payloads to sign given the current state of the device.
+// It may update the device, which is persisted along with the signatures.
+type payloadsFunc func(device *domain.Device) ([]domain.Payload, error)
+
+func fixedPayloads(payloads ...domain.Payload) payloadsFunc {
+	return func(*domain.Device) ([]domain.Payload, error) {
+		return payloads, nil
+	}
+}
+
+// sign chains and signs the payloads in order on the device on behalf of the client, if any,
+// in the given format or the one of the device if empty, and persists all the resulting
+// signatures at once. It records its progress on the span in ctx.
+func (h *CreateSignatureCommandHandler) sign(ctx context.Context, deviceID string, clientID string, payloadsFor payloadsFunc, format domain.SignatureFormat) ([]domain.Signature, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, deviceID))
+
+	maxRetries := h.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
 
 	// Fail and retry in case of concurrent updates of the same device instead of locking
 	var err error
-	for retries := 0; retries < 3; retries++ {
-		device, err := h.DeviceRepository.FindByID(ctx, cmd.deviceID)
+	for retries := 0; retries < maxRetries; retries++ {
+		span.SetAttributes(attribute.Int(tracing.AttributeRetryCount, retries))
+		observeAttempt(h.Observer, retries)
+
+		var signatures []domain.Signature
+		signatures, err = h.trySign(withRetryAttempt(ctx, retries), deviceID, clientID, payloadsFor, format)
+		if err == nil {
+			return h.timestamp(ctx, deviceID, signatures), nil
+		}
+		if !errors.Is(err, domain.ErrDeviceVersionMismatch) {
+			break
+		}
+		span.AddEvent("device version conflict", trace.WithAttributes(attribute.Int(tracing.AttributeRetryCount, retries)))
+		logging.FromContext(ctx).Debug("Concurrent update of the device detected",
+			slog.String("device_id", deviceID),
+			slog.Int("retry_count", retries),
+		)
+	}
+
+	tracing.RecordError(span, err)
+	return nil, err
+}
+
+func (h *CreateSignatureCommandHandler) trySign(ctx context.Context, deviceID string, clientID string, payloadsFor payloadsFunc, format domain.SignatureFormat) ([]domain.Signature, error) {
+	device, err := h.DeviceRepository.FindByID(ctx, deviceID)
+	if err != nil {
+		return nil, errors.Join(ErrFetchingDevice, err)
+	}
+	originalVersion := device.Version()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(tracing.AttributeAlgorithm, string(device.Algorithm())))
+
+	signerFactory, ok := h.SignerFactoryResolver[device.Algorithm()]
+	if !ok {
+		return nil, ErrAlgorithmNotSupported
+	}
+
+	signer, err := signerFactory.Build(ctx, device.PrivateKey())
+	if err != nil {
+		return nil, errors.Join(ErrBuildingSigner, err)
+	}
+	if format == "" {
+		format = device.SignatureFormat()
+	}
+	if !device.SupportsSignatureFormat(format) {
+		return nil, errors.Join(ErrValidation, domain.ErrUnsupportedSignatureFormat)
+	}
+	payloads, err := payloadsFor(&device)
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make([]domain.Signature, 0, len(payloads))
+	for i, payload := range payloads {
+		// Each signature is chained to the previous one, including those of this same call
+		// Secured data formats embed the time in milliseconds, keep it consistent with the signature
+		now := h.clock().Now().Truncate(time.Millisecond)
+		enrichedData, err := device.EnrichData(payload, clientID, now, h.TurnoverKeys)
+		if errors.Is(err, domain.ErrInvalidTurnoverKey) {
+			return nil, &BatchItemError{Index: i, Err: errors.Join(ErrSigning, err)}
+		}
 		if err != nil {
-			return domain.Signature{}, errors.Join(ErrFetchingDevice, err)
+			return nil, &BatchItemError{Index: i, Err: errors.Join(ErrValidation, err)}
 		}
-		originalVersion := device.Version()
-		enrichedData := device.EnrichData(cmd.data)
 
-		signerFactory, ok := h.SignerFactoryResolver[device.Algorithm()]
-		if !ok {
-			return domain.Signature{}, ErrAlgorithmNotSupported
+		signed, envelope, err := signInFormat(signer, device, format, enrichedData, now)
+		if err != nil {
+			return nil, &BatchItemError{Index: i, Err: errors.Join(ErrSigning, err)}
 		}
 
-		signer, err := signerFactory.Build(device.PrivateKey())
+		signature, err := device.NewSignature(uuid.NewString(), enrichedData, signed, now)
 		if err != nil {
-			return domain.Signature{}, errors.Join(ErrBuildingSigner, err)
+			return nil, &BatchItemError{Index: i, Err: errors.Join(ErrSignatureCreation, err)}
+		}
+		signature = signature.WithClientID(clientID)
+		if format != domain.SignatureFormatRaw {
+			signature, err = signature.WithEnvelope(format, envelope)
+			if err != nil {
+				return nil, &BatchItemError{Index: i, Err: errors.Join(ErrSignatureCreation, err)}
+			}
+		}
+		if err := device.AddSignature(signature); err != nil {
+			return nil, &BatchItemError{Index: i, Err: errors.Join(ErrSignatureCreation, err)}
+		}
+		signatures = append(signatures, signature)
+
+		// Stop early on long batches nobody is waiting for anymore
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Don't consume a counter value on behalf of a request nobody is waiting for
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err = h.DeviceRepository.Update(ctx, device, originalVersion)
+	if err != nil {
+		return nil, errors.Join(ErrSavingDevice, err)
+	}
+	if h.Observer != nil {
+		h.Observer.SignaturesCreated(device.Algorithm(), len(signatures))
+	}
+	if h.TransparencyLog != nil {
+		h.TransparencyLog.Append(signatures...)
+	}
+
+	return signatures, nil
+}
+
+// timestamp obtains the timestamp tokens of persisted signatures, once per signature and
+// concurrently, and stores them with the signatures. Signatures whose token can't be obtained
+// or stored are kept without one, as they are already part of the chain of the device.
+func (h *CreateSignatureCommandHandler) timestamp(ctx context.Context, deviceID string, signatures []domain.Signature) []domain.Signature {
+	if h.TimestampAuthority == nil {
+		return signatures
+	}
+	span := trace.SpanFromContext(ctx)
+	logger := logging.FromContext(ctx)
+	// The signatures are created already, get their tokens even if nobody is waiting anymore
+	ctx = context.WithoutCancel(ctx)
+
+	tokens := make([][]byte, len(signatures))
+	errs := make([]error, len(signatures))
+	limit := make(chan struct{}, maxConcurrentTimestamps)
+	var wg sync.WaitGroup
+	for i, signature := range signatures {
+		wg.Add(1)
+		go func(i int, value []byte) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			tokens[i], errs[i] = h.TimestampAuthority.Timestamp(ctx, value)
+		}(i, signature.Value())
+	}
+	wg.Wait()
+
+	tokensByID := make(map[string][]byte, len(signatures))
+	for i, signature := range signatures {
+		if errs[i] != nil {
+			err := errors.Join(ErrTimestamping, errs[i])
+			tracing.RecordError(span, err)
+			logger.Error("Failed to timestamp a signature",
+				slog.String("device_id", deviceID),
+				slog.String("signature_id", signature.ID()),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		tokensByID[signature.ID()] = tokens[i]
+	}
+	if len(tokensByID) == 0 {
+		return signatures
+	}
+
+	if err := h.attachTimestampTokens(ctx, deviceID, tokensByID); err != nil {
+		err = errors.Join(ErrTimestamping, err)
+		tracing.RecordError(span, err)
+		logger.Error("Failed to store the timestamp tokens of signatures",
+			slog.String("device_id", deviceID),
+			slog.String("error", err.Error()),
+		)
+		return signatures
+	}
+
+	timestamped := make([]domain.Signature, 0, len(signatures))
+	for _, signature := range signatures {
+		if token, ok := tokensByID[signature.ID()]; ok {
+			signature = signature.WithTimestampToken(token)
 		}
+		timestamped = append(timestamped, signature)
+	}
+	return timestamped
+}
 
-		signed, err := signer.Sign([]byte(enrichedData))
+// attachTimestampTokens stores timestamp tokens by signature ID, retrying on concurrent
+// updates of the device without requesting the tokens again.
+func (h *CreateSignatureCommandHandler) attachTimestampTokens(ctx context.Context, deviceID string, tokens map[string][]byte) error {
+	maxRetries := h.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	var err error
+	for retries := 0; retries < maxRetries; retries++ {
+		observeAttempt(h.Observer, retries)
+		var device domain.Device
+		device, err = h.DeviceRepository.FindByID(withRetryAttempt(ctx, retries), deviceID)
 		if err != nil {
-			return domain.Signature{}, errors.Join(ErrSigning, err)
+			return errors.Join(ErrFetchingDevice, err)
 		}
+		originalVersion := device.Version()
+		if err := device.AttachTimestampTokens(tokens); err != nil {
+			return err
+		}
+		err = h.DeviceRepository.Update(ctx, device, originalVersion)
+		if err == nil || !errors.Is(err, domain.ErrDeviceVersionMismatch) {
+			break
+		}
+	}
+	if err != nil {
+		return errors.Join(ErrSavingDevice, err)
+	}
+	return nil
+}
 
-		signature, err := domain.NewSignature(device.ID(), uuid.NewString(), enrichedData, signed)
+// signInFormat signs the next secured data of the device in the given format. It returns
+// the signature value along with the envelope carrying it, nil for raw signatures.
+func signInFormat(signer crypto.Signer, device domain.Device, format domain.SignatureFormat, securedData string, signingTime time.Time) ([]byte, []byte, error) {
+	switch format {
+	case domain.SignatureFormatCMS:
+		return signCMS(signer, device, securedData, signingTime)
+	case domain.SignatureFormatCOSE:
+		publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+		if err != nil {
+			return nil, nil, err
+		}
+		algorithm, err := cose.AlgorithmOf(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		message, err := cose.Sign(signer, cose.Header{
+			Algorithm: algorithm,
+			KeyID:     device.KeyID(),
+			Counter:   device.NextCounter(),
+		}, []byte(securedData))
+		if err != nil {
+			return nil, nil, err
+		}
+		envelope, err := message.Encode()
+		return message.Signature, envelope, err
+	case domain.SignatureFormatJWS:
+		publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+		if err != nil {
+			return nil, nil, err
+		}
+		algorithm, err := jose.AlgorithmOf(device.Algorithm(), publicKey)
 		if err != nil {
-			return domain.Signature{}, errors.Join(ErrSignatureCreation, err)
+			return nil, nil, err
 		}
-		device.AddSignature(signature)
+		jws, err := jose.Sign(signer, jose.Header{
+			Algorithm: algorithm,
+			KeyID:     device.KeyID(),
+			Counter:   device.NextCounter(),
+		}, []byte(securedData))
+		if err != nil {
+			return nil, nil, err
+		}
+		return jws.Signature, []byte(jws.Compact()), nil
+	default:
+		signed, err := signer.Sign([]byte(securedData))
+		return signed, nil, err
+	}
+}
 
-		err = h.DeviceRepository.Update(ctx, device, originalVersion)
-		if err == nil {
-			return signature, nil
+// signCMS makes a detached CMS SignedData over the secured data, signing the signing time
+// and the signature counter along with it. The device must be certified.
+func signCMS(signer crypto.Signer, device domain.Device, securedData string, signingTime time.Time) ([]byte, []byte, error) {
+	if !device.Certified() {
+		return nil, nil, errors.Join(ErrValidation, domain.ErrMissingCertificate)
+	}
+	certificate, err := x509.ParseCertificate(device.Certificate())
+	if err != nil {
+		return nil, nil, err
+	}
+	chain := make([]*x509.Certificate, 0, len(device.CertificateChain()))
+	for _, der := range device.CertificateChain() {
+		issuer, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, nil, err
 		}
-		if err != domain.ErrDeviceNotFound {
-			break
+		chain = append(chain, issuer)
+	}
+
+	options := cms.SignOptions{
+		Detached:    true,
+		Certificate: certificate,
+		Chain:       chain,
+		PSS:         device.Algorithm() == domain.SigningAlgorithmRSAPSS,
+		SignedAttributes: []cms.Attribute{
+			{Type: cms.OIDAttributeSigningTime, Value: signingTime.UTC()},
+			{Type: cms.OIDAttributeSignatureCounter, Value: device.NextCounter()},
+		},
+	}
+	// The digest algorithm must be the one the device signers hash with
+	switch key := certificate.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			options.Hash = stdcrypto.SHA256
+		case 384:
+			options.Hash = stdcrypto.SHA384
+		default:
+			options.Hash = stdcrypto.SHA512
 		}
+	case ed25519.PublicKey:
+		// Ed25519 signs the attributes themselves, RFC 8419 mandates SHA-512 for their digest
+		options.Hash = stdcrypto.SHA512
+	default:
+		options.Hash = stdcrypto.SHA256
 	}
 
-	return domain.Signature{}, err
+	envelope, err := cms.Sign([]byte(securedData), signer, options)
+	if err != nil {
+		return nil, nil, err
+	}
+	signedData, err := cms.Parse(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signedData.Signature(), envelope, nil
+}
+
+func (h *CreateSignatureCommandHandler) clock() domain.Clock {
+	if h.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return h.Clock
 }
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const MaxBatchSize = 5000
+
+var (
+	ErrEmptyBatch    = errors.New("empty batch")
+	ErrBatchTooLarge = fmt.Errorf("batch larger than %d items", MaxBatchSize)
+)
+
+// BatchItemError is the failure of one of the payloads of a batch, which aborts the whole batch.
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchItemErrors collects the failures of single items within err, in order.
+func BatchItemErrors(err error) []*BatchItemError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var itemErrs []*BatchItemError
+		for _, err := range joined.Unwrap() {
+			itemErrs = append(itemErrs, BatchItemErrors(err)...)
+		}
+		return itemErrs
+	}
+	var itemErr *BatchItemError
+	if errors.As(err, &itemErr) {
+		return []*BatchItemError{itemErr}
+	}
+	return nil
+}
+
+// withoutItemIndex drops the item index from the failure of a request signing a single payload.
+func withoutItemIndex(err error) error {
+	var itemErr *BatchItemError
+	if errors.As(err, &itemErr) {
+		return itemErr.Err
+	}
+	return err
+}
+
+type createSignatureBatchCommand struct {
+	deviceID string
+	// clientID is the client of the device requesting the signatures, if any.
+	clientID string
+	payloads []domain.Payload
+	// format overrides the signature format of the device when set.
+	format domain.SignatureFormat
+}
+
+// NewCreateSignatureBatchCommand creates a command signing all the given payloads, in order, on the same device
+// on behalf of one of its clients, empty for none. An empty signature format stands for the signature format of the device.
+func NewCreateSignatureBatchCommand(deviceID string, clientID string, payloads []SignaturePayload, signatureFormat string) (createSignatureBatchCommand, error) {
+	if len(payloads) == 0 {
+		return createSignatureBatchCommand{}, errors.Join(ErrValidation, ErrEmptyBatch)
+	}
+	if len(payloads) > MaxBatchSize {
+		return createSignatureBatchCommand{}, errors.Join(ErrValidation, ErrBatchTooLarge)
+	}
+
+	format, err := toSignatureFormat(signatureFormat)
+	if err != nil {
+		return createSignatureBatchCommand{}, err
+	}
+
+	cmd := createSignatureBatchCommand{
+		deviceID: deviceID,
+		clientID: clientID,
+		payloads: make([]domain.Payload, 0, len(payloads)),
+		format:   format,
+	}
+	errs := []error{ErrValidation}
+	for i, payload := range payloads {
+		p, err := payload.toDomain()
+		if err != nil {
+			errs = append(errs, &BatchItemError{Index: i, Err: err})
+			continue
+		}
+		cmd.payloads = append(cmd.payloads, p)
+	}
+	if len(errs) > 1 {
+		return createSignatureBatchCommand{}, errors.Join(errs...)
+	}
+
+	return cmd, cmd.validate()
+}
+
+func (c createSignatureBatchCommand) DeviceID() string {
+	return c.deviceID
+}
+
+func (c createSignatureBatchCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	return nil
+}
+
+// HandleBatch signs all the payloads of the command with consecutive counters and
+// persists the signatures with a single update of the device: either all of them
+// are created or none is.
+// TODO: this should return DTOs instead of domain entities
+func (h *CreateSignatureCommandHandler) HandleBatch(ctx context.Context, cmd createSignatureBatchCommand) ([]domain.Signature, error) {
+	ctx, span := tracer.Start(ctx, "CreateSignatureCommandHandler.HandleBatch")
+	defer span.End()
+	span.SetAttributes(attribute.Int("signing.batch.size", len(cmd.payloads)))
+
+	return h.sign(ctx, cmd.deviceID, cmd.clientID, fixedPayloads(cmd.payloads...), cmd.format)
+}
@@ -0,0 +1,62 @@
+package commands_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func Test_CreateSignatureCommandHandler_HandleBatch_OK(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+
+	cmd, err := commands.NewCreateSignatureBatchCommand(device.ID(), "", textPayloads("data_0", "data_1", "data_2"), "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signatures, err := handler.HandleBatch(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if len(signatures) != 3 {
+		t.Fatal("Expected 3 signatures, got", len(signatures))
+	}
+
+	expectedFirst := "v2_0_text_" + base64.StdEncoding.EncodeToString([]byte("data_0")) + "_" + base64.StdEncoding.EncodeToString([]byte(device.ID()))
+	if signatures[0].RawData() != expectedFirst {
+		t.Fatal("Expected signed data to be", expectedFirst, "got", signatures[0].RawData())
+	}
+	for i := 1; i < len(signatures); i++ {
+		expected := "v2_" + strconv.Itoa(i) + "_text_" + base64.StdEncoding.EncodeToString([]byte("data_"+strconv.Itoa(i))) + "_" + base64.StdEncoding.EncodeToString(signatures[i-1].Value())
+		if signatures[i].RawData() != expected {
+			t.Fatal("Expected signed data to be", expected, "got", signatures[i].RawData())
+		}
+	}
+
+	stored, err := repository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.SignaturesCount() != 3 {
+		t.Fatal("Expected signature count to be 3, got", stored.SignaturesCount())
+	}
+}
+
+func Test_NewCreateSignatureBatchCommand_EmptyItem_Error(t *testing.T) {
+	_, err := commands.NewCreateSignatureBatchCommand("device_id_0", "", textPayloads("data_0", ""), "")
+
+	if err == nil || !errors.Is(err, commands.ErrMissingDataToSign) {
+		t.Fatal("Expected error to be", commands.ErrMissingDataToSign, "got", err)
+	}
+	itemErrs := commands.BatchItemErrors(err)
+	if len(itemErrs) != 1 || itemErrs[0].Index != 1 {
+		t.Fatal("Expected only item 1 to fail, got", itemErrs)
+	}
+}
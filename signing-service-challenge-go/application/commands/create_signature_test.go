@@ -0,0 +1,496 @@
+package commands_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tsa"
+)
+
+func newTestDevice(t *testing.T, repository domain.DeviceRepository) domain.Device {
+	keyPair, err := (&crypto.ECDSAProvider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ecdsa", "device_label_0", keyPair.Public, keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return device
+}
+
+func newCreateSignatureCommandHandler(repository domain.DeviceRepository) commands.CreateSignatureCommandHandler {
+	return commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmECDSA: &crypto.ECDSASignerFactory{},
+		},
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_OK(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signature, err := handler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if signature.DeviceID() != device.ID() {
+		t.Fatal("Expected device id to be", device.ID(), "got", signature.DeviceID())
+	}
+
+	stored, err := repository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.SignaturesCount() != 1 {
+		t.Fatal("Expected signature count to be 1, got", stored.SignaturesCount())
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_CancelledContext_Error(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = handler.Handle(ctx, cmd)
+	if err == nil || !errors.Is(err, context.Canceled) {
+		t.Fatal("Expected error to be", context.Canceled, "got", err)
+	}
+
+	stored, err := repository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.SignaturesCount() != 0 {
+		t.Fatal("Expected signature count to be 0, got", stored.SignaturesCount())
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_CounterAndTime(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+	handler.Clock = fixedClock{now}
+
+	var signatures []domain.Signature
+	for i := 0; i < 2; i++ {
+		cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signature, err := handler.Handle(context.Background(), cmd)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signatures = append(signatures, signature)
+	}
+
+	if signatures[0].Counter() != 0 || signatures[1].Counter() != 1 {
+		t.Fatal("Expected counters to be 0 and 1, got", signatures[0].Counter(), signatures[1].Counter())
+	}
+	if signatures[0].PreviousID() != "" {
+		t.Fatal("Expected no previous signature, got", signatures[0].PreviousID())
+	}
+	if signatures[1].PreviousID() != signatures[0].ID() {
+		t.Fatal("Expected previous signature to be", signatures[0].ID(), "got", signatures[1].PreviousID())
+	}
+	if signatures[1].Algorithm() != domain.SigningAlgorithmECDSA {
+		t.Fatal("Expected algorithm to be ecdsa, got", signatures[1].Algorithm())
+	}
+
+	expectedTime := time.Date(2024, 5, 1, 8, 0, 0, 123000000, time.UTC)
+	if signatures[1].CreatedAt() != expectedTime {
+		t.Fatal("Expected creation time to be", expectedTime, "got", signatures[1].CreatedAt())
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_Concurrent(t *testing.T) {
+	repository := &interleavingRepository{DeviceRepository: persistence.NewInMemoryDeviceRepository()}
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+	handler.MaxRetries = 100
+	sign := func(data string) (domain.Signature, error) {
+		cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte(data)}, "")
+		if err != nil {
+			return domain.Signature{}, err
+		}
+		return handler.Handle(context.Background(), cmd)
+	}
+	// Three signatures leave room for a fourth one in the slice of the stored device
+	for _, data := range []string{"data_0", "data_1", "data_2"} {
+		if _, err := sign(data); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+
+	const signers = 16
+	repository.reads = &sync.WaitGroup{}
+	repository.reads.Add(signers)
+	type result struct {
+		signature domain.Signature
+		err       error
+	}
+	results := make(chan result, signers)
+	for i := 0; i < signers; i++ {
+		go func(data string) {
+			signature, err := sign(data)
+			results <- result{signature, err}
+		}("data_concurrent_" + strconv.Itoa(i))
+	}
+
+	signed := make([]domain.Signature, 0, signers)
+	for i := 0; i < signers; i++ {
+		result := <-results
+		if result.err != nil {
+			t.Fatal("Expected no error, got", result.err)
+		}
+		signed = append(signed, result.signature)
+	}
+	updated, err := repository.DeviceRepository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if updated.SignaturesCount() != 3+signers {
+		t.Fatal("Expected", 3+signers, "signatures, got", updated.SignaturesCount())
+	}
+	// The chain holds the very signatures returned to the callers
+	for _, signature := range signed {
+		stored, err := updated.Signature(signature.ID())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if stored.Counter() != signature.Counter() || !bytes.Equal(stored.Value(), signature.Value()) {
+			t.Fatal("Expected the stored signature", signature.ID(), "to be the returned one, got", stored)
+		}
+	}
+	for i, signature := range updated.Signatures() {
+		if signature.Counter() != i {
+			t.Fatal("Expected the signature", i, "in the chain, got counter", signature.Counter())
+		}
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_Timestamped(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+	authority, err := tsa.GenerateLocalAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	handler.TimestampAuthority = authority
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := handler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+	if _, err := (&tsa.Verifier{Roots: roots}).Verify(signature.TimestampToken(), signature.Value()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
+
+// countingAuthority counts the timestamp tokens requested.
+type countingAuthority struct {
+	tsa.Authority
+	requests atomic.Int32
+}
+
+func (a *countingAuthority) Timestamp(ctx context.Context, message []byte) ([]byte, error) {
+	a.requests.Add(1)
+	return a.Authority.Timestamp(ctx, message)
+}
+
+// conflictingRepository fails the first update of a device as if it had been updated concurrently.
+type conflictingRepository struct {
+	domain.DeviceRepository
+	conflicted bool
+}
+
+func (r *conflictingRepository) Update(ctx context.Context, device domain.Device, expectedVersion int) error {
+	if !r.conflicted {
+		r.conflicted = true
+		return domain.ErrDeviceVersionMismatch
+	}
+	return r.DeviceRepository.Update(ctx, device, expectedVersion)
+}
+
+func Test_CreateSignatureCommandHandler_HandleBatch_TimestampedOnce(t *testing.T) {
+	repository := &conflictingRepository{DeviceRepository: persistence.NewInMemoryDeviceRepository()}
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+	local, err := tsa.GenerateLocalAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	authority := &countingAuthority{Authority: local}
+	handler.TimestampAuthority = authority
+
+	cmd, err := commands.NewCreateSignatureBatchCommand(device.ID(), "", textPayloads("data_0", "data_1", "data_2"), "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := handler.HandleBatch(context.Background(), cmd); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	// The signing is retried once, the tokens are only requested for the persisted signatures
+	if requests := authority.requests.Load(); requests != 3 {
+		t.Fatal("Expected 3 timestamp requests, got", requests)
+	}
+	stored, err := repository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(local.Certificate())
+	for _, signature := range stored.Signatures() {
+		if _, err := (&tsa.Verifier{Roots: roots}).Verify(signature.TimestampToken(), signature.Value()); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func textPayloads(data ...string) []commands.SignaturePayload {
+	payloads := make([]commands.SignaturePayload, 0, len(data))
+	for _, d := range data {
+		payloads = append(payloads, commands.SignaturePayload{Data: []byte(d)})
+	}
+	return payloads
+}
+
+func Test_CreateSignatureCommandHandler_Handle_JWS(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "jws")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := handler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if signature.Format() != domain.SignatureFormatJWS {
+		t.Fatal("Expected format", domain.SignatureFormatJWS, "got", signature.Format())
+	}
+
+	jws, err := jose.Parse(string(signature.Envelope()))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if jws.Header.Algorithm != jose.AlgorithmES384 || jws.Header.KeyID != device.KeyID() || jws.Header.Counter != 0 {
+		t.Fatal("Expected ES384 header for", device.KeyID(), "at counter 0, got", jws.Header)
+	}
+	if string(jws.Payload) != signature.RawData() {
+		t.Fatal("Expected payload", signature.RawData(), "got", string(jws.Payload))
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_CMS(t *testing.T) {
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	tests := []struct {
+		algorithm     domain.SigningAlgorithm
+		provider      crypto.Provider
+		signerFactory crypto.SignerFactory
+	}{
+		{domain.SigningAlgorithmRSA, &crypto.RSAProvider{}, &crypto.RSASignerFactory{}},
+		{domain.SigningAlgorithmRSAPSS, &crypto.RSAProvider{}, &crypto.RSAPSSSignerFactory{}},
+		{domain.SigningAlgorithmECDSA, &crypto.ECDSAProvider{}, &crypto.ECDSASignerFactory{}},
+		{domain.SigningAlgorithmEd25519, &crypto.Ed25519Provider{}, &crypto.Ed25519SignerFactory{}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.algorithm), func(t *testing.T) {
+			repository := persistence.NewInMemoryDeviceRepository()
+			keyPair, err := test.provider.Provide(context.Background())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			device, err := domain.NewDevice("device_id_0", string(test.algorithm), "", keyPair.Public, keyPair.Private,
+				domain.WithSignatureFormat(domain.SignatureFormatCMS),
+			)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			certificate, err := authority.Issue(context.Background(), device)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if err := device.AttachCertificate(certificate.Leaf, certificate.Chain); err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if err := repository.Save(context.Background(), device); err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			handler := commands.CreateSignatureCommandHandler{
+				DeviceRepository:      repository,
+				SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{test.algorithm: test.signerFactory},
+			}
+
+			cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			signature, err := handler.Handle(context.Background(), cmd)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if signature.Format() != domain.SignatureFormatCMS {
+				t.Fatal("Expected format", domain.SignatureFormatCMS, "got", signature.Format())
+			}
+
+			signedData, err := cms.Parse(signature.Envelope())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if signedData.Content != nil {
+				t.Fatal("Expected detached content, got", signedData.Content)
+			}
+			if err := signedData.Verify([]byte(signature.RawData())); err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			signer, err := signedData.Signer()
+			if err != nil || !bytes.Equal(signer.Raw, certificate.Leaf) {
+				t.Fatal("Expected the device certificate as signer, got", err)
+			}
+			signingTime, err := signedData.SigningTime()
+			if err != nil || !signingTime.Equal(signature.CreatedAt().Truncate(time.Second)) {
+				t.Fatal("Expected signing time", signature.CreatedAt(), "got", signingTime, err)
+			}
+			var counter int
+			if err := signedData.UnmarshalAttribute(cms.OIDAttributeSignatureCounter, &counter); err != nil || counter != 0 {
+				t.Fatal("Expected counter 0, got", counter, err)
+			}
+			if !bytes.Equal(signedData.Signature(), signature.Value()) {
+				t.Fatal("Expected the signature value to be the one of the SignedData")
+			}
+		})
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_CMS_Uncertified(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "cms")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	_, err = handler.Handle(context.Background(), cmd)
+	if !errors.Is(err, commands.ErrValidation) || !errors.Is(err, domain.ErrMissingCertificate) {
+		t.Fatal("Expected", domain.ErrMissingCertificate, "got", err)
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_COSE(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	handler := newCreateSignatureCommandHandler(repository)
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "cose")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := handler.Handle(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	message, err := cose.Parse(signature.Envelope())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if message.Header != (cose.Header{Algorithm: cose.AlgorithmES384, KeyID: device.KeyID(), Counter: 0}) {
+		t.Fatal("Expected ES384 header for", device.KeyID(), "at counter 0, got", message.Header)
+	}
+	if string(message.Payload) != signature.RawData() {
+		t.Fatal("Expected payload", signature.RawData(), "got", string(message.Payload))
+	}
+	if err := message.Verify(cose.AlgorithmES384, &crypto.ECDSAVerifier{}, device.PublicKey()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
+
+func Test_CreateSignatureCommandHandler_Handle_COSE_RSA(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	keyPair, err := (&crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "rsa", "", keyPair.Public, keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	handler := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmRSA: &crypto.RSASignerFactory{},
+		},
+	}
+
+	cmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "cose")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	_, err = handler.Handle(context.Background(), cmd)
+	if !errors.Is(err, commands.ErrValidation) || !errors.Is(err, domain.ErrUnsupportedSignatureFormat) {
+		t.Fatal("Expected", domain.ErrUnsupportedSignatureFormat, "got", err)
+	}
+}
@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+)
+
+// ExpireTransactionsCommandHandler closes the transactions left without steps past their timeout,
+// which are otherwise only found expired when their next step is requested.
+type ExpireTransactionsCommandHandler struct {
+	DeviceRepository      domain.DeviceRepository
+	TransactionRepository domain.TransactionRepository
+	// MaxRetries bounds the attempts made on concurrent updates of a device, DefaultMaxRetries if unset.
+	MaxRetries int
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+	// Observer is optional. When set, it's told about the retries.
+	Observer Observer
+}
+
+// Handle expires the timed out transactions of all the devices, returning how many it expired.
+func (h *ExpireTransactionsCommandHandler) Handle(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "ExpireTransactionsCommandHandler.Handle")
+	defer span.End()
+
+	expired, err := h.handle(ctx)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return expired, err
+}
+
+func (h *ExpireTransactionsCommandHandler) handle(ctx context.Context) (int, error) {
+	devices, err := h.DeviceRepository.ListAll(ctx)
+	if err != nil {
+		return 0, errors.Join(ErrFetchingDevice, err)
+	}
+
+	now := h.clock().Now()
+	expired := 0
+	for _, device := range devices {
+		transactions, err := h.TransactionRepository.ListByDevice(ctx, device.ID())
+		if err != nil {
+			return expired, errors.Join(ErrFetchingTransaction, err)
+		}
+		for _, transaction := range transactions {
+			ok, err := expireTransaction(ctx, h.DeviceRepository, h.TransactionRepository, h.MaxRetries, h.Observer, transaction, now)
+			if err != nil {
+				return expired, err
+			}
+			if ok {
+				expired++
+			}
+		}
+	}
+	return expired, nil
+}
+
+// Run expires the timed out transactions every interval until ctx is done.
+func (h *ExpireTransactionsCommandHandler) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.Handle(ctx); err != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (h *ExpireTransactionsCommandHandler) clock() domain.Clock {
+	if h.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return h.Clock
+}
+
+// expireTransaction expires the transaction if it timed out by now, reporting whether it did.
+// It's closed on its device first, where the steps are reserved, so that a step signed
+// concurrently keeps it open. maxRetries bounds the attempts made on concurrent updates
+// of the device, DefaultMaxRetries if not positive, which are told to the observer, if any.
+func expireTransaction(ctx context.Context, devices domain.DeviceRepository, transactions domain.TransactionRepository, maxRetries int, observer Observer, transaction domain.Transaction, now time.Time) (bool, error) {
+	originalVersion := transaction.Version()
+	if !transaction.Expire(now) {
+		return false, nil
+	}
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	var closed bool
+	var err error
+	for retries := 0; retries < maxRetries; retries++ {
+		observeAttempt(observer, retries)
+		closed, err = tryCloseTransaction(withRetryAttempt(ctx, retries), devices, transaction)
+		if !errors.Is(err, domain.ErrDeviceVersionMismatch) {
+			break
+		}
+	}
+	if err != nil || !closed {
+		return false, err
+	}
+
+	// Nothing else updates the transaction once closed on its device, as no step can be reserved.
+	// It's recorded even if the request was cancelled meanwhile, like the steps
+	if err := transactions.Update(context.WithoutCancel(ctx), transaction, originalVersion); err != nil {
+		return false, errors.Join(ErrSavingTransaction, err)
+	}
+	return true, nil
+}
+
+func tryCloseTransaction(ctx context.Context, devices domain.DeviceRepository, transaction domain.Transaction) (bool, error) {
+	device, err := devices.FindByID(ctx, transaction.DeviceID())
+	if err != nil {
+		return false, errors.Join(ErrFetchingDevice, err)
+	}
+	originalVersion := device.Version()
+
+	if !device.CloseTransaction(transaction.Number(), transaction.Revision()) {
+		return false, nil
+	}
+	if err := devices.Update(ctx, device, originalVersion); err != nil {
+		return false, errors.Join(ErrSavingDevice, err)
+	}
+	return true, nil
+}
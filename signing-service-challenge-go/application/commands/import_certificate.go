@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrMissingCertificate = errors.New("missing certificate")
+
+type importCertificateCommand struct {
+	deviceID    string
+	certificate []byte
+	chain       [][]byte
+}
+
+// NewImportCertificateCommand creates a command attaching a DER encoded certificate
+// to a device, along with the DER encoded certificates of its issuers.
+func NewImportCertificateCommand(deviceID string, certificate []byte, chain [][]byte) (importCertificateCommand, error) {
+	cmd := importCertificateCommand{
+		deviceID:    deviceID,
+		certificate: certificate,
+		chain:       chain,
+	}
+	return cmd, cmd.validate()
+}
+
+func (c importCertificateCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if len(c.certificate) == 0 {
+		return errors.Join(ErrValidation, ErrMissingCertificate)
+	}
+	return nil
+}
+
+// ImportCertificateCommandHandler certifies devices with certificates issued by external CAs.
+type ImportCertificateCommandHandler struct {
+	DeviceRepository domain.DeviceRepository
+	// MaxRetries bounds the attempts made on concurrent updates, DefaultMaxRetries if unset.
+	MaxRetries int
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+	// Observer is optional. When set, it's told about the retries.
+	Observer Observer
+}
+
+// TODO: this should return a DTO instead of a domain entity
+func (h *ImportCertificateCommandHandler) Handle(ctx context.Context, cmd importCertificateCommand) (domain.Device, error) {
+	ctx, span := tracer.Start(ctx, "ImportCertificateCommandHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, cmd.deviceID))
+
+	maxRetries := h.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	// Signatures may be created concurrently, retry instead of locking the device
+	var device domain.Device
+	var err error
+	for retries := 0; retries < maxRetries; retries++ {
+		observeAttempt(h.Observer, retries)
+		device, err = h.tryImport(withRetryAttempt(ctx, retries), cmd)
+		if !errors.Is(err, domain.ErrDeviceVersionMismatch) {
+			break
+		}
+	}
+	if err != nil {
+		tracing.RecordError(span, err)
+		return domain.Device{}, err
+	}
+	return device, nil
+}
+
+func (h *ImportCertificateCommandHandler) tryImport(ctx context.Context, cmd importCertificateCommand) (domain.Device, error) {
+	device, err := h.DeviceRepository.FindByID(ctx, cmd.deviceID)
+	if err != nil {
+		return domain.Device{}, errors.Join(ErrFetchingDevice, err)
+	}
+	originalVersion := device.Version()
+
+	if err := pki.CheckCertificate(device, cmd.certificate, cmd.chain, h.clock().Now()); err != nil {
+		return domain.Device{}, errors.Join(ErrValidation, err)
+	}
+	if err := device.AttachCertificate(cmd.certificate, cmd.chain); err != nil {
+		return domain.Device{}, errors.Join(ErrValidation, err)
+	}
+
+	if err := h.DeviceRepository.Update(ctx, device, originalVersion); err != nil {
+		return domain.Device{}, errors.Join(ErrSavingDevice, err)
+	}
+	return device, nil
+}
+
+func (h *ImportCertificateCommandHandler) clock() domain.Clock {
+	if h.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return h.Clock
+}
@@ -0,0 +1,19 @@
+package commands
+
+import "github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+
+// Observer is told about the outcomes of the commands worth monitoring, e.g. to expose metrics.
+// It's optional on the command handlers.
+type Observer interface {
+	// SignaturesCreated is called once count signatures of a device using the given algorithm are persisted.
+	SignaturesCreated(algorithm domain.SigningAlgorithm, count int)
+	// Retried is called whenever a command is attempted again after a concurrent update of a device.
+	Retried()
+}
+
+// observeAttempt tells the observer, if any, about the given attempt of a command when it's a retry.
+func observeAttempt(observer Observer, attempt int) {
+	if observer != nil && attempt > 0 {
+		observer.Retried()
+	}
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrMissingClientSerialNumber = errors.New("missing client serial number")
+	ErrMissingClientID           = errors.New("missing client ID")
+)
+
+type registerClientCommand struct {
+	deviceID     string
+	serialNumber string
+}
+
+// NewRegisterClientCommand creates a command registering a client, e.g. a cash register,
+// identified by its serial number to sign with a device.
+func NewRegisterClientCommand(deviceID, serialNumber string) (registerClientCommand, error) {
+	cmd := registerClientCommand{
+		deviceID:     deviceID,
+		serialNumber: serialNumber,
+	}
+	return cmd, cmd.validate()
+}
+
+func (c registerClientCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if c.serialNumber == "" {
+		return errors.Join(ErrValidation, ErrMissingClientSerialNumber)
+	}
+	return nil
+}
+
+type RegisterClientCommandHandler struct {
+	DeviceRepository domain.DeviceRepository
+	// MaxRetries bounds the attempts made on concurrent updates, DefaultMaxRetries if unset.
+	MaxRetries int
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+	// Observer is optional. When set, it's told about the retries.
+	Observer Observer
+}
+
+// TODO: this should return a DTO instead of a domain entity
+func (h *RegisterClientCommandHandler) Handle(ctx context.Context, cmd registerClientCommand) (domain.Client, error) {
+	ctx, span := tracer.Start(ctx, "RegisterClientCommandHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, cmd.deviceID))
+
+	id := uuid.NewString()
+	client, err := updateClients(ctx, h.DeviceRepository, h.MaxRetries, h.Observer, cmd.deviceID, func(device *domain.Device) (domain.Client, error) {
+		return device.RegisterClient(id, cmd.serialNumber, h.clock().Now())
+	})
+	if err != nil {
+		tracing.RecordError(span, err)
+		return domain.Client{}, err
+	}
+	span.SetAttributes(attribute.String(tracing.AttributeClientID, client.ID()))
+	return client, nil
+}
+
+func (h *RegisterClientCommandHandler) clock() domain.Clock {
+	if h.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return h.Clock
+}
+
+type deregisterClientCommand struct {
+	deviceID string
+	clientID string
+}
+
+// NewDeregisterClientCommand creates a command refusing further signatures on behalf of a client of a device.
+func NewDeregisterClientCommand(deviceID, clientID string) (deregisterClientCommand, error) {
+	cmd := deregisterClientCommand{
+		deviceID: deviceID,
+		clientID: clientID,
+	}
+	return cmd, cmd.validate()
+}
+
+func (c deregisterClientCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if c.clientID == "" {
+		return errors.Join(ErrValidation, ErrMissingClientID)
+	}
+	return nil
+}
+
+type DeregisterClientCommandHandler struct {
+	DeviceRepository domain.DeviceRepository
+	// MaxRetries bounds the attempts made on concurrent updates, DefaultMaxRetries if unset.
+	MaxRetries int
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+	// Observer is optional. When set, it's told about the retries.
+	Observer Observer
+}
+
+// TODO: this should return a DTO instead of a domain entity
+func (h *DeregisterClientCommandHandler) Handle(ctx context.Context, cmd deregisterClientCommand) (domain.Client, error) {
+	ctx, span := tracer.Start(ctx, "DeregisterClientCommandHandler.Handle")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String(tracing.AttributeDeviceID, cmd.deviceID),
+		attribute.String(tracing.AttributeClientID, cmd.clientID),
+	)
+
+	client, err := updateClients(ctx, h.DeviceRepository, h.MaxRetries, h.Observer, cmd.deviceID, func(device *domain.Device) (domain.Client, error) {
+		return device.DeregisterClient(cmd.clientID, h.clock().Now())
+	})
+	if err != nil {
+		tracing.RecordError(span, err)
+		return domain.Client{}, err
+	}
+	return client, nil
+}
+
+func (h *DeregisterClientCommandHandler) clock() domain.Clock {
+	if h.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return h.Clock
+}
+
+// updateClients applies a change to the clients of a device and saves it. Signatures
+// may be created concurrently, the change is retried instead of locking the device.
+func updateClients(ctx context.Context, repository domain.DeviceRepository, maxRetries int, observer Observer, deviceID string,
+	change func(device *domain.Device) (domain.Client, error)) (domain.Client, error) {
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	var client domain.Client
+	var err error
+	for retries := 0; retries < maxRetries; retries++ {
+		observeAttempt(observer, retries)
+		client, err = tryUpdateClients(withRetryAttempt(ctx, retries), repository, deviceID, change)
+		if !errors.Is(err, domain.ErrDeviceVersionMismatch) {
+			break
+		}
+	}
+	return client, err
+}
+
+func tryUpdateClients(ctx context.Context, repository domain.DeviceRepository, deviceID string,
+	change func(device *domain.Device) (domain.Client, error)) (domain.Client, error) {
+	device, err := repository.FindByID(ctx, deviceID)
+	if err != nil {
+		return domain.Client{}, errors.Join(ErrFetchingDevice, err)
+	}
+	originalVersion := device.Version()
+
+	client, err := change(&device)
+	if errors.Is(err, domain.ErrClientNotFound) {
+		return domain.Client{}, err
+	}
+	if err != nil {
+		return domain.Client{}, errors.Join(ErrValidation, err)
+	}
+
+	if err := repository.Update(ctx, device, originalVersion); err != nil {
+		return domain.Client{}, errors.Join(ErrSavingDevice, err)
+	}
+	return client, nil
+}
@@ -0,0 +1,18 @@
+package commands
+
+import "context"
+
+type retryAttemptKey struct{}
+
+// withRetryAttempt marks ctx as the given attempt of a command retried on concurrent
+// updates of a device, starting at 0.
+func withRetryAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, retryAttemptKey{}, attempt)
+}
+
+// RetryAttempt is the attempt of the command ctx belongs to, 0 for the first one or outside
+// of commands retried on concurrent updates.
+func RetryAttempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(retryAttemptKey{}).(int)
+	return attempt
+}
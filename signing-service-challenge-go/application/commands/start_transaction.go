@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultTransactionTimeout is how long transactions are kept open without steps unless configured otherwise.
+const DefaultTransactionTimeout = 15 * time.Minute
+
+var (
+	ErrFetchingTransaction = errors.New("failed to fetch transaction")
+	ErrSavingTransaction   = errors.New("failed to save transaction")
+)
+
+type startTransactionCommand struct {
+	deviceID string
+	// clientID is the client of the device signing the steps, if any.
+	clientID string
+	// payload is the optional data of the step.
+	payload *domain.Payload
+	// format overrides the signature format of the device when set.
+	format domain.SignatureFormat
+}
+
+// NewStartTransactionCommand creates a command starting a transaction on the device on behalf of
+// one of its clients, empty for none. All the steps are signed on behalf of that client.
+// The payload is optional, and an empty signature format stands for the signature format of the device.
+func NewStartTransactionCommand(deviceID string, clientID string, payload SignaturePayload, signatureFormat string) (startTransactionCommand, error) {
+	p, err := payload.toOptionalDomain()
+	if err != nil {
+		return startTransactionCommand{}, errors.Join(ErrValidation, err)
+	}
+	format, err := toSignatureFormat(signatureFormat)
+	if err != nil {
+		return startTransactionCommand{}, err
+	}
+
+	cmd := startTransactionCommand{
+		deviceID: deviceID,
+		clientID: clientID,
+		payload:  p,
+		format:   format,
+	}
+	return cmd, cmd.validate()
+}
+
+func (c startTransactionCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	return nil
+}
+
+// toOptionalDomain is toDomain for optional payloads, nil when there is no data.
+func (p SignaturePayload) toOptionalDomain() (*domain.Payload, error) {
+	if len(p.Data) == 0 {
+		return nil, nil
+	}
+	payload, err := p.toDomain()
+	if err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+type StartTransactionCommandHandler struct {
+	TransactionRepository domain.TransactionRepository
+	// SignatureHandler signs the steps of the transactions through their devices.
+	SignatureHandler *CreateSignatureCommandHandler
+	// Timeout is how long transactions are kept open without steps, DefaultTransactionTimeout if unset.
+	Timeout time.Duration
+}
+
+// Handle reserves the next transaction number of the device and signs the start step
+// of the transaction with it.
+// TODO: this should return DTOs instead of domain entities
+func (h *StartTransactionCommandHandler) Handle(ctx context.Context, cmd startTransactionCommand) (domain.Transaction, domain.Signature, error) {
+	ctx, span := tracer.Start(ctx, "StartTransactionCommandHandler.Handle")
+	defer span.End()
+
+	var number int
+	signatures, err := h.SignatureHandler.sign(ctx, cmd.deviceID, cmd.clientID, func(device *domain.Device) ([]domain.Payload, error) {
+		number = device.StartTransaction()
+		payload, err := device.TransactionStepPayload(number, domain.TransactionStepStart, 0, cmd.payload)
+		if err != nil {
+			return nil, errors.Join(ErrValidation, err)
+		}
+		return []domain.Payload{payload}, nil
+	}, cmd.format)
+	if err != nil {
+		return domain.Transaction{}, domain.Signature{}, withoutItemIndex(err)
+	}
+	signature := signatures[0]
+	span.SetAttributes(attribute.Int(tracing.AttributeTransactionNumber, number))
+
+	transaction, err := domain.NewTransaction(uuid.NewString(), cmd.deviceID, cmd.clientID, number, h.timeout(),
+		domain.NewTransactionStep(domain.TransactionStepStart, 0, signature),
+	)
+	if err == nil {
+		// Saved even if the request was cancelled meanwhile, as the start signature
+		// is already part of the chain of the device
+		err = h.TransactionRepository.Save(context.WithoutCancel(ctx), transaction)
+	}
+	if err != nil {
+		err = errors.Join(ErrSavingTransaction, err)
+		tracing.RecordError(span, err)
+		return domain.Transaction{}, domain.Signature{}, err
+	}
+	return transaction, signature, nil
+}
+
+func (h *StartTransactionCommandHandler) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultTransactionTimeout
+	}
+	return h.Timeout
+}
@@ -0,0 +1,5 @@
+package commands
+
+import "go.opentelemetry.io/otel"
+
+var tracer = otel.Tracer("github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands")
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrMissingTransactionID   = errors.New("missing transaction ID")
+	ErrInvalidTransactionStep = errors.New("transaction steps are either update or finish")
+)
+
+type transactionStepCommand struct {
+	deviceID      string
+	transactionID string
+	stepType      domain.TransactionStepType
+	// payload is the optional data of the step.
+	payload *domain.Payload
+	// format overrides the signature format of the device when set.
+	format domain.SignatureFormat
+}
+
+// NewTransactionStepCommand creates a command signing an "update" or the "finish" step of an active
+// transaction. The payload is optional, and an empty signature format stands for the signature
+// format of the device.
+func NewTransactionStepCommand(deviceID, transactionID string, stepType string, payload SignaturePayload, signatureFormat string) (transactionStepCommand, error) {
+	p, err := payload.toOptionalDomain()
+	if err != nil {
+		return transactionStepCommand{}, errors.Join(ErrValidation, err)
+	}
+	format, err := toSignatureFormat(signatureFormat)
+	if err != nil {
+		return transactionStepCommand{}, err
+	}
+
+	cmd := transactionStepCommand{
+		deviceID:      deviceID,
+		transactionID: transactionID,
+		stepType:      domain.TransactionStepType(stepType),
+		payload:       p,
+		format:        format,
+	}
+	return cmd, cmd.validate()
+}
+
+func (c transactionStepCommand) validate() error {
+	if c.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if c.transactionID == "" {
+		return errors.Join(ErrValidation, ErrMissingTransactionID)
+	}
+	if c.stepType != domain.TransactionStepUpdate && c.stepType != domain.TransactionStepFinish {
+		return errors.Join(ErrValidation, ErrInvalidTransactionStep)
+	}
+	return nil
+}
+
+type TransactionStepCommandHandler struct {
+	TransactionRepository domain.TransactionRepository
+	// SignatureHandler signs the steps of the transactions through their devices.
+	SignatureHandler *CreateSignatureCommandHandler
+}
+
+// Handle signs the next step of an active transaction. Transactions found timed out are
+// closed instead, failing with domain.ErrTransactionExpired.
+// TODO: this should return DTOs instead of domain entities
+func (h *TransactionStepCommandHandler) Handle(ctx context.Context, cmd transactionStepCommand) (domain.Transaction, domain.Signature, error) {
+	ctx, span := tracer.Start(ctx, "TransactionStepCommandHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, cmd.deviceID))
+
+	transaction, signature, err := h.handle(ctx, cmd)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return transaction, signature, err
+}
+
+func (h *TransactionStepCommandHandler) handle(ctx context.Context, cmd transactionStepCommand) (domain.Transaction, domain.Signature, error) {
+	transaction, err := h.TransactionRepository.FindByID(ctx, cmd.deviceID, cmd.transactionID)
+	if err != nil {
+		return domain.Transaction{}, domain.Signature{}, errors.Join(ErrFetchingTransaction, err)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int(tracing.AttributeTransactionNumber, transaction.Number()))
+
+	now := h.SignatureHandler.clock().Now()
+	expired, err := expireTransaction(ctx, h.SignatureHandler.DeviceRepository, h.TransactionRepository, h.SignatureHandler.MaxRetries, h.SignatureHandler.Observer, transaction, now)
+	if err != nil {
+		return domain.Transaction{}, domain.Signature{}, err
+	}
+	if expired {
+		return domain.Transaction{}, domain.Signature{}, domain.ErrTransactionExpired
+	}
+	if err := transaction.Open(now); err != nil {
+		return domain.Transaction{}, domain.Signature{}, err
+	}
+
+	// The step is reserved on the device along with its signature, so that concurrent steps
+	// of the same transaction are rejected before they are signed rather than after
+	revision := transaction.Revision() + 1
+	signatures, err := h.SignatureHandler.sign(ctx, cmd.deviceID, transaction.ClientID(), func(device *domain.Device) ([]domain.Payload, error) {
+		if err := transaction.Open(h.SignatureHandler.clock().Now()); err != nil {
+			return nil, err
+		}
+		if err := device.ReserveTransactionStep(transaction.Number(), cmd.stepType, revision); err != nil {
+			return nil, errors.Join(domain.ErrTransactionVersionMismatch, err)
+		}
+		payload, err := device.TransactionStepPayload(transaction.Number(), cmd.stepType, revision, cmd.payload)
+		if err != nil {
+			return nil, errors.Join(ErrValidation, err)
+		}
+		return []domain.Payload{payload}, nil
+	}, cmd.format)
+	if err != nil {
+		return domain.Transaction{}, domain.Signature{}, withoutItemIndex(err)
+	}
+	signature := signatures[0]
+
+	// Nothing else updates the transaction while the step holds its reservation. It's recorded
+	// even if the request was cancelled meanwhile, as it's already part of the chain of the device
+	originalVersion := transaction.Version()
+	err = transaction.AddStep(domain.NewTransactionStep(cmd.stepType, revision, signature))
+	if err == nil {
+		err = h.TransactionRepository.Update(context.WithoutCancel(ctx), transaction, originalVersion)
+	}
+	if err != nil {
+		return domain.Transaction{}, domain.Signature{}, errors.Join(ErrSavingTransaction, err)
+	}
+	return transaction, signature, nil
+}
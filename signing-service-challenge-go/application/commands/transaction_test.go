@@ -0,0 +1,225 @@
+package commands_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func Test_TransactionCommandHandlers_Lifecycle(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	signatureHandler := newCreateSignatureCommandHandler(repository)
+	transactions := persistence.NewInMemoryTransactionRepository()
+	startHandler := commands.StartTransactionCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler}
+	stepHandler := commands.TransactionStepCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler}
+
+	start, err := commands.NewStartTransactionCommand(device.ID(), "", commands.SignaturePayload{}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, _, err := startHandler.Handle(context.Background(), start); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	transaction, signature, err := startHandler.Handle(context.Background(), start)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if transaction.Number() != 2 || transaction.State() != domain.TransactionStateActive || signature.Counter() != 1 {
+		t.Fatal("Expected the active transaction 2 signed with counter 1, got", transaction.Number(), transaction.State(), signature.Counter())
+	}
+
+	update, err := commands.NewTransactionStepCommand(device.ID(), transaction.ID(), "update", commands.SignaturePayload{Data: []byte("item_0")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	transaction, signature, err = stepHandler.Handle(context.Background(), update)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	securedData, err := domain.ParseSecuredData(signature.RawData())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	expectedPayload := `{"data":"aXRlbV8w","payload_type":"text","revision":1,"step":"update","transaction_number":2}`
+	if string(securedData.Payload.Data()) != expectedPayload {
+		t.Fatal("Expected the signed step", expectedPayload, "got", string(securedData.Payload.Data()))
+	}
+
+	finish, err := commands.NewTransactionStepCommand(device.ID(), transaction.ID(), "finish", commands.SignaturePayload{}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	transaction, signature, err = stepHandler.Handle(context.Background(), finish)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if transaction.State() != domain.TransactionStateFinished || transaction.Revision() != 2 || signature.Counter() != 3 {
+		t.Fatal("Expected the transaction finished at revision 2 with counter 3, got", transaction.State(), transaction.Revision(), signature.Counter())
+	}
+	if _, _, err := stepHandler.Handle(context.Background(), update); !errors.Is(err, domain.ErrTransactionFinished) {
+		t.Fatal("Expected", domain.ErrTransactionFinished, "got", err)
+	}
+
+	stored, err := repository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.SignaturesCount() != 4 || stored.TransactionsCount() != 2 {
+		t.Fatal("Expected 4 signatures of 2 transactions, got", stored.SignaturesCount(), stored.TransactionsCount())
+	}
+}
+
+func Test_TransactionStepCommandHandler_Handle_Expired(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	signatureHandler := newCreateSignatureCommandHandler(repository)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	signatureHandler.Clock = fixedClock{now}
+	transactions := persistence.NewInMemoryTransactionRepository()
+	startHandler := commands.StartTransactionCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler, Timeout: time.Minute}
+	stepHandler := commands.TransactionStepCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler}
+
+	start, _ := commands.NewStartTransactionCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_0")}, "")
+	transaction, _, err := startHandler.Handle(context.Background(), start)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signatureHandler.Clock = fixedClock{now.Add(time.Minute + time.Second)}
+	update, _ := commands.NewTransactionStepCommand(device.ID(), transaction.ID(), "update", commands.SignaturePayload{}, "")
+	if _, _, err := stepHandler.Handle(context.Background(), update); !errors.Is(err, domain.ErrTransactionExpired) {
+		t.Fatal("Expected", domain.ErrTransactionExpired, "got", err)
+	}
+	stored, err := transactions.FindByID(context.Background(), device.ID(), transaction.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.State() != domain.TransactionStateExpired {
+		t.Fatal("Expected the transaction to be expired, got", stored.State())
+	}
+}
+
+func Test_NewTransactionStepCommand_Error(t *testing.T) {
+	tests := []struct {
+		transactionID string
+		stepType      string
+		expected      error
+	}{
+		{"", "update", commands.ErrMissingTransactionID},
+		{"transaction_id_0", "start", commands.ErrInvalidTransactionStep},
+	}
+	for _, test := range tests {
+		_, err := commands.NewTransactionStepCommand("device_id_0", test.transactionID, test.stepType, commands.SignaturePayload{}, "")
+		if !errors.Is(err, test.expected) || !errors.Is(err, commands.ErrValidation) {
+			t.Fatal("Expected", test.expected, "got", err)
+		}
+	}
+	if _, err := commands.NewStartTransactionCommand("device_id_0", "", commands.SignaturePayload{Type: "unknown", Data: []byte("data")}, ""); !errors.Is(err, domain.ErrUnknownPayloadType) {
+		t.Fatal("Expected", domain.ErrUnknownPayloadType, "got", err)
+	}
+}
+
+func Test_TransactionStepCommandHandler_Handle_Concurrent(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	signatureHandler := newCreateSignatureCommandHandler(repository)
+	signatureHandler.MaxRetries = 10
+	transactions := persistence.NewInMemoryTransactionRepository()
+	startHandler := commands.StartTransactionCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler}
+	stepHandler := commands.TransactionStepCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler}
+
+	start, _ := commands.NewStartTransactionCommand(device.ID(), "", commands.SignaturePayload{}, "")
+	transaction, _, err := startHandler.Handle(context.Background(), start)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	finish, _ := commands.NewTransactionStepCommand(device.ID(), transaction.ID(), "finish", commands.SignaturePayload{}, "")
+	const steps = 8
+	results := make(chan error, steps)
+	for i := 0; i < steps; i++ {
+		go func() {
+			_, _, err := stepHandler.Handle(context.Background(), finish)
+			results <- err
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < steps; i++ {
+		err := <-results
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, domain.ErrTransactionVersionMismatch) && !errors.Is(err, domain.ErrTransactionFinished) {
+			t.Fatal("Expected a conflict, got", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatal("Expected a single finish step, got", succeeded)
+	}
+
+	// The losing steps were rejected before being signed
+	stored, err := repository.FindByID(context.Background(), device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	recorded, err := transactions.FindByID(context.Background(), device.ID(), transaction.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.SignaturesCount() != 2 || len(recorded.Steps()) != 2 || recorded.State() != domain.TransactionStateFinished {
+		t.Fatal("Expected 2 signatures recorded as the steps of the finished transaction, got", stored.SignaturesCount(), len(recorded.Steps()), recorded.State())
+	}
+}
+
+func Test_ExpireTransactionsCommandHandler_Handle(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	device := newTestDevice(t, repository)
+	signatureHandler := newCreateSignatureCommandHandler(repository)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	signatureHandler.Clock = fixedClock{now}
+	transactions := persistence.NewInMemoryTransactionRepository()
+	startHandler := commands.StartTransactionCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler, Timeout: time.Minute}
+	stepHandler := commands.TransactionStepCommandHandler{TransactionRepository: transactions, SignatureHandler: &signatureHandler}
+	expireHandler := commands.ExpireTransactionsCommandHandler{DeviceRepository: repository, TransactionRepository: transactions}
+
+	start, _ := commands.NewStartTransactionCommand(device.ID(), "", commands.SignaturePayload{}, "")
+	timedOut, _, err := startHandler.Handle(context.Background(), start)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatureHandler.Clock = fixedClock{now.Add(50 * time.Second)}
+	active, _, err := startHandler.Handle(context.Background(), start)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expireHandler.Clock = fixedClock{now.Add(time.Minute + time.Second)}
+	expired, err := expireHandler.Handle(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if expired != 1 {
+		t.Fatal("Expected 1 expired transaction, got", expired)
+	}
+	stored, err := transactions.FindByID(context.Background(), device.ID(), timedOut.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if stored.State() != domain.TransactionStateExpired {
+		t.Fatal("Expected the transaction to be expired, got", stored.State())
+	}
+	if stored, _ := transactions.FindByID(context.Background(), device.ID(), active.ID()); stored.State() != domain.TransactionStateActive {
+		t.Fatal("Expected the transaction to be active, got", stored.State())
+	}
+
+	// The expired transaction takes no more steps
+	update, _ := commands.NewTransactionStepCommand(device.ID(), timedOut.ID(), "update", commands.SignaturePayload{}, "")
+	if _, _, err := stepHandler.Handle(context.Background(), update); !errors.Is(err, domain.ErrTransactionExpired) {
+		t.Fatal("Expected", domain.ErrTransactionExpired, "got", err)
+	}
+}
@@ -0,0 +1,115 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tsa"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type auditDeviceQuery struct {
+	deviceID string
+}
+
+func NewAuditDeviceQuery(deviceID string) (auditDeviceQuery, error) {
+	q := auditDeviceQuery{
+		deviceID: deviceID,
+	}
+	return q, q.validate()
+}
+
+func (q auditDeviceQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	return nil
+}
+
+// AuditReport lists the signatures of a device which failed the audit.
+type AuditReport struct {
+	DeviceID        string
+	SignaturesCount int
+	Findings        []domain.AuditFinding
+}
+
+func (r AuditReport) Valid() bool {
+	return len(r.Findings) == 0
+}
+
+// AuditDeviceQueryHandler checks the signature chain of a device and verifies
+// every signature against the device public key, along with its timestamp token if any.
+type AuditDeviceQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+	VerifierResolver map[domain.SigningAlgorithm]crypto.Verifier
+	// TimestampVerifier is optional, timestamp tokens are not checked if unset.
+	TimestampVerifier *tsa.Verifier
+	// TurnoverKeys is optional, it unwraps the turnover keys of RKSV devices, see
+	// commands.CreateDeviceCommandHandler.KEK. The keys are used as stored if unset.
+	TurnoverKeys domain.KeyUnwrapper
+}
+
+func (h *AuditDeviceQueryHandler) Handle(ctx context.Context, q auditDeviceQuery) (AuditReport, error) {
+	ctx, span := tracer.Start(ctx, "AuditDeviceQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	report, err := h.handle(ctx, q)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return report, err
+}
+
+func (h *AuditDeviceQueryHandler) handle(ctx context.Context, q auditDeviceQuery) (AuditReport, error) {
+	device, err := h.DeviceRepository.FindByID(ctx, q.deviceID)
+	if err != nil {
+		return AuditReport{}, errors.Join(ErrFetchingDevice, err)
+	}
+
+	verifier, ok := h.VerifierResolver[device.Algorithm()]
+	if !ok {
+		return AuditReport{}, ErrAlgorithmNotSupported
+	}
+
+	findings := device.AuditSignatureChain(h.TurnoverKeys)
+	for _, signature := range device.Signatures() {
+		if err := h.verify(verifier, device, signature); err != nil {
+			findings = append(findings, domain.AuditFinding{
+				SignatureID: signature.ID(),
+				Counter:     signature.Counter(),
+				Version:     signature.SecuredDataVersion(),
+				Err:         err,
+			})
+		}
+		if err := ctx.Err(); err != nil {
+			return AuditReport{}, err
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Counter < findings[j].Counter
+	})
+
+	return AuditReport{
+		DeviceID:        device.ID(),
+		SignaturesCount: device.SignaturesCount(),
+		Findings:        findings,
+	}, nil
+}
+
+func (h *AuditDeviceQueryHandler) verify(verifier crypto.Verifier, device domain.Device, signature domain.Signature) error {
+	if err := verifySignature(verifier, device, signature); err != nil {
+		return err
+	}
+	if h.TimestampVerifier != nil && signature.TimestampToken() != nil {
+		if _, err := h.TimestampVerifier.Verify(signature.TimestampToken(), signature.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
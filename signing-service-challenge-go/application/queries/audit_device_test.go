@@ -0,0 +1,120 @@
+package queries_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func Test_AuditDeviceQueryHandler_Handle_OK(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	signatureHandler := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmECDSA: &crypto.ECDSASignerFactory{},
+		},
+	}
+	auditHandler := queries.AuditDeviceQueryHandler{
+		DeviceRepository: repository,
+		VerifierResolver: map[domain.SigningAlgorithm]crypto.Verifier{
+			domain.SigningAlgorithmECDSA: &crypto.ECDSAVerifier{},
+		},
+	}
+
+	for _, version := range []string{"v1", "v2", "v3"} {
+		keyPair, err := (&crypto.ECDSAProvider{}).Provide(context.Background())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		format, err := domain.NewSecuredDataFormat(version)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		device, err := domain.NewDevice("device_"+version, "ecdsa", "", keyPair.Public, keyPair.Private, domain.WithSecuredDataFormat(format))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := repository.Save(context.Background(), device); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+
+		cmd, err := commands.NewCreateSignatureBatchCommand(device.ID(), "", []commands.SignaturePayload{
+			{Data: []byte("data_0")}, {Data: []byte("data_1")}, {Data: []byte("data_2")},
+		}, "")
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if _, err := signatureHandler.HandleBatch(context.Background(), cmd); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+
+		query, err := queries.NewAuditDeviceQuery(device.ID())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		report, err := auditHandler.Handle(context.Background(), query)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if !report.Valid() || report.SignaturesCount != 3 {
+			t.Fatal("Expected a valid report with 3 signatures for", version, "got", report)
+		}
+	}
+}
+
+func Test_AuditDeviceQueryHandler_Handle_TamperedSignature(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	keyPair, err := (&crypto.ECDSAProvider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ecdsa", "", keyPair.Public, keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	// Well chained, but not signed by the device
+	payload, err := domain.NewTextPayload("data_0")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := device.NewSignature("signature_id_0", enrichedData, []byte("forged"), time.Now())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := device.AddSignature(signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	handler := queries.AuditDeviceQueryHandler{
+		DeviceRepository: repository,
+		VerifierResolver: map[domain.SigningAlgorithm]crypto.Verifier{
+			domain.SigningAlgorithmECDSA: &crypto.ECDSAVerifier{},
+		},
+	}
+	query, err := queries.NewAuditDeviceQuery(device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	report, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if len(report.Findings) != 1 || !errors.Is(report.Findings[0].Err, crypto.ErrInvalidSignature) {
+		t.Fatal("Expected a finding with", crypto.ErrInvalidSignature, "got", report.Findings)
+	}
+}
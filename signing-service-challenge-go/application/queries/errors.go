@@ -0,0 +1,12 @@
+package queries
+
+import (
+	"errors"
+)
+
+var (
+	ErrValidation            = errors.New("invalid query")
+	ErrAlgorithmNotSupported = errors.New("algorithm not supported")
+	ErrFetchingDevice        = errors.New("failed to fetch device")
+	ErrMissingDeviceID       = errors.New("missing device ID")
+)
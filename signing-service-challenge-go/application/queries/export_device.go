@@ -0,0 +1,165 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/export"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultExportPageSize is how many signatures exports read at a time unless configured otherwise.
+const DefaultExportPageSize = 256
+
+var (
+	ErrBuildingSigner     = errors.New("failed to build signer")
+	ErrFetchingSignatures = errors.New("failed to fetch signatures")
+)
+
+type exportDeviceQuery struct {
+	deviceID   string
+	signatures export.Range
+}
+
+// NewExportDeviceQuery creates a query exporting the signatures of a device in the given range.
+func NewExportDeviceQuery(deviceID string, signatures export.Range) (exportDeviceQuery, error) {
+	q := exportDeviceQuery{
+		deviceID:   deviceID,
+		signatures: signatures,
+	}
+	return q, q.validate()
+}
+
+func (q exportDeviceQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if err := q.signatures.Validate(); err != nil {
+		return errors.Join(ErrValidation, err)
+	}
+	return nil
+}
+
+// ExportDeviceQueryHandler exports the signature logs of the devices as TAR archives, see package export.
+type ExportDeviceQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+	// SignatureRepository reads the exported signatures a page at a time.
+	SignatureRepository domain.SignatureRepository
+	// PageSize is how many signatures are read at a time, DefaultExportPageSize if unset.
+	PageSize int
+	// SignerFactoryResolver builds the signers of the devices, which sign the index of their archives.
+	SignerFactoryResolver map[domain.SigningAlgorithm]crypto.SignerFactory
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+}
+
+// DeviceExport is the prepared export of a device, see Stream.
+type DeviceExport struct {
+	device     domain.Device
+	signer     crypto.Signer
+	signatures export.Range
+	// signaturesCount is the number of signatures of the device when the export was prepared.
+	signaturesCount     int
+	signatureRepository domain.SignatureRepository
+	pageSize            int
+	exportedAt          time.Time
+}
+
+func (e DeviceExport) DeviceID() string {
+	return e.device.ID()
+}
+
+func (e DeviceExport) ExportedAt() time.Time {
+	return e.exportedAt
+}
+
+// Handle prepares the export of a device, failing before anything is written
+// if the device can't be found or can't sign its archive.
+func (h *ExportDeviceQueryHandler) Handle(ctx context.Context, q exportDeviceQuery) (DeviceExport, error) {
+	ctx, span := tracer.Start(ctx, "ExportDeviceQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	deviceExport, err := h.handle(ctx, q)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return deviceExport, err
+}
+
+func (h *ExportDeviceQueryHandler) handle(ctx context.Context, q exportDeviceQuery) (DeviceExport, error) {
+	device, err := h.DeviceRepository.FindByID(ctx, q.deviceID)
+	if err != nil {
+		return DeviceExport{}, errors.Join(ErrFetchingDevice, err)
+	}
+
+	signerFactory, ok := h.SignerFactoryResolver[device.Algorithm()]
+	if !ok {
+		return DeviceExport{}, ErrAlgorithmNotSupported
+	}
+	signer, err := signerFactory.Build(ctx, device.PrivateKey())
+	if err != nil {
+		return DeviceExport{}, errors.Join(ErrBuildingSigner, err)
+	}
+
+	pageSize := h.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultExportPageSize
+	}
+	return DeviceExport{
+		device:              device,
+		signer:              signer,
+		signatures:          q.signatures,
+		signaturesCount:     device.SignaturesCount(),
+		signatureRepository: h.SignatureRepository,
+		pageSize:            pageSize,
+		exportedAt:          clockOrSystem(h.Clock).Now().UTC(),
+	}, nil
+}
+
+// Stream writes the archive of the export, one signature at a time, reading them a page at a time.
+// The signatures are those of the device when the export was prepared, later ones are left
+// for the next export.
+func (e DeviceExport) Stream(ctx context.Context, w io.Writer) error {
+	ctx, span := tracer.Start(ctx, "DeviceExport.Stream")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, e.device.ID()))
+
+	if err := e.stream(ctx, w); err != nil {
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+func (e DeviceExport) stream(ctx context.Context, w io.Writer) error {
+	archive := export.NewArchive(w, e.device, e.exportedAt, e.signatures)
+	first, last := e.signatures.Counters(e.signaturesCount)
+	for counter := first; counter < last; {
+		page, err := e.signatureRepository.ListSignatures(ctx, e.device.ID(), counter, min(e.pageSize, last-counter))
+		if err != nil {
+			return errors.Join(ErrFetchingSignatures, err)
+		}
+		if len(page) == 0 {
+			return ErrFetchingSignatures
+		}
+		for _, signature := range page {
+			if !e.signatures.IncludesTime(signature.CreatedAt()) {
+				continue
+			}
+			if err := archive.AddSignature(signature); err != nil {
+				return err
+			}
+		}
+		counter += len(page)
+	}
+	if err := archive.AddKeys(e.device); err != nil {
+		return err
+	}
+	return archive.Close(e.signer)
+}
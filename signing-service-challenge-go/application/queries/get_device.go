@@ -0,0 +1,47 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type getDeviceQuery struct {
+	deviceID string
+}
+
+func NewGetDeviceQuery(deviceID string) (getDeviceQuery, error) {
+	q := getDeviceQuery{
+		deviceID: deviceID,
+	}
+	return q, q.validate()
+}
+
+func (q getDeviceQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	return nil
+}
+
+type GetDeviceQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+}
+
+// TODO: this should return a DTO instead of a domain entity
+func (h *GetDeviceQueryHandler) Handle(ctx context.Context, q getDeviceQuery) (domain.Device, error) {
+	ctx, span := tracer.Start(ctx, "GetDeviceQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	device, err := h.DeviceRepository.FindByID(ctx, q.deviceID)
+	if err != nil {
+		err = errors.Join(ErrFetchingDevice, err)
+		tracing.RecordError(span, err)
+		return domain.Device{}, err
+	}
+	return device, nil
+}
@@ -0,0 +1,120 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/receipt"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrMissingSignatureID = errors.New("missing signature ID")
+	ErrUnknownTemplate    = errors.New("unknown receipt template")
+	ErrReceiptLayout      = errors.New("failed to lay out the receipt")
+	// ErrTemplateNotApplicable is returned when the template requested does not lay out the signature,
+	// like the RKSV one for other secured data formats.
+	ErrTemplateNotApplicable = errors.New("receipt template not applicable to the signature")
+)
+
+type getSignatureReceiptQuery struct {
+	deviceID    string
+	signatureID string
+	template    string
+}
+
+// NewGetSignatureReceiptQuery creates a query laying out the receipt payload of a signature
+// with the named template. An empty template name stands for the default template.
+func NewGetSignatureReceiptQuery(deviceID string, signatureID string, template string) (getSignatureReceiptQuery, error) {
+	q := getSignatureReceiptQuery{
+		deviceID:    deviceID,
+		signatureID: signatureID,
+		template:    template,
+	}
+	return q, q.validate()
+}
+
+func (q getSignatureReceiptQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if q.signatureID == "" {
+		return errors.Join(ErrValidation, ErrMissingSignatureID)
+	}
+	return nil
+}
+
+// Receipt is the payload of the QR code of a signature.
+type Receipt struct {
+	DeviceID    string
+	SignatureID string
+	Template    string
+	Payload     string
+}
+
+type GetSignatureReceiptQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+	TemplateResolver map[string]receipt.Template
+	// DefaultTemplate is the name of the template used unless requested otherwise,
+	// receipt.DefaultTemplateName if unset.
+	DefaultTemplate string
+}
+
+func (h *GetSignatureReceiptQueryHandler) Handle(ctx context.Context, q getSignatureReceiptQuery) (Receipt, error) {
+	ctx, span := tracer.Start(ctx, "GetSignatureReceiptQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	result, err := h.handle(ctx, q)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return result, err
+}
+
+func (h *GetSignatureReceiptQueryHandler) handle(ctx context.Context, q getSignatureReceiptQuery) (Receipt, error) {
+	name := q.template
+	if name == "" {
+		name = h.defaultTemplate()
+	}
+	template, ok := h.TemplateResolver[name]
+	if !ok {
+		return Receipt{}, errors.Join(ErrValidation, ErrUnknownTemplate)
+	}
+
+	device, err := h.DeviceRepository.FindByID(ctx, q.deviceID)
+	if err != nil {
+		return Receipt{}, errors.Join(ErrFetchingDevice, err)
+	}
+	signature, err := device.Signature(q.signatureID)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	data, err := receipt.NewData(device, signature)
+	if err != nil {
+		return Receipt{}, errors.Join(ErrReceiptLayout, err)
+	}
+	payload, err := template.Payload(data)
+	if err != nil && q.template != "" {
+		return Receipt{}, errors.Join(ErrTemplateNotApplicable, err)
+	}
+	if err != nil {
+		return Receipt{}, errors.Join(ErrReceiptLayout, err)
+	}
+	return Receipt{
+		DeviceID:    device.ID(),
+		SignatureID: signature.ID(),
+		Template:    name,
+		Payload:     payload,
+	}, nil
+}
+
+func (h *GetSignatureReceiptQueryHandler) defaultTemplate() string {
+	if h.DefaultTemplate == "" {
+		return receipt.DefaultTemplateName
+	}
+	return h.DefaultTemplate
+}
@@ -0,0 +1,92 @@
+package queries_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/receipt"
+)
+
+func Test_GetSignatureReceiptQueryHandler_Handle(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	signatures := newJWSSignatures(t, repository)
+	counterTemplate, err := receipt.NewTextTemplate("counter", "{{.Counter}}")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	handler := queries.GetSignatureReceiptQueryHandler{
+		DeviceRepository: repository,
+		TemplateResolver: map[string]receipt.Template{
+			receipt.DefaultTemplateName: receipt.DefaultTemplate,
+			"counter":                   counterTemplate,
+		},
+	}
+
+	query, err := queries.NewGetSignatureReceiptQuery("device_id_0", signatures[1].ID(), "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	result, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	fields := strings.Split(result.Payload, ";")
+	if result.Template != receipt.DefaultTemplateName || len(fields) != 7 {
+		t.Fatal("Expected a default payload of 7 fields, got", result.Template, result.Payload)
+	}
+	if fields[0] != "V1" || fields[1] != "device_id_0" || fields[2] != strconv.Itoa(signatures[1].Counter()) {
+		t.Fatal("Expected the version, device and counter of the signature, got", fields[:3])
+	}
+	if fields[6] != base64.StdEncoding.EncodeToString(signatures[1].Value()) {
+		t.Fatal("Expected the signature value, got", fields[6])
+	}
+
+	query, _ = queries.NewGetSignatureReceiptQuery("device_id_0", signatures[0].ID(), "counter")
+	result, err = handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if result.Payload != strconv.Itoa(signatures[0].Counter()) {
+		t.Fatal("Expected the counter of the signature, got", result.Payload)
+	}
+}
+
+func Test_GetSignatureReceiptQueryHandler_Handle_Errors(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	signatures := newJWSSignatures(t, repository)
+	handler := queries.GetSignatureReceiptQueryHandler{
+		DeviceRepository: repository,
+		TemplateResolver: map[string]receipt.Template{receipt.DefaultTemplateName: receipt.DefaultTemplate},
+	}
+
+	tests := []struct {
+		deviceID    string
+		signatureID string
+		template    string
+		expected    error
+	}{
+		{"device_id_0", "unknown", "", domain.ErrSignatureNotFound},
+		{"unknown", signatures[0].ID(), "", domain.ErrDeviceNotFound},
+		{"device_id_0", signatures[0].ID(), "unknown", queries.ErrUnknownTemplate},
+	}
+	for _, test := range tests {
+		query, err := queries.NewGetSignatureReceiptQuery(test.deviceID, test.signatureID, test.template)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if _, err := handler.Handle(context.Background(), query); !errors.Is(err, test.expected) {
+			t.Fatal("Expected", test.expected, "got", err)
+		}
+	}
+
+	if _, err := queries.NewGetSignatureReceiptQuery("device_id_0", "", ""); !errors.Is(err, queries.ErrMissingSignatureID) {
+		t.Fatal("Expected", queries.ErrMissingSignatureID, "got", err)
+	}
+}
@@ -0,0 +1,69 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrMissingTransactionID = errors.New("missing transaction ID")
+	ErrFetchingTransaction  = errors.New("failed to fetch transaction")
+)
+
+type getTransactionQuery struct {
+	deviceID      string
+	transactionID string
+}
+
+func NewGetTransactionQuery(deviceID string, transactionID string) (getTransactionQuery, error) {
+	q := getTransactionQuery{
+		deviceID:      deviceID,
+		transactionID: transactionID,
+	}
+	return q, q.validate()
+}
+
+func (q getTransactionQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	if q.transactionID == "" {
+		return errors.Join(ErrValidation, ErrMissingTransactionID)
+	}
+	return nil
+}
+
+type GetTransactionQueryHandler struct {
+	TransactionRepository domain.TransactionRepository
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+}
+
+// Handle returns a transaction of a device. Transactions which timed out are reported
+// as expired, even if nothing closed them yet.
+// TODO: this should return a DTO instead of a domain entity
+func (h *GetTransactionQueryHandler) Handle(ctx context.Context, q getTransactionQuery) (domain.Transaction, error) {
+	ctx, span := tracer.Start(ctx, "GetTransactionQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	transaction, err := h.TransactionRepository.FindByID(ctx, q.deviceID, q.transactionID)
+	if err != nil {
+		err = errors.Join(ErrFetchingTransaction, err)
+		tracing.RecordError(span, err)
+		return domain.Transaction{}, err
+	}
+	transaction.Expire(clockOrSystem(h.Clock).Now())
+	return transaction, nil
+}
+
+func clockOrSystem(clock domain.Clock) domain.Clock {
+	if clock == nil {
+		return domain.SystemClock{}
+	}
+	return clock
+}
@@ -0,0 +1,67 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrUnknownClientState = errors.New("unknown client state")
+
+type listClientsQuery struct {
+	deviceID string
+	// state filters the clients when set.
+	state domain.ClientState
+}
+
+// NewListClientsQuery creates a query listing the clients of a device,
+// only those in the given state unless empty.
+func NewListClientsQuery(deviceID string, state string) (listClientsQuery, error) {
+	q := listClientsQuery{
+		deviceID: deviceID,
+		state:    domain.ClientState(state),
+	}
+	return q, q.validate()
+}
+
+func (q listClientsQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	switch q.state {
+	case "", domain.ClientStateRegistered, domain.ClientStateDeregistered:
+	default:
+		return errors.Join(ErrValidation, ErrUnknownClientState)
+	}
+	return nil
+}
+
+type ListClientsQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+}
+
+// Handle lists the clients of a device sorted by their registration.
+// TODO: this should return DTOs instead of domain entities
+func (h *ListClientsQueryHandler) Handle(ctx context.Context, q listClientsQuery) ([]domain.Client, error) {
+	ctx, span := tracer.Start(ctx, "ListClientsQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	device, err := h.DeviceRepository.FindByID(ctx, q.deviceID)
+	if err != nil {
+		err = errors.Join(ErrFetchingDevice, err)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+
+	clients := make([]domain.Client, 0, len(device.Clients()))
+	for _, client := range device.Clients() {
+		if q.state == "" || client.State() == q.state {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
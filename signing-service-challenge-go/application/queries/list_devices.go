@@ -0,0 +1,29 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+)
+
+var ErrListingDevices = errors.New("failed to list devices")
+
+type ListDevicesQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+}
+
+// TODO: this should return DTOs instead of domain entities, and be paginated
+func (h *ListDevicesQueryHandler) Handle(ctx context.Context) ([]domain.Device, error) {
+	ctx, span := tracer.Start(ctx, "ListDevicesQueryHandler.Handle")
+	defer span.End()
+
+	devices, err := h.DeviceRepository.ListAll(ctx)
+	if err != nil {
+		err = errors.Join(ErrListingDevices, err)
+		tracing.RecordError(span, err)
+		return nil, err
+	}
+	return devices, nil
+}
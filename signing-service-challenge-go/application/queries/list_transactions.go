@@ -0,0 +1,84 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrListingTransactions     = errors.New("failed to list transactions")
+	ErrUnknownTransactionState = errors.New("unknown transaction state")
+)
+
+type listTransactionsQuery struct {
+	deviceID string
+	// state filters the transactions when set.
+	state domain.TransactionState
+}
+
+// NewListTransactionsQuery creates a query listing the transactions of a device,
+// only those in the given state unless empty.
+func NewListTransactionsQuery(deviceID string, state string) (listTransactionsQuery, error) {
+	q := listTransactionsQuery{
+		deviceID: deviceID,
+		state:    domain.TransactionState(state),
+	}
+	return q, q.validate()
+}
+
+func (q listTransactionsQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	switch q.state {
+	case "", domain.TransactionStateActive, domain.TransactionStateFinished, domain.TransactionStateExpired:
+	default:
+		return errors.Join(ErrValidation, ErrUnknownTransactionState)
+	}
+	return nil
+}
+
+type ListTransactionsQueryHandler struct {
+	DeviceRepository      domain.DeviceRepository
+	TransactionRepository domain.TransactionRepository
+	// Clock is optional, domain.SystemClock if unset
+	Clock domain.Clock
+}
+
+// Handle lists the transactions of a device sorted by their number, see GetTransactionQueryHandler.
+// TODO: this should return DTOs instead of domain entities, and be paginated
+func (h *ListTransactionsQueryHandler) Handle(ctx context.Context, q listTransactionsQuery) ([]domain.Transaction, error) {
+	ctx, span := tracer.Start(ctx, "ListTransactionsQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	transactions, err := h.handle(ctx, q)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return transactions, err
+}
+
+func (h *ListTransactionsQueryHandler) handle(ctx context.Context, q listTransactionsQuery) ([]domain.Transaction, error) {
+	if _, err := h.DeviceRepository.FindByID(ctx, q.deviceID); err != nil {
+		return nil, errors.Join(ErrFetchingDevice, err)
+	}
+	transactions, err := h.TransactionRepository.ListByDevice(ctx, q.deviceID)
+	if err != nil {
+		return nil, errors.Join(ErrListingTransactions, err)
+	}
+
+	now := clockOrSystem(h.Clock).Now()
+	result := make([]domain.Transaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		transaction.Expire(now)
+		if q.state == "" || transaction.State() == q.state {
+			result = append(result, transaction)
+		}
+	}
+	return result, nil
+}
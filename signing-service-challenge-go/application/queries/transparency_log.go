@@ -0,0 +1,121 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+)
+
+type GetTreeHeadQueryHandler struct {
+	Log *transparency.Log
+}
+
+// Handle returns the latest signed tree head of the transparency log.
+func (h *GetTreeHeadQueryHandler) Handle(ctx context.Context) (transparency.SignedTreeHead, error) {
+	_, span := tracer.Start(ctx, "GetTreeHeadQueryHandler.Handle")
+	defer span.End()
+
+	head, err := h.Log.LatestTreeHead()
+	if err != nil {
+		tracing.RecordError(span, err)
+		return transparency.SignedTreeHead{}, err
+	}
+	return head, nil
+}
+
+type getInclusionProofQuery struct {
+	signatureID string
+	treeSize    int
+}
+
+// NewGetInclusionProofQuery creates a query proving a signature is in the tree of the given
+// size. A zero tree size stands for the size of the latest tree head.
+func NewGetInclusionProofQuery(signatureID string, treeSize int) (getInclusionProofQuery, error) {
+	q := getInclusionProofQuery{
+		signatureID: signatureID,
+		treeSize:    treeSize,
+	}
+	return q, q.validate()
+}
+
+func (q getInclusionProofQuery) validate() error {
+	if q.signatureID == "" {
+		return errors.Join(ErrValidation, ErrMissingSignatureID)
+	}
+	if q.treeSize < 0 {
+		return errors.Join(ErrValidation, transparency.ErrInvalidTreeSize)
+	}
+	return nil
+}
+
+type GetInclusionProofQueryHandler struct {
+	Log *transparency.Log
+}
+
+func (h *GetInclusionProofQueryHandler) Handle(ctx context.Context, q getInclusionProofQuery) (transparency.InclusionProof, error) {
+	_, span := tracer.Start(ctx, "GetInclusionProofQueryHandler.Handle")
+	defer span.End()
+
+	proof, err := h.Log.InclusionProof(q.signatureID, q.treeSize)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return transparency.InclusionProof{}, err
+	}
+	return proof, nil
+}
+
+type getConsistencyProofQuery struct {
+	first  int
+	second int
+}
+
+// NewGetConsistencyProofQuery creates a query proving the tree of the first size is a prefix
+// of the tree of the second size. A zero second size stands for the size of the latest tree head.
+func NewGetConsistencyProofQuery(first int, second int) (getConsistencyProofQuery, error) {
+	q := getConsistencyProofQuery{
+		first:  first,
+		second: second,
+	}
+	return q, q.validate()
+}
+
+func (q getConsistencyProofQuery) validate() error {
+	if q.first <= 0 || q.second < 0 || (q.second != 0 && q.first > q.second) {
+		return errors.Join(ErrValidation, transparency.ErrInvalidTreeSize)
+	}
+	return nil
+}
+
+// ConsistencyProof proves the tree of size First is a prefix of the tree of size Second.
+type ConsistencyProof struct {
+	First  int
+	Second int
+	Proof  [][]byte
+}
+
+type GetConsistencyProofQueryHandler struct {
+	Log *transparency.Log
+}
+
+func (h *GetConsistencyProofQueryHandler) Handle(ctx context.Context, q getConsistencyProofQuery) (ConsistencyProof, error) {
+	_, span := tracer.Start(ctx, "GetConsistencyProofQueryHandler.Handle")
+	defer span.End()
+
+	second := q.second
+	if second == 0 {
+		head, err := h.Log.LatestTreeHead()
+		if err != nil {
+			tracing.RecordError(span, err)
+			return ConsistencyProof{}, err
+		}
+		second = head.TreeSize
+	}
+	proof, err := h.Log.ConsistencyProof(q.first, second)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return ConsistencyProof{}, err
+	}
+	return ConsistencyProof{First: q.first, Second: second, Proof: proof}, nil
+}
@@ -0,0 +1,119 @@
+package queries
+
+import (
+	"bytes"
+	stdcrypto "crypto"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jose"
+)
+
+var (
+	ErrEnvelopeMismatch = errors.New("signature envelope does not match the signature")
+	ErrKeyIDMismatch    = errors.New("signature key id does not match the device")
+	ErrSignerMismatch   = errors.New("signature signer certificate does not match the device key")
+)
+
+// verifySignature verifies a signature of the device in its format.
+func verifySignature(verifier crypto.Verifier, device domain.Device, signature domain.Signature) error {
+	switch signature.Format() {
+	case domain.SignatureFormatJWS:
+		jws, err := jose.Parse(string(signature.Envelope()))
+		if err != nil {
+			return err
+		}
+		if string(jws.Payload) != signature.RawData() || !bytes.Equal(jws.Signature, signature.Value()) || jws.Header.Counter != signature.Counter() {
+			return ErrEnvelopeMismatch
+		}
+		return verifyJWS(verifier, device, jws)
+	case domain.SignatureFormatCOSE:
+		message, err := cose.Parse(signature.Envelope())
+		if err != nil {
+			return err
+		}
+		if string(message.Payload) != signature.RawData() || !bytes.Equal(message.Signature, signature.Value()) || message.Header.Counter != signature.Counter() {
+			return ErrEnvelopeMismatch
+		}
+		return verifyCOSE(verifier, device, message)
+	case domain.SignatureFormatCMS:
+		signedData, err := cms.Parse(signature.Envelope())
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(signedData.Signature(), signature.Value()) {
+			return ErrEnvelopeMismatch
+		}
+		counter, err := verifyCMS(device, signedData, []byte(signature.RawData()))
+		if err != nil {
+			return err
+		}
+		if counter != signature.Counter() {
+			return ErrEnvelopeMismatch
+		}
+		return nil
+	default:
+		return verifier.Verify(device.PublicKey(), []byte(signature.RawData()), signature.Value())
+	}
+}
+
+// verifyJWS verifies a JWS made by the device with its current key.
+func verifyJWS(verifier crypto.Verifier, device domain.Device, jws jose.JWS) error {
+	if jws.Header.KeyID != device.KeyID() {
+		return ErrKeyIDMismatch
+	}
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return err
+	}
+	algorithm, err := jose.AlgorithmOf(device.Algorithm(), publicKey)
+	if err != nil {
+		return err
+	}
+	return jws.Verify(algorithm, verifier, device.PublicKey())
+}
+
+// verifyCOSE verifies a COSE_Sign1 message made by the device with its current key.
+func verifyCOSE(verifier crypto.Verifier, device domain.Device, message cose.Sign1) error {
+	if message.Header.KeyID != device.KeyID() {
+		return ErrKeyIDMismatch
+	}
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return err
+	}
+	algorithm, err := cose.AlgorithmOf(publicKey)
+	if err != nil {
+		return err
+	}
+	return message.Verify(algorithm, verifier, device.PublicKey())
+}
+
+// verifyCMS verifies a detached CMS SignedData over content made by the device with its
+// current key, and returns the signature counter it carries.
+func verifyCMS(device domain.Device, signedData *cms.SignedData, content []byte) (int, error) {
+	certificate, err := signedData.Signer()
+	if err != nil {
+		return 0, err
+	}
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return 0, err
+	}
+	if key, ok := publicKey.(interface {
+		Equal(stdcrypto.PublicKey) bool
+	}); !ok || !key.Equal(certificate.PublicKey) {
+		return 0, ErrSignerMismatch
+	}
+	if err := signedData.Verify(content); err != nil {
+		return 0, err
+	}
+	var counter int
+	if err := signedData.UnmarshalAttribute(cms.OIDAttributeSignatureCounter, &counter); err != nil {
+		return 0, err
+	}
+	return counter, nil
+}
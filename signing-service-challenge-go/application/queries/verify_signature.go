@@ -0,0 +1,205 @@
+package queries
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	ErrMissingSignature   = errors.New("missing signature")
+	ErrAmbiguousSignature = errors.New("JWS, COSE, CMS and raw signatures are mutually exclusive")
+	ErrMissingSignedData  = errors.New("missing signed data")
+	ErrUnexpectedData     = errors.New("JWS and COSE signatures carry their signed data")
+	ErrCounterMismatch    = errors.New("signature counter does not match the signed data")
+	ErrIncompletePrevious = errors.New("the previous signature must be given along with its signed data")
+)
+
+type verifySignatureQuery struct {
+	deviceID   string
+	jws        string
+	cose       []byte
+	cms        []byte
+	signedData string
+	signature  []byte
+	// previousSignedData and previousSignature are the previous signature of the device, to
+	// check the chaining of the signature against. Optional.
+	previousSignedData string
+	previousSignature  []byte
+}
+
+// NewVerifySignatureQuery creates a query verifying a signature of a device, given either
+// as a JWS compact serialization, as a COSE_Sign1 message, as a detached CMS SignedData along
+// with the signed data, or as a raw signature along with the signed data.
+func NewVerifySignatureQuery(deviceID string, jws string, cose []byte, cms []byte, signedData string, signature []byte) (verifySignatureQuery, error) {
+	q := verifySignatureQuery{
+		deviceID:   deviceID,
+		jws:        jws,
+		cose:       cose,
+		cms:        cms,
+		signedData: signedData,
+		signature:  signature,
+	}
+	return q, q.validate()
+}
+
+func (q verifySignatureQuery) validate() error {
+	if q.deviceID == "" {
+		return errors.Join(ErrValidation, ErrMissingDeviceID)
+	}
+	signatures := 0
+	for _, given := range []bool{q.jws != "", len(q.cose) > 0, len(q.cms) > 0, len(q.signature) > 0} {
+		if given {
+			signatures++
+		}
+	}
+	switch {
+	case signatures == 0:
+		return errors.Join(ErrValidation, ErrMissingSignature)
+	case signatures > 1:
+		return errors.Join(ErrValidation, ErrAmbiguousSignature)
+	case q.carriesData() && q.signedData != "":
+		return errors.Join(ErrValidation, ErrUnexpectedData)
+	case !q.carriesData() && q.signedData == "":
+		return errors.Join(ErrValidation, ErrMissingSignedData)
+	}
+	return nil
+}
+
+// WithPreviousSignature returns a copy of the query also checking the signature is chained to
+// the given previous signature of the device, given as its signed data and raw signature.
+func (q verifySignatureQuery) WithPreviousSignature(signedData string, signature []byte) (verifySignatureQuery, error) {
+	if signedData == "" || len(signature) == 0 {
+		return verifySignatureQuery{}, errors.Join(ErrValidation, ErrIncompletePrevious)
+	}
+	q.previousSignedData = signedData
+	q.previousSignature = signature
+	return q, nil
+}
+
+// carriesData tells whether the signature carries the signed data as its payload.
+func (q verifySignatureQuery) carriesData() bool {
+	return q.jws != "" || len(q.cose) > 0
+}
+
+// Verification is the outcome of the verification of a signature.
+type Verification struct {
+	DeviceID string
+	Format   domain.SignatureFormat
+	// SecuredData is the signed data, if it could be parsed.
+	SecuredData *domain.SecuredData
+	// Err tells why the signature is invalid, nil if valid.
+	Err error
+}
+
+func (v Verification) Valid() bool {
+	return v.Err == nil
+}
+
+// VerifySignatureQueryHandler verifies signatures presented by third parties against the device keys.
+type VerifySignatureQueryHandler struct {
+	DeviceRepository domain.DeviceRepository
+	VerifierResolver map[domain.SigningAlgorithm]crypto.Verifier
+}
+
+func (h *VerifySignatureQueryHandler) Handle(ctx context.Context, q verifySignatureQuery) (Verification, error) {
+	ctx, span := tracer.Start(ctx, "VerifySignatureQueryHandler.Handle")
+	defer span.End()
+	span.SetAttributes(attribute.String(tracing.AttributeDeviceID, q.deviceID))
+
+	verification, err := h.handle(ctx, q)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return verification, err
+}
+
+func (h *VerifySignatureQueryHandler) handle(ctx context.Context, q verifySignatureQuery) (Verification, error) {
+	device, err := h.DeviceRepository.FindByID(ctx, q.deviceID)
+	if err != nil {
+		return Verification{}, errors.Join(ErrFetchingDevice, err)
+	}
+	verifier, ok := h.VerifierResolver[device.Algorithm()]
+	if !ok {
+		return Verification{}, ErrAlgorithmNotSupported
+	}
+
+	verification := verify(verifier, device, q)
+	if verification.Valid() && q.previousSignedData != "" {
+		if verification.SecuredData == nil {
+			verification.Err = domain.ErrInvalidSecuredData
+			return verification, nil
+		}
+		verification.Err = device.VerifyChaining(*verification.SecuredData, q.previousSignedData, q.previousSignature)
+	}
+	return verification, nil
+}
+
+// verify checks the signature of the query against the key of the device.
+func verify(verifier crypto.Verifier, device domain.Device, q verifySignatureQuery) Verification {
+	verification := Verification{
+		DeviceID: device.ID(),
+		Format:   domain.SignatureFormatRaw,
+	}
+	switch {
+	case len(q.cms) > 0:
+		verification.Format = domain.SignatureFormatCMS
+		verification.SecuredData = parseSecuredData(q.signedData)
+		signedData, err := cms.Parse(q.cms)
+		if err != nil {
+			verification.Err = err
+			return verification
+		}
+		counter, err := verifyCMS(device, signedData, []byte(q.signedData))
+		verification.Err = err
+		if verification.Valid() && verification.SecuredData != nil && verification.SecuredData.Counter != counter {
+			verification.Err = ErrCounterMismatch
+		}
+		return verification
+	case len(q.cose) > 0:
+		verification.Format = domain.SignatureFormatCOSE
+		message, err := cose.Parse(q.cose)
+		if err != nil {
+			verification.Err = err
+			return verification
+		}
+		verification.SecuredData = parseSecuredData(string(message.Payload))
+		verification.Err = verifyCOSE(verifier, device, message)
+		if verification.Valid() && verification.SecuredData != nil && verification.SecuredData.Counter != message.Header.Counter {
+			verification.Err = ErrCounterMismatch
+		}
+		return verification
+	case q.jws == "":
+		verification.SecuredData = parseSecuredData(q.signedData)
+		verification.Err = verifier.Verify(device.PublicKey(), []byte(q.signedData), q.signature)
+		return verification
+	}
+
+	verification.Format = domain.SignatureFormatJWS
+	jws, err := jose.Parse(q.jws)
+	if err != nil {
+		verification.Err = err
+		return verification
+	}
+	verification.SecuredData = parseSecuredData(string(jws.Payload))
+	verification.Err = verifyJWS(verifier, device, jws)
+	if verification.Valid() && verification.SecuredData != nil && verification.SecuredData.Counter != jws.Header.Counter {
+		verification.Err = ErrCounterMismatch
+	}
+	return verification
+}
+
+func parseSecuredData(raw string) *domain.SecuredData {
+	securedData, err := domain.ParseSecuredData(raw)
+	if err != nil {
+		return nil
+	}
+	return &securedData
+}
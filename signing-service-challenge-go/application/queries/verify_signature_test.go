@@ -0,0 +1,354 @@
+package queries_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+)
+
+// newJWSSignatures creates an Ed25519 device signing JWS by default, and two signatures with it.
+func newJWSSignatures(t *testing.T, repository domain.DeviceRepository) []domain.Signature {
+	keyPair, err := (&crypto.Ed25519Provider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ed25519", "", keyPair.Public, keyPair.Private,
+		domain.WithSignatureFormat(domain.SignatureFormatJWS),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signatureHandler := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmEd25519: &crypto.Ed25519SignerFactory{},
+		},
+	}
+	cmd, err := commands.NewCreateSignatureBatchCommand(device.ID(), "", []commands.SignaturePayload{
+		{Data: []byte("data_0")}, {Data: []byte("data_1")},
+	}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatures, err := signatureHandler.HandleBatch(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	for _, signature := range signatures {
+		if signature.Format() != domain.SignatureFormatJWS {
+			t.Fatal("Expected the jws format of the device, got", signature.Format())
+		}
+	}
+	return signatures
+}
+
+var ed25519Verifiers = map[domain.SigningAlgorithm]crypto.Verifier{
+	domain.SigningAlgorithmEd25519: &crypto.Ed25519Verifier{},
+}
+
+func Test_AuditDeviceQueryHandler_Handle_JWS(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	newJWSSignatures(t, repository)
+
+	handler := queries.AuditDeviceQueryHandler{DeviceRepository: repository, VerifierResolver: ed25519Verifiers}
+	query, err := queries.NewAuditDeviceQuery("device_id_0")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	report, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !report.Valid() {
+		t.Fatal("Expected a valid report, got", report.Findings)
+	}
+}
+
+func Test_VerifySignatureQueryHandler_Handle_JWS(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	signatures := newJWSSignatures(t, repository)
+	handler := queries.VerifySignatureQueryHandler{DeviceRepository: repository, VerifierResolver: ed25519Verifiers}
+
+	query, err := queries.NewVerifySignatureQuery("device_id_0", string(signatures[1].Envelope()), nil, nil, "", nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !verification.Valid() {
+		t.Fatal("Expected a valid signature, got", verification.Err)
+	}
+	if verification.SecuredData == nil || verification.SecuredData.Counter != 1 {
+		t.Fatal("Expected the secured data of counter 1, got", verification.SecuredData)
+	}
+
+	// Swap the signatures of both JWS
+	first := strings.Split(string(signatures[0].Envelope()), ".")
+	second := strings.Split(string(signatures[1].Envelope()), ".")
+	forged := strings.Join([]string{second[0], second[1], first[2]}, ".")
+	query, err = queries.NewVerifySignatureQuery("device_id_0", forged, nil, nil, "", nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err = handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !errors.Is(verification.Err, crypto.ErrInvalidSignature) {
+		t.Fatal("Expected", crypto.ErrInvalidSignature, "got", verification.Err)
+	}
+}
+
+func Test_VerifySignatureQueryHandler_Handle_Raw(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	signatures := newJWSSignatures(t, repository)
+	handler := queries.VerifySignatureQueryHandler{DeviceRepository: repository, VerifierResolver: ed25519Verifiers}
+
+	// The JWS signature is over the JWS signing input, not over the bare secured data
+	query, err := queries.NewVerifySignatureQuery("device_id_0", "", nil, nil, signatures[0].RawData(), signatures[0].Value())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if verification.Valid() {
+		t.Fatal("Expected an invalid raw signature")
+	}
+}
+
+func Test_VerifySignatureQueryHandler_Handle_PreviousSignature(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	keyPair, err := (&crypto.Ed25519Provider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ed25519", "", keyPair.Public, keyPair.Private,
+		domain.WithChainingMode(domain.ChainingModeHash),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatureHandler := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmEd25519: &crypto.Ed25519SignerFactory{},
+		},
+	}
+	cmd, err := commands.NewCreateSignatureBatchCommand(device.ID(), "", []commands.SignaturePayload{
+		{Data: []byte("data_0")}, {Data: []byte("data_1")},
+	}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatures, err := signatureHandler.HandleBatch(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	handler := queries.VerifySignatureQueryHandler{DeviceRepository: repository, VerifierResolver: ed25519Verifiers}
+
+	tests := []struct {
+		previous domain.Signature
+		expected error
+	}{
+		{signatures[0], nil},
+		{signatures[1], domain.ErrSignatureCounterMismatch},
+	}
+	for _, test := range tests {
+		query, err := queries.NewVerifySignatureQuery("device_id_0", "", nil, nil, signatures[1].RawData(), signatures[1].Value())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		query, err = query.WithPreviousSignature(test.previous.RawData(), test.previous.Value())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		verification, err := handler.Handle(context.Background(), query)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if !errors.Is(verification.Err, test.expected) {
+			t.Fatal("Expected", test.expected, "got", verification.Err)
+		}
+	}
+}
+
+func Test_NewVerifySignatureQuery_Ambiguous(t *testing.T) {
+	_, err := queries.NewVerifySignatureQuery("device_id_0", "a.b.c", nil, nil, "data", []byte("signature"))
+	if !errors.Is(err, queries.ErrAmbiguousSignature) {
+		t.Fatal("Expected", queries.ErrAmbiguousSignature, "got", err)
+	}
+}
+
+func Test_VerifySignatureQueryHandler_Handle_CMS(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	createDevice := commands.CreateDeviceCommandHandler{
+		DeviceRepository:    repository,
+		KeyProviderResolver: map[string]crypto.Provider{"ecdsa": &crypto.ECDSAProvider{}},
+		CertificateIssuer:   authority,
+	}
+	createDeviceCmd, err := commands.NewCreateDeviceCommand("ecdsa", "", "", "cms", "", false)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := createDevice.Handle(context.Background(), createDeviceCmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	createSignature := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmECDSA: &crypto.ECDSASignerFactory{},
+		},
+	}
+	createSignatureCmd, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_0")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := createSignature.Handle(context.Background(), createSignatureCmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	verifiers := map[domain.SigningAlgorithm]crypto.Verifier{domain.SigningAlgorithmECDSA: &crypto.ECDSAVerifier{}}
+	audit := queries.AuditDeviceQueryHandler{DeviceRepository: repository, VerifierResolver: verifiers}
+	auditQuery, err := queries.NewAuditDeviceQuery(device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	report, err := audit.Handle(context.Background(), auditQuery)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !report.Valid() {
+		t.Fatal("Expected a valid report, got", report.Findings)
+	}
+
+	handler := queries.VerifySignatureQueryHandler{DeviceRepository: repository, VerifierResolver: verifiers}
+	query, err := queries.NewVerifySignatureQuery(device.ID(), "", nil, signature.Envelope(), signature.RawData(), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !verification.Valid() || verification.Format != domain.SignatureFormatCMS {
+		t.Fatal("Expected a valid cms signature, got", verification.Format, verification.Err)
+	}
+
+	query, err = queries.NewVerifySignatureQuery(device.ID(), "", nil, signature.Envelope(), "tampered", nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err = handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !errors.Is(verification.Err, cms.ErrDigestMismatch) {
+		t.Fatal("Expected", cms.ErrDigestMismatch, "got", verification.Err)
+	}
+}
+
+func Test_VerifySignatureQueryHandler_Handle_COSE(t *testing.T) {
+	repository := persistence.NewInMemoryDeviceRepository()
+	keyPair, err := (&crypto.Ed25519Provider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ed25519", "", keyPair.Public, keyPair.Private,
+		domain.WithSignatureFormat(domain.SignatureFormatCOSE),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	createSignature := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmEd25519: &crypto.Ed25519SignerFactory{},
+		},
+	}
+	cmd, err := commands.NewCreateSignatureBatchCommand(device.ID(), "", []commands.SignaturePayload{
+		{Data: []byte("data_0")}, {Data: []byte("data_1")},
+	}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatures, err := createSignature.HandleBatch(context.Background(), cmd)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	audit := queries.AuditDeviceQueryHandler{DeviceRepository: repository, VerifierResolver: ed25519Verifiers}
+	auditQuery, err := queries.NewAuditDeviceQuery(device.ID())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	report, err := audit.Handle(context.Background(), auditQuery)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !report.Valid() {
+		t.Fatal("Expected a valid report, got", report.Findings)
+	}
+
+	handler := queries.VerifySignatureQueryHandler{DeviceRepository: repository, VerifierResolver: ed25519Verifiers}
+	query, err := queries.NewVerifySignatureQuery(device.ID(), "", signatures[1].Envelope(), nil, "", nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err := handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !verification.Valid() || verification.Format != domain.SignatureFormatCOSE || verification.SecuredData.Counter != 1 {
+		t.Fatal("Expected a valid cose signature of counter 1, got", verification.Format, verification.Err)
+	}
+
+	// The payload of the second message under the signature of the first one
+	first, _ := cose.Parse(signatures[0].Envelope())
+	forged, _ := cose.Parse(signatures[1].Envelope())
+	forged.Signature = first.Signature
+	encoded, err := forged.Encode()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	query, err = queries.NewVerifySignatureQuery(device.ID(), "", encoded, nil, "", nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	verification, err = handler.Handle(context.Background(), query)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !errors.Is(verification.Err, crypto.ErrInvalidSignature) {
+		t.Fatal("Expected", crypto.ErrInvalidSignature, "got", verification.Err)
+	}
+}
@@ -0,0 +1,172 @@
+package cms_test
+
+import (
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+)
+
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) Sign(data []byte) ([]byte, error) {
+	digest := sha512.Sum384(data)
+	return ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+}
+
+func newTestCertificate(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return certificate, key
+}
+
+func Test_Sign_Detached_RoundTrip(t *testing.T) {
+	certificate, key := newTestCertificate(t)
+	content := []byte("data_to_be_signed")
+	signingTime := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	counterType := asn1.ObjectIdentifier{2, 25, 1}
+
+	der, err := cms.Sign(content, ecdsaSigner{key}, cms.SignOptions{
+		Detached:    true,
+		Certificate: certificate,
+		Hash:        stdcrypto.SHA384,
+		SignedAttributes: []cms.Attribute{
+			{Type: cms.OIDAttributeSigningTime, Value: signingTime},
+			{Type: counterType, Value: 7},
+		},
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signedData, err := cms.Parse(der)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if signedData.Content != nil {
+		t.Fatal("Expected no content, got", signedData.Content)
+	}
+	if err := signedData.Verify(content); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	parsedTime, err := signedData.SigningTime()
+	if err != nil || !parsedTime.Equal(signingTime) {
+		t.Fatal("Expected signing time to be", signingTime, "got", parsedTime, err)
+	}
+	var counter int
+	if err := signedData.UnmarshalAttribute(counterType, &counter); err != nil || counter != 7 {
+		t.Fatal("Expected counter to be 7, got", counter, err)
+	}
+
+	err = signedData.Verify([]byte("tampered"))
+	if err == nil || !errors.Is(err, cms.ErrDigestMismatch) {
+		t.Fatal("Expected error to be", cms.ErrDigestMismatch, "got", err)
+	}
+}
+
+func Test_Sign_Attached_RoundTrip(t *testing.T) {
+	certificate, key := newTestCertificate(t)
+	content := []byte("data_to_be_signed")
+
+	der, err := cms.Sign(content, ecdsaSigner{key}, cms.SignOptions{
+		Certificate: certificate,
+		Hash:        stdcrypto.SHA384,
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signedData, err := cms.Parse(der)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if string(signedData.Content) != string(content) {
+		t.Fatal("Expected content to be", string(content), "got", string(signedData.Content))
+	}
+	if err := signedData.Verify(nil); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
+
+type rsaPSSSigner struct {
+	key *rsa.PrivateKey
+}
+
+func (s rsaPSSSigner) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return rsa.SignPSS(rand.Reader, s.key, stdcrypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+}
+
+func Test_Sign_RSAPSS_RoundTrip(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	certificate, err := x509.ParseCertificate(certificateDER)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	content := []byte("data_to_be_signed")
+
+	der, err := cms.Sign(content, rsaPSSSigner{key}, cms.SignOptions{
+		Detached:    true,
+		Certificate: certificate,
+		Hash:        stdcrypto.SHA256,
+		PSS:         true,
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signedData, err := cms.Parse(der)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := signedData.Verify(content); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if len(signedData.Signature()) != key.Size() {
+		t.Fatal("Expected a signature of", key.Size(), "bytes, got", len(signedData.Signature()))
+	}
+}
@@ -0,0 +1,197 @@
+package cms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+// SignOptions describe the SignedData to produce.
+type SignOptions struct {
+	// ContentType of the signed content, OIDData if unset.
+	ContentType asn1.ObjectIdentifier
+	// Detached leaves the content out of the SignedData.
+	Detached bool
+	// Certificate of the signer. Its public key determines the signature algorithm.
+	Certificate *x509.Certificate
+	// Chain holds further certificates to include, e.g. intermediate CAs.
+	Chain []*x509.Certificate
+	// Hash must be the digest algorithm used by the Signer.
+	Hash crypto.Hash
+	// PSS tells an RSA Signer makes RSASSA-PSS signatures, with a salt as long as the hash.
+	PSS bool
+	// SignedAttributes are signed along with the content type and the message digest.
+	SignedAttributes []Attribute
+}
+
+// Sign produces a DER encoded ContentInfo holding a SignedData over content,
+// with a single signer identified by its issuer and serial number.
+func Sign(content []byte, signer Signer, options SignOptions) ([]byte, error) {
+	if options.Certificate == nil {
+		return nil, errors.New("missing signer certificate")
+	}
+	contentType := options.ContentType
+	if contentType == nil {
+		contentType = OIDData
+	}
+
+	digestAlgorithm, err := digestOID(options.Hash)
+	if err != nil {
+		return nil, err
+	}
+	signatureAlgorithm, err := signatureAlgorithmFor(options.Certificate.PublicKey, options.Hash, options.PSS)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := options.Hash.New()
+	digest.Write(content)
+	attributes := append([]Attribute{
+		{Type: OIDAttributeContentType, Value: contentType},
+		{Type: OIDAttributeMessageDigest, Value: digest.Sum(nil)},
+	}, options.SignedAttributes...)
+	signedAttributes, err := marshalAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the attributes with their universal SET tag,
+	// even though they are stored with an implicit [0] tag.
+	signature, err := signer.Sign(signedAttributes.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: options.Certificate.RawIssuer},
+		SerialNumber: options.Certificate.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var certificates []byte
+	for _, certificate := range append([]*x509.Certificate{options.Certificate}, options.Chain...) {
+		certificates = append(certificates, certificate.Raw...)
+	}
+
+	encapsulated := encapsulatedContentInfo{EContentType: contentType}
+	if !options.Detached {
+		encapsulated.EContent = content
+	}
+
+	version := 1
+	if !contentType.Equal(OIDData) {
+		version = 3
+	}
+	sd := signedData{
+		Version:          version,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: digestAlgorithm}},
+		EncapContentInfo: encapsulated,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: digestAlgorithm},
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttributes.Bytes},
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+	encoded, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: encoded},
+	})
+}
+
+// marshalAttributes encodes the attributes as a DER SET OF, sorted as DER requires.
+func marshalAttributes(attributes []Attribute) (asn1.RawValue, error) {
+	encoded := make([]attribute, 0, len(attributes))
+	for _, a := range attributes {
+		value, err := asn1.Marshal(a.Value)
+		if err != nil {
+			return asn1.RawValue{}, fmt.Errorf("attribute %v: %w", a.Type, err)
+		}
+		encoded = append(encoded, attribute{Type: a.Type, Values: []asn1.RawValue{{FullBytes: value}}})
+	}
+
+	set, err := asn1.MarshalWithParams(encoded, "set")
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(set, &raw); err != nil {
+		return asn1.RawValue{}, err
+	}
+	return raw, nil
+}
+
+func signatureAlgorithmFor(publicKey crypto.PublicKey, hash crypto.Hash, pss bool) (pkix.AlgorithmIdentifier, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		if pss {
+			return PSSAlgorithm(hash)
+		}
+		identifier := pkix.AlgorithmIdentifier{Parameters: asn1.NullRawValue}
+		switch hash {
+		case crypto.SHA256:
+			identifier.Algorithm = oidSignatureSHA256WithRSA
+		case crypto.SHA384:
+			identifier.Algorithm = oidSignatureSHA384WithRSA
+		case crypto.SHA512:
+			identifier.Algorithm = oidSignatureSHA512WithRSA
+		default:
+			return pkix.AlgorithmIdentifier{}, ErrUnsupportedAlgorithm
+		}
+		return identifier, nil
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, nil
+		case crypto.SHA384:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, nil
+		case crypto.SHA512:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}, nil
+		}
+	case ed25519.PublicKey:
+		// RFC 8419: the signed attributes are signed as is, their digest must be SHA-512
+		if hash == crypto.SHA512 {
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureEd25519}, nil
+		}
+	}
+	return pkix.AlgorithmIdentifier{}, ErrUnsupportedAlgorithm
+}
+
+// PSSAlgorithm identifies RSASSA-PSS signatures over hash with MGF1 over the same hash
+// and a salt as long as the hash.
+func PSSAlgorithm(hash crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	digestAlgorithm, err := digestOID(hash)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	hashIdentifier := pkix.AlgorithmIdentifier{Algorithm: digestAlgorithm, Parameters: asn1.NullRawValue}
+	mgfParameters, err := asn1.Marshal(hashIdentifier)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	parameters, err := asn1.Marshal(pssParameters{
+		Hash:       hashIdentifier,
+		MGF:        pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfParameters}},
+		SaltLength: hash.Size(),
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidSignatureRSAPSS, Parameters: asn1.RawValue{FullBytes: parameters}}, nil
+}
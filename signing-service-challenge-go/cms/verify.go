@@ -0,0 +1,228 @@
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SignedData is a parsed CMS SignedData with a single signer.
+type SignedData struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is nil for detached signatures.
+	Content      []byte
+	Certificates []*x509.Certificate
+
+	signer     signerInfo
+	attributes []attribute
+}
+
+// Parse decodes a DER encoded ContentInfo holding a SignedData.
+func Parse(der []byte) (*SignedData, error) {
+	var info contentInfo
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSignedData, err)
+	}
+	if len(rest) > 0 || !info.ContentType.Equal(OIDSignedData) {
+		return nil, ErrInvalidSignedData
+	}
+
+	var sd signedData
+	if rest, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil || len(rest) > 0 {
+		return nil, errors.Join(ErrInvalidSignedData, err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: expected 1 signer, got %d", ErrInvalidSignedData, len(sd.SignerInfos))
+	}
+
+	certificates, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSignedData, err)
+	}
+
+	var attributes []attribute
+	if len(sd.SignerInfos[0].SignedAttrs.Bytes) > 0 {
+		// Re-tag the attributes as a SET OF to decode them
+		set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: sd.SignerInfos[0].SignedAttrs.Bytes})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := asn1.UnmarshalWithParams(set, &attributes, "set"); err != nil {
+			return nil, errors.Join(ErrInvalidSignedData, err)
+		}
+	}
+
+	return &SignedData{
+		ContentType:  sd.EncapContentInfo.EContentType,
+		Content:      sd.EncapContentInfo.EContent,
+		Certificates: certificates,
+		signer:       sd.SignerInfos[0],
+		attributes:   attributes,
+	}, nil
+}
+
+// Signer returns the certificate of the signer, among the included ones.
+func (s *SignedData) Signer() (*x509.Certificate, error) {
+	sid := s.signer.SID
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, certificate := range s.Certificates {
+			if bytes.Equal(certificate.SubjectKeyId, sid.Bytes) {
+				return certificate, nil
+			}
+		}
+		return nil, ErrSignerNotFound
+	}
+
+	var issuerAndSerial issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(sid.FullBytes, &issuerAndSerial); err != nil {
+		return nil, errors.Join(ErrInvalidSignedData, err)
+	}
+	for _, certificate := range s.Certificates {
+		if bytes.Equal(certificate.RawIssuer, issuerAndSerial.Issuer.FullBytes) && certificate.SerialNumber.Cmp(issuerAndSerial.SerialNumber) == 0 {
+			return certificate, nil
+		}
+	}
+	return nil, ErrSignerNotFound
+}
+
+// Verify checks the signature over the encapsulated content, or over
+// detachedContent when the SignedData has none. It doesn't check the
+// signer certificate is trusted.
+func (s *SignedData) Verify(detachedContent []byte) error {
+	content := s.Content
+	if content == nil {
+		content = detachedContent
+	}
+	if content == nil {
+		return fmt.Errorf("%w: missing content", ErrInvalidSignedData)
+	}
+
+	certificate, err := s.Signer()
+	if err != nil {
+		return err
+	}
+	hash, err := digestHash(s.signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	algorithm, err := x509SignatureAlgorithm(s.signer.SignatureAlgorithm, hash)
+	if err != nil {
+		return err
+	}
+
+	signed := content
+	if s.attributes != nil {
+		var contentType asn1.ObjectIdentifier
+		if err := s.UnmarshalAttribute(OIDAttributeContentType, &contentType); err != nil || !contentType.Equal(s.ContentType) {
+			return fmt.Errorf("%w: content type attribute mismatch", ErrInvalidSignedData)
+		}
+		var messageDigest []byte
+		if err := s.UnmarshalAttribute(OIDAttributeMessageDigest, &messageDigest); err != nil {
+			return err
+		}
+		digest := hash.New()
+		digest.Write(content)
+		if !bytes.Equal(digest.Sum(nil), messageDigest) {
+			return ErrDigestMismatch
+		}
+
+		signed, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: s.signer.SignedAttrs.Bytes})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := certificate.CheckSignature(algorithm, signed, s.signer.Signature); err != nil {
+		return errors.Join(ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// UnmarshalAttribute decodes the value of the signed attribute with the given type into out.
+func (s *SignedData) UnmarshalAttribute(attributeType asn1.ObjectIdentifier, out interface{}) error {
+	for _, a := range s.attributes {
+		if !a.Type.Equal(attributeType) {
+			continue
+		}
+		if len(a.Values) != 1 {
+			return fmt.Errorf("%w: attribute %v must have a single value", ErrInvalidSignedData, attributeType)
+		}
+		if _, err := asn1.Unmarshal(a.Values[0].FullBytes, out); err != nil {
+			return errors.Join(ErrInvalidSignedData, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrAttributeNotFound, attributeType)
+}
+
+// Signature returns the signature value of the signer.
+func (s *SignedData) Signature() []byte {
+	return s.signer.Signature
+}
+
+// SigningTime returns the signing time attribute, if any.
+func (s *SignedData) SigningTime() (time.Time, error) {
+	var signingTime time.Time
+	err := s.UnmarshalAttribute(OIDAttributeSigningTime, &signingTime)
+	return signingTime, err
+}
+
+func x509SignatureAlgorithm(identifier pkix.AlgorithmIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	oid := identifier.Algorithm
+	switch {
+	case oid.Equal(oidSignatureSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSignatureSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSignatureSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidSignatureECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidSignatureECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidSignatureECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	case oid.Equal(oidSignatureEd25519):
+		return x509.PureEd25519, nil
+	case oid.Equal(oidSignatureRSAPSS):
+		return pssSignatureAlgorithm(identifier.Parameters.FullBytes)
+	case oid.Equal(oidSignatureRSA):
+		// Commonly used instead of the combined identifiers, the digest algorithm tells the hash
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, ErrUnsupportedAlgorithm
+}
+
+// pssSignatureAlgorithm maps RSASSA-PSS parameters to the signature algorithms of crypto/x509,
+// which only verify salts as long as the hash.
+func pssSignatureAlgorithm(parameters []byte) (x509.SignatureAlgorithm, error) {
+	var params pssParameters
+	if _, err := asn1.Unmarshal(parameters, &params); err != nil {
+		return x509.UnknownSignatureAlgorithm, errors.Join(ErrInvalidSignedData, err)
+	}
+	hash, err := digestHash(params.Hash.Algorithm)
+	if err != nil || params.SaltLength != hash.Size() {
+		return x509.UnknownSignatureAlgorithm, ErrUnsupportedAlgorithm
+	}
+	switch hash {
+	case crypto.SHA256:
+		return x509.SHA256WithRSAPSS, nil
+	case crypto.SHA384:
+		return x509.SHA384WithRSAPSS, nil
+	default:
+		return x509.SHA512WithRSAPSS, nil
+	}
+}
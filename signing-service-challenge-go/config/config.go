@@ -0,0 +1,310 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// Config holds all the settings of the service.
+// Fields tagged with `secret:"true"` are redacted when printed.
+type Config struct {
+	Server       ServerConfig       `yaml:"server"`
+	TLS          TLSConfig          `yaml:"tls"`
+	Storage      StorageConfig      `yaml:"storage"`
+	Crypto       CryptoConfig       `yaml:"crypto"`
+	Signing      SigningConfig      `yaml:"signing"`
+	Transactions TransactionsConfig `yaml:"transactions"`
+	Timestamping TimestampingConfig `yaml:"timestamping"`
+	Certificates CertificatesConfig `yaml:"certificates"`
+	Receipts     ReceiptsConfig     `yaml:"receipts"`
+	Transparency TransparencyConfig `yaml:"transparency"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit"`
+	Logging      LoggingConfig      `yaml:"logging"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	ListenAddress     string        `yaml:"listen_address"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+}
+
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile enables verifying client certificates, which then identify the clients.
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+type StorageConfig struct {
+	Backend string `yaml:"backend"`
+	DSN     string `yaml:"dsn" secret:"true"`
+}
+
+type CryptoConfig struct {
+	Algorithms []string `yaml:"algorithms"`
+	RSAKeySize int      `yaml:"rsa_key_size"`
+	ECDSACurve string   `yaml:"ecdsa_curve"`
+	// KEKFile holds the base64 encoded AES-256 key encryption key wrapping the device private keys.
+	// A throwaway one is generated on startup when unset.
+	KEKFile string `yaml:"kek_file"`
+}
+
+type SigningConfig struct {
+	MaxRetries int `yaml:"max_retries"`
+}
+
+type TransactionsConfig struct {
+	// Timeout is how long transactions are kept open without steps.
+	Timeout time.Duration `yaml:"timeout"`
+	// SweepInterval is how often the timed out transactions are expired.
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+}
+
+// TimestampingConfig selects the RFC 3161 authority timestamping the signatures.
+type TimestampingConfig struct {
+	// Mode is one of "none", "local" for the built-in authority or "remote".
+	Mode string `yaml:"mode"`
+	// URL of the remote authority.
+	URL     string        `yaml:"url"`
+	Timeout time.Duration `yaml:"timeout"`
+	// CAFile holds the certificates trusted to issue tokens, checked on audits.
+	// It is required in remote mode. The certificate of the built-in authority is always trusted.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile hold the identity of the built-in authority.
+	// A throwaway one is generated on startup when unset.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Policy is the OID of the tokens issued by the built-in authority.
+	Policy string `yaml:"policy"`
+}
+
+// CertificatesConfig sets up the internal CA issuing the device certificates.
+type CertificatesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CACertFile and CAKeyFile hold the identity of the CA. The certificates following
+	// the CA certificate in CACertFile are served as its chain.
+	// A throwaway CA is generated on startup when unset.
+	CACertFile string `yaml:"ca_cert_file"`
+	CAKeyFile  string `yaml:"ca_key_file"`
+	// Validity of the issued certificates.
+	Validity time.Duration `yaml:"validity"`
+}
+
+// ReceiptsConfig sets up the QR codes of the signatures printed on receipts.
+type ReceiptsConfig struct {
+	// DefaultTemplate names the payload layout used unless requested otherwise, the built-in
+	// "default" layout if empty. The service checks it names a known layout on startup.
+	DefaultTemplate string `yaml:"default_template"`
+	// Templates are additional payload layouts by name, written as Go text templates.
+	// The built-in "default" and "rksv" layouts cannot be overridden.
+	Templates map[string]string `yaml:"templates"`
+	// ErrorCorrection is the QR code error correction level, one of L, M, Q or H.
+	ErrorCorrection string `yaml:"error_correction"`
+}
+
+// TransparencyConfig sets up the Merkle tree log all the signatures are appended to.
+type TransparencyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// KeyFile holds the PEM encoded private key signing the tree heads.
+	// A throwaway key is generated on startup when unset.
+	KeyFile string `yaml:"key_file"`
+	// PublishInterval is how often a new tree head is signed, if signatures were logged meanwhile.
+	PublishInterval time.Duration `yaml:"publish_interval"`
+}
+
+type RateLimitConfig struct {
+	Enabled   bool            `yaml:"enabled"`
+	PerClient RateLimitBucket `yaml:"per_client"`
+	PerDevice RateLimitBucket `yaml:"per_device"`
+}
+
+// RateLimitBucket describes a token bucket refilled at Rate tokens per second and holding up to Burst tokens.
+type RateLimitBucket struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type LoggingConfig struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+}
+
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// OTLPEndpoint overrides the standard OTEL_EXPORTER_OTLP_ENDPOINT variable.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+}
+
+const (
+	StorageBackendMemory = "memory"
+
+	TimestampingModeNone   = "none"
+	TimestampingModeLocal  = "local"
+	TimestampingModeRemote = "remote"
+)
+
+// Default returns the configuration used when nothing else is specified.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddress:     ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      40 * time.Second,
+			IdleTimeout:       120 * time.Second,
+		},
+		Storage: StorageConfig{
+			Backend: StorageBackendMemory,
+		},
+		Crypto: CryptoConfig{
+			Algorithms: []string{"rsa", "ecdsa", "rsa-pss", "ed25519"},
+			RSAKeySize: 2048,
+			ECDSACurve: "P-384",
+		},
+		Signing: SigningConfig{
+			MaxRetries: 3,
+		},
+		Transactions: TransactionsConfig{
+			Timeout:       15 * time.Minute,
+			SweepInterval: time.Minute,
+		},
+		Timestamping: TimestampingConfig{
+			Mode:    TimestampingModeNone,
+			Timeout: 5 * time.Second,
+			Policy:  "1.2.3.4.1",
+		},
+		Certificates: CertificatesConfig{
+			Enabled:  true,
+			Validity: 3 * 365 * 24 * time.Hour,
+		},
+		Receipts: ReceiptsConfig{
+			ErrorCorrection: "M",
+		},
+		Transparency: TransparencyConfig{
+			Enabled:         true,
+			PublishInterval: time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   false,
+			PerClient: RateLimitBucket{Rate: 50, Burst: 100},
+			PerDevice: RateLimitBucket{Rate: 20, Burst: 40},
+		},
+		Logging: LoggingConfig{
+			Format: "json",
+			Level:  "info",
+		},
+	}
+}
+
+// Validate checks the configuration is consistent, reporting all the problems found.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.ListenAddress != "", "server.listen_address is required")
+	check(c.Server.ReadHeaderTimeout >= 0, "server.read_header_timeout must not be negative")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+
+	if c.TLS.Enabled {
+		check(c.TLS.CertFile != "", "tls.cert_file is required when TLS is enabled")
+		check(c.TLS.KeyFile != "", "tls.key_file is required when TLS is enabled")
+	} else {
+		check(c.TLS.ClientCAFile == "", "tls.client_ca_file requires TLS to be enabled")
+	}
+
+	check(c.Storage.Backend == StorageBackendMemory, "storage.backend %q is not supported", c.Storage.Backend)
+
+	check(len(c.Crypto.Algorithms) > 0, "crypto.algorithms must not be empty")
+	for _, algorithm := range c.Crypto.Algorithms {
+		switch algorithm {
+		case "rsa", "ecdsa", "rsa-pss", "ed25519":
+		default:
+			check(false, "crypto.algorithms: %q is not supported", algorithm)
+		}
+	}
+	check(c.Crypto.RSAKeySize >= 512 && c.Crypto.RSAKeySize%8 == 0, "crypto.rsa_key_size must be a multiple of 8 and at least 512")
+	check(c.Crypto.ECDSACurve == "P-256" || c.Crypto.ECDSACurve == "P-384" || c.Crypto.ECDSACurve == "P-521",
+		"crypto.ecdsa_curve must be one of P-256, P-384 or P-521")
+
+	check(c.Signing.MaxRetries > 0, "signing.max_retries must be positive")
+	check(c.Transactions.Timeout > 0, "transactions.timeout must be positive")
+	check(c.Transactions.SweepInterval > 0, "transactions.sweep_interval must be positive")
+
+	switch c.Timestamping.Mode {
+	case TimestampingModeNone:
+	case TimestampingModeLocal:
+		check((c.Timestamping.CertFile == "") == (c.Timestamping.KeyFile == ""), "timestamping.cert_file and timestamping.key_file must be given together")
+		check(isOID(c.Timestamping.Policy), "timestamping.policy must be a dotted OID")
+	case TimestampingModeRemote:
+		check(c.Timestamping.URL != "", "timestamping.url is required in remote mode")
+		check(c.Timestamping.CAFile != "", "timestamping.ca_file is required in remote mode")
+		check(c.Timestamping.Timeout > 0, "timestamping.timeout must be positive")
+	default:
+		check(false, "timestamping.mode must be one of none, local or remote")
+	}
+
+	if c.Certificates.Enabled {
+		check((c.Certificates.CACertFile == "") == (c.Certificates.CAKeyFile == ""), "certificates.ca_cert_file and certificates.ca_key_file must be given together")
+		check(c.Certificates.Validity > 0, "certificates.validity must be positive")
+	}
+
+	for name, layout := range c.Receipts.Templates {
+		check(name != "", "receipts.templates: %q is not a valid template name", name)
+		check(strings.TrimSpace(layout) != "", "receipts.templates: %q must not be empty", name)
+	}
+	switch c.Receipts.ErrorCorrection {
+	case "L", "M", "Q", "H":
+	default:
+		check(false, "receipts.error_correction must be one of L, M, Q or H")
+	}
+
+	if c.Transparency.Enabled {
+		check(c.Transparency.PublishInterval > 0, "transparency.publish_interval must be positive")
+	}
+
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.PerClient.Rate > 0 && c.RateLimit.PerClient.Burst > 0, "rate_limit.per_client rate and burst must be positive")
+		check(c.RateLimit.PerDevice.Rate > 0 && c.RateLimit.PerDevice.Burst > 0, "rate_limit.per_device rate and burst must be positive")
+	}
+
+	format := strings.ToLower(c.Logging.Format)
+	check(format == "json" || format == "text", "logging.format must be json or text")
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "logging.level must be one of debug, info, warn or error")
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrInvalidConfig}, errs...)...)
+	}
+	return nil
+}
+
+func isOID(value string) bool {
+	arcs := strings.Split(value, ".")
+	if len(arcs) < 2 {
+		return false
+	}
+	for _, arc := range arcs {
+		if _, err := strconv.Atoi(arc); err != nil || arc == "" || arc[0] == '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvPrefix prefixes the environment variables overriding settings,
+	// e.g. SIGNING_SERVER_LISTEN_ADDRESS overrides server.listen_address.
+	EnvPrefix = "SIGNING_"
+
+	redacted = "[REDACTED]"
+)
+
+// Options are the command line options which are not settings themselves.
+type Options struct {
+	ConfigFile  string
+	PrintConfig bool
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, the YAML file given with --config, the environment and the command line flags.
+// Every setting can be given as a flag named after its YAML path, e.g. --server.listen_address.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (Config, Options, error) {
+	cfg := Default()
+	fields := settings(&cfg)
+
+	var options Options
+	flagValues := make(map[string]string)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&options.ConfigFile, "config", "", "path to a YAML configuration file")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	for _, field := range fields {
+		path := field.path
+		flags.Func(path, field.usage(), func(value string) error {
+			flagValues[path] = value
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, Options{}, err
+	}
+
+	if options.ConfigFile == "" {
+		options.ConfigFile, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if options.ConfigFile != "" {
+		if err := loadFile(&cfg, options.ConfigFile); err != nil {
+			return Config{}, Options{}, err
+		}
+	}
+
+	for _, field := range fields {
+		if value, ok := lookupEnv(field.env()); ok {
+			if err := field.set(value); err != nil {
+				return Config{}, Options{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, field.env(), err)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if value, ok := flagValues[field.path]; ok {
+			if err := field.set(value); err != nil {
+				return Config{}, Options{}, fmt.Errorf("%w: --%s: %v", ErrInvalidConfig, field.path, err)
+			}
+		}
+	}
+
+	return cfg, options, cfg.Validate()
+}
+
+func loadFile(cfg *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	return nil
+}
+
+// Print writes the configuration as YAML, with secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	redactedConfig := c.Redacted()
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redactedConfig); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Redacted returns a copy of the configuration whose non-empty secrets are masked.
+func (c Config) Redacted() Config {
+	redactedConfig := c
+	redactedConfig.Crypto.Algorithms = append([]string(nil), c.Crypto.Algorithms...)
+	if c.Receipts.Templates != nil {
+		redactedConfig.Receipts.Templates = make(map[string]string, len(c.Receipts.Templates))
+		for name, layout := range c.Receipts.Templates {
+			redactedConfig.Receipts.Templates[name] = layout
+		}
+	}
+	for _, field := range settings(&redactedConfig) {
+		if field.secret && !field.value.IsZero() {
+			field.value.SetString(redacted)
+		}
+	}
+	return redactedConfig
+}
+
+// setting is a leaf of the configuration tree.
+type setting struct {
+	path   string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists all the leaves of the configuration, sorted by path.
+func settings(cfg *Config) []setting {
+	var result []setting
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			path := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(path, v.Field(i))
+				continue
+			}
+			result = append(result, setting{
+				path:   path,
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+
+	sort.Slice(result, func(i, j int) bool { return result[i].path < result[j].path })
+	return result
+}
+
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.path, ".", "_"))
+}
+
+func (s setting) usage() string {
+	return fmt.Sprintf("overrides %s (env %s)", s.path, s.env())
+}
+
+func (s setting) set(raw string) error {
+	switch s.value.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(d))
+		return nil
+	case []string:
+		var values []string
+		for _, value := range strings.Split(raw, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		s.value.Set(reflect.ValueOf(values))
+		return nil
+	case map[string]string:
+		// name=value entries separated by commas
+		values := make(map[string]string)
+		for _, entry := range strings.Split(raw, ",") {
+			if strings.TrimSpace(entry) == "" {
+				continue
+			}
+			name, value, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("expected name=value entries, got %q", entry)
+			}
+			values[strings.TrimSpace(name)] = value
+		}
+		s.value.Set(reflect.ValueOf(values))
+		return nil
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetBool(b)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(int64(i))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		s.value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
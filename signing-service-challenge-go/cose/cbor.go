@@ -0,0 +1,263 @@
+package cose
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The subset of CBOR (RFC 8949) COSE_Sign1 messages are made of: integers, byte and text
+// strings, arrays, maps and tags. Encoding is deterministic (RFC 8949, section 4.2.1):
+// arguments are as short as possible, lengths are definite and map keys are sorted by
+// their encoding.
+
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+)
+
+// maxDepth bounds the nesting of decoded items.
+const maxDepth = 16
+
+var ErrMalformedCBOR = errors.New("malformed CBOR")
+
+// tag is a tagged CBOR item.
+type tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// marshal encodes int, int64, []byte, string, []interface{}, map[interface{}]interface{}
+// and tag values.
+func marshal(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := encode(&buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func encode(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case int:
+		encodeInt(buffer, int64(v))
+	case int64:
+		encodeInt(buffer, v)
+	case []byte:
+		encodeHead(buffer, majorBytes, uint64(len(v)))
+		buffer.Write(v)
+	case string:
+		encodeHead(buffer, majorText, uint64(len(v)))
+		buffer.WriteString(v)
+	case []interface{}:
+		encodeHead(buffer, majorArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encode(buffer, item); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		return encodeMap(buffer, v)
+	case tag:
+		encodeHead(buffer, majorTag, v.Number)
+		return encode(buffer, v.Content)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrMalformedCBOR, value)
+	}
+	return nil
+}
+
+func encodeInt(buffer *bytes.Buffer, value int64) {
+	if value < 0 {
+		encodeHead(buffer, majorNegative, uint64(-(value + 1)))
+		return
+	}
+	encodeHead(buffer, majorUnsigned, uint64(value))
+}
+
+// encodeHead writes the initial byte of an item along with its argument, in its shortest form.
+func encodeHead(buffer *bytes.Buffer, major byte, argument uint64) {
+	switch {
+	case argument < 24:
+		buffer.WriteByte(major<<5 | byte(argument))
+	case argument <= math.MaxUint8:
+		buffer.Write([]byte{major<<5 | 24, byte(argument)})
+	case argument <= math.MaxUint16:
+		buffer.WriteByte(major<<5 | 25)
+		buffer.Write(binary.BigEndian.AppendUint16(nil, uint16(argument)))
+	case argument <= math.MaxUint32:
+		buffer.WriteByte(major<<5 | 26)
+		buffer.Write(binary.BigEndian.AppendUint32(nil, uint32(argument)))
+	default:
+		buffer.WriteByte(major<<5 | 27)
+		buffer.Write(binary.BigEndian.AppendUint64(nil, argument))
+	}
+}
+
+// encodeMap writes the entries sorted by the bytewise order of their encoded keys.
+func encodeMap(buffer *bytes.Buffer, m map[interface{}]interface{}) error {
+	type entry struct {
+		key, value []byte
+	}
+	entries := make([]entry, 0, len(m))
+	for key, value := range m {
+		encodedKey, err := marshal(key)
+		if err != nil {
+			return err
+		}
+		encodedValue, err := marshal(value)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{encodedKey, encodedValue})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	encodeHead(buffer, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		buffer.Write(e.key)
+		buffer.Write(e.value)
+	}
+	return nil
+}
+
+// unmarshal decodes a single item, the whole data. Integers are decoded as int64, and map
+// keys must be integers or text strings.
+func unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(data) {
+		return nil, fmt.Errorf("%w: trailing data", ErrMalformedCBOR)
+	}
+	return value, nil
+}
+
+type decoder struct {
+	data   []byte
+	offset int
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deep", ErrMalformedCBOR)
+	}
+	major, argument, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUnsigned:
+		if argument > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", ErrMalformedCBOR)
+		}
+		return int64(argument), nil
+	case majorNegative:
+		if argument > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", ErrMalformedCBOR)
+		}
+		return -1 - int64(argument), nil
+	case majorBytes, majorText:
+		content, err := d.read(argument)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorText {
+			return string(content), nil
+		}
+		return append([]byte(nil), content...), nil
+	case majorArray:
+		// Every item takes at least a byte
+		if argument > uint64(len(d.data)-d.offset) {
+			return nil, fmt.Errorf("%w: truncated array", ErrMalformedCBOR)
+		}
+		array := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		return array, nil
+	case majorMap:
+		if argument > uint64(len(d.data)-d.offset)/2 {
+			return nil, fmt.Errorf("%w: truncated map", ErrMalformedCBOR)
+		}
+		m := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key %T", ErrMalformedCBOR, key)
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("%w: duplicate map key %v", ErrMalformedCBOR, key)
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case majorTag:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return tag{Number: argument, Content: content}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported major type %d", ErrMalformedCBOR, major)
+}
+
+// head reads the initial byte of an item and its argument, which must be definite.
+func (d *decoder) head() (byte, uint64, error) {
+	initial, err := d.read(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	major, additional := initial[0]>>5, initial[0]&0x1f
+
+	switch {
+	case additional < 24:
+		return major, uint64(additional), nil
+	case additional <= 27:
+		argument, err := d.read(1 << (additional - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+		var value uint64
+		for _, b := range argument {
+			value = value<<8 | uint64(b)
+		}
+		return major, value, nil
+	}
+	return 0, 0, fmt.Errorf("%w: indefinite or reserved argument", ErrMalformedCBOR)
+}
+
+func (d *decoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.offset) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrMalformedCBOR)
+	}
+	content := d.data[d.offset : d.offset+int(n)]
+	d.offset += int(n)
+	return content, nil
+}
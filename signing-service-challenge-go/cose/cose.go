@@ -0,0 +1,240 @@
+// Package cose packages device signatures as COSE_Sign1 messages (RFC 9052), a compact
+// binary alternative to JWS meant for receipts and QR codes.
+package cose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	signingcrypto "github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+)
+
+// COSE algorithms (RFC 9053) of the device signatures.
+const (
+	AlgorithmES256 = -7
+	AlgorithmES384 = -35
+	AlgorithmES512 = -36
+	AlgorithmEdDSA = -8
+)
+
+// Header labels of the device signatures.
+const (
+	labelAlgorithm = 1
+	labelKeyID     = 4
+	// labelCounter is the signature counter of the device, a private header parameter.
+	labelCounter = "counter"
+)
+
+// tagSign1 is the CBOR tag of COSE_Sign1 messages.
+const tagSign1 = 18
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported COSE algorithm")
+	ErrMalformedSign1       = errors.New("malformed COSE_Sign1")
+	ErrAlgorithmMismatch    = errors.New("unexpected COSE algorithm")
+)
+
+// Header is the protected header of the device signatures.
+type Header struct {
+	Algorithm int
+	KeyID     string
+	Counter   int
+}
+
+// Sign1 is a signed COSE_Sign1 message.
+type Sign1 struct {
+	Header    Header
+	Payload   []byte
+	Signature []byte
+	// protected is the encoded protected header as signed, which may differ from
+	// the encoding of Header when parsed.
+	protected []byte
+}
+
+// AlgorithmOf is the COSE algorithm of the signatures of the crypto signers for the given key.
+// Only ECDSA and Ed25519 keys are supported.
+func AlgorithmOf(publicKey crypto.PublicKey) (int, error) {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return AlgorithmES256, nil
+		case 384:
+			return AlgorithmES384, nil
+		case 521:
+			return AlgorithmES512, nil
+		}
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, nil
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// Sign creates a COSE_Sign1 message of the payload. The signer must make signatures of the header algorithm.
+func Sign(signer signingcrypto.Signer, header Header, payload []byte) (Sign1, error) {
+	protected, err := marshal(map[interface{}]interface{}{
+		labelAlgorithm: header.Algorithm,
+		labelKeyID:     []byte(header.KeyID),
+		labelCounter:   header.Counter,
+	})
+	if err != nil {
+		return Sign1{}, err
+	}
+	message := Sign1{
+		Header:    header,
+		Payload:   payload,
+		protected: protected,
+	}
+
+	toBeSigned, err := message.SigningInput()
+	if err != nil {
+		return Sign1{}, err
+	}
+	signature, err := signer.Sign(toBeSigned)
+	if err != nil {
+		return Sign1{}, err
+	}
+	message.Signature, err = toCOSESignature(header.Algorithm, signature)
+	if err != nil {
+		return Sign1{}, err
+	}
+	return message, nil
+}
+
+// Parse decodes a COSE_Sign1 message, tagged or not.
+func Parse(data []byte) (Sign1, error) {
+	decoded, err := unmarshal(data)
+	if err != nil {
+		return Sign1{}, errors.Join(ErrMalformedSign1, err)
+	}
+	if tagged, ok := decoded.(tag); ok {
+		if tagged.Number != tagSign1 {
+			return Sign1{}, fmt.Errorf("%w: unexpected tag %d", ErrMalformedSign1, tagged.Number)
+		}
+		decoded = tagged.Content
+	}
+
+	array, ok := decoded.([]interface{})
+	if !ok || len(array) != 4 {
+		return Sign1{}, fmt.Errorf("%w: expected an array of 4 items", ErrMalformedSign1)
+	}
+	protected, ok := array[0].([]byte)
+	if !ok {
+		return Sign1{}, fmt.Errorf("%w: protected header", ErrMalformedSign1)
+	}
+	if _, ok := array[1].(map[interface{}]interface{}); !ok {
+		return Sign1{}, fmt.Errorf("%w: unprotected header", ErrMalformedSign1)
+	}
+	payload, ok := array[2].([]byte)
+	if !ok {
+		return Sign1{}, fmt.Errorf("%w: payload must be attached", ErrMalformedSign1)
+	}
+	signature, ok := array[3].([]byte)
+	if !ok {
+		return Sign1{}, fmt.Errorf("%w: signature", ErrMalformedSign1)
+	}
+
+	header, err := parseHeader(protected)
+	if err != nil {
+		return Sign1{}, err
+	}
+	return Sign1{
+		Header:    header,
+		Payload:   payload,
+		Signature: signature,
+		protected: protected,
+	}, nil
+}
+
+func parseHeader(protected []byte) (Header, error) {
+	if len(protected) == 0 {
+		return Header{}, fmt.Errorf("%w: missing protected header", ErrMalformedSign1)
+	}
+	decoded, err := unmarshal(protected)
+	if err != nil {
+		return Header{}, errors.Join(ErrMalformedSign1, err)
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return Header{}, fmt.Errorf("%w: protected header", ErrMalformedSign1)
+	}
+
+	var header Header
+	if algorithm, ok := m[int64(labelAlgorithm)].(int64); ok {
+		header.Algorithm = int(algorithm)
+	}
+	if keyID, ok := m[int64(labelKeyID)].([]byte); ok {
+		header.KeyID = string(keyID)
+	}
+	if counter, ok := m[labelCounter].(int64); ok {
+		header.Counter = int(counter)
+	}
+	return header, nil
+}
+
+// SigningInput is the Sig_structure the signature is made over, without external data.
+func (s Sign1) SigningInput() ([]byte, error) {
+	return marshal([]interface{}{"Signature1", s.protected, []byte{}, s.Payload})
+}
+
+// Encode is the tagged COSE_Sign1 message, with an empty unprotected header.
+func (s Sign1) Encode() ([]byte, error) {
+	return marshal(tag{
+		Number:  tagSign1,
+		Content: []interface{}{s.protected, map[interface{}]interface{}{}, s.Payload, s.Signature},
+	})
+}
+
+// Verify checks the message is signed with the given algorithm by the key of the public key.
+// The verifier must check signatures of that algorithm.
+func (s Sign1) Verify(algorithm int, verifier signingcrypto.Verifier, publicKey []byte) error {
+	if s.Header.Algorithm != algorithm {
+		return ErrAlgorithmMismatch
+	}
+	signature, err := fromCOSESignature(algorithm, s.Signature)
+	if err != nil {
+		return err
+	}
+	toBeSigned, err := s.SigningInput()
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(publicKey, toBeSigned, signature)
+}
+
+// ecdsaSize is the size of the coordinates of the curve of ECDSA algorithms, 0 for EdDSA.
+func ecdsaSize(algorithm int) (int, error) {
+	switch algorithm {
+	case AlgorithmEdDSA:
+		return 0, nil
+	case AlgorithmES256:
+		return 32, nil
+	case AlgorithmES384:
+		return 48, nil
+	case AlgorithmES512:
+		return 66, nil
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// toCOSESignature turns the ASN.1 ECDSA signatures of the crypto signers into the
+// fixed size R || S concatenation of COSE. EdDSA signatures are kept as is.
+func toCOSESignature(algorithm int, signature []byte) ([]byte, error) {
+	size, err := ecdsaSize(algorithm)
+	if err != nil || size == 0 {
+		return signature, err
+	}
+	return signingcrypto.ConcatECDSASignature(signature, size)
+}
+
+// fromCOSESignature is the inverse of toCOSESignature.
+func fromCOSESignature(algorithm int, signature []byte) ([]byte, error) {
+	size, err := ecdsaSize(algorithm)
+	if err != nil || size == 0 {
+		return signature, err
+	}
+	return signingcrypto.ASN1ECDSASignature(signature, size)
+}
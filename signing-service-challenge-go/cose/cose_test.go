@@ -0,0 +1,118 @@
+package cose_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cose"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+)
+
+type algorithm struct {
+	provider      crypto.Provider
+	signerFactory crypto.SignerFactory
+	verifier      crypto.Verifier
+	coseAlgorithm int
+}
+
+var algorithms = map[string]algorithm{
+	"ecdsa":   {&crypto.ECDSAProvider{}, &crypto.ECDSASignerFactory{}, &crypto.ECDSAVerifier{}, cose.AlgorithmES384},
+	"ed25519": {&crypto.Ed25519Provider{}, &crypto.Ed25519SignerFactory{}, &crypto.Ed25519Verifier{}, cose.AlgorithmEdDSA},
+}
+
+func sign(t *testing.T, a algorithm, header cose.Header, payload []byte) (cose.Sign1, crypto.KeyPair) {
+	keyPair, err := a.provider.Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	publicKey, err := crypto.ParsePublicKey(keyPair.Public)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	header.Algorithm, err = cose.AlgorithmOf(publicKey)
+	if err != nil || header.Algorithm != a.coseAlgorithm {
+		t.Fatal("Expected", a.coseAlgorithm, "got", header.Algorithm, err)
+	}
+	signer, err := a.signerFactory.Build(context.Background(), keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	message, err := cose.Sign(signer, header, payload)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return message, keyPair
+}
+
+func Test_Sign1_RoundTrip(t *testing.T) {
+	for name, a := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			message, keyPair := sign(t, a, cose.Header{KeyID: "device_id_0:1", Counter: 3}, []byte("secured_data"))
+			encoded, err := message.Encode()
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			parsed, err := cose.Parse(encoded)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if parsed.Header != message.Header {
+				t.Fatal("Expected header", message.Header, "got", parsed.Header)
+			}
+			if string(parsed.Payload) != "secured_data" {
+				t.Fatal("Expected payload secured_data, got", string(parsed.Payload))
+			}
+			if err := parsed.Verify(a.coseAlgorithm, a.verifier, keyPair.Public); err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			parsed.Payload = []byte("tampered")
+			if err := parsed.Verify(a.coseAlgorithm, a.verifier, keyPair.Public); !errors.Is(err, crypto.ErrInvalidSignature) {
+				t.Fatal("Expected", crypto.ErrInvalidSignature, "got", err)
+			}
+		})
+	}
+}
+
+func Test_Sign1_Encode_Deterministic(t *testing.T) {
+	message, _ := sign(t, algorithms["ecdsa"], cose.Header{KeyID: "k", Counter: 3}, []byte("data"))
+	encoded, err := message.Encode()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	// Tag 18, array of 4, then the protected header {1: -35, 4: h'6b', "counter": 3}
+	// with its keys sorted by their encoding, an empty unprotected header and the payload
+	expected, _ := hex.DecodeString("d28450a301382204416b67636f756e74657203a04464617461")
+	if !bytes.HasPrefix(encoded, expected) {
+		t.Fatal("Expected prefix", hex.EncodeToString(expected), "got", hex.EncodeToString(encoded))
+	}
+	// 96 bytes R || S signature of ES384
+	if len(encoded) != len(expected)+2+96 {
+		t.Fatal("Expected", len(expected)+2+96, "bytes, got", len(encoded))
+	}
+}
+
+func Test_Parse_Malformed(t *testing.T) {
+	tests := map[string]string{
+		"empty":           "",
+		"not an array":    "a0",
+		"indefinite":      "9f40a04040ff",
+		"wrong tag":       "d38440a04040",
+		"trailing data":   "8440a0404000",
+		"detached":        "8440a0f640",
+		"missing headers": "8440a04040",
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, _ := hex.DecodeString(input)
+			if _, err := cose.Parse(data); !errors.Is(err, cose.ErrMalformedSign1) {
+				t.Fatal("Expected", cose.ErrMalformedSign1, "got", err)
+			}
+		})
+	}
+}
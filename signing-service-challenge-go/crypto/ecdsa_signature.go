@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"encoding/asn1"
+	"math/big"
+)
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ConcatECDSASignature turns an ASN.1 ECDSA signature, as made by ECDSASigner, into the
+// fixed size R || S concatenation of JOSE and COSE. Size is the byte size of the coordinates.
+func ConcatECDSASignature(signature []byte, size int) ([]byte, error) {
+	var parsed ecdsaSignature
+	if rest, err := asn1.Unmarshal(signature, &parsed); err != nil || len(rest) > 0 {
+		return nil, ErrInvalidSignature
+	}
+	if parsed.R.Sign() < 0 || parsed.S.Sign() < 0 || parsed.R.BitLen() > 8*size || parsed.S.BitLen() > 8*size {
+		return nil, ErrInvalidSignature
+	}
+	concatenated := make([]byte, 2*size)
+	parsed.R.FillBytes(concatenated[:size])
+	parsed.S.FillBytes(concatenated[size:])
+	return concatenated, nil
+}
+
+// ASN1ECDSASignature is the inverse of ConcatECDSASignature.
+func ASN1ECDSASignature(signature []byte, size int) ([]byte, error) {
+	if len(signature) != 2*size {
+		return nil, ErrInvalidSignature
+	}
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(signature[:size]),
+		S: new(big.Int).SetBytes(signature[size:]),
+	})
+}
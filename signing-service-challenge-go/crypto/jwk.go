@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is a public JSON Web Key (RFC 7517) for verifying signatures.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+	// RSA keys
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	// EC and OKP keys, the latter without Y
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+	// CertificateChain holds the base64 (not URL safe) DER certificates of the key, if any.
+	CertificateChain []string `json:"x5c,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes a public key as a JWK identified by keyID, for verifying
+// JWS signatures of the given algorithm, e.g. ES384.
+func NewJWK(publicKey crypto.PublicKey, keyID string, algorithm string) (JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: algorithm,
+			KeyID:     keyID,
+			Modulus:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			KeyType:   "EC",
+			Use:       "sig",
+			Algorithm: algorithm,
+			KeyID:     keyID,
+			Curve:     key.Curve.Params().Name,
+			X:         base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			Y:         base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		// Octet key pair (RFC 8037)
+		return JWK{
+			KeyType:   "OKP",
+			Use:       "sig",
+			Algorithm: algorithm,
+			KeyID:     keyID,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return JWK{}, ErrInvalidPublicKey
+}
+
+// WithCertificateChain adds the DER encoded certificates of the key, starting with its own.
+func (k JWK) WithCertificateChain(certificates ...[]byte) JWK {
+	k.CertificateChain = make([]string, 0, len(certificates))
+	for _, certificate := range certificates {
+		k.CertificateChain = append(k.CertificateChain, base64.StdEncoding.EncodeToString(certificate))
+	}
+	return k
+}
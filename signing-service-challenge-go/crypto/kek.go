@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+var (
+	ErrInvalidKEK    = errors.New("invalid key encryption key")
+	ErrKeyUnwrapping = errors.New("failed to unwrap private key")
+)
+
+// KeyEncryptionKey (KEK) wraps the private keys of the devices with AES-256-GCM, so that they're
+// only stored encrypted. Wrapped keys are the random nonce followed by the sealed key.
+type KeyEncryptionKey struct {
+	aead cipher.AEAD
+}
+
+// NewKeyEncryptionKey creates a KEK from an AES-256 key, see GenerateAESKey.
+func NewKeyEncryptionKey(key []byte) (*KeyEncryptionKey, error) {
+	if len(key) != AESKeySize {
+		return nil, ErrInvalidKEK
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidKEK, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidKEK, err)
+	}
+	return &KeyEncryptionKey{aead: aead}, nil
+}
+
+// GenerateKeyEncryptionKey creates a KEK from a fresh key. The keys it wraps can
+// only be unwrapped as long as it's kept.
+func GenerateKeyEncryptionKey() (*KeyEncryptionKey, error) {
+	key, err := GenerateAESKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyEncryptionKey(key)
+}
+
+func (k *KeyEncryptionKey) Wrap(privateKey []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(privateKey)+k.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, privateKey, nil), nil
+}
+
+func (k *KeyEncryptionKey) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < k.aead.NonceSize() {
+		return nil, ErrKeyUnwrapping
+	}
+	nonce, sealed := wrapped[:k.aead.NonceSize()], wrapped[k.aead.NonceSize():]
+	privateKey, err := k.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.Join(ErrKeyUnwrapping, err)
+	}
+	return privateKey, nil
+}
+
+// WrappingProvider decorates a Provider to wrap the private keys it generates with a KEK.
+type WrappingProvider struct {
+	KEK  *KeyEncryptionKey
+	Next Provider
+}
+
+func (p *WrappingProvider) Provide(ctx context.Context) (KeyPair, error) {
+	keyPair, err := p.Next.Provide(ctx)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	wrapped, err := p.KEK.Wrap(keyPair.Private)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	return KeyPair{Public: keyPair.Public, Private: wrapped}, nil
+}
+
+// UnwrappingSignerFactory decorates a SignerFactory to build signers from private keys
+// wrapped by a WrappingProvider.
+type UnwrappingSignerFactory struct {
+	KEK  *KeyEncryptionKey
+	Next SignerFactory
+}
+
+func (f *UnwrappingSignerFactory) Build(ctx context.Context, wrappedPrivateKey []byte) (Signer, error) {
+	privateKey, err := f.KEK.Unwrap(wrappedPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return f.Next.Build(ctx, privateKey)
+}
@@ -0,0 +1,49 @@
+package crypto_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+)
+
+func Test_KeyEncryptionKey_WrappedKeys(t *testing.T) {
+	kek, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	provider := &crypto.WrappingProvider{KEK: kek, Next: &crypto.Ed25519Provider{}}
+	signerFactory := &crypto.UnwrappingSignerFactory{KEK: kek, Next: &crypto.Ed25519SignerFactory{}}
+
+	keyPair, err := provider.Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if bytes.Contains(keyPair.Private, []byte("PRIVATE KEY")) {
+		t.Fatal("Expected the private key to be wrapped, got", string(keyPair.Private))
+	}
+	signer, err := signerFactory.Build(context.Background(), keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := signer.Sign([]byte("data_to_be_signed"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := (&crypto.Ed25519Verifier{}).Verify(keyPair.Public, []byte("data_to_be_signed"), signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	otherKEK, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := otherKEK.Unwrap(keyPair.Private); !errors.Is(err, crypto.ErrKeyUnwrapping) {
+		t.Fatal("Expected error to be", crypto.ErrKeyUnwrapping, "got", err)
+	}
+	if _, err := crypto.NewKeyEncryptionKey(bytes.Repeat([]byte{1}, 16)); !errors.Is(err, crypto.ErrInvalidKEK) {
+		t.Fatal("Expected error to be", crypto.ErrInvalidKEK, "got", err)
+	}
+}
@@ -1,5 +1,7 @@
 package crypto
 
+import "context"
+
 type KeyPair struct {
 	Public  []byte
 	Private []byte
@@ -7,7 +9,7 @@ type KeyPair struct {
 
 // Generator defines a contract for different types of signing implementations.
 type Provider interface {
-	Provide() (KeyPair, error)
+	Provide(ctx context.Context) (KeyPair, error)
 }
 
 // RSAGenerator generates a RSA key pair.
@@ -16,8 +18,8 @@ type RSAProvider struct {
 	RSAMarshaler
 }
 
-func (g *RSAProvider) Provide() (KeyPair, error) {
-	pair, err := g.Generate()
+func (g *RSAProvider) Provide(ctx context.Context) (KeyPair, error) {
+	pair, err := runWithContext(ctx, g.Generate)
 	if err != nil {
 		return KeyPair{}, err
 	}
@@ -40,8 +42,59 @@ type ECDSAProvider struct {
 	ECCMarshaler
 }
 
-func (g *ECDSAProvider) Provide() (KeyPair, error) {
-	pair, err := g.Generate()
+func (g *ECDSAProvider) Provide(ctx context.Context) (KeyPair, error) {
+	pair, err := runWithContext(ctx, g.Generate)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	publicKey, privateKey, err := g.Encode(*pair)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{
+		Public:  publicKey,
+		Private: privateKey,
+	}, nil
+}
+
+// runWithContext runs fn in the background and returns as soon as either fn
+// finishes or ctx is done. The standard library key generators can't be
+// interrupted, so a cancelled generation keeps running until it completes
+// and its result is discarded.
+func runWithContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value: value, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case r := <-done:
+		return r.value, r.err
+	}
+}
+
+// Ed25519Provider generates an Ed25519 key pair.
+type Ed25519Provider struct {
+	Ed25519Generator
+	Ed25519Marshaler
+}
+
+func (g *Ed25519Provider) Provide(ctx context.Context) (KeyPair, error) {
+	pair, err := runWithContext(ctx, g.Generate)
 	if err != nil {
 		return KeyPair{}, err
 	}
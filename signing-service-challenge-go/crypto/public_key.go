@@ -0,0 +1,38 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+// pemTypePublicKey is the PEM block type of SubjectPublicKeyInfo public keys (RFC 7468).
+const pemTypePublicKey = "PUBLIC KEY"
+
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// ParsePublicKey decodes a PEM encoded device public key, either PKIX or PKCS #1 for RSA keys.
+func ParsePublicKey(publicKey []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidPublicKey, err)
+	}
+	return key, nil
+}
+
+// MarshalPublicKeyPEM encodes a public key as a PEM SubjectPublicKeyInfo.
+func MarshalPublicKeyPEM(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidPublicKey, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+}
@@ -0,0 +1,125 @@
+package crypto_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+)
+
+func Test_Providers_EncodeStandardPEM(t *testing.T) {
+	testCases := map[string]struct {
+		provider          crypto.Provider
+		privateKeyPEMType string
+	}{
+		"rsa":   {&crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}}, "RSA PRIVATE KEY"},
+		"ecdsa": {&crypto.ECDSAProvider{}, "EC PRIVATE KEY"},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			keyPair, err := testCase.provider.Provide(context.Background())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if block, _ := pem.Decode(keyPair.Public); block == nil || block.Type != "PUBLIC KEY" {
+				t.Fatal("Expected a PUBLIC KEY block, got", string(keyPair.Public))
+			}
+			if block, _ := pem.Decode(keyPair.Private); block == nil || block.Type != testCase.privateKeyPEMType {
+				t.Fatal("Expected a", testCase.privateKeyPEMType, "block")
+			}
+		})
+	}
+}
+
+func Test_NewJWK_RSA(t *testing.T) {
+	keyPair, err := (&crypto.RSAGenerator{KeySize: 1024}).Generate()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	jwk, err := crypto.NewJWK(keyPair.Public, "device", "RS256")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if jwk.KeyType != "RSA" || jwk.Algorithm != "RS256" || jwk.KeyID != "device" {
+		t.Fatal("Expected an RS256 RSA key, got", jwk)
+	}
+	modulus, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if new(big.Int).SetBytes(modulus).Cmp(keyPair.Public.N) != 0 {
+		t.Fatal("Expected the modulus of the key")
+	}
+	if jwk.Exponent != "AQAB" {
+		t.Fatal("Expected exponent AQAB, got", jwk.Exponent)
+	}
+}
+
+func Test_NewJWK_ECDSA(t *testing.T) {
+	keyPair, err := (&crypto.ECCGenerator{Curve: elliptic.P521()}).Generate()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	jwk, err := crypto.NewJWK(keyPair.Public, "device", "ES512")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if jwk.KeyType != "EC" || jwk.Algorithm != "ES512" || jwk.Curve != "P-521" {
+		t.Fatal("Expected an ES512 P-521 key, got", jwk)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	// Coordinates are padded to the size of the curve
+	if len(x) != 66 || new(big.Int).SetBytes(x).Cmp(keyPair.Public.X) != 0 {
+		t.Fatal("Expected the 66 bytes x coordinate of the key, got", len(x), "bytes")
+	}
+}
+
+func Test_MarshalOpenSSHPublicKey(t *testing.T) {
+	rsaKey := &rsa.PublicKey{N: big.NewInt(0xc1), E: 65537}
+	encoded, err := crypto.MarshalOpenSSHPublicKey(rsaKey, "device")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	fields := strings.Fields(string(encoded))
+	if len(fields) != 3 || fields[0] != "ssh-rsa" || fields[2] != "device" {
+		t.Fatal("Expected an ssh-rsa line with a comment, got", string(encoded))
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	expected := []byte{
+		0, 0, 0, 7, 's', 's', 'h', '-', 'r', 's', 'a',
+		0, 0, 0, 3, 0x01, 0x00, 0x01,
+		// The most significant bit of the modulus is set, it is padded with a zero byte
+		0, 0, 0, 2, 0x00, 0xc1,
+	}
+	if !bytes.Equal(blob, expected) {
+		t.Fatal("Expected", expected, "got", blob)
+	}
+
+	ecdsaKey, err := (&crypto.ECCGenerator{}).Generate()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	encoded, err = crypto.MarshalOpenSSHPublicKey(ecdsaKey.Public, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !strings.HasPrefix(string(encoded), "ecdsa-sha2-nistp384 ") {
+		t.Fatal("Expected an ecdsa-sha2-nistp384 key, got", string(encoded))
+	}
+}
@@ -1,8 +1,10 @@
 package crypto
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -14,7 +16,7 @@ type Signer interface {
 }
 
 type SignerFactory interface {
-	Build(privateKey []byte) (Signer, error)
+	Build(ctx context.Context, privateKey []byte) (Signer, error)
 }
 
 type RSASigner struct {
@@ -45,13 +47,50 @@ func (s *RSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 type RSASignerFactory struct {
 }
 
-func (f *RSASignerFactory) Build(privateKey []byte) (Signer, error) {
+func (f *RSASignerFactory) Build(ctx context.Context, privateKey []byte) (Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return &RSASigner{
 		privateKey:   privateKey,
 		RSAMarshaler: RSAMarshaler{},
 	}, nil
 }
 
+// RSAPSSSigner signs with RSASSA-PSS over SHA-256, with a salt as long as the hash.
+type RSAPSSSigner struct {
+	privateKey []byte
+	RSAMarshaler
+}
+
+func (s *RSAPSSSigner) Sign(dataToBeSigned []byte) ([]byte, error) {
+	keyPair, err := s.Unmarshal(s.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed := sha256.Sum256(dataToBeSigned)
+	return rsa.SignPSS(rand.Reader, keyPair.Private, crypto.SHA256, hashed[:], &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+	})
+}
+
+type RSAPSSSignerFactory struct {
+}
+
+func (f *RSAPSSSignerFactory) Build(ctx context.Context, privateKey []byte) (Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &RSAPSSSigner{
+		privateKey:   privateKey,
+		RSAMarshaler: RSAMarshaler{},
+	}, nil
+}
+
+// ECDSASigner signs the SHA-2 digest of the data matching the curve strength (SHA-256 for P-256,
+// SHA-384 for P-384 and SHA-512 for P-521), as ECDSA verifiers, JWS and COSE expect. Signatures
+// made before, over the raw data truncated to the curve size, don't verify anymore.
 type ECDSASigner struct {
 	privateKey []byte
 	ECCMarshaler
@@ -66,7 +105,7 @@ func (s *ECDSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 	signature, err := ecdsa.SignASN1(
 		rand.Reader,
 		keyPair.Private,
-		dataToBeSigned,
+		ecdsaDigest(keyPair.Private.Curve, dataToBeSigned),
 	)
 	if err != nil {
 		return nil, err
@@ -78,9 +117,40 @@ func (s *ECDSASigner) Sign(dataToBeSigned []byte) ([]byte, error) {
 type ECDSASignerFactory struct {
 }
 
-func (f *ECDSASignerFactory) Build(privateKey []byte) (Signer, error) {
+func (f *ECDSASignerFactory) Build(ctx context.Context, privateKey []byte) (Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return &ECDSASigner{
 		privateKey:   privateKey,
 		ECCMarshaler: ECCMarshaler{},
 	}, nil
 }
+
+// Ed25519Signer signs the data itself, Ed25519 hashes it internally.
+type Ed25519Signer struct {
+	privateKey []byte
+	Ed25519Marshaler
+}
+
+func (s *Ed25519Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	keyPair, err := s.Decode(s.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.Sign(keyPair.Private, dataToBeSigned), nil
+}
+
+type Ed25519SignerFactory struct {
+}
+
+func (f *Ed25519SignerFactory) Build(ctx context.Context, privateKey []byte) (Signer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &Ed25519Signer{
+		privateKey:       privateKey,
+		Ed25519Marshaler: Ed25519Marshaler{},
+	}, nil
+}
@@ -0,0 +1,97 @@
+package crypto_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha512"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+)
+
+func Test_SignAndVerify(t *testing.T) {
+	testCases := map[string]struct {
+		provider      crypto.Provider
+		signerFactory crypto.SignerFactory
+		verifier      crypto.Verifier
+	}{
+		"rsa": {
+			provider:      &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}},
+			signerFactory: &crypto.RSASignerFactory{},
+			verifier:      &crypto.RSAVerifier{},
+		},
+		"ecdsa": {
+			provider:      &crypto.ECDSAProvider{},
+			signerFactory: &crypto.ECDSASignerFactory{},
+			verifier:      &crypto.ECDSAVerifier{},
+		},
+		"rsa-pss": {
+			provider:      &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}},
+			signerFactory: &crypto.RSAPSSSignerFactory{},
+			verifier:      &crypto.RSAPSSVerifier{},
+		},
+		"ed25519": {
+			provider:      &crypto.Ed25519Provider{},
+			signerFactory: &crypto.Ed25519SignerFactory{},
+			verifier:      &crypto.Ed25519Verifier{},
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			keyPair, err := testCase.provider.Provide(context.Background())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			signer, err := testCase.signerFactory.Build(context.Background(), keyPair.Private)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			// Longer than any digest, so that tampering at the end must be detected
+			data := []byte(strings.Repeat("data_to_be_signed_", 10))
+			signature, err := signer.Sign(data)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			if err := testCase.verifier.Verify(keyPair.Public, data, signature); err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			tampered := append(append([]byte(nil), data...), '!')
+			err = testCase.verifier.Verify(keyPair.Public, tampered, signature)
+			if err == nil || !errors.Is(err, crypto.ErrInvalidSignature) {
+				t.Fatal("Expected error to be", crypto.ErrInvalidSignature, "got", err)
+			}
+		})
+	}
+}
+
+func Test_ECDSASigner_Sign_Digest(t *testing.T) {
+	keyPair, err := (&crypto.ECDSAProvider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signer, err := (&crypto.ECDSASignerFactory{}).Build(context.Background(), keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	data := []byte("data_to_be_signed")
+	signature, err := signer.Sign(data)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	// Standard verifiers check the SHA-384 digest of the data with the default P-384 keys
+	publicKey, err := crypto.ParsePublicKey(keyPair.Public)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	digest := sha512.Sum384(data)
+	if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature) {
+		t.Fatal("Expected the signature to verify over the SHA-384 digest")
+	}
+}
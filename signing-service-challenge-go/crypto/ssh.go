@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+)
+
+// MarshalOpenSSHPublicKey encodes a public key in the authorized_keys format of OpenSSH (RFC 4253, RFC 5656, RFC 8709).
+func MarshalOpenSSHPublicKey(publicKey crypto.PublicKey, comment string) ([]byte, error) {
+	var keyType string
+	var blob bytes.Buffer
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		keyType = "ssh-rsa"
+		writeSSHString(&blob, []byte(keyType))
+		writeSSHMPInt(&blob, big.NewInt(int64(key.E)))
+		writeSSHMPInt(&blob, key.N)
+	case *ecdsa.PublicKey:
+		var curve string
+		switch key.Curve.Params().BitSize {
+		case 256:
+			curve = "nistp256"
+		case 384:
+			curve = "nistp384"
+		case 521:
+			curve = "nistp521"
+		default:
+			return nil, ErrInvalidPublicKey
+		}
+		point, err := key.ECDH()
+		if err != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		keyType = "ecdsa-sha2-" + curve
+		writeSSHString(&blob, []byte(keyType))
+		writeSSHString(&blob, []byte(curve))
+		writeSSHString(&blob, point.Bytes())
+	case ed25519.PublicKey:
+		keyType = "ssh-ed25519"
+		writeSSHString(&blob, []byte(keyType))
+		writeSSHString(&blob, key)
+	default:
+		return nil, ErrInvalidPublicKey
+	}
+
+	line := keyType + " " + base64.StdEncoding.EncodeToString(blob.Bytes())
+	if comment != "" {
+		line += " " + comment
+	}
+	return []byte(line + "\n"), nil
+}
+
+func writeSSHString(buffer *bytes.Buffer, value []byte) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(value)))
+	buffer.Write(value)
+}
+
+// writeSSHMPInt writes a non-negative multiple precision integer, which needs a leading
+// zero byte when its most significant bit is set.
+func writeSSHMPInt(buffer *bytes.Buffer, value *big.Int) {
+	bytes := value.Bytes()
+	if len(bytes) > 0 && bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0}, bytes...)
+	}
+	writeSSHString(buffer, bytes)
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+)
+
+var (
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Verifier checks signatures made by the matching Signer.
+type Verifier interface {
+	Verify(publicKey []byte, data []byte, signature []byte) error
+}
+
+type RSAVerifier struct{}
+
+func (v *RSAVerifier) Verify(publicKey []byte, data []byte, signature []byte) error {
+	parsed, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidPublicKey
+	}
+
+	hashed := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return errors.Join(ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+type RSAPSSVerifier struct{}
+
+func (v *RSAPSSVerifier) Verify(publicKey []byte, data []byte, signature []byte) error {
+	parsed, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidPublicKey
+	}
+
+	hashed := sha256.Sum256(data)
+	err = rsa.VerifyPSS(key, crypto.SHA256, hashed[:], signature, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+	})
+	if err != nil {
+		return errors.Join(ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+type ECDSAVerifier struct{}
+
+func (v *ECDSAVerifier) Verify(publicKey []byte, data []byte, signature []byte) error {
+	parsed, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return ErrInvalidPublicKey
+	}
+
+	if !ecdsa.VerifyASN1(key, ecdsaDigest(key.Curve, data), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type Ed25519Verifier struct{}
+
+func (v *Ed25519Verifier) Verify(publicKey []byte, data []byte, signature []byte) error {
+	parsed, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return ErrInvalidPublicKey
+	}
+
+	if !ed25519.Verify(key, data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ecdsaDigest hashes data with the SHA-2 function matching the strength of the curve.
+func ecdsaDigest(curve elliptic.Curve, data []byte) []byte {
+	switch curve.Params().BitSize {
+	case 256:
+		hashed := sha256.Sum256(data)
+		return hashed[:]
+	case 384:
+		hashed := sha512.Sum384(data)
+		return hashed[:]
+	default:
+		hashed := sha512.Sum512(data)
+		return hashed[:]
+	}
+}
@@ -9,8 +9,10 @@ var (
 )
 
 const (
-	SigningAlgorithmRSA   SigningAlgorithm = "rsa"
-	SigningAlgorithmECDSA SigningAlgorithm = "ecdsa"
+	SigningAlgorithmRSA     SigningAlgorithm = "rsa"
+	SigningAlgorithmECDSA   SigningAlgorithm = "ecdsa"
+	SigningAlgorithmRSAPSS  SigningAlgorithm = "rsa-pss"
+	SigningAlgorithmEd25519 SigningAlgorithm = "ed25519"
 )
 
 func (s SigningAlgorithm) validate() error {
@@ -19,6 +21,10 @@ func (s SigningAlgorithm) validate() error {
 		return nil
 	case SigningAlgorithmECDSA:
 		return nil
+	case SigningAlgorithmRSAPSS:
+		return nil
+	case SigningAlgorithmEd25519:
+		return nil
 	}
 	return ErrUnknownSigningAlgorithm
 }
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrSignatureCounterMismatch = errors.New("signature counter does not match the chain")
+	ErrBrokenSignatureChain     = errors.New("signature is not chained to the previous one")
+	ErrSignatureClientMismatch  = errors.New("signature client does not match its secured data")
+)
+
+// AuditFinding describes a signature which doesn't fit in the chain of its device.
+type AuditFinding struct {
+	SignatureID string
+	Counter     int
+	Version     SecuredDataVersion
+	Err         error
+}
+
+// AuditSignatureChain checks that every signature of the device was made over
+// well-formed secured data, with the right counter and chained to the previous
+// signature. Each signature is parsed with the format and chained in the mode it records,
+// so devices can be audited regardless of the format versions their signatures were made with.
+// The encrypted turnover counters of RKSV receipts are checked against their amounts, with
+// the turnover key of the device unwrapped with turnoverKeys, see KeyUnwrapper.
+func (d Device) AuditSignatureChain(turnoverKeys KeyUnwrapper) []AuditFinding {
+	var findings []AuditFinding
+
+	var previous *Signature
+	var turnover int64
+	for counter, signature := range d.signatures {
+		securedData, err := d.auditSignature(signature, counter, previous)
+		if err == nil && securedData.Receipt != nil {
+			var next int64
+			if next, err = securedData.Receipt.Amounts.addTo(turnover); err == nil {
+				turnover = next
+				err = d.auditTurnover(securedData, turnover, turnoverKeys)
+			}
+		}
+		if err != nil {
+			findings = append(findings, AuditFinding{
+				SignatureID: signature.ID(),
+				Counter:     signature.Counter(),
+				Version:     signature.SecuredDataVersion(),
+				Err:         err,
+			})
+		}
+		previous = &d.signatures[counter]
+	}
+
+	return findings
+}
+
+func (d Device) auditSignature(signature Signature, counter int, previous *Signature) (SecuredData, error) {
+	previousID := ""
+	if previous != nil {
+		previousID = previous.ID()
+	}
+	if signature.Counter() != counter {
+		return SecuredData{}, fmt.Errorf("%w: expected %d, got %d", ErrSignatureCounterMismatch, counter, signature.Counter())
+	}
+	if signature.PreviousID() != previousID {
+		return SecuredData{}, ErrBrokenSignatureChain
+	}
+
+	format, err := NewSecuredDataFormat(string(signature.SecuredDataVersion()))
+	if err != nil {
+		return SecuredData{}, err
+	}
+	securedData, err := format.Parse(signature.RawData())
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	if securedData.Counter != signature.Counter() {
+		return SecuredData{}, fmt.Errorf("%w: expected %d, got %d", ErrSignatureCounterMismatch, signature.Counter(), securedData.Counter)
+	}
+	chainValue, err := d.chainValue(previous, signature.ChainingMode())
+	if err != nil {
+		return SecuredData{}, err
+	}
+	if !bytes.Equal(securedData.LastSignature, chainValue) {
+		return SecuredData{}, ErrBrokenSignatureChain
+	}
+	if securedData.ClientID != signature.ClientID() {
+		return SecuredData{}, ErrSignatureClientMismatch
+	}
+	return securedData, nil
+}
+
+// auditTurnover checks the turnover counter of an RKSV receipt decrypts to the sum of the amounts so far.
+func (d Device) auditTurnover(securedData SecuredData, turnover int64, turnoverKeys KeyUnwrapper) error {
+	receipt := securedData.Receipt
+	if receipt.CashRegisterID != d.id {
+		return fmt.Errorf("%w: unexpected cash register %q", ErrInvalidSecuredData, receipt.CashRegisterID)
+	}
+	key, err := d.plainTurnoverKey(turnoverKeys)
+	if err != nil {
+		return err
+	}
+	decrypted, err := DecryptTurnover(key, d.id, securedData.Counter, receipt.EncryptedTurnover)
+	if err != nil {
+		return err
+	}
+	if decrypted != turnover {
+		return fmt.Errorf("%w: expected %d, got %d", ErrTurnoverCounterMismatch, turnover, decrypted)
+	}
+	return nil
+}
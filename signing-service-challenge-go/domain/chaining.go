@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ChainingMode is how the secured data of a signature is chained to the previous signature of its device.
+type ChainingMode string
+
+const (
+	// ChainingModeSignature embeds the whole previous signature.
+	ChainingModeSignature ChainingMode = "signature"
+	// ChainingModeHash embeds the SHA-256 digest of the previous signature record instead,
+	// see Signature.RecordDigest, which keeps the secured data small with large RSA keys.
+	ChainingModeHash ChainingMode = "hash"
+
+	DefaultChainingMode = ChainingModeSignature
+)
+
+var (
+	ErrUnknownChainingMode     = errors.New("unknown chaining mode")
+	ErrUnsupportedChainingMode = errors.New("chaining mode not supported by the secured data format")
+)
+
+func (m ChainingMode) validate() error {
+	switch m {
+	case ChainingModeSignature, ChainingModeHash:
+		return nil
+	}
+	return ErrUnknownChainingMode
+}
+
+func NewChainingMode(val string) (ChainingMode, error) {
+	m := ChainingMode(val)
+	return m, m.validate()
+}
+
+// RecordDigest is the SHA-256 digest of the record of the signature, which ChainingModeHash
+// chains the next signature to: <counter>_<raw_data_base64>_<signature_base64>.
+func (s Signature) RecordDigest() []byte {
+	return SignatureRecordDigest(s.counter, s.rawData, s.value)
+}
+
+// SignatureRecordDigest is the digest of Signature.RecordDigest, from the fields of a signature.
+func SignatureRecordDigest(counter int, rawData string, value []byte) []byte {
+	digest := sha256.Sum256([]byte(strconv.Itoa(counter) + securedDataSeparator +
+		base64.StdEncoding.EncodeToString([]byte(rawData)) + securedDataSeparator +
+		base64.StdEncoding.EncodeToString(value)))
+	return digest[:]
+}
+
+// chainValue is what a signature of the device embeds to be chained to the previous one
+// in the given mode, the device ID for the first one. RKSV receipts embed a digest of the
+// previous receipt instead, see rksvChainValue.
+func (d Device) chainValue(previous *Signature, mode ChainingMode) ([]byte, error) {
+	if d.securedDataFormat.Version() == SecuredDataVersionRKSV {
+		return rksvChainValue(d.id, previous)
+	}
+	if previous == nil {
+		return []byte(d.id), nil
+	}
+	switch mode {
+	case ChainingModeSignature:
+		return previous.Value(), nil
+	case ChainingModeHash:
+		return previous.RecordDigest(), nil
+	}
+	return nil, ErrUnknownChainingMode
+}
+
+// VerifyChaining checks secured data signed by the device is chained to the given previous
+// signature in the chaining mode of the device, for third parties holding both signatures.
+func (d Device) VerifyChaining(securedData SecuredData, previousRawData string, previousValue []byte) error {
+	previousData, err := ParseSecuredData(previousRawData)
+	if err != nil {
+		return err
+	}
+	if securedData.Counter != previousData.Counter+1 {
+		return fmt.Errorf("%w: expected %d, got %d", ErrSignatureCounterMismatch, previousData.Counter+1, securedData.Counter)
+	}
+	previous := Signature{counter: previousData.Counter, rawData: previousRawData, value: previousValue}
+	chainValue, err := d.chainValue(&previous, d.chainingMode)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(securedData.LastSignature, chainValue) {
+		return ErrBrokenSignatureChain
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package domain_test
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+// newChainedDevice creates a device chaining in the given mode, with two signatures.
+func newChainedDevice(t *testing.T, mode domain.ChainingMode) domain.Device {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"),
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "v3")),
+		domain.WithChainingMode(mode),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	for i := 0; i < 2; i++ {
+		payload, err := domain.NewTextPayload("data_to_be_signed")
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signature, err := device.NewSignature("signature_id_"+strconv.Itoa(i), enrichedData, bytes.Repeat([]byte{byte(i)}, 512), time.Now())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := device.AddSignature(signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+	return device
+}
+
+func Test_Device_EnrichData_ChainingModeHash(t *testing.T) {
+	device := newChainedDevice(t, domain.ChainingModeHash)
+	signatures := device.Signatures()
+
+	securedData, err := domain.ParseSecuredData(signatures[1].RawData())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !bytes.Equal(securedData.LastSignature, signatures[0].RecordDigest()) || len(securedData.LastSignature) != 32 {
+		t.Fatal("Expected the digest of the first signature record, got", securedData.LastSignature)
+	}
+	if signatures[1].ChainingMode() != domain.ChainingModeHash {
+		t.Fatal("Expected the chaining mode to be recorded, got", signatures[1].ChainingMode())
+	}
+	if findings := device.AuditSignatureChain(nil); len(findings) != 0 {
+		t.Fatal("Expected no findings, got", findings)
+	}
+
+	if err := device.VerifyChaining(securedData, signatures[0].RawData(), signatures[0].Value()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	err = device.VerifyChaining(securedData, signatures[0].RawData(), []byte("other_signature"))
+	if !errors.Is(err, domain.ErrBrokenSignatureChain) {
+		t.Fatal("Expected error to be", domain.ErrBrokenSignatureChain, "got", err)
+	}
+	err = device.VerifyChaining(securedData, signatures[1].RawData(), signatures[1].Value())
+	if !errors.Is(err, domain.ErrSignatureCounterMismatch) {
+		t.Fatal("Expected error to be", domain.ErrSignatureCounterMismatch, "got", err)
+	}
+}
+
+func Test_Device_AuditSignatureChain_ChainingModeMismatch(t *testing.T) {
+	device := newChainedDevice(t, domain.ChainingModeSignature)
+
+	// A signature recording the other chaining mode doesn't match its secured data
+	payload, err := domain.NewTextPayload("data_to_be_signed")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := device.NewSignature("signature_id_2", enrichedData, []byte("signature_2"), time.Now())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if signature, err = signature.WithChainingMode(domain.ChainingModeHash); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := device.AddSignature(signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	findings := device.AuditSignatureChain(nil)
+	if len(findings) != 1 || findings[0].SignatureID != signature.ID() || !errors.Is(findings[0].Err, domain.ErrBrokenSignatureChain) {
+		t.Fatal("Expected a broken chain finding for", signature.ID(), "got", findings)
+	}
+}
+
+func Test_NewChainingMode_Error(t *testing.T) {
+	if _, err := domain.NewChainingMode("merkle"); !errors.Is(err, domain.ErrUnknownChainingMode) {
+		t.Fatal("Expected error to be", domain.ErrUnknownChainingMode, "got", err)
+	}
+}
@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrMissingClientID            = errors.New("missing client id")
+	ErrMissingClientSerialNumber  = errors.New("missing client serial number")
+	ErrClientNotFound             = errors.New("client not found")
+	ErrClientAlreadyRegistered    = errors.New("client serial number already registered")
+	ErrClientNotRegistered        = errors.New("client not registered")
+	ErrMissingClient              = errors.New("the secured data format of the device requires a client")
+	ErrUnsupportedClientForFormat = errors.New("the secured data format of the device does not record clients")
+)
+
+type ClientState string
+
+const (
+	ClientStateRegistered   ClientState = "registered"
+	ClientStateDeregistered ClientState = "deregistered"
+)
+
+// Client is a point of sale, e.g. a cash register, registered to sign with a device.
+type Client struct {
+	id string
+	// serialNumber identifies the client among those of the device.
+	serialNumber string
+	state        ClientState
+	registeredAt time.Time
+	// deregisteredAt is zero while the client is registered.
+	deregisteredAt time.Time
+}
+
+func (c Client) ID() string {
+	return c.id
+}
+
+func (c Client) SerialNumber() string {
+	return c.serialNumber
+}
+
+func (c Client) State() ClientState {
+	return c.state
+}
+
+func (c Client) Registered() bool {
+	return c.state == ClientStateRegistered
+}
+
+func (c Client) RegisteredAt() time.Time {
+	return c.registeredAt
+}
+
+func (c Client) DeregisteredAt() time.Time {
+	return c.deregisteredAt
+}
+
+// Clients are sorted by their registration.
+func (d Device) Clients() []Client {
+	return d.clients
+}
+
+// Client returns the client of the device with the given ID, registered or not.
+func (d Device) Client(id string) (Client, error) {
+	for _, client := range d.clients {
+		if client.id == id {
+			return client, nil
+		}
+	}
+	return Client{}, ErrClientNotFound
+}
+
+// RegisterClient registers a client with the given serial number, which must not be
+// registered on the device already. Deregistered serial numbers can be registered again.
+func (d *Device) RegisterClient(id, serialNumber string, at time.Time) (Client, error) {
+	if id == "" {
+		return Client{}, ErrMissingClientID
+	}
+	if serialNumber == "" {
+		return Client{}, ErrMissingClientSerialNumber
+	}
+	for _, client := range d.clients {
+		if client.Registered() && client.serialNumber == serialNumber {
+			return Client{}, ErrClientAlreadyRegistered
+		}
+	}
+
+	client := Client{
+		id:           id,
+		serialNumber: serialNumber,
+		state:        ClientStateRegistered,
+		registeredAt: at.UTC(),
+	}
+	// The clients may be shared with copies of the device held by its repository
+	d.clients = append(slices.Clip(d.clients), client)
+	d.version++
+	return client, nil
+}
+
+// DeregisterClient refuses further signatures of a client. Its past signatures are kept.
+func (d *Device) DeregisterClient(id string, at time.Time) (Client, error) {
+	for i, client := range d.clients {
+		if client.id != id {
+			continue
+		}
+		if !client.Registered() {
+			return Client{}, ErrClientNotRegistered
+		}
+		client.state = ClientStateDeregistered
+		client.deregisteredAt = at.UTC()
+		// The clients may be shared with copies of the device held by its repository
+		d.clients = slices.Clone(d.clients)
+		d.clients[i] = client
+		d.version++
+		return client, nil
+	}
+	return Client{}, ErrClientNotFound
+}
+
+// checkClient checks the device can sign on behalf of the client, empty for none.
+func (d Device) checkClient(clientID string) error {
+	if clientID == "" {
+		if d.securedDataFormat.Version() == SecuredDataVersion4 {
+			return ErrMissingClient
+		}
+		return nil
+	}
+	if d.securedDataFormat.Version() != SecuredDataVersion4 {
+		return ErrUnsupportedClientForFormat
+	}
+	client, err := d.Client(clientID)
+	if err != nil || !client.Registered() {
+		return ErrClientNotRegistered
+	}
+	return nil
+}
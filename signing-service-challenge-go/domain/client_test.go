@@ -0,0 +1,140 @@
+package domain_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+func Test_Device_RegisterClient(t *testing.T) {
+	device := newClientDevice(t)
+	now := time.Now()
+
+	client, err := device.RegisterClient("client-0", "serial_0", now)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if !client.Registered() {
+		t.Fatal("Expected client to be registered, got", client.State())
+	}
+	if device.Version() != 1 {
+		t.Fatal("Expected device version to be 1, got", device.Version())
+	}
+	if _, err := device.RegisterClient("client-1", "serial_0", now); !errors.Is(err, domain.ErrClientAlreadyRegistered) {
+		t.Fatal("Expected error to be", domain.ErrClientAlreadyRegistered, "got", err)
+	}
+}
+
+func Test_Device_RegisterClient_Copies(t *testing.T) {
+	device := newClientDevice(t)
+	now := time.Now()
+	for _, serialNumber := range []string{"serial_0", "serial_1", "serial_2"} {
+		if _, err := device.RegisterClient("client-"+serialNumber, serialNumber, now); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+
+	// Copies of the device, e.g. read concurrently from a repository, share their clients
+	first, second := device, device
+	if _, err := first.RegisterClient("client-3", "serial_3", now); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := second.RegisterClient("client-4", "serial_4", now); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := first.Client("client-3"); err != nil {
+		t.Fatal("Expected the client of the first copy to be kept, got", err)
+	}
+	if len(device.Clients()) != 3 {
+		t.Fatal("Expected the original device to keep 3 clients, got", len(device.Clients()))
+	}
+}
+
+func Test_Device_DeregisterClient(t *testing.T) {
+	device := newClientDevice(t)
+	now := time.Now()
+	if _, err := device.RegisterClient("client-0", "serial_0", now); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	client, err := device.DeregisterClient("client-0", now)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if client.State() != domain.ClientStateDeregistered {
+		t.Fatal("Expected client to be deregistered, got", client.State())
+	}
+	if _, err := device.DeregisterClient("client-0", now); !errors.Is(err, domain.ErrClientNotRegistered) {
+		t.Fatal("Expected error to be", domain.ErrClientNotRegistered, "got", err)
+	}
+	if _, err := device.DeregisterClient("client-1", now); !errors.Is(err, domain.ErrClientNotFound) {
+		t.Fatal("Expected error to be", domain.ErrClientNotFound, "got", err)
+	}
+	// The serial number of a deregistered client can be registered again
+	if _, err := device.RegisterClient("client-1", "serial_0", now); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
+
+func Test_Device_EnrichData_Version4(t *testing.T) {
+	device := newClientDevice(t)
+	if _, err := device.RegisterClient("client-0", "serial_0", time.Now()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	payload, err := domain.NewTextPayload("data_to_be_signed")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	enrichedData, err := device.EnrichData(payload, "client-0", time.UnixMilli(1700000000123), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expectedEnrichedData := "v4_0_1700000000123_client-0_text_" + base64.StdEncoding.EncodeToString([]byte("data_to_be_signed")) + "_" + base64.StdEncoding.EncodeToString([]byte(device.ID()))
+	if enrichedData != expectedEnrichedData {
+		t.Fatal("Expected enriched data to be", expectedEnrichedData, "got", enrichedData)
+	}
+}
+
+func Test_Device_EnrichData_Version4_UnregisteredClient_Error(t *testing.T) {
+	device := newClientDevice(t)
+	now := time.Now()
+	if _, err := device.RegisterClient("client-0", "serial_0", now); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := device.DeregisterClient("client-0", now); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	payload, err := domain.NewTextPayload("data_to_be_signed")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	testCases := map[string]error{
+		"client-0": domain.ErrClientNotRegistered,
+		"client-1": domain.ErrClientNotRegistered,
+		"":         domain.ErrMissingClient,
+	}
+	for clientID, expectedError := range testCases {
+		_, err := device.EnrichData(payload, clientID, now, nil)
+		if !errors.Is(err, expectedError) {
+			t.Fatal("Expected error to be", expectedError, "for", clientID, "got", err)
+		}
+	}
+}
+
+func newClientDevice(t *testing.T) domain.Device {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"),
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "v4")),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return device
+}
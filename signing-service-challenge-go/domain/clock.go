@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Clock tells the current time. It's injected wherever time is recorded,
+// so that tests can be deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock of the host.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
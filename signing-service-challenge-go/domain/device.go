@@ -2,44 +2,80 @@ package domain
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
+	"maps"
+	"slices"
 	"strconv"
+	"time"
 )
 
 var (
 	ErrMissingDeviceID         = errors.New("missing device id")
 	ErrMissingDevicePublicKey  = errors.New("missing device public key")
 	ErrMissingDevicePrivateKey = errors.New("missing device private key")
+	ErrSignatureOutOfOrder     = errors.New("signature does not follow the last signature of the device")
+	ErrMissingCertificate      = errors.New("missing device certificate")
+	ErrInvalidKeyVersion       = errors.New("invalid device key version")
+	ErrSignatureNotFound       = errors.New("signature not found")
 )
 
 type Device struct {
-	id               string
-	signingAlgorithm SigningAlgorithm
-	publicKey        []byte
-	privateKey       []byte
-	label            string
-	version          int
-	signatures       []Signature
+	id                string
+	signingAlgorithm  SigningAlgorithm
+	publicKey         []byte
+	privateKey        []byte
+	label             string
+	securedDataFormat SecuredDataFormat
+	// signatureFormat is the format of the signatures unless requested otherwise.
+	signatureFormat SignatureFormat
+	// chainingMode is how the signatures of the device are chained to the previous one.
+	chainingMode ChainingMode
+	// keyVersion tells the successive keys of the device apart, starting at 1.
+	keyVersion int
+	// certificate is the DER encoded X.509 certificate of the public key, if certified.
+	certificate []byte
+	// certificateChain holds the DER encoded issuers of the certificate.
+	certificateChain [][]byte
+	// transactionsCount is the number of the last transaction started on the device.
+	transactionsCount int
+	// transactionRevisions maps the numbers of the open transactions of the device to the
+	// revision of the last step reserved for them, see ReserveTransactionStep.
+	transactionRevisions map[int]int
+	// clients are the points of sale signing with the device, see Client.
+	clients []Client
+	// turnoverKey is the AES-256 key encrypting the turnover counters of RKSV receipts, kept
+	// along with the private key and wrapped like it, see KeyUnwrapper. turnoverCounter is
+	// the sum of the amounts of the receipts, in cents.
+	turnoverKey     []byte
+	turnoverCounter int64
+	version         int
+	signatures      []Signature
 }
 
 // TODO: having a list with all the signatures means we'll be loading all of them
 // even if we don't need them, e.g. when creating a new signature.
 // I'd turn Signature into an aggregate root with it's own repositories or views,
 // which would support filtering, ordering and pagination
-func NewDevice(id, algorithmName, label string, publicKey, privateKey []byte) (Device, error) {
+func NewDevice(id, algorithmName, label string, publicKey, privateKey []byte, options ...DeviceOption) (Device, error) {
 	Algorithm, err := NewSigningAlgorithm(algorithmName)
 	if err != nil {
 		return Device{}, err
 	}
 
 	d := Device{
-		id:               id,
-		signingAlgorithm: Algorithm,
-		publicKey:        publicKey,
-		privateKey:       privateKey,
-		label:            label,
-		version:          0,
+		id:                id,
+		signingAlgorithm:  Algorithm,
+		publicKey:         publicKey,
+		privateKey:        privateKey,
+		label:             label,
+		securedDataFormat: securedDataFormats[DefaultSecuredDataVersion],
+		signatureFormat:   DefaultSignatureFormat,
+		chainingMode:      DefaultChainingMode,
+		keyVersion:        1,
+		version:           0,
+	}
+	for _, option := range options {
+		option(&d)
 	}
 
 	return d, d.validate()
@@ -55,18 +91,111 @@ func (d Device) validate() error {
 	if len(d.privateKey) == 0 {
 		return ErrMissingDevicePrivateKey
 	}
+	if d.securedDataFormat == nil {
+		return ErrUnknownSecuredDataFormat
+	}
+	if err := d.signatureFormat.validate(); err != nil {
+		return err
+	}
+	if !d.SupportsSignatureFormat(d.signatureFormat) {
+		return ErrUnsupportedSignatureFormat
+	}
+	if err := d.chainingMode.validate(); err != nil {
+		return err
+	}
+	if d.keyVersion < 1 {
+		return ErrInvalidKeyVersion
+	}
+	if d.securedDataFormat.Version() == SecuredDataVersionRKSV {
+		if err := checkRKSVPublicKey(d.signingAlgorithm, d.publicKey); err != nil {
+			return err
+		}
+		if len(d.turnoverKey) == 0 {
+			return ErrInvalidTurnoverKey
+		}
+		// RKSV receipts are chained their own way
+		if d.chainingMode != ChainingModeSignature {
+			return ErrUnsupportedChainingMode
+		}
+	}
 	return nil
 }
 
-func (d Device) EnrichData(data string) string {
-	data = strconv.Itoa(d.SignaturesCount()) + "_" + data + "_"
-	if d.SignaturesCount() == 0 {
-		data += base64.StdEncoding.EncodeToString([]byte(d.ID()))
-	} else {
-		latestSignature := d.signatures[len(d.signatures)-1]
-		data += base64.StdEncoding.EncodeToString(latestSignature.Value())
+type DeviceOption func(*Device)
+
+// WithSecuredDataFormat sets the format of the data signed by the device.
+// It can't be changed afterwards, as it would break the signature chain.
+func WithSecuredDataFormat(format SecuredDataFormat) DeviceOption {
+	return func(d *Device) {
+		d.securedDataFormat = format
+	}
+}
+
+// WithSignatureFormat sets the format of the signatures of the device, unless requested otherwise.
+func WithSignatureFormat(format SignatureFormat) DeviceOption {
+	return func(d *Device) {
+		d.signatureFormat = format
+	}
+}
+
+// WithChainingMode sets how the signatures of the device are chained, DefaultChainingMode if unset.
+func WithChainingMode(mode ChainingMode) DeviceOption {
+	return func(d *Device) {
+		d.chainingMode = mode
+	}
+}
+
+// WithTurnoverKey sets the AES-256 key encrypting the turnover counters, required by SecuredDataVersionRKSV.
+// The key is stored as given, usually wrapped, and unwrapped by the KeyUnwrapper of the methods using it.
+func WithTurnoverKey(key []byte) DeviceOption {
+	return func(d *Device) {
+		d.turnoverKey = key
+	}
+}
+
+// WithKeyVersion restores the version of the device key.
+func WithKeyVersion(version int) DeviceOption {
+	return func(d *Device) {
+		d.keyVersion = version
 	}
-	return data
+}
+
+// EnrichData chains the payload to the signature counter and the last signature of the device,
+// encoded in the secured data format of the device. The client signing, if any, must be registered
+// on the device. It's recorded by the formats which include it, and required by them.
+// The turnover key of RKSV devices is unwrapped with turnoverKeys, see KeyUnwrapper.
+func (d Device) EnrichData(payload Payload, clientID string, at time.Time, turnoverKeys KeyUnwrapper) (string, error) {
+	if err := d.checkClient(clientID); err != nil {
+		return "", err
+	}
+	var previous *Signature
+	if last, ok := d.lastSignature(); ok {
+		previous = &last
+	}
+	chainValue, err := d.chainValue(previous, d.chainingMode)
+	if err != nil {
+		return "", err
+	}
+	data := SecuredData{
+		Version:       d.securedDataFormat.Version(),
+		Counter:       d.nextCounter(),
+		Timestamp:     at,
+		ClientID:      clientID,
+		Payload:       payload,
+		LastSignature: chainValue,
+	}
+
+	// RKSV receipts sign the amounts by VAT rate of the payload, along with the turnover counter
+	if data.Version == SecuredDataVersionRKSV {
+		amounts, err := ParseTaxAmounts(payload)
+		if err != nil {
+			return "", err
+		}
+		if data.Receipt, err = d.rksvReceipt(amounts, data.Counter, turnoverKeys); err != nil {
+			return "", err
+		}
+	}
+	return d.securedDataFormat.Encode(data)
 }
 
 func (d Device) ID() string {
@@ -89,6 +218,61 @@ func (d Device) Label() string {
 	return d.label
 }
 
+func (d Device) SecuredDataFormat() SecuredDataFormat {
+	return d.securedDataFormat
+}
+
+// SupportsSignatureFormat tells whether the device can sign in the given format. RKSV
+// receipts are JWS signing inputs themselves, their signatures can only be raw.
+func (d Device) SupportsSignatureFormat(format SignatureFormat) bool {
+	if d.securedDataFormat != nil && d.securedDataFormat.Version() == SecuredDataVersionRKSV && format != SignatureFormatRaw {
+		return false
+	}
+	return format.Supports(d.signingAlgorithm)
+}
+
+func (d Device) SignatureFormat() SignatureFormat {
+	return d.signatureFormat
+}
+
+func (d Device) ChainingMode() ChainingMode {
+	return d.chainingMode
+}
+
+func (d Device) KeyVersion() int {
+	return d.keyVersion
+}
+
+// KeyID identifies the current key of the device, as "<device ID>:<key version>".
+func (d Device) KeyID() string {
+	return d.id + ":" + strconv.Itoa(d.keyVersion)
+}
+
+// Certified tells whether the device public key has been certified.
+func (d Device) Certified() bool {
+	return len(d.certificate) > 0
+}
+
+func (d Device) Certificate() []byte {
+	return d.certificate
+}
+
+func (d Device) CertificateChain() [][]byte {
+	return d.certificateChain
+}
+
+// AttachCertificate stores the certificate of the device public key, along with the chain of its issuers.
+// Checking the certificate matches the key is up to the caller.
+func (d *Device) AttachCertificate(certificate []byte, chain [][]byte) error {
+	if len(certificate) == 0 {
+		return ErrMissingCertificate
+	}
+	d.certificate = certificate
+	d.certificateChain = chain
+	d.version++
+	return nil
+}
+
 func (d Device) Version() int {
 	return d.version
 }
@@ -97,13 +281,176 @@ func (d Device) SignaturesCount() int {
 	return len(d.signatures)
 }
 
+// Signatures are sorted by their counter.
 func (d Device) Signatures() []Signature {
 	return d.signatures
 }
 
-func (d *Device) AddSignature(signature Signature) {
-	d.signatures = append(d.signatures, signature)
+func (d Device) TransactionsCount() int {
+	return d.transactionsCount
+}
+
+// StartTransaction reserves the number of a new transaction of the device, starting at 1,
+// along with the revision 0 of its start step.
+func (d *Device) StartTransaction() int {
+	d.transactionsCount++
+	// The map may be shared with other copies of the device
+	revisions := maps.Clone(d.transactionRevisions)
+	if revisions == nil {
+		revisions = map[int]int{}
+	}
+	revisions[d.transactionsCount] = 0
+	d.transactionRevisions = revisions
+	d.version++
+	return d.transactionsCount
+}
+
+// ReserveTransactionStep reserves the revision of the next step of an open transaction of the device,
+// which must directly follow the last step reserved. Reserving the steps along with their signatures,
+// rather than in the transactions, ensures that only one of concurrent steps gets signed.
+// Finish steps close the transaction.
+func (d *Device) ReserveTransactionStep(number int, stepType TransactionStepType, revision int) error {
+	last, ok := d.transactionRevisions[number]
+	if !ok || stepType == TransactionStepStart || revision != last+1 {
+		return ErrTransactionStepOutOfOrder
+	}
+	revisions := maps.Clone(d.transactionRevisions)
+	if stepType == TransactionStepFinish {
+		delete(revisions, number)
+	} else {
+		revisions[number] = revision
+	}
+	d.transactionRevisions = revisions
+	d.version++
+	return nil
+}
+
+// CloseTransaction closes an open transaction of the device unless steps were reserved past
+// the given revision, e.g. when it timed out, reporting whether it did.
+func (d *Device) CloseTransaction(number int, revision int) bool {
+	if last, ok := d.transactionRevisions[number]; !ok || last != revision {
+		return false
+	}
+	revisions := maps.Clone(d.transactionRevisions)
+	delete(revisions, number)
+	d.transactionRevisions = revisions
 	d.version++
+	return true
+}
+
+// Signature returns the signature of the device with the given ID.
+func (d Device) Signature(id string) (Signature, error) {
+	for _, signature := range d.signatures {
+		if signature.ID() == id {
+			return signature, nil
+		}
+	}
+	return Signature{}, ErrSignatureNotFound
+}
+
+// NewSignature creates the next signature of the device, over data returned by EnrichData.
+func (d Device) NewSignature(id string, rawData string, value []byte, createdAt time.Time) (Signature, error) {
+	previousID := ""
+	if last, ok := d.lastSignature(); ok {
+		previousID = last.ID()
+	}
+	signature, err := NewSignature(d.id, id, d.nextCounter(), previousID, d.signingAlgorithm, d.securedDataFormat.Version(), rawData, value, createdAt)
+	if err != nil {
+		return Signature{}, err
+	}
+	return signature.WithChainingMode(d.chainingMode)
+}
+
+// AddSignature appends a signature to the chain of the device.
+// It must directly follow the last signature of the device.
+func (d *Device) AddSignature(signature Signature) error {
+	previousID := ""
+	if last, ok := d.lastSignature(); ok {
+		previousID = last.ID()
+	}
+	if signature.DeviceID() != d.id || signature.Counter() != d.nextCounter() || signature.PreviousID() != previousID {
+		return ErrSignatureOutOfOrder
+	}
+
+	if d.securedDataFormat.Version() == SecuredDataVersionRKSV {
+		data, err := d.securedDataFormat.Parse(signature.RawData())
+		if err != nil {
+			return err
+		}
+		turnover, err := data.Receipt.Amounts.addTo(d.turnoverCounter)
+		if err != nil {
+			return err
+		}
+		d.turnoverCounter = turnover
+	}
+
+	// The signatures may be shared with copies of the device held by its repository
+	d.signatures = append(slices.Clip(d.signatures), signature)
+	d.version++
+	return nil
+}
+
+// AttachTimestampTokens stores the timestamp tokens of signatures of the device, by signature ID.
+func (d *Device) AttachTimestampTokens(tokens map[string][]byte) error {
+	// The signatures may share their backing array with other copies of the device
+	signatures := slices.Clone(d.signatures)
+	attached := 0
+	for i, signature := range signatures {
+		if token, ok := tokens[signature.ID()]; ok {
+			signatures[i] = signature.WithTimestampToken(token)
+			attached++
+		}
+	}
+	if attached != len(tokens) {
+		return ErrSignatureNotFound
+	}
+	d.signatures = signatures
+	d.version++
+	return nil
+}
+
+// TurnoverKey is the AES-256 key encrypting the turnover counters of RKSV receipts as stored, usually
+// wrapped, nil for other formats.
+func (d Device) TurnoverKey() []byte {
+	return d.turnoverKey
+}
+
+// WithPlainTurnoverKey returns a copy of the device holding its turnover key unwrapped, for the key to
+// be disclosed once the device is created. The copy must not be stored.
+func (d Device) WithPlainTurnoverKey(turnoverKeys KeyUnwrapper) (Device, error) {
+	key, err := d.plainTurnoverKey(turnoverKeys)
+	if err != nil {
+		return Device{}, err
+	}
+	d.turnoverKey = key
+	return d, nil
+}
+
+// TurnoverCounter is the sum of the amounts of the RKSV receipts of the device, in cents.
+func (d Device) TurnoverCounter() int64 {
+	return d.turnoverCounter
+}
+
+// NextCounter is the signature counter of the next signature of the device.
+func (d Device) NextCounter() int {
+	return d.nextCounter()
+}
+
+// nextCounter is the signature counter of the next signature of the device.
+func (d Device) nextCounter() int {
+	if last, ok := d.lastSignature(); ok {
+		return last.Counter() + 1
+	}
+	return 0
+}
+
+// lastSignature is the signature with the highest counter. AddSignature
+// keeps the signatures sorted by their counter.
+func (d Device) lastSignature() (Signature, bool) {
+	if len(d.signatures) == 0 {
+		return Signature{}, false
+	}
+	return d.signatures[len(d.signatures)-1], true
 }
 
 var (
@@ -117,3 +464,10 @@ type DeviceRepository interface {
 	FindByID(ctx context.Context, id string) (Device, error)
 	ListAll(ctx context.Context) ([]Device, error)
 }
+
+// SignatureRepository reads the signature chains of the devices a page at a time,
+// for the readers of whole chains which don't need them in memory at once.
+type SignatureRepository interface {
+	// ListSignatures lists up to limit signatures of the device from the given counter on, sorted by their counter.
+	ListSignatures(ctx context.Context, deviceID string, fromCounter int, limit int) ([]Signature, error)
+}
@@ -3,7 +3,9 @@ package domain_test
 import (
 	"encoding/base64"
 	"errors"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
 )
@@ -78,13 +80,15 @@ func Test_Device_AddSignature(t *testing.T) {
 		t.Fatal("Expected no error, got", err)
 	}
 
-	signature, err := domain.NewSignature("device_id_0", "signature_id_0", "foo", []byte("signature_0"))
+	signature, err := device.NewSignature("signature_id_0", "foo", []byte("signature_0"), time.Now())
 	if err != nil {
 		t.Fatal("Expected no error, got", err)
 	}
 
 	previousSignatureCount := device.SignaturesCount()
-	device.AddSignature(signature)
+	if err := device.AddSignature(signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
 
 	expectedSignatureCount := previousSignatureCount + 1
 	if device.SignaturesCount() != expectedSignatureCount {
@@ -103,17 +107,26 @@ func Test_Device_EnrichData(t *testing.T) {
 		t.Fatal("Expected no error, got", err)
 	}
 
-	signature, err := domain.NewSignature("device_id_0", "signature_id_0", "foo", []byte("signature_0"))
+	signature, err := device.NewSignature("signature_id_0", "foo", []byte("signature_0"), time.Now())
 	if err != nil {
 		t.Fatal("Expected no error, got", err)
 	}
-	device.AddSignature(signature)
+	if err := device.AddSignature(signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
 
 	dataToBeSigned := "data_to_be_signed"
+	payload, err := domain.NewTextPayload(dataToBeSigned)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
 
-	enrichedData := device.EnrichData(dataToBeSigned)
+	enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
 
-	expectedEnrichedData := "1" + "_" + dataToBeSigned + "_" + base64.StdEncoding.EncodeToString(signature.Value())
+	expectedEnrichedData := "v2_1_text_" + base64.StdEncoding.EncodeToString([]byte(dataToBeSigned)) + "_" + base64.StdEncoding.EncodeToString(signature.Value())
 	if enrichedData != expectedEnrichedData {
 		t.Fatal("Expected enriched data to be", expectedEnrichedData, "got", enrichedData)
 	}
@@ -127,12 +140,140 @@ func Test_Device_EnrichData_FirstSignature(t *testing.T) {
 	}
 
 	dataToBeSigned := "data_to_be_signed"
+	payload, err := domain.NewTextPayload(dataToBeSigned)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
 
-	enrichedData := device.EnrichData(dataToBeSigned)
+	enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
 
-	expectedEnrichedData := "0" + "_" + dataToBeSigned + "_" + base64.StdEncoding.EncodeToString([]byte(device.ID()))
+	expectedEnrichedData := "v2_0_text_" + base64.StdEncoding.EncodeToString([]byte(dataToBeSigned)) + "_" + base64.StdEncoding.EncodeToString([]byte(device.ID()))
 	if enrichedData != expectedEnrichedData {
 		t.Fatal("Expected enriched data to be", expectedEnrichedData, "got", enrichedData)
 	}
 
 }
+
+func Test_Device_EnrichData_Version3(t *testing.T) {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"),
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "v3")),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	payload, err := domain.NewTextPayload("data_to_be_signed")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	enrichedData, err := device.EnrichData(payload, "", time.UnixMilli(1700000000123), nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expectedEnrichedData := "v3_0_1700000000123_text_" + base64.StdEncoding.EncodeToString([]byte("data_to_be_signed")) + "_" + base64.StdEncoding.EncodeToString([]byte(device.ID()))
+	if enrichedData != expectedEnrichedData {
+		t.Fatal("Expected enriched data to be", expectedEnrichedData, "got", enrichedData)
+	}
+}
+
+func Test_Device_EnrichData_Version1_BinaryPayload_Error(t *testing.T) {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"),
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "v1")),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	payload, err := domain.NewPayload("binary", []byte{0x00, 0x01})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	_, err = device.EnrichData(payload, "", time.Now(), nil)
+
+	expectedError := domain.ErrUnsupportedPayloadForFormat
+	if err == nil || !errors.Is(err, expectedError) {
+		t.Fatal("Expected error to be", expectedError, "got", err)
+	}
+}
+
+func Test_Device_AuditSignatureChain(t *testing.T) {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"),
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "v1")),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	for i, value := range []string{"signature_0", "signature_1"} {
+		payload, err := domain.NewTextPayload("data_to_be_signed")
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signature, err := device.NewSignature("signature_id_"+strconv.Itoa(i), enrichedData, []byte(value), time.Now())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := device.AddSignature(signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+
+	if findings := device.AuditSignatureChain(nil); len(findings) != 0 {
+		t.Fatal("Expected no findings, got", findings)
+	}
+
+	// Chained to the first signature again instead of the second one
+	forged, err := device.NewSignature("signature_id_2",
+		"2_data_to_be_signed_"+base64.StdEncoding.EncodeToString([]byte("signature_0")), []byte("signature_2"), time.Now())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := device.AddSignature(forged); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	findings := device.AuditSignatureChain(nil)
+	if len(findings) != 1 || findings[0].SignatureID != forged.ID() {
+		t.Fatal("Expected a finding for", forged.ID(), "got", findings)
+	}
+	if !errors.Is(findings[0].Err, domain.ErrBrokenSignatureChain) {
+		t.Fatal("Expected error to be", domain.ErrBrokenSignatureChain, "got", findings[0].Err)
+	}
+}
+
+func mustSecuredDataFormat(t *testing.T, version string) domain.SecuredDataFormat {
+	format, err := domain.NewSecuredDataFormat(version)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return format
+}
+
+func Test_Device_AddSignature_OutOfOrder_Error(t *testing.T) {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	signature, err := domain.NewSignature("device_id_0", "signature_id_1", 1, "signature_id_0", domain.SigningAlgorithmRSA, domain.SecuredDataVersion2, "foo", []byte("signature_1"), time.Now())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	err = device.AddSignature(signature)
+
+	expectedError := domain.ErrSignatureOutOfOrder
+	if err == nil || !errors.Is(err, expectedError) {
+		t.Fatal("Expected error to be", expectedError, "got", err)
+	}
+}
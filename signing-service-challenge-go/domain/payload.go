@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jcs"
+)
+
+type PayloadType string
+
+const (
+	PayloadTypeText   PayloadType = "text"
+	PayloadTypeBinary PayloadType = "binary"
+	PayloadTypeJSON   PayloadType = "json"
+)
+
+var (
+	ErrUnknownPayloadType = errors.New("unknown payload type")
+	ErrMissingPayloadData = errors.New("missing payload data")
+	ErrInvalidTextPayload = errors.New("text payload is not valid UTF-8")
+	ErrInvalidJSONPayload = errors.New("invalid JSON payload")
+)
+
+// Payload is the data_to_be_signed provided by the clients, along with how it must be interpreted.
+type Payload struct {
+	payloadType PayloadType
+	data        []byte
+}
+
+// NewPayload creates a payload of the given type. JSON payloads are
+// canonicalized (RFC 8785) so that equivalent documents are signed identically.
+func NewPayload(payloadType string, data []byte) (Payload, error) {
+	p := Payload{
+		payloadType: PayloadType(payloadType),
+		data:        data,
+	}
+	if err := p.validate(); err != nil {
+		return Payload{}, err
+	}
+
+	if p.payloadType == PayloadTypeJSON {
+		canonical, err := jcs.Canonicalize(data)
+		if err != nil {
+			return Payload{}, errors.Join(ErrInvalidJSONPayload, err)
+		}
+		p.data = canonical
+	}
+	return p, nil
+}
+
+// NewTextPayload creates a text payload.
+func NewTextPayload(data string) (Payload, error) {
+	return NewPayload(string(PayloadTypeText), []byte(data))
+}
+
+func (p Payload) validate() error {
+	switch p.payloadType {
+	case PayloadTypeText, PayloadTypeBinary, PayloadTypeJSON:
+	default:
+		return ErrUnknownPayloadType
+	}
+	if len(p.data) == 0 {
+		return ErrMissingPayloadData
+	}
+	if p.payloadType == PayloadTypeText && !utf8.Valid(p.data) {
+		return ErrInvalidTextPayload
+	}
+	return nil
+}
+
+func (p Payload) Type() PayloadType {
+	return p.payloadType
+}
+
+func (p Payload) Data() []byte {
+	return p.data
+}
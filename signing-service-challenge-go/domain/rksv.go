@@ -0,0 +1,399 @@
+package domain
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	// The receipt times are Austrian local times, whatever the zone database of the host
+	_ "time/tzdata"
+)
+
+// The RKSV receipts use the algorithm suite R1: ES256 signatures, chain values of the first
+// 8 bytes of a SHA-256 digest and AES-256-ICM encrypted turnover counters. Without a trust
+// service provider the signing certificates are identified as AT0.
+const (
+	// rksvJWSHeader is the encoded protected header of the RKSV signatures, {"alg":"ES256"}.
+	rksvJWSHeader     = "eyJhbGciOiJFUzI1NiJ9"
+	rksvSuite         = "R1-AT0"
+	rksvTimeLayout    = "2006-01-02T15:04:05"
+	rksvChainSize     = 8
+	rksvTurnoverSize  = 8
+	rksvSignatureSize = 32
+
+	// TurnoverKeySize is the size of the AES-256 keys encrypting the turnover counters.
+	TurnoverKeySize = 32
+)
+
+var (
+	ErrInvalidTaxAmounts             = errors.New("invalid amounts by VAT rate")
+	ErrInvalidTurnoverKey            = errors.New("invalid turnover key")
+	ErrUnsupportedAlgorithmForFormat = errors.New("the secured data format of the device requires ECDSA P-256 keys")
+	ErrTurnoverCounterMismatch       = errors.New("turnover counter does not match the receipts")
+	ErrNotRKSVSignature              = errors.New("not an RKSV signature")
+	ErrTurnoverOverflow              = errors.New("turnover counter out of range")
+)
+
+var rksvLocation = mustLoadLocation("Europe/Vienna")
+
+// TaxAmounts are the amounts of a receipt by VAT rate, in cents. Refunds are negative.
+type TaxAmounts struct {
+	Normal   int64 `json:"normal"`
+	Reduced1 int64 `json:"reduced_1"`
+	Reduced2 int64 `json:"reduced_2"`
+	Zero     int64 `json:"zero"`
+	Special  int64 `json:"special"`
+}
+
+// ParseTaxAmounts reads the amounts of a receipt from a JSON payload. Rates left out are zero.
+func ParseTaxAmounts(payload Payload) (TaxAmounts, error) {
+	if payload.Type() != PayloadTypeJSON {
+		return TaxAmounts{}, fmt.Errorf("%w: expected a JSON payload", ErrInvalidTaxAmounts)
+	}
+	var amounts TaxAmounts
+	decoder := json.NewDecoder(bytes.NewReader(payload.Data()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&amounts); err != nil {
+		return TaxAmounts{}, errors.Join(ErrInvalidTaxAmounts, err)
+	}
+	return amounts, nil
+}
+
+// addTo moves a turnover counter by the amounts of a receipt. It fails with ErrTurnoverOverflow
+// rather than wrapping around.
+func (a TaxAmounts) addTo(turnover int64) (int64, error) {
+	for _, amount := range a.list() {
+		if (amount > 0 && turnover > math.MaxInt64-amount) || (amount < 0 && turnover < math.MinInt64-amount) {
+			return 0, ErrTurnoverOverflow
+		}
+		turnover += amount
+	}
+	return turnover, nil
+}
+
+func (a TaxAmounts) list() []int64 {
+	return []int64{a.Normal, a.Reduced1, a.Reduced2, a.Zero, a.Special}
+}
+
+// payload is the canonical JSON payload of the amounts, every rate included.
+func (a TaxAmounts) payload() (Payload, error) {
+	encoded, err := json.Marshal(a)
+	if err != nil {
+		return Payload{}, err
+	}
+	return NewPayload(string(PayloadTypeJSON), encoded)
+}
+
+// RKSVReceipt holds the fields of the RKSV receipts besides the counter, time and chain value.
+type RKSVReceipt struct {
+	CashRegisterID string
+	Amounts        TaxAmounts
+	// EncryptedTurnover is the turnover counter of the device including the receipt, see EncryptTurnover.
+	EncryptedTurnover []byte
+	// CertificateSerial identifies the signing certificate, or the key of uncertified devices.
+	CertificateSerial string
+}
+
+// EncryptTurnover encrypts a turnover counter with AES-256 in counter mode (ICM). The counter
+// is 8 bytes of big-endian two's complement, and the IV the first 16 bytes of the SHA-256
+// digest of the cash register ID followed by the receipt number.
+func EncryptTurnover(key []byte, cashRegisterID string, receiptNumber int, turnover int64) ([]byte, error) {
+	plaintext := make([]byte, rksvTurnoverSize)
+	binary.BigEndian.PutUint64(plaintext, uint64(turnover))
+	return turnoverStream(key, cashRegisterID, receiptNumber, plaintext)
+}
+
+// DecryptTurnover decrypts a turnover counter encrypted by EncryptTurnover.
+func DecryptTurnover(key []byte, cashRegisterID string, receiptNumber int, encrypted []byte) (int64, error) {
+	if len(encrypted) != rksvTurnoverSize {
+		return 0, fmt.Errorf("%w: invalid turnover counter size %d", ErrInvalidSecuredData, len(encrypted))
+	}
+	plaintext, err := turnoverStream(key, cashRegisterID, receiptNumber, encrypted)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(plaintext)), nil
+}
+
+func turnoverStream(key []byte, cashRegisterID string, receiptNumber int, input []byte) ([]byte, error) {
+	if len(key) != TurnoverKeySize {
+		return nil, ErrInvalidTurnoverKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidTurnoverKey, err)
+	}
+	iv := sha256.Sum256([]byte(cashRegisterID + strconv.Itoa(receiptNumber)))
+	output := make([]byte, len(input))
+	cipher.NewCTR(block, iv[:aes.BlockSize]).XORKeyStream(output, input)
+	return output, nil
+}
+
+// KeyUnwrapper unwraps the secret keys the devices store wrapped, e.g. their turnover keys
+// wrapped by the KEK of their private keys.
+type KeyUnwrapper interface {
+	Unwrap(wrapped []byte) ([]byte, error)
+}
+
+// plainTurnoverKey unwraps the turnover key of the device. Without an unwrapper, the key is used as stored.
+func (d Device) plainTurnoverKey(turnoverKeys KeyUnwrapper) ([]byte, error) {
+	if turnoverKeys == nil {
+		return d.turnoverKey, nil
+	}
+	key, err := turnoverKeys.Unwrap(d.turnoverKey)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidTurnoverKey, err)
+	}
+	return key, nil
+}
+
+// rksvReceipt gathers the RKSV fields of the next receipt of the device, its turnover counter including the amounts.
+func (d Device) rksvReceipt(amounts TaxAmounts, receiptNumber int, turnoverKeys KeyUnwrapper) (*RKSVReceipt, error) {
+	turnover, err := amounts.addTo(d.turnoverCounter)
+	if err != nil {
+		return nil, err
+	}
+	key, err := d.plainTurnoverKey(turnoverKeys)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := EncryptTurnover(key, d.id, receiptNumber, turnover)
+	if err != nil {
+		return nil, err
+	}
+	return &RKSVReceipt{
+		CashRegisterID:    d.id,
+		Amounts:           amounts,
+		EncryptedTurnover: encrypted,
+		CertificateSerial: d.certificateSerial(),
+	}, nil
+}
+
+// certificateSerial is the hexadecimal serial number of the device certificate, its key ID if uncertified.
+func (d Device) certificateSerial() string {
+	if certificate, err := x509.ParseCertificate(d.certificate); err == nil {
+		return certificate.SerialNumber.Text(16)
+	}
+	return d.KeyID()
+}
+
+// checkRKSVPublicKey checks a device key can make ES256 signatures, that is it's an ECDSA P-256 key.
+func checkRKSVPublicKey(algorithm SigningAlgorithm, publicKey []byte) error {
+	if algorithm != SigningAlgorithmECDSA {
+		return ErrUnsupportedAlgorithmForFormat
+	}
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return ErrUnsupportedAlgorithmForFormat
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errors.Join(ErrUnsupportedAlgorithmForFormat, err)
+	}
+	if key, ok := parsed.(*ecdsa.PublicKey); !ok || key.Curve != elliptic.P256() {
+		return ErrUnsupportedAlgorithmForFormat
+	}
+	return nil
+}
+
+// rksvChainValue chains a receipt to the previous one: the first 8 bytes of the SHA-256 digest
+// of the JWS compact serialization of the previous receipt, or of the cash register ID for the first one.
+func rksvChainValue(cashRegisterID string, previous *Signature) ([]byte, error) {
+	chained := cashRegisterID
+	if previous != nil {
+		signature, err := rksvSignature(previous.Value())
+		if err != nil {
+			return nil, err
+		}
+		chained = previous.RawData() + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	digest := sha256.Sum256([]byte(chained))
+	return digest[:rksvChainSize], nil
+}
+
+// rksvSignature converts an ASN.1 ECDSA P-256 signature to the R||S encoding of JWS.
+func rksvSignature(signature []byte) ([]byte, error) {
+	var values struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(signature, &values)
+	if err != nil || len(rest) > 0 {
+		return nil, ErrUnsupportedAlgorithmForFormat
+	}
+	if values.R.Sign() <= 0 || values.S.Sign() <= 0 || values.R.BitLen() > 8*rksvSignatureSize || values.S.BitLen() > 8*rksvSignatureSize {
+		return nil, ErrUnsupportedAlgorithmForFormat
+	}
+	encoded := make([]byte, 2*rksvSignatureSize)
+	values.R.FillBytes(encoded[:rksvSignatureSize])
+	values.S.FillBytes(encoded[rksvSignatureSize:])
+	return encoded, nil
+}
+
+// MachineReadableCode is the code printed on the RKSV receipts: the signed receipt
+// fields followed by the base64 encoded JWS signature.
+func (s Signature) MachineReadableCode() (string, error) {
+	if s.version != SecuredDataVersionRKSV {
+		return "", ErrNotRKSVSignature
+	}
+	_, encoded, _ := strings.Cut(s.rawData, ".")
+	code, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.Join(ErrInvalidSecuredData, err)
+	}
+	signature, err := rksvSignature(s.value)
+	if err != nil {
+		return "", err
+	}
+	return string(code) + securedDataSeparator + base64.StdEncoding.EncodeToString(signature), nil
+}
+
+type securedDataFormatRKSV struct{}
+
+func (securedDataFormatRKSV) Version() SecuredDataVersion {
+	return SecuredDataVersionRKSV
+}
+
+func (securedDataFormatRKSV) Encode(data SecuredData) (string, error) {
+	receipt := data.Receipt
+	if receipt == nil {
+		return "", fmt.Errorf("%w: missing receipt", ErrInvalidSecuredData)
+	}
+	if data.Timestamp.IsZero() {
+		return "", fmt.Errorf("%w: missing timestamp", ErrInvalidSecuredData)
+	}
+	for _, field := range []string{receipt.CashRegisterID, receipt.CertificateSerial} {
+		if field == "" || strings.Contains(field, securedDataSeparator) {
+			return "", fmt.Errorf("%w: invalid receipt field %q", ErrInvalidSecuredData, field)
+		}
+	}
+
+	fields := []string{
+		"",
+		rksvSuite,
+		receipt.CashRegisterID,
+		strconv.Itoa(data.Counter),
+		data.Timestamp.In(rksvLocation).Format(rksvTimeLayout),
+	}
+	for _, amount := range receipt.Amounts.list() {
+		formatted, err := formatAmount(amount)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, formatted)
+	}
+	fields = append(fields,
+		base64.StdEncoding.EncodeToString(receipt.EncryptedTurnover),
+		receipt.CertificateSerial,
+		base64.StdEncoding.EncodeToString(data.LastSignature),
+	)
+	code := strings.Join(fields, securedDataSeparator)
+	return rksvJWSHeader + "." + base64.RawURLEncoding.EncodeToString([]byte(code)), nil
+}
+
+func (securedDataFormatRKSV) Parse(raw string) (SecuredData, error) {
+	header, encoded, _ := strings.Cut(raw, ".")
+	if header != rksvJWSHeader {
+		return SecuredData{}, fmt.Errorf("%w: expected the RKSV JWS header", ErrInvalidSecuredData)
+	}
+	code, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return SecuredData{}, errors.Join(ErrInvalidSecuredData, err)
+	}
+	fields := strings.Split(string(code), securedDataSeparator)
+	if len(fields) != 13 || fields[0] != "" || fields[1] != rksvSuite {
+		return SecuredData{}, fmt.Errorf("%w: expected a %s receipt", ErrInvalidSecuredData, rksvSuite)
+	}
+
+	counter, err := parseCounter(fields[3])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	timestamp, err := time.ParseInLocation(rksvTimeLayout, fields[4], rksvLocation)
+	if err != nil {
+		return SecuredData{}, errors.Join(ErrInvalidSecuredData, err)
+	}
+	var amounts [5]int64
+	for i := range amounts {
+		if amounts[i], err = parseAmount(fields[5+i]); err != nil {
+			return SecuredData{}, err
+		}
+	}
+	taxAmounts := TaxAmounts{amounts[0], amounts[1], amounts[2], amounts[3], amounts[4]}
+	payload, err := taxAmounts.payload()
+	if err != nil {
+		return SecuredData{}, errors.Join(ErrInvalidSecuredData, err)
+	}
+	encryptedTurnover, err := parseBase64(fields[10])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	chainValue, err := parseBase64(fields[12])
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	return SecuredData{
+		Version:   SecuredDataVersionRKSV,
+		Counter:   counter,
+		Timestamp: timestamp.UTC(),
+		Payload:   payload,
+		Receipt: &RKSVReceipt{
+			CashRegisterID:    fields[2],
+			Amounts:           taxAmounts,
+			EncryptedTurnover: encryptedTurnover,
+			CertificateSerial: fields[11],
+		},
+		LastSignature: chainValue,
+	}, nil
+}
+
+// formatAmount formats cents as the RKSV amounts, e.g. 1234,56. The lowest int64 is
+// rejected, as it can't be negated.
+func formatAmount(cents int64) (string, error) {
+	if cents == math.MinInt64 {
+		return "", fmt.Errorf("%w: amount out of range", ErrInvalidTaxAmounts)
+	}
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d,%02d", sign, cents/100, cents%100), nil
+}
+
+func parseAmount(raw string) (int64, error) {
+	units, decimals, ok := strings.Cut(raw, ",")
+	if !ok || len(decimals) != 2 || units == "" || units == "-" {
+		return 0, fmt.Errorf("%w: invalid amount %q", ErrInvalidSecuredData, raw)
+	}
+	cents, err := strconv.ParseInt(units+decimals, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid amount %q", ErrInvalidSecuredData, raw)
+	}
+	if formatted, err := formatAmount(cents); err != nil || formatted != raw {
+		return 0, fmt.Errorf("%w: invalid amount %q", ErrInvalidSecuredData, raw)
+	}
+	return cents, nil
+}
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
@@ -0,0 +1,262 @@
+package domain_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/elliptic"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+var turnoverKey = []byte("0123456789abcdef0123456789abcdef")
+
+func Test_EncryptTurnover_RoundTrip(t *testing.T) {
+	for _, turnover := range []int64{0, 1234, -500} {
+		encrypted, err := domain.EncryptTurnover(turnoverKey, "device_id_0", 3, turnover)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		decrypted, err := domain.DecryptTurnover(turnoverKey, "device_id_0", 3, encrypted)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if decrypted != turnover {
+			t.Fatal("Expected turnover", turnover, "got", decrypted)
+		}
+	}
+
+	if _, err := domain.EncryptTurnover([]byte("short"), "device_id_0", 3, 0); !errors.Is(err, domain.ErrInvalidTurnoverKey) {
+		t.Fatal("Expected error to be", domain.ErrInvalidTurnoverKey, "got", err)
+	}
+}
+
+func Test_NewDevice_RKSV_Error(t *testing.T) {
+	keyPair, err := (&crypto.ECDSAProvider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	format := domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "rksv"))
+
+	// P-384 keys can't make ES256 signatures
+	_, err = domain.NewDevice("device_id_0", "ecdsa", "", keyPair.Public, keyPair.Private, format, domain.WithTurnoverKey(turnoverKey))
+	if !errors.Is(err, domain.ErrUnsupportedAlgorithmForFormat) {
+		t.Fatal("Expected error to be", domain.ErrUnsupportedAlgorithmForFormat, "got", err)
+	}
+	device := newRKSVDevice(t)
+	_, err = domain.NewDevice("device_id_0", "ecdsa", "", device.PublicKey(), device.PrivateKey(), format)
+	if !errors.Is(err, domain.ErrInvalidTurnoverKey) {
+		t.Fatal("Expected error to be", domain.ErrInvalidTurnoverKey, "got", err)
+	}
+}
+
+func Test_Device_RKSV_Receipts(t *testing.T) {
+	device := newRKSVDevice(t)
+	signer, err := (&crypto.ECDSASignerFactory{}).Build(context.Background(), device.PrivateKey())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	at := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	for i, amounts := range []string{`{"normal":1250,"reduced_1":300}`, `{"normal":-250}`} {
+		payload, err := domain.NewPayload("json", []byte(amounts))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		enrichedData, err := device.EnrichData(payload, "", at, nil)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		value, err := signer.Sign([]byte(enrichedData))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signature, err := device.NewSignature("signature_id_"+strconv.Itoa(i), enrichedData, value, at)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := device.AddSignature(signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+
+	if device.TurnoverCounter() != 1300 {
+		t.Fatal("Expected turnover counter to be 1300, got", device.TurnoverCounter())
+	}
+	code, err := device.Signatures()[0].MachineReadableCode()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	// The receipt time is the Austrian local time
+	expectedPrefix := "_R1-AT0_device-0_0_2024-07-01T12:00:00_12,50_3,00_0,00_0,00_0,00_"
+	if !strings.HasPrefix(code, expectedPrefix) || strings.Count(code, "_") != 13 {
+		t.Fatal("Expected a machine-readable code starting with", expectedPrefix, "got", code)
+	}
+	securedData, err := domain.ParseSecuredData(device.Signatures()[1].RawData())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if securedData.Version != domain.SecuredDataVersionRKSV || securedData.Receipt.Amounts.Normal != -250 {
+		t.Fatal("Expected the RKSV receipt of the refund, got", securedData)
+	}
+	if findings := device.AuditSignatureChain(nil); len(findings) != 0 {
+		t.Fatal("Expected no findings, got", findings)
+	}
+
+	// Other payloads than amounts by VAT rate can't be signed
+	payload, err := domain.NewTextPayload("data_to_be_signed")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := device.EnrichData(payload, "", at, nil); !errors.Is(err, domain.ErrInvalidTaxAmounts) {
+		t.Fatal("Expected error to be", domain.ErrInvalidTaxAmounts, "got", err)
+	}
+}
+
+func newRKSVDevice(t *testing.T) domain.Device {
+	keyPair, err := (&crypto.ECDSAProvider{ECCGenerator: crypto.ECCGenerator{Curve: elliptic.P256()}}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device-0", "ecdsa", "", keyPair.Public, keyPair.Private,
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "rksv")),
+		domain.WithTurnoverKey(turnoverKey),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return device
+}
+
+func Test_Device_RKSV_WrappedTurnoverKey(t *testing.T) {
+	kek, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	otherKEK, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	wrapped, err := kek.Wrap(turnoverKey)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	plain := newRKSVDevice(t)
+	device, err := domain.NewDevice("device-0", "ecdsa", "", plain.PublicKey(), plain.PrivateKey(),
+		domain.WithSecuredDataFormat(mustSecuredDataFormat(t, "rksv")),
+		domain.WithTurnoverKey(wrapped),
+	)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	payload, err := domain.NewPayload("json", []byte(`{"normal":1250}`))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	at := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	// The receipts encrypt the turnover counter with the unwrapped key
+	enrichedData, err := device.EnrichData(payload, "", at, kek)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	expected, err := plain.EnrichData(payload, "", at, nil)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if enrichedData != expected {
+		t.Fatal("Expected", expected, "got", enrichedData)
+	}
+	addRKSVReceipt(t, &device, `{"normal":1250}`, kek)
+	if findings := device.AuditSignatureChain(kek); len(findings) != 0 {
+		t.Fatal("Expected no findings, got", findings)
+	}
+
+	// The key can't be used without the KEK which wrapped it
+	for _, keys := range []domain.KeyUnwrapper{nil, otherKEK} {
+		if _, err := device.EnrichData(payload, "", at, keys); !errors.Is(err, domain.ErrInvalidTurnoverKey) {
+			t.Fatal("Expected error to be", domain.ErrInvalidTurnoverKey, "got", err)
+		}
+		findings := device.AuditSignatureChain(keys)
+		if len(findings) != 1 || !errors.Is(findings[0].Err, domain.ErrInvalidTurnoverKey) {
+			t.Fatal("Expected a finding about the turnover key, got", findings)
+		}
+	}
+
+	disclosed, err := device.WithPlainTurnoverKey(kek)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !bytes.Equal(disclosed.TurnoverKey(), turnoverKey) || !bytes.Equal(device.TurnoverKey(), wrapped) {
+		t.Fatal("Expected the turnover key to be unwrapped on the copy only, got", disclosed.TurnoverKey())
+	}
+}
+
+func Test_Device_RKSV_TurnoverOverflow(t *testing.T) {
+	device := newRKSVDevice(t)
+	// JSON amounts are exact up to 2^53, the counter reaches 2^63 after 205 such receipts
+	amounts := `{"normal":9007199254740992,"reduced_1":9007199254740992,"reduced_2":9007199254740992,"zero":9007199254740992,"special":9007199254740992}`
+	for i := 0; i < 204; i++ {
+		addRKSVReceipt(t, &device, amounts, nil)
+	}
+
+	payload, err := domain.NewPayload("json", []byte(amounts))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := device.EnrichData(payload, "", time.Now(), nil); !errors.Is(err, domain.ErrTurnoverOverflow) {
+		t.Fatal("Expected error to be", domain.ErrTurnoverOverflow, "got", err)
+	}
+	if device.TurnoverCounter() != 204*5*9007199254740992 {
+		t.Fatal("Expected the turnover counter to be left as is, got", device.TurnoverCounter())
+	}
+
+	// The lowest amount can't be formatted, as it can't be negated
+	format := mustSecuredDataFormat(t, "rksv")
+	_, err = format.Encode(domain.SecuredData{
+		Version:   domain.SecuredDataVersionRKSV,
+		Timestamp: time.Now(),
+		Receipt: &domain.RKSVReceipt{
+			CashRegisterID:    "device-0",
+			Amounts:           domain.TaxAmounts{Normal: math.MinInt64},
+			CertificateSerial: "serial",
+		},
+	})
+	if !errors.Is(err, domain.ErrInvalidTaxAmounts) {
+		t.Fatal("Expected error to be", domain.ErrInvalidTaxAmounts, "got", err)
+	}
+}
+
+// addRKSVReceipt signs a receipt of the amounts with the device and adds it to its chain.
+func addRKSVReceipt(t *testing.T, device *domain.Device, amounts string, turnoverKeys domain.KeyUnwrapper) {
+	signer, err := (&crypto.ECDSASignerFactory{}).Build(context.Background(), device.PrivateKey())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	payload, err := domain.NewPayload("json", []byte(amounts))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	now := time.Now().Truncate(time.Millisecond)
+	enrichedData, err := device.EnrichData(payload, "", now, turnoverKeys)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	value, err := signer.Sign([]byte(enrichedData))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signature, err := device.NewSignature("signature_id_"+strconv.Itoa(device.NextCounter()), enrichedData, value, now)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := device.AddSignature(signature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
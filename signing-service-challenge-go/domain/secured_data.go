@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type SecuredDataVersion string
+
+const (
+	// SecuredDataVersion1 is the original unversioned format:
+	// <counter>_<data>_<last_signature_base64>
+	// Only text payloads can be embedded.
+	SecuredDataVersion1 SecuredDataVersion = "v1"
+	// SecuredDataVersion2 escapes every field so that any payload can be embedded:
+	// v2_<counter>_<payload_type>_<data_base64>_<last_signature_base64>
+	SecuredDataVersion2 SecuredDataVersion = "v2"
+	// SecuredDataVersion3 extends SecuredDataVersion2 with the signing time, in Unix milliseconds:
+	// v3_<counter>_<timestamp>_<payload_type>_<data_base64>_<last_signature_base64>
+	SecuredDataVersion3 SecuredDataVersion = "v3"
+	// SecuredDataVersion4 extends SecuredDataVersion3 with the ID of the client signing, which is required:
+	// v4_<counter>_<timestamp>_<client_id>_<payload_type>_<data_base64>_<last_signature_base64>
+	SecuredDataVersion4 SecuredDataVersion = "v4"
+	// SecuredDataVersionRKSV is the receipt format of the Austrian cash register regulation (RKSV).
+	// The device signs the signing input of an ES256 JWS of the receipt fields, see rksv.go:
+	// eyJhbGciOiJFUzI1NiJ9.<base64url(_R1-AT0_<cash_register_id>_<counter>_<date_time>_<amounts>_<turnover>_<certificate_serial>_<chain_value>)>
+	SecuredDataVersionRKSV SecuredDataVersion = "rksv"
+
+	// DefaultSecuredDataVersion is used by devices created without choosing a format.
+	DefaultSecuredDataVersion = SecuredDataVersion2
+
+	securedDataSeparator = "_"
+)
+
+var (
+	ErrInvalidSecuredData          = errors.New("invalid secured data")
+	ErrUnknownSecuredDataFormat    = errors.New("unknown secured data format")
+	ErrUnsupportedPayloadForFormat = errors.New("payload type not supported by the secured data format")
+)
+
+// SecuredData is the data actually signed by a device: the payload chained
+// with the signature counter and the last signature of the device.
+type SecuredData struct {
+	Version SecuredDataVersion
+	Counter int
+	// Timestamp is only part of the formats which include it, zero otherwise.
+	Timestamp time.Time
+	// ClientID is only part of the formats which include it, empty otherwise.
+	ClientID string
+	Payload  Payload
+	// Receipt is only part of SecuredDataVersionRKSV, nil otherwise.
+	Receipt *RKSVReceipt
+	// LastSignature is the previous signature of the device, or its ID for the first one. Devices
+	// chaining with ChainingModeHash hold its record digest, and RKSV receipts their chain value instead.
+	LastSignature []byte
+}
+
+// SecuredDataFormat encodes and parses the data signed by a device.
+// Every device uses a single format, chosen on creation.
+type SecuredDataFormat interface {
+	Version() SecuredDataVersion
+	Encode(data SecuredData) (string, error)
+	Parse(raw string) (SecuredData, error)
+}
+
+var securedDataFormats = map[SecuredDataVersion]SecuredDataFormat{
+	SecuredDataVersion1:    securedDataFormatV1{},
+	SecuredDataVersion2:    securedDataFormatV2{},
+	SecuredDataVersion3:    securedDataFormatV3{},
+	SecuredDataVersion4:    securedDataFormatV4{},
+	SecuredDataVersionRKSV: securedDataFormatRKSV{},
+}
+
+// NewSecuredDataFormat returns the format with the given version.
+func NewSecuredDataFormat(version string) (SecuredDataFormat, error) {
+	format, ok := securedDataFormats[SecuredDataVersion(version)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSecuredDataFormat, version)
+	}
+	return format, nil
+}
+
+// ParseSecuredData splits signed data back into its fields, detecting its format
+// from its version prefix. Data without a version prefix is parsed as SecuredDataVersion1,
+// unless it's the JWS signing input of an RKSV receipt.
+func ParseSecuredData(raw string) (SecuredData, error) {
+	if strings.HasPrefix(raw, rksvJWSHeader+".") {
+		return securedDataFormatRKSV{}.Parse(raw)
+	}
+	version, _, _ := strings.Cut(raw, securedDataSeparator)
+	if format, ok := securedDataFormats[SecuredDataVersion(version)]; ok && version != string(SecuredDataVersion1) {
+		return format.Parse(raw)
+	}
+	return securedDataFormatV1{}.Parse(raw)
+}
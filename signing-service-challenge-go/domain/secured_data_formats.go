@@ -0,0 +1,272 @@
+package domain
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type securedDataFormatV1 struct{}
+
+func (securedDataFormatV1) Version() SecuredDataVersion {
+	return SecuredDataVersion1
+}
+
+func (securedDataFormatV1) Encode(data SecuredData) (string, error) {
+	if data.Payload.Type() != PayloadTypeText {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedPayloadForFormat, data.Payload.Type())
+	}
+	return strings.Join([]string{
+		strconv.Itoa(data.Counter),
+		string(data.Payload.Data()),
+		base64.StdEncoding.EncodeToString(data.LastSignature),
+	}, securedDataSeparator), nil
+}
+
+func (securedDataFormatV1) Parse(raw string) (SecuredData, error) {
+	// Neither the counter nor the base64 signature contain separators,
+	// so the data is whatever lies between the first and the last one.
+	first := strings.Index(raw, securedDataSeparator)
+	last := strings.LastIndex(raw, securedDataSeparator)
+	if first < 0 || first == last {
+		return SecuredData{}, fmt.Errorf("%w: missing fields", ErrInvalidSecuredData)
+	}
+
+	counter, err := parseCounter(raw[:first])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	payload, err := NewTextPayload(raw[first+1 : last])
+	if err != nil {
+		return SecuredData{}, errors.Join(ErrInvalidSecuredData, err)
+	}
+	lastSignature, err := parseBase64(raw[last+1:])
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	return SecuredData{
+		Version:       SecuredDataVersion1,
+		Counter:       counter,
+		Payload:       payload,
+		LastSignature: lastSignature,
+	}, nil
+}
+
+type securedDataFormatV2 struct{}
+
+func (securedDataFormatV2) Version() SecuredDataVersion {
+	return SecuredDataVersion2
+}
+
+func (securedDataFormatV2) Encode(data SecuredData) (string, error) {
+	// The standard base64 alphabet has no underscore, which keeps the fields unambiguous
+	return strings.Join([]string{
+		string(SecuredDataVersion2),
+		strconv.Itoa(data.Counter),
+		string(data.Payload.Type()),
+		base64.StdEncoding.EncodeToString(data.Payload.Data()),
+		base64.StdEncoding.EncodeToString(data.LastSignature),
+	}, securedDataSeparator), nil
+}
+
+func (securedDataFormatV2) Parse(raw string) (SecuredData, error) {
+	fields, err := splitFields(raw, SecuredDataVersion2, 5)
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	counter, err := parseCounter(fields[1])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	payload, err := parsePayload(fields[2], fields[3])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	lastSignature, err := parseBase64(fields[4])
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	return SecuredData{
+		Version:       SecuredDataVersion2,
+		Counter:       counter,
+		Payload:       payload,
+		LastSignature: lastSignature,
+	}, nil
+}
+
+type securedDataFormatV3 struct{}
+
+func (securedDataFormatV3) Version() SecuredDataVersion {
+	return SecuredDataVersion3
+}
+
+func (securedDataFormatV3) Encode(data SecuredData) (string, error) {
+	if data.Timestamp.IsZero() {
+		return "", fmt.Errorf("%w: missing timestamp", ErrInvalidSecuredData)
+	}
+	return strings.Join([]string{
+		string(SecuredDataVersion3),
+		strconv.Itoa(data.Counter),
+		strconv.FormatInt(data.Timestamp.UnixMilli(), 10),
+		string(data.Payload.Type()),
+		base64.StdEncoding.EncodeToString(data.Payload.Data()),
+		base64.StdEncoding.EncodeToString(data.LastSignature),
+	}, securedDataSeparator), nil
+}
+
+func (securedDataFormatV3) Parse(raw string) (SecuredData, error) {
+	fields, err := splitFields(raw, SecuredDataVersion3, 6)
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	counter, err := parseCounter(fields[1])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	timestamp, err := parseTimestamp(fields[2])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	payload, err := parsePayload(fields[3], fields[4])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	lastSignature, err := parseBase64(fields[5])
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	return SecuredData{
+		Version:       SecuredDataVersion3,
+		Counter:       counter,
+		Timestamp:     timestamp,
+		Payload:       payload,
+		LastSignature: lastSignature,
+	}, nil
+}
+
+type securedDataFormatV4 struct{}
+
+func (securedDataFormatV4) Version() SecuredDataVersion {
+	return SecuredDataVersion4
+}
+
+func (securedDataFormatV4) Encode(data SecuredData) (string, error) {
+	if data.Timestamp.IsZero() {
+		return "", fmt.Errorf("%w: missing timestamp", ErrInvalidSecuredData)
+	}
+	if err := checkClientID(data.ClientID); err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		string(SecuredDataVersion4),
+		strconv.Itoa(data.Counter),
+		strconv.FormatInt(data.Timestamp.UnixMilli(), 10),
+		data.ClientID,
+		string(data.Payload.Type()),
+		base64.StdEncoding.EncodeToString(data.Payload.Data()),
+		base64.StdEncoding.EncodeToString(data.LastSignature),
+	}, securedDataSeparator), nil
+}
+
+func (securedDataFormatV4) Parse(raw string) (SecuredData, error) {
+	fields, err := splitFields(raw, SecuredDataVersion4, 7)
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	counter, err := parseCounter(fields[1])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	timestamp, err := parseTimestamp(fields[2])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	if err := checkClientID(fields[3]); err != nil {
+		return SecuredData{}, err
+	}
+	payload, err := parsePayload(fields[4], fields[5])
+	if err != nil {
+		return SecuredData{}, err
+	}
+	lastSignature, err := parseBase64(fields[6])
+	if err != nil {
+		return SecuredData{}, err
+	}
+
+	return SecuredData{
+		Version:       SecuredDataVersion4,
+		Counter:       counter,
+		Timestamp:     timestamp,
+		ClientID:      fields[3],
+		Payload:       payload,
+		LastSignature: lastSignature,
+	}, nil
+}
+
+// checkClientID checks a client ID can be embedded as a field.
+func checkClientID(clientID string) error {
+	if clientID == "" {
+		return fmt.Errorf("%w: missing client ID", ErrInvalidSecuredData)
+	}
+	if strings.Contains(clientID, securedDataSeparator) {
+		return fmt.Errorf("%w: invalid client ID %q", ErrInvalidSecuredData, clientID)
+	}
+	return nil
+}
+
+func splitFields(raw string, version SecuredDataVersion, count int) ([]string, error) {
+	fields := strings.Split(raw, securedDataSeparator)
+	if len(fields) != count {
+		return nil, fmt.Errorf("%w: expected %d fields, got %d", ErrInvalidSecuredData, count, len(fields))
+	}
+	if fields[0] != string(version) {
+		return nil, fmt.Errorf("%w: expected version %s, got %q", ErrInvalidSecuredData, version, fields[0])
+	}
+	return fields, nil
+}
+
+func parseCounter(raw string) (int, error) {
+	counter, err := strconv.Atoi(raw)
+	if err != nil || counter < 0 || strconv.Itoa(counter) != raw {
+		return 0, fmt.Errorf("%w: invalid counter %q", ErrInvalidSecuredData, raw)
+	}
+	return counter, nil
+}
+
+// parseTimestamp parses a time in Unix milliseconds.
+func parseTimestamp(raw string) (time.Time, error) {
+	millis, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || millis <= 0 {
+		return time.Time{}, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidSecuredData, raw)
+	}
+	return time.UnixMilli(millis).UTC(), nil
+}
+
+func parsePayload(payloadType, data string) (Payload, error) {
+	decoded, err := parseBase64(data)
+	if err != nil {
+		return Payload{}, err
+	}
+	payload := Payload{payloadType: PayloadType(payloadType), data: decoded}
+	if err := payload.validate(); err != nil {
+		return Payload{}, errors.Join(ErrInvalidSecuredData, err)
+	}
+	return payload, nil
+}
+
+func parseBase64(raw string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSecuredData, err)
+	}
+	return decoded, nil
+}
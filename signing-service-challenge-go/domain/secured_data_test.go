@@ -0,0 +1,122 @@
+package domain_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+func Test_ParseSecuredData_RoundTrip(t *testing.T) {
+	testCases := map[string][]byte{
+		"text":   []byte("data_with_under_scores"),
+		"binary": {0x00, '_', 0xff, 0xfe},
+		"json":   []byte(`{"b": [1, 2.50], "a": "_"}`),
+	}
+	timestamp := time.UnixMilli(1700000000123).UTC()
+
+	for _, version := range []domain.SecuredDataVersion{domain.SecuredDataVersion2, domain.SecuredDataVersion3, domain.SecuredDataVersion4} {
+		format, err := domain.NewSecuredDataFormat(string(version))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+
+		clientID := ""
+		if version == domain.SecuredDataVersion4 {
+			clientID = "client-0"
+		}
+
+		for payloadType, data := range testCases {
+			payload, err := domain.NewPayload(payloadType, data)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			raw, err := format.Encode(domain.SecuredData{
+				Counter:       42,
+				Timestamp:     timestamp,
+				ClientID:      clientID,
+				Payload:       payload,
+				LastSignature: []byte("signature_0"),
+			})
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			parsed, err := domain.ParseSecuredData(raw)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			if parsed.Version != version {
+				t.Fatal("Expected version to be", version, "got", parsed.Version)
+			}
+			if version != domain.SecuredDataVersion2 && !parsed.Timestamp.Equal(timestamp) {
+				t.Fatal("Expected timestamp to be", timestamp, "got", parsed.Timestamp)
+			}
+			if parsed.ClientID != clientID {
+				t.Fatal("Expected client ID to be", clientID, "got", parsed.ClientID)
+			}
+			if parsed.Counter != 42 {
+				t.Fatal("Expected counter to be 42, got", parsed.Counter)
+			}
+			if parsed.Payload.Type() != payload.Type() || !bytes.Equal(parsed.Payload.Data(), payload.Data()) {
+				t.Fatal("Expected payload to be", string(payload.Data()), "got", string(parsed.Payload.Data()))
+			}
+			if string(parsed.LastSignature) != "signature_0" {
+				t.Fatal("Expected last signature to be signature_0, got", string(parsed.LastSignature))
+			}
+		}
+	}
+}
+
+func Test_ParseSecuredData_Version1(t *testing.T) {
+	parsed, err := domain.ParseSecuredData("3_data_with_under_scores_c2lnbmF0dXJlXzA=")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if parsed.Version != domain.SecuredDataVersion1 {
+		t.Fatal("Expected version to be v1, got", parsed.Version)
+	}
+	if parsed.Counter != 3 {
+		t.Fatal("Expected counter to be 3, got", parsed.Counter)
+	}
+	if string(parsed.Payload.Data()) != "data_with_under_scores" {
+		t.Fatal("Expected data to be data_with_under_scores, got", string(parsed.Payload.Data()))
+	}
+	if string(parsed.LastSignature) != "signature_0" {
+		t.Fatal("Expected last signature to be signature_0, got", string(parsed.LastSignature))
+	}
+}
+
+func Test_ParseSecuredData_Invalid_Error(t *testing.T) {
+	for _, raw := range []string{"", "no-separators", "x_data_c2ln", "v2_1_text_!!_c2ln", "v2_1_text_ZGF0YQ==", "v3_1_text_ZGF0YQ==_c2ln", "v3_1_0_text_ZGF0YQ==_c2ln", "v4_1_1700000000123_text_ZGF0YQ==_c2ln", "v4_1_1700000000123__text_ZGF0YQ==_c2ln"} {
+		_, err := domain.ParseSecuredData(raw)
+		if err == nil || !errors.Is(err, domain.ErrInvalidSecuredData) {
+			t.Fatal("Expected error to be", domain.ErrInvalidSecuredData, "for", raw, "got", err)
+		}
+	}
+}
+
+func Test_NewSecuredDataFormat_Unknown_Error(t *testing.T) {
+	_, err := domain.NewSecuredDataFormat("v0")
+
+	expectedError := domain.ErrUnknownSecuredDataFormat
+	if err == nil || !errors.Is(err, expectedError) {
+		t.Fatal("Expected error to be", expectedError, "got", err)
+	}
+}
+
+func Test_NewPayload_JSON_Canonicalized(t *testing.T) {
+	payload, err := domain.NewPayload("json", []byte(`{ "b": 1.0, "a": [true] }`))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expected := `{"a":[true],"b":1}`
+	if string(payload.Data()) != expected {
+		t.Fatal("Expected payload data to be", expected, "got", string(payload.Data()))
+	}
+}
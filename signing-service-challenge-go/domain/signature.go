@@ -11,23 +11,52 @@ var (
 	ErrMissingSignatureRawData  = errors.New("missing signature raw data")
 	ErrMissingSignatureValue    = errors.New("missing signature value")
 	ErrMissingSignatureTime     = errors.New("missing signature time")
+	ErrMissingSignatureVersion  = errors.New("missing signature secured data version")
+	ErrInvalidSignatureCounter  = errors.New("invalid signature counter")
+	ErrMissingPreviousSignature = errors.New("missing previous signature id")
+	ErrMissingSignatureEnvelope = errors.New("missing signature envelope")
 )
 
 type Signature struct {
-	deviceID  string
-	id        string
-	rawData   string
-	value     []byte
-	createdAt time.Time
+	deviceID string
+	id       string
+	// counter is the position of the signature in the chain of its device, starting at 0.
+	counter int
+	// previousID is the ID of the signature with the previous counter, empty for the first one.
+	previousID string
+	algorithm  SigningAlgorithm
+	version    SecuredDataVersion
+	rawData    string
+	value      []byte
+	createdAt  time.Time
+	// timestampToken is an optional RFC 3161 token over the value.
+	timestampToken []byte
+	format         SignatureFormat
+	// envelope is the encoded signature in its format, e.g. the JWS compact
+	// serialization. Raw signatures have none.
+	envelope []byte
+	// clientID is the client of the device which requested the signature, if any.
+	clientID string
+	// chainingMode is how the signature is chained to the previous one of its device.
+	chainingMode ChainingMode
 }
 
-func NewSignature(deviceID string, id string, rawData string, value []byte) (Signature, error) {
+// NewSignature restores a signature with all its attributes.
+// New signatures of a device should be created with Device.NewSignature.
+func NewSignature(deviceID, id string, counter int, previousID string, algorithm SigningAlgorithm, version SecuredDataVersion, rawData string, value []byte, createdAt time.Time) (Signature, error) {
 	s := Signature{
-		deviceID:  deviceID,
-		id:        id,
-		rawData:   rawData,
-		value:     value,
-		createdAt: time.Now(),
+		deviceID:   deviceID,
+		id:         id,
+		counter:    counter,
+		previousID: previousID,
+		algorithm:  algorithm,
+		version:    version,
+		rawData:    rawData,
+		value:      value,
+		createdAt:  createdAt.UTC(),
+		format:     SignatureFormatRaw,
+		// Restored signatures embed the previous signature unless told otherwise
+		chainingMode: ChainingModeSignature,
 	}
 
 	return s, s.validate()
@@ -40,6 +69,18 @@ func (s Signature) validate() error {
 	if s.deviceID == "" {
 		return ErrMissingSignatureDeviceID
 	}
+	if s.counter < 0 {
+		return ErrInvalidSignatureCounter
+	}
+	if s.counter > 0 && s.previousID == "" {
+		return ErrMissingPreviousSignature
+	}
+	if err := s.algorithm.validate(); err != nil {
+		return err
+	}
+	if s.version == "" {
+		return ErrMissingSignatureVersion
+	}
 	if s.rawData == "" {
 		return ErrMissingSignatureRawData
 	}
@@ -49,6 +90,9 @@ func (s Signature) validate() error {
 	if s.createdAt.IsZero() {
 		return ErrMissingSignatureTime
 	}
+	if s.format != SignatureFormatRaw && len(s.envelope) == 0 {
+		return ErrMissingSignatureEnvelope
+	}
 	return nil
 }
 
@@ -60,6 +104,25 @@ func (s Signature) ID() string {
 	return s.id
 }
 
+// Counter is the signature counter the signature was made with.
+func (s Signature) Counter() int {
+	return s.counter
+}
+
+// PreviousID is the ID of the previous signature of the device, empty for the first one.
+func (s Signature) PreviousID() string {
+	return s.previousID
+}
+
+func (s Signature) Algorithm() SigningAlgorithm {
+	return s.algorithm
+}
+
+// SecuredDataVersion is the format of the signed raw data.
+func (s Signature) SecuredDataVersion() SecuredDataVersion {
+	return s.version
+}
+
 func (s Signature) RawData() string {
 	return s.rawData
 }
@@ -67,3 +130,65 @@ func (s Signature) RawData() string {
 func (s Signature) Value() []byte {
 	return s.value
 }
+
+// CreatedAt is the signing time, in UTC.
+func (s Signature) CreatedAt() time.Time {
+	return s.createdAt
+}
+
+// TimestampToken is the RFC 3161 timestamp token over the signature value, if any.
+func (s Signature) TimestampToken() []byte {
+	return s.timestampToken
+}
+
+// WithTimestampToken returns a copy of the signature carrying the given timestamp token.
+func (s Signature) WithTimestampToken(token []byte) Signature {
+	s.timestampToken = token
+	return s
+}
+
+// ClientID is the client of the device which requested the signature, empty if none did.
+func (s Signature) ClientID() string {
+	return s.clientID
+}
+
+// WithClientID returns a copy of the signature requested by the given client.
+func (s Signature) WithClientID(clientID string) Signature {
+	s.clientID = clientID
+	return s
+}
+
+// ChainingMode is how the signature is chained to the previous one, ChainingModeSignature unless set with WithChainingMode.
+func (s Signature) ChainingMode() ChainingMode {
+	return s.chainingMode
+}
+
+// WithChainingMode returns a copy of the signature chained in the given mode.
+func (s Signature) WithChainingMode(mode ChainingMode) (Signature, error) {
+	if err := mode.validate(); err != nil {
+		return Signature{}, err
+	}
+	s.chainingMode = mode
+	return s, nil
+}
+
+// Format is the format of the signature, SignatureFormatRaw unless set with WithEnvelope.
+func (s Signature) Format() SignatureFormat {
+	return s.format
+}
+
+// Envelope is the encoded signature in its format, nil for raw signatures.
+// The value is the signature found in the envelope.
+func (s Signature) Envelope() []byte {
+	return s.envelope
+}
+
+// WithEnvelope returns a copy of the signature packaged in the given format.
+func (s Signature) WithEnvelope(format SignatureFormat, envelope []byte) (Signature, error) {
+	s.format = format
+	s.envelope = envelope
+	if err := format.validate(); err != nil {
+		return Signature{}, err
+	}
+	return s, s.validate()
+}
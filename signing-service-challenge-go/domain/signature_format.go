@@ -0,0 +1,48 @@
+package domain
+
+import "errors"
+
+// SignatureFormat is how a signature is packaged: a bare signature over the secured
+// data, or an envelope carrying the secured data as its payload.
+type SignatureFormat string
+
+const (
+	// SignatureFormatRaw is a bare signature over the secured data.
+	SignatureFormatRaw SignatureFormat = "raw"
+	// SignatureFormatJWS is a JWS compact serialization (RFC 7515) of the secured data.
+	SignatureFormatJWS SignatureFormat = "jws"
+	// SignatureFormatCMS is a detached CMS SignedData (RFC 5652) over the secured data,
+	// embedding the device certificate.
+	SignatureFormatCMS SignatureFormat = "cms"
+	// SignatureFormatCOSE is a COSE_Sign1 message (RFC 9052) carrying the secured data,
+	// for ECDSA and Ed25519 devices only.
+	SignatureFormatCOSE SignatureFormat = "cose"
+
+	DefaultSignatureFormat = SignatureFormatRaw
+)
+
+var (
+	ErrUnknownSignatureFormat     = errors.New("unknown signature format")
+	ErrUnsupportedSignatureFormat = errors.New("signature format not supported by the signing algorithm")
+)
+
+func (f SignatureFormat) validate() error {
+	switch f {
+	case SignatureFormatRaw, SignatureFormatJWS, SignatureFormatCMS, SignatureFormatCOSE:
+		return nil
+	}
+	return ErrUnknownSignatureFormat
+}
+
+func NewSignatureFormat(val string) (SignatureFormat, error) {
+	f := SignatureFormat(val)
+	return f, f.validate()
+}
+
+// Supports tells whether signatures of the algorithm can be made in the format.
+func (f SignatureFormat) Supports(algorithm SigningAlgorithm) bool {
+	if f == SignatureFormatCOSE {
+		return algorithm == SigningAlgorithmECDSA || algorithm == SigningAlgorithmEd25519
+	}
+	return true
+}
@@ -0,0 +1,254 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrMissingTransactionID      = errors.New("missing transaction id")
+	ErrInvalidTransactionNumber  = errors.New("invalid transaction number")
+	ErrInvalidTransactionTimeout = errors.New("invalid transaction timeout")
+	ErrTransactionStepOutOfOrder = errors.New("transaction step does not follow the last step of the transaction")
+	ErrTransactionFinished       = errors.New("transaction already finished")
+	ErrTransactionExpired        = errors.New("transaction timed out")
+)
+
+type TransactionState string
+
+const (
+	TransactionStateActive   TransactionState = "active"
+	TransactionStateFinished TransactionState = "finished"
+	// TransactionStateExpired is the state of the transactions left without steps past their timeout.
+	TransactionStateExpired TransactionState = "expired"
+)
+
+type TransactionStepType string
+
+const (
+	TransactionStepStart  TransactionStepType = "start"
+	TransactionStepUpdate TransactionStepType = "update"
+	TransactionStepFinish TransactionStepType = "finish"
+)
+
+// TransactionStep is a step of a transaction, signed by its device.
+type TransactionStep struct {
+	Type TransactionStepType
+	// Revision is the position of the step in the transaction, starting at 0.
+	Revision    int
+	SignatureID string
+	// SignatureCounter is the counter of the signature in the chain of the device.
+	SignatureCounter int
+	At               time.Time
+}
+
+// NewTransactionStep creates the step of the given type and revision signed by the signature.
+func NewTransactionStep(stepType TransactionStepType, revision int, signature Signature) TransactionStep {
+	return TransactionStep{
+		Type:             stepType,
+		Revision:         revision,
+		SignatureID:      signature.ID(),
+		SignatureCounter: signature.Counter(),
+		At:               signature.CreatedAt(),
+	}
+}
+
+// Transaction groups the signatures made by a device for a single business transaction,
+// from its start until it's finished, modeled after the transactions of the German TSEs.
+type Transaction struct {
+	id       string
+	deviceID string
+	// clientID is the client of the device signing the steps, if any.
+	clientID string
+	// number is the position of the transaction among those of its device, starting at 1.
+	number int
+	state  TransactionState
+	// timeout is how long the transaction is kept open without steps.
+	timeout time.Duration
+	steps   []TransactionStep
+	version int
+}
+
+// NewTransaction creates an active transaction from its start step, signed on behalf of the client if any.
+func NewTransaction(id, deviceID, clientID string, number int, timeout time.Duration, start TransactionStep) (Transaction, error) {
+	t := Transaction{
+		id:       id,
+		deviceID: deviceID,
+		clientID: clientID,
+		number:   number,
+		state:    TransactionStateActive,
+		timeout:  timeout,
+		steps:    []TransactionStep{start},
+	}
+	return t, t.validate()
+}
+
+func (t Transaction) validate() error {
+	if t.id == "" {
+		return ErrMissingTransactionID
+	}
+	if t.deviceID == "" {
+		return ErrMissingDeviceID
+	}
+	if t.number < 1 {
+		return ErrInvalidTransactionNumber
+	}
+	if t.timeout <= 0 {
+		return ErrInvalidTransactionTimeout
+	}
+	if start := t.steps[0]; start.Type != TransactionStepStart || start.Revision != 0 || start.SignatureID == "" {
+		return ErrTransactionStepOutOfOrder
+	}
+	return nil
+}
+
+func (t Transaction) ID() string {
+	return t.id
+}
+
+func (t Transaction) DeviceID() string {
+	return t.deviceID
+}
+
+// ClientID is the client of the device signing the steps, empty if none.
+func (t Transaction) ClientID() string {
+	return t.clientID
+}
+
+func (t Transaction) Number() int {
+	return t.number
+}
+
+// State is the state of the transaction as of its last change, see Expire.
+func (t Transaction) State() TransactionState {
+	return t.state
+}
+
+func (t Transaction) Timeout() time.Duration {
+	return t.timeout
+}
+
+// Steps are sorted by their revision.
+func (t Transaction) Steps() []TransactionStep {
+	return t.steps
+}
+
+// Revision is the revision of the last step of the transaction.
+func (t Transaction) Revision() int {
+	return t.lastStep().Revision
+}
+
+func (t Transaction) StartedAt() time.Time {
+	return t.steps[0].At
+}
+
+// UpdatedAt is the time of the last step of the transaction.
+func (t Transaction) UpdatedAt() time.Time {
+	return t.lastStep().At
+}
+
+// ExpiresAt is the time the transaction times out unless it gets a new step.
+func (t Transaction) ExpiresAt() time.Time {
+	return t.UpdatedAt().Add(t.timeout)
+}
+
+func (t Transaction) Version() int {
+	return t.version
+}
+
+// Open checks new steps can be added to the transaction at the given time.
+func (t Transaction) Open(at time.Time) error {
+	switch {
+	case t.state == TransactionStateFinished:
+		return ErrTransactionFinished
+	case t.state == TransactionStateExpired || at.After(t.ExpiresAt()):
+		return ErrTransactionExpired
+	}
+	return nil
+}
+
+// Expire closes the transaction if it timed out by the given time, reporting whether it did.
+func (t *Transaction) Expire(now time.Time) bool {
+	if t.state != TransactionStateActive || !now.After(t.ExpiresAt()) {
+		return false
+	}
+	t.state = TransactionStateExpired
+	t.version++
+	return true
+}
+
+// AddStep appends an update or finish step to the transaction, finishing it with the latter.
+// It must directly follow the last step of the active transaction. Whether the transaction
+// was open at the time of the step is checked when reserving it, see Device.ReserveTransactionStep.
+func (t *Transaction) AddStep(step TransactionStep) error {
+	switch t.state {
+	case TransactionStateFinished:
+		return ErrTransactionFinished
+	case TransactionStateExpired:
+		return ErrTransactionExpired
+	}
+	if step.Type == TransactionStepStart || step.Revision != t.Revision()+1 || step.SignatureID == "" {
+		return ErrTransactionStepOutOfOrder
+	}
+
+	t.steps = append(t.steps, step)
+	if step.Type == TransactionStepFinish {
+		t.state = TransactionStateFinished
+	}
+	t.version++
+	return nil
+}
+
+func (t Transaction) lastStep() TransactionStep {
+	return t.steps[len(t.steps)-1]
+}
+
+// transactionStepPayload is the JSON document signed for a transaction step.
+type transactionStepPayload struct {
+	TransactionNumber int                 `json:"transaction_number"`
+	Step              TransactionStepType `json:"step"`
+	Revision          int                 `json:"revision"`
+	PayloadType       PayloadType         `json:"payload_type,omitempty"`
+	Data              []byte              `json:"data,omitempty"`
+}
+
+// TransactionStepPayload is the payload the device signs for a step of one of its transactions:
+// the transaction number, step type and revision along with the optional data of the step,
+// as canonical JSON. It's a text payload for the secured data formats restricted to text.
+func (d Device) TransactionStepPayload(number int, stepType TransactionStepType, revision int, data *Payload) (Payload, error) {
+	document := transactionStepPayload{
+		TransactionNumber: number,
+		Step:              stepType,
+		Revision:          revision,
+	}
+	if data != nil {
+		document.PayloadType = data.Type()
+		document.Data = data.Data()
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return Payload{}, err
+	}
+
+	payload, err := NewPayload(string(PayloadTypeJSON), encoded)
+	if err != nil || d.securedDataFormat.Version() != SecuredDataVersion1 {
+		return payload, err
+	}
+	return NewTextPayload(string(payload.Data()))
+}
+
+var (
+	ErrTransactionNotFound        = errors.New("transaction not found")
+	ErrTransactionVersionMismatch = errors.New("transaction version mismatch")
+)
+
+type TransactionRepository interface {
+	Save(ctx context.Context, t Transaction) error
+	Update(ctx context.Context, t Transaction, expectedVersion int) error
+	// FindByID finds a transaction of the given device.
+	FindByID(ctx context.Context, deviceID, id string) (Transaction, error)
+	// ListByDevice lists the transactions of the device, sorted by their number.
+	ListByDevice(ctx context.Context, deviceID string) ([]Transaction, error)
+}
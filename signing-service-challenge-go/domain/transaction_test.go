@@ -0,0 +1,100 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+var transactionStart = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestTransaction(t *testing.T) domain.Transaction {
+	transaction, err := domain.NewTransaction("transaction_id_0", "device_id_0", "", 1, time.Minute, domain.TransactionStep{
+		Type:        domain.TransactionStepStart,
+		SignatureID: "signature_id_0",
+		At:          transactionStart,
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return transaction
+}
+
+func Test_Transaction_AddStep(t *testing.T) {
+	transaction := newTestTransaction(t)
+
+	update := domain.TransactionStep{Type: domain.TransactionStepUpdate, Revision: 1, SignatureID: "signature_id_1", At: transactionStart.Add(50 * time.Second)}
+	if err := transaction.AddStep(update); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !transaction.ExpiresAt().Equal(update.At.Add(time.Minute)) {
+		t.Fatal("Expected the timeout to restart on updates, got", transaction.ExpiresAt())
+	}
+
+	outOfOrder := domain.TransactionStep{Type: domain.TransactionStepFinish, Revision: 1, SignatureID: "signature_id_2", At: update.At}
+	if err := transaction.AddStep(outOfOrder); !errors.Is(err, domain.ErrTransactionStepOutOfOrder) {
+		t.Fatal("Expected", domain.ErrTransactionStepOutOfOrder, "got", err)
+	}
+
+	finish := domain.TransactionStep{Type: domain.TransactionStepFinish, Revision: 2, SignatureID: "signature_id_2", At: update.At}
+	if err := transaction.AddStep(finish); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if transaction.State() != domain.TransactionStateFinished || transaction.Version() != 2 {
+		t.Fatal("Expected a finished transaction at version 2, got", transaction.State(), transaction.Version())
+	}
+	if transaction.Expire(update.At.Add(time.Hour)) {
+		t.Fatal("Expected finished transactions not to expire")
+	}
+}
+
+func Test_Transaction_Expire(t *testing.T) {
+	transaction := newTestTransaction(t)
+
+	if transaction.Expire(transactionStart.Add(time.Minute)) {
+		t.Fatal("Expected the transaction to be open until its timeout")
+	}
+	late := domain.TransactionStep{Type: domain.TransactionStepUpdate, Revision: 1, SignatureID: "signature_id_1", At: transactionStart.Add(2 * time.Minute)}
+	if err := transaction.Open(late.At); !errors.Is(err, domain.ErrTransactionExpired) {
+		t.Fatal("Expected", domain.ErrTransactionExpired, "got", err)
+	}
+	if !transaction.Expire(late.At) || transaction.State() != domain.TransactionStateExpired {
+		t.Fatal("Expected the transaction to expire, got", transaction.State())
+	}
+	if err := transaction.AddStep(late); !errors.Is(err, domain.ErrTransactionExpired) {
+		t.Fatal("Expected", domain.ErrTransactionExpired, "got", err)
+	}
+}
+
+func Test_Device_ReserveTransactionStep(t *testing.T) {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	number := device.StartTransaction()
+	stored := device
+
+	if err := device.ReserveTransactionStep(number, domain.TransactionStepUpdate, 1); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	// A concurrent step of the same revision loses, and copies of the device are left untouched
+	if err := device.ReserveTransactionStep(number, domain.TransactionStepFinish, 1); !errors.Is(err, domain.ErrTransactionStepOutOfOrder) {
+		t.Fatal("Expected", domain.ErrTransactionStepOutOfOrder, "got", err)
+	}
+	if err := stored.ReserveTransactionStep(number, domain.TransactionStepFinish, 1); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	// Timed out transactions are only closed while no step was reserved since
+	if device.CloseTransaction(number, 0) {
+		t.Fatal("Expected the transaction not to close past its revision")
+	}
+	if !device.CloseTransaction(number, 1) {
+		t.Fatal("Expected the transaction to close")
+	}
+	if err := device.ReserveTransactionStep(number, domain.TransactionStepUpdate, 2); !errors.Is(err, domain.ErrTransactionStepOutOfOrder) {
+		t.Fatal("Expected", domain.ErrTransactionStepOutOfOrder, "got", err)
+	}
+}
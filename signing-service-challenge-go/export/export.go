@@ -0,0 +1,272 @@
+// Package export writes the TAR archives of the signature logs of the devices, handed over
+// for tax audits. Their layout follows the TAR exports of the German TSEs (DSFinV-K): one log
+// message per signature, the certificates or public key of the device and an index of the files.
+package export
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+const (
+	// IndexName is the name of the index of the files of an archive.
+	IndexName = "index.json"
+	// IndexSignatureName is the name of the signature of the device over the index.
+	IndexSignatureName = IndexName + ".sig"
+	// PublicKeyName is the name of the PEM encoded public key of the device.
+	PublicKeyName = "public_key.pem"
+	// CertificateName is the name of the DER encoded certificate of the device, when certified.
+	CertificateName = "certificate.cer"
+)
+
+var (
+	ErrArchiveClosed      = errors.New("export archive already closed")
+	ErrInvalidExportRange = errors.New("invalid export range")
+)
+
+// Range selects the signatures of an export, unbounded on the sides left unset.
+type Range struct {
+	// From and To bound the creation time of the signatures, inclusive.
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+	// CounterFrom and CounterTo bound the counters of the signatures, inclusive.
+	CounterFrom *int `json:"counter_from,omitempty"`
+	CounterTo   *int `json:"counter_to,omitempty"`
+}
+
+func (r Range) Validate() error {
+	if r.From != nil && r.To != nil && r.To.Before(*r.From) {
+		return fmt.Errorf("%w: to is before from", ErrInvalidExportRange)
+	}
+	if (r.CounterFrom != nil && *r.CounterFrom < 0) || (r.CounterTo != nil && *r.CounterTo < 0) {
+		return fmt.Errorf("%w: negative counter", ErrInvalidExportRange)
+	}
+	if r.CounterFrom != nil && r.CounterTo != nil && *r.CounterTo < *r.CounterFrom {
+		return fmt.Errorf("%w: counter_to is below counter_from", ErrInvalidExportRange)
+	}
+	return nil
+}
+
+// Signatures returns the signatures of the device in the range, sorted by their counter.
+// The signatures of a device are indexed by their counter, so counter ranges are sliced
+// instead of scanned; the result shares the storage of the device signatures.
+func (r Range) Signatures(device domain.Device) []domain.Signature {
+	first, last := r.Counters(device.SignaturesCount())
+	return device.Signatures()[first:last]
+}
+
+// Counters returns the counters of the range among count signatures, from first included
+// to last excluded. Creation times are left to IncludesTime.
+func (r Range) Counters(count int) (first int, last int) {
+	first, last = 0, count
+	if r.CounterFrom != nil {
+		first = min(*r.CounterFrom, last)
+	}
+	if r.CounterTo != nil {
+		last = max(first, min(*r.CounterTo+1, last))
+	}
+	return first, last
+}
+
+// IncludesTime tells whether signatures created at the given time are in the range.
+func (r Range) IncludesTime(at time.Time) bool {
+	return (r.From == nil || !at.Before(*r.From)) && (r.To == nil || !at.After(*r.To))
+}
+
+// LogMessage is the log message of a signature, as written to the archives.
+type LogMessage struct {
+	DeviceID            string `json:"device_id"`
+	SignatureID         string `json:"signature_id"`
+	SignatureCounter    int    `json:"signature_counter"`
+	PreviousSignatureID string `json:"previous_signature_id,omitempty"`
+	ClientID            string `json:"client_id,omitempty"`
+	LogTime             string `json:"log_time"`
+	Algorithm           string `json:"algorithm"`
+	SecuredDataVersion  string `json:"secured_data_version"`
+	ChainingMode        string `json:"chaining_mode"`
+	SignedData          string `json:"signed_data"`
+	Signature           []byte `json:"signature"`
+	SignatureFormat     string `json:"signature_format"`
+	// Envelope is the JWS, CMS or COSE_Sign1 envelope of the signature, omitted for raw ones.
+	Envelope       []byte `json:"envelope,omitempty"`
+	TimestampToken []byte `json:"timestamp_token,omitempty"`
+}
+
+// NewLogMessage gathers the log message of a signature.
+func NewLogMessage(signature domain.Signature) LogMessage {
+	return LogMessage{
+		DeviceID:            signature.DeviceID(),
+		SignatureID:         signature.ID(),
+		SignatureCounter:    signature.Counter(),
+		PreviousSignatureID: signature.PreviousID(),
+		ClientID:            signature.ClientID(),
+		LogTime:             signature.CreatedAt().UTC().Format(time.RFC3339Nano),
+		Algorithm:           string(signature.Algorithm()),
+		SecuredDataVersion:  string(signature.SecuredDataVersion()),
+		ChainingMode:        string(signature.ChainingMode()),
+		SignedData:          signature.RawData(),
+		Signature:           signature.Value(),
+		SignatureFormat:     string(signature.Format()),
+		Envelope:            signature.Envelope(),
+		TimestampToken:      signature.TimestampToken(),
+	}
+}
+
+// LogMessageName is the name of the log message of a signature, after the DSFinV-K naming:
+// Unixt_<unix_time>_Sig-<signature_counter>_Log.json
+func LogMessageName(signature domain.Signature) string {
+	return fmt.Sprintf("Unixt_%d_Sig-%d_Log.json", signature.CreatedAt().Unix(), signature.Counter())
+}
+
+// ChainCertificateName is the name of the DER encoded certificate of the i-th issuer of the device.
+func ChainCertificateName(i int) string {
+	return fmt.Sprintf("chain_%d.cer", i)
+}
+
+// IndexEntry describes a file of an archive.
+type IndexEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 []byte `json:"sha256"`
+}
+
+// Index lists the files of an archive along with their digests. It's signed by the device
+// at export time, so that the archive can be checked against its public key.
+type Index struct {
+	DeviceID   string `json:"device_id"`
+	KeyID      string `json:"key_id"`
+	Algorithm  string `json:"algorithm"`
+	ExportedAt string `json:"exported_at"`
+	// Range selects the signatures of the export.
+	Range           Range        `json:"range"`
+	SignaturesCount int          `json:"signatures_count"`
+	Files           []IndexEntry `json:"files"`
+}
+
+// Archive streams the files of an export to a TAR archive. Files are written as they are
+// added, only their index entries are kept until the archive is closed.
+type Archive struct {
+	writer  *tar.Writer
+	index   Index
+	modTime time.Time
+	closed  bool
+}
+
+// NewArchive starts the archive of the signatures of the device, exported at the given time.
+func NewArchive(w io.Writer, device domain.Device, exportedAt time.Time, signatures Range) *Archive {
+	return &Archive{
+		writer: tar.NewWriter(w),
+		index: Index{
+			DeviceID:   device.ID(),
+			KeyID:      device.KeyID(),
+			Algorithm:  string(device.Algorithm()),
+			ExportedAt: exportedAt.UTC().Format(time.RFC3339Nano),
+			Range:      signatures,
+			Files:      []IndexEntry{},
+		},
+		modTime: exportedAt,
+	}
+}
+
+// AddSignature writes the log message of a signature.
+func (a *Archive) AddSignature(signature domain.Signature) error {
+	content, err := json.Marshal(NewLogMessage(signature))
+	if err != nil {
+		return err
+	}
+	if err := a.Add(LogMessageName(signature), content); err != nil {
+		return err
+	}
+	a.index.SignaturesCount++
+	return nil
+}
+
+// AddKeys writes the certificate and issuers of the device if certified, its public key otherwise.
+func (a *Archive) AddKeys(device domain.Device) error {
+	if device.Certified() {
+		if err := a.Add(CertificateName, device.Certificate()); err != nil {
+			return err
+		}
+		for i, certificate := range device.CertificateChain() {
+			if err := a.Add(ChainCertificateName(i), certificate); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return err
+	}
+	encoded, err := crypto.MarshalPublicKeyPEM(publicKey)
+	if err != nil {
+		return err
+	}
+	return a.Add(PublicKeyName, encoded)
+}
+
+// Add writes a file and records it in the index.
+func (a *Archive) Add(name string, content []byte) error {
+	if a.closed {
+		return ErrArchiveClosed
+	}
+	if err := a.write(name, content); err != nil {
+		return err
+	}
+	digest := sha256.Sum256(content)
+	a.index.Files = append(a.index.Files, IndexEntry{
+		Name:   name,
+		Size:   int64(len(content)),
+		SHA256: digest[:],
+	})
+	return nil
+}
+
+// Close writes the index and its signature by the device, then terminates the archive.
+func (a *Archive) Close(signer crypto.Signer) error {
+	if a.closed {
+		return ErrArchiveClosed
+	}
+	a.closed = true
+
+	index, err := json.Marshal(a.index)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(index)
+	if err != nil {
+		return err
+	}
+	if err := a.write(IndexName, index); err != nil {
+		return err
+	}
+	if err := a.write(IndexSignatureName, signature); err != nil {
+		return err
+	}
+	return a.writer.Close()
+}
+
+func (a *Archive) write(name string, content []byte) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o444,
+		Size:     int64(len(content)),
+		ModTime:  a.modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := a.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := a.writer.Write(content)
+	return err
+}
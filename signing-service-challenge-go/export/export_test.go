@@ -0,0 +1,151 @@
+package export_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/export"
+)
+
+var start = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestDevice creates a device with signatures made a minute apart from start.
+func newTestDevice(t *testing.T, signaturesCount int) (domain.Device, crypto.KeyPair) {
+	keyPair, err := (&crypto.Ed25519Provider{}).Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ed25519", "device_label_0", keyPair.Public, keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	for i := 0; i < signaturesCount; i++ {
+		signature, err := device.NewSignature("signature_"+strconv.Itoa(i), "data_"+strconv.Itoa(i), []byte("value"), start.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := device.AddSignature(signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+	return device, keyPair
+}
+
+func Test_Range_Signatures(t *testing.T) {
+	device, _ := newTestDevice(t, 5)
+	one, three, ten := 1, 3, 10
+
+	tests := []struct {
+		signatures export.Range
+		expected   []int
+	}{
+		{export.Range{}, []int{0, 1, 2, 3, 4}},
+		{export.Range{CounterFrom: &one, CounterTo: &three}, []int{1, 2, 3}},
+		{export.Range{CounterFrom: &three}, []int{3, 4}},
+		{export.Range{CounterFrom: &ten}, nil},
+		{export.Range{CounterTo: &ten}, []int{0, 1, 2, 3, 4}},
+	}
+	for _, test := range tests {
+		var counters []int
+		for _, signature := range test.signatures.Signatures(device) {
+			counters = append(counters, signature.Counter())
+		}
+		if len(counters) != len(test.expected) {
+			t.Fatal("Expected counters", test.expected, "got", counters)
+		}
+		for i := range counters {
+			if counters[i] != test.expected[i] {
+				t.Fatal("Expected counters", test.expected, "got", counters)
+			}
+		}
+	}
+}
+
+func Test_Range_Validate_Error(t *testing.T) {
+	one, three, negative := 1, 3, -1
+	end := start.Add(-time.Second)
+
+	for _, signatures := range []export.Range{
+		{From: &start, To: &end},
+		{CounterFrom: &three, CounterTo: &one},
+		{CounterFrom: &negative},
+	} {
+		if err := signatures.Validate(); !errors.Is(err, export.ErrInvalidExportRange) {
+			t.Fatal("Expected error to be", export.ErrInvalidExportRange, "got", err)
+		}
+	}
+}
+
+func Test_Archive_SignedIndex(t *testing.T) {
+	device, keyPair := newTestDevice(t, 2)
+	signer, err := (&crypto.Ed25519SignerFactory{}).Build(context.Background(), keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	var buffer bytes.Buffer
+	archive := export.NewArchive(&buffer, device, start, export.Range{})
+	for _, signature := range device.Signatures() {
+		if err := archive.AddSignature(signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+	if err := archive.AddKeys(device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := archive.Close(signer); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := archive.Add("late.json", nil); !errors.Is(err, export.ErrArchiveClosed) {
+		t.Fatal("Expected error to be", export.ErrArchiveClosed, "got", err)
+	}
+
+	files := readArchive(t, &buffer)
+	expectedNames := []string{"Unixt_1704164645_Sig-0_Log.json", "Unixt_1704164705_Sig-1_Log.json", export.PublicKeyName}
+
+	var index export.Index
+	if err := json.Unmarshal(files[export.IndexName], &index); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if index.SignaturesCount != 2 || len(index.Files) != len(expectedNames) {
+		t.Fatal("Expected an index of 2 signatures and", len(expectedNames), "files, got", index)
+	}
+	for i, entry := range index.Files {
+		digest := sha256.Sum256(files[entry.Name])
+		if entry.Name != expectedNames[i] || !bytes.Equal(entry.SHA256, digest[:]) {
+			t.Fatal("Expected the digest of", expectedNames[i], "got", entry)
+		}
+	}
+	if err := (&crypto.Ed25519Verifier{}).Verify(device.PublicKey(), files[export.IndexName], files[export.IndexSignatureName]); err != nil {
+		t.Fatal("Expected a valid index signature, got", err)
+	}
+}
+
+func readArchive(t *testing.T, r io.Reader) map[string][]byte {
+	files := map[string][]byte{}
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		files[header.Name] = content
+	}
+}
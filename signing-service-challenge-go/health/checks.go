@@ -0,0 +1,137 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/google/uuid"
+)
+
+// RepositoryCheck makes a round-trip to the device repository looking up a device that can't exist.
+func RepositoryCheck(repository domain.DeviceRepository) Check {
+	return Check{
+		Component:     "repository",
+		Measurement:   "roundtrip",
+		ComponentID:   "devices",
+		ComponentType: "datastore",
+		Run: func(ctx context.Context) error {
+			_, err := repository.FindByID(ctx, "health-"+uuid.NewString())
+			if errors.Is(err, domain.ErrDeviceNotFound) {
+				return nil
+			}
+			if err == nil {
+				return errors.New("unexpected device found")
+			}
+			return err
+		},
+	}
+}
+
+// KEKCheck makes sure the key encryption key is loaded and wraps and unwraps keys.
+func KEKCheck(kek *crypto.KeyEncryptionKey) Check {
+	return Check{
+		Component:     "kek",
+		Measurement:   "roundtrip",
+		ComponentType: "component",
+		Run: func(ctx context.Context) error {
+			if kek == nil {
+				return errors.New("key encryption key not loaded")
+			}
+			wrapped, err := kek.Wrap(selfTestData)
+			if err != nil {
+				return fmt.Errorf("wrapping failed: %w", err)
+			}
+			unwrapped, err := kek.Unwrap(wrapped)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(unwrapped, selfTestData) {
+				return errors.New("unwrapped key mismatch")
+			}
+			return nil
+		},
+	}
+}
+
+// keyStoreSample bounds the devices whose keys are checked on every run of KeyStoreCheck.
+const keyStoreSample = 16
+
+// KeyStoreCheck makes sure the private and turnover keys stored with the devices can be read and
+// unwrapped by the loaded key encryption key, which fails when another KEK wrapped them.
+// It checks the first keyStoreSample devices by ID on every run, so that its outcome
+// doesn't depend on which devices it happens to pick.
+// TODO: replace with a dedicated sampling query once a relational backend exists.
+func KeyStoreCheck(repository domain.DeviceRepository, kek *crypto.KeyEncryptionKey) Check {
+	return Check{
+		Component:     "keystore",
+		Measurement:   "unwrap",
+		ComponentID:   "devices",
+		ComponentType: "datastore",
+		Run: func(ctx context.Context) error {
+			devices, err := repository.ListAll(ctx)
+			if err != nil {
+				return err
+			}
+			if len(devices) == 0 {
+				return nil
+			}
+			if kek == nil {
+				return errors.New("key encryption key not loaded")
+			}
+			slices.SortFunc(devices, func(a, b domain.Device) int {
+				return strings.Compare(a.ID(), b.ID())
+			})
+			for _, device := range devices[:min(len(devices), keyStoreSample)] {
+				if _, err := kek.Unwrap(device.PrivateKey()); err != nil {
+					return fmt.Errorf("device %s: %w", device.ID(), err)
+				}
+				if device.TurnoverKey() == nil {
+					continue
+				}
+				if _, err := kek.Unwrap(device.TurnoverKey()); err != nil {
+					return fmt.Errorf("device %s turnover key: %w", device.ID(), err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+var selfTestData = []byte("signing-service self-test")
+
+// SignerCheck signs with a throwaway key of the given algorithm and verifies the signature.
+// The key is generated once, here rather than on the first run, as generating RSA keys
+// could exceed the timeouts of the probes and report the service unready on startup.
+func SignerCheck(ctx context.Context, algorithm string, provider crypto.Provider, signerFactory crypto.SignerFactory, verifier crypto.Verifier) (Check, error) {
+	keyPair, err := provider.Provide(ctx)
+	if err != nil {
+		return Check{}, fmt.Errorf("key generation failed: %w", err)
+	}
+
+	return Check{
+		Component:     "signer",
+		Measurement:   "selftest",
+		ComponentID:   algorithm,
+		ComponentType: "component",
+		Run: func(ctx context.Context) error {
+			signer, err := signerFactory.Build(ctx, keyPair.Private)
+			if err != nil {
+				return fmt.Errorf("signer build failed: %w", err)
+			}
+			signature, err := signer.Sign(selfTestData)
+			if err != nil {
+				return fmt.Errorf("signing failed: %w", err)
+			}
+			if err := verifier.Verify(keyPair.Public, selfTestData, signature); err != nil {
+				return fmt.Errorf("verification failed: %w", err)
+			}
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,191 @@
+package health
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status values defined by the health check response format draft
+// (https://datatracker.ietf.org/doc/html/draft-inadarei-api-health-check).
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusWarn Status = "warn"
+
+	ContentType = "application/health+json"
+
+	defaultCheckTimeout = 2 * time.Second
+)
+
+// Response is the health check response of the service.
+type Response struct {
+	Status    Status                   `json:"status"`
+	Version   string                   `json:"version,omitempty"`
+	ReleaseID string                   `json:"releaseId,omitempty"`
+	ServiceID string                   `json:"serviceId,omitempty"`
+	Output    string                   `json:"output,omitempty"`
+	Notes     []string                 `json:"notes,omitempty"`
+	Checks    map[string][]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of a single component check.
+type CheckResult struct {
+	ComponentID   string `json:"componentId,omitempty"`
+	ComponentType string `json:"componentType,omitempty"`
+	Status        Status `json:"status"`
+	Time          string `json:"time"`
+	Output        string `json:"output,omitempty"`
+}
+
+// Check verifies the health of one of the components the service depends on.
+type Check struct {
+	// Component and Measurement compose the key of the check in the response, e.g. "repository:roundtrip".
+	Component     string
+	Measurement   string
+	ComponentID   string
+	ComponentType string
+	Run           func(ctx context.Context) error
+}
+
+func (c Check) key() string {
+	return c.Component + ":" + c.Measurement
+}
+
+// Checker evaluates the liveness and readiness of the service.
+type Checker struct {
+	serviceID string
+	version   string
+	releaseID string
+	timeout   time.Duration
+	checks    []Check
+}
+
+// NewChecker creates a Checker reporting the given version, with no readiness checks.
+func NewChecker(serviceID, version string) *Checker {
+	return &Checker{
+		serviceID: serviceID,
+		version:   version,
+		releaseID: releaseID(),
+		timeout:   defaultCheckTimeout,
+	}
+}
+
+// Register adds readiness checks.
+func (c *Checker) Register(checks ...Check) {
+	c.checks = append(c.checks, checks...)
+}
+
+// Live reports whether the process is up. It never depends on other components,
+// so that an orchestrator doesn't restart the service because of an outage elsewhere.
+func (c *Checker) Live() Response {
+	return c.response(StatusPass)
+}
+
+// Ready runs all the registered checks concurrently and reports whether the
+// service is able to serve requests. Failing components are listed in the output.
+func (c *Checker) Ready(ctx context.Context) Response {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	response := c.response(StatusPass)
+	response.Checks = make(map[string][]CheckResult)
+	var failing []string
+	for i, check := range c.checks {
+		response.Checks[check.key()] = append(response.Checks[check.key()], results[i])
+		if results[i].Status == StatusFail {
+			failing = append(failing, check.key())
+		}
+	}
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		response.Status = StatusFail
+		response.Output = "failing components: " + strings.Join(failing, ", ")
+	}
+	return response
+}
+
+func (c *Checker) response(status Status) Response {
+	return Response{
+		Status:    status,
+		Version:   c.version,
+		ReleaseID: c.releaseID,
+		ServiceID: c.serviceID,
+	}
+}
+
+func run(ctx context.Context, check Check) CheckResult {
+	result := CheckResult{
+		ComponentID:   check.ComponentID,
+		ComponentType: check.ComponentType,
+		Status:        StatusPass,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Output = err.Error()
+	}
+	result.Time = time.Now().UTC().Format(time.RFC3339)
+	return result
+}
+
+// BuildVersion returns the version set at link time if any, or the module
+// version recorded by the Go toolchain otherwise.
+func BuildVersion(linkedVersion string) string {
+	if linkedVersion != "" {
+		return linkedVersion
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "unknown"
+	}
+	return info.Main.Version
+}
+
+// releaseID identifies the exact build with the VCS revision recorded by the Go toolchain.
+func releaseID() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,163 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/health"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+)
+
+func Test_Checker_Ready_OK(t *testing.T) {
+	checker := health.NewChecker("service_id_0", "v1")
+	checker.Register(health.RepositoryCheck(persistence.NewInMemoryDeviceRepository()))
+
+	response := checker.Ready(context.Background())
+
+	if response.Status != health.StatusPass {
+		t.Fatal("Expected status to be pass, got", response.Status, response.Output)
+	}
+	if response.Version != "v1" {
+		t.Fatal("Expected version to be v1, got", response.Version)
+	}
+	if len(response.Checks["repository:roundtrip"]) != 1 {
+		t.Fatal("Expected the repository check to be reported, got", response.Checks)
+	}
+}
+
+func Test_Checker_Ready_FailingComponent(t *testing.T) {
+	checker := health.NewChecker("service_id_0", "v1")
+	checker.Register(
+		health.RepositoryCheck(persistence.NewInMemoryDeviceRepository()),
+		health.Check{
+			Component:   "broken",
+			Measurement: "status",
+			Run: func(ctx context.Context) error {
+				return errors.New("broken")
+			},
+		},
+	)
+
+	response := checker.Ready(context.Background())
+
+	if response.Status != health.StatusFail {
+		t.Fatal("Expected status to be fail, got", response.Status)
+	}
+	if response.Output != "failing components: broken:status" {
+		t.Fatal("Expected the failing component to be listed, got", response.Output)
+	}
+	if response.Checks["repository:roundtrip"][0].Status != health.StatusPass {
+		t.Fatal("Expected the repository check to pass, got", response.Checks["repository:roundtrip"][0])
+	}
+}
+
+func Test_Checker_Ready_KeyStore(t *testing.T) {
+	kek, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	otherKEK, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	wrapped, err := kek.Wrap([]byte("private_key_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice("device_id_0", "ed25519", "device_label_0", []byte("public_key_0"), wrapped)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	repository := persistence.NewInMemoryDeviceRepository()
+	if err := repository.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	checker := health.NewChecker("service_id_0", "v1")
+	checker.Register(health.KEKCheck(kek), health.KeyStoreCheck(repository, kek))
+	if response := checker.Ready(context.Background()); response.Status != health.StatusPass {
+		t.Fatal("Expected status to be pass, got", response.Status, response.Output)
+	}
+
+	// Keys wrapped by another KEK, or no KEK at all, fail readiness
+	checker = health.NewChecker("service_id_0", "v1")
+	checker.Register(health.KEKCheck(nil), health.KeyStoreCheck(repository, otherKEK))
+	response := checker.Ready(context.Background())
+	if response.Status != health.StatusFail {
+		t.Fatal("Expected status to be fail, got", response.Status)
+	}
+	if response.Output != "failing components: kek:roundtrip, keystore:unwrap" {
+		t.Fatal("Expected the KEK and key store to be listed, got", response.Output)
+	}
+}
+
+// countingProvider counts the key pairs it provides.
+type countingProvider struct {
+	crypto.Provider
+	provided int
+}
+
+func (p *countingProvider) Provide(ctx context.Context) (crypto.KeyPair, error) {
+	p.provided++
+	return p.Provider.Provide(ctx)
+}
+
+func Test_SignerCheck_GeneratesKeyOnce(t *testing.T) {
+	provider := &countingProvider{Provider: &crypto.Ed25519Provider{}}
+	check, err := health.SignerCheck(context.Background(), "ed25519", provider, &crypto.Ed25519SignerFactory{}, &crypto.Ed25519Verifier{})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if provider.provided != 1 {
+		t.Fatal("Expected the key to be generated on construction, got", provider.provided, "keys")
+	}
+
+	checker := health.NewChecker("service_id_0", "v1")
+	checker.Register(check)
+	for i := 0; i < 2; i++ {
+		if response := checker.Ready(context.Background()); response.Status != health.StatusPass {
+			t.Fatal("Expected status to be pass, got", response.Status, response.Output)
+		}
+	}
+	if provider.provided != 1 {
+		t.Fatal("Expected no key to be generated by the probes, got", provider.provided, "keys")
+	}
+}
+
+func Test_KeyStoreCheck_Deterministic(t *testing.T) {
+	kek, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	otherKEK, err := crypto.GenerateKeyEncryptionKey()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	repository := persistence.NewInMemoryDeviceRepository()
+	for i, wrapping := range []*crypto.KeyEncryptionKey{kek, otherKEK, kek} {
+		wrapped, err := wrapping.Wrap([]byte("private_key"))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		device, err := domain.NewDevice("device_id_"+strconv.Itoa(i), "ed25519", "", []byte("public_key"), wrapped)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := repository.Save(context.Background(), device); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+	}
+
+	// The key wrapped by another KEK is found on every run, whatever order the devices are listed in
+	check := health.KeyStoreCheck(repository, kek)
+	for i := 0; i < 10; i++ {
+		if err := check.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "device_id_1") {
+			t.Fatal("Expected the key of device_id_1 to fail, got", err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package jcs implements the JSON Canonicalization Scheme (RFC 8785).
+package jcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	ErrInvalidJSON    = errors.New("invalid JSON")
+	ErrDuplicateKey   = errors.New("duplicate object key")
+	ErrInvalidNumber  = errors.New("number not representable in I-JSON")
+	ErrTrailingTokens = errors.New("trailing data after JSON value")
+)
+
+// Canonicalize returns the canonical form of the given JSON text:
+// no insignificant whitespace, object members sorted by the UTF-16 code units
+// of their keys, and strings and numbers serialized as ECMAScript does.
+func Canonicalize(input []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+
+	var output bytes.Buffer
+	if err := canonicalizeValue(decoder, &output); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, ErrTrailingTokens
+	}
+	return output.Bytes(), nil
+}
+
+func canonicalizeValue(decoder *json.Decoder, output *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return errors.Join(ErrInvalidJSON, err)
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return canonicalizeObject(decoder, output)
+		case '[':
+			return canonicalizeArray(decoder, output)
+		}
+		return fmt.Errorf("%w: unexpected %q", ErrInvalidJSON, t)
+	case string:
+		writeString(output, t)
+	case json.Number:
+		number, err := formatNumber(t)
+		if err != nil {
+			return err
+		}
+		output.WriteString(number)
+	case bool:
+		output.WriteString(strconv.FormatBool(t))
+	case nil:
+		output.WriteString("null")
+	}
+	return nil
+}
+
+func canonicalizeObject(decoder *json.Decoder, output *bytes.Buffer) error {
+	members := make(map[string][]byte)
+	var keys []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return errors.Join(ErrInvalidJSON, err)
+		}
+		key := token.(string)
+		if _, ok := members[key]; ok {
+			return fmt.Errorf("%w: %q", ErrDuplicateKey, key)
+		}
+
+		var value bytes.Buffer
+		if err := canonicalizeValue(decoder, &value); err != nil {
+			return err
+		}
+		members[key] = value.Bytes()
+		keys = append(keys, key)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return errors.Join(ErrInvalidJSON, err)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return lessUTF16(keys[i], keys[j])
+	})
+
+	output.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			output.WriteByte(',')
+		}
+		writeString(output, key)
+		output.WriteByte(':')
+		output.Write(members[key])
+	}
+	output.WriteByte('}')
+	return nil
+}
+
+func canonicalizeArray(decoder *json.Decoder, output *bytes.Buffer) error {
+	output.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			output.WriteByte(',')
+		}
+		if err := canonicalizeValue(decoder, output); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return errors.Join(ErrInvalidJSON, err)
+	}
+	output.WriteByte(']')
+	return nil
+}
+
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// writeString serializes s as ECMAScript's JSON.stringify does.
+func writeString(output *bytes.Buffer, s string) {
+	output.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			output.WriteString(`\"`)
+		case '\\':
+			output.WriteString(`\\`)
+		case '\b':
+			output.WriteString(`\b`)
+		case '\f':
+			output.WriteString(`\f`)
+		case '\n':
+			output.WriteString(`\n`)
+		case '\r':
+			output.WriteString(`\r`)
+		case '\t':
+			output.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(output, `\u%04x`, r)
+			} else {
+				output.WriteRune(r)
+			}
+		}
+	}
+	output.WriteByte('"')
+}
+
+// formatNumber serializes a number as ECMAScript's Number.prototype.toString does for IEEE 754 doubles.
+func formatNumber(number json.Number) (string, error) {
+	f, err := strconv.ParseFloat(number.String(), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidNumber, number)
+	}
+	if f == 0 {
+		// Also covers -0
+		return "0", nil
+	}
+
+	abs := math.Abs(f)
+	if abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	// Go pads exponents to two digits and ECMAScript doesn't, e.g. 1e-07 vs 1e-7
+	formatted := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exponent, _ := strings.Cut(formatted, "e")
+	sign, digits := exponent[:1], strings.TrimLeft(exponent[1:], "0")
+	return mantissa + "e" + sign + digits, nil
+}
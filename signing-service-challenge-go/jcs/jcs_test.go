@@ -0,0 +1,38 @@
+package jcs_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jcs"
+)
+
+func Test_Canonicalize(t *testing.T) {
+	testCases := map[string]string{
+		// Examples from RFC 8785, sections 3.2.2 and 3.2.3
+		`{"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+		  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+		  "literals": [null, true, false]}`: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		`{"€": "Euro Sign", "\r": "Carriage Return", "\ufb33": "Hebrew Letter Dalet With Dagesh",
+		  "1": "One", "😀": "Emoji: Grinning Face", "\u0080": "Control", "ö": "Latin Small Letter O With Diaeresis"}`: `{"\r":"Carriage Return","1":"One","` + "\u0080" + `":"Control","ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign","😀":"Emoji: Grinning Face","` + "\ufb33" + `":"Hebrew Letter Dalet With Dagesh"}`,
+		`[-0, 1e21, 1e-7, 123456789012345680000]`: `[0,1e+21,1e-7,123456789012345680000]`,
+	}
+
+	for input, expected := range testCases {
+		canonical, err := jcs.Canonicalize([]byte(input))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if string(canonical) != expected {
+			t.Fatal("Expected canonical form to be", expected, "got", string(canonical))
+		}
+	}
+}
+
+func Test_Canonicalize_DuplicateKey_Error(t *testing.T) {
+	_, err := jcs.Canonicalize([]byte(`{"a": 1, "a": 2}`))
+
+	if err == nil || !errors.Is(err, jcs.ErrDuplicateKey) {
+		t.Fatal("Expected error to be", jcs.ErrDuplicateKey, "got", err)
+	}
+}
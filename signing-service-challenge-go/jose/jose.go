@@ -0,0 +1,186 @@
+// Package jose packages device signatures as JWS compact serializations (RFC 7515).
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	signingcrypto "github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+// JWS algorithms (RFC 7518, RFC 8037) of the device signatures.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmPS256 = "PS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmES384 = "ES384"
+	AlgorithmES512 = "ES512"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported JWS algorithm")
+	ErrMalformedJWS         = errors.New("malformed JWS")
+	ErrAlgorithmMismatch    = errors.New("unexpected JWS algorithm")
+)
+
+// Header is the protected header of the device signatures.
+type Header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// Counter is the signature counter of the device, a private header parameter.
+	Counter int `json:"counter"`
+}
+
+// JWS is a signed JWS.
+type JWS struct {
+	Header    Header
+	Payload   []byte
+	Signature []byte
+	// protected is the encoded protected header as signed, which may differ from
+	// the encoding of Header when parsed.
+	protected string
+}
+
+// AlgorithmOf is the JWS algorithm of the signatures of the crypto signers of the algorithm for the given key.
+func AlgorithmOf(algorithm domain.SigningAlgorithm, publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch algorithm {
+		case domain.SigningAlgorithmRSA:
+			return AlgorithmRS256, nil
+		case domain.SigningAlgorithmRSAPSS:
+			return AlgorithmPS256, nil
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return AlgorithmES256, nil
+		case 384:
+			return AlgorithmES384, nil
+		case 521:
+			return AlgorithmES512, nil
+		}
+	case ed25519.PublicKey:
+		return AlgorithmEdDSA, nil
+	}
+	return "", ErrUnsupportedAlgorithm
+}
+
+// Sign creates a JWS of the payload. The signer must make signatures of the header algorithm.
+func Sign(signer signingcrypto.Signer, header Header, payload []byte) (JWS, error) {
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return JWS{}, err
+	}
+	jws := JWS{
+		Header:    header,
+		Payload:   payload,
+		protected: base64.RawURLEncoding.EncodeToString(encodedHeader),
+	}
+
+	signature, err := signer.Sign(jws.SigningInput())
+	if err != nil {
+		return JWS{}, err
+	}
+	jws.Signature, err = toJOSESignature(header.Algorithm, signature)
+	if err != nil {
+		return JWS{}, err
+	}
+	return jws, nil
+}
+
+// Parse decodes a JWS compact serialization.
+func Parse(compact string) (JWS, error) {
+	parts := strings.Split(compact, ".")
+	if len(parts) != 3 {
+		return JWS{}, ErrMalformedJWS
+	}
+	encodedHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return JWS{}, errors.Join(ErrMalformedJWS, err)
+	}
+	var header Header
+	if err := json.Unmarshal(encodedHeader, &header); err != nil {
+		return JWS{}, errors.Join(ErrMalformedJWS, err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return JWS{}, errors.Join(ErrMalformedJWS, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return JWS{}, errors.Join(ErrMalformedJWS, err)
+	}
+
+	return JWS{
+		Header:    header,
+		Payload:   payload,
+		Signature: signature,
+		protected: parts[0],
+	}, nil
+}
+
+// SigningInput is the data the signature is made over.
+func (j JWS) SigningInput() []byte {
+	return []byte(j.protected + "." + base64.RawURLEncoding.EncodeToString(j.Payload))
+}
+
+// Compact is the JWS compact serialization.
+func (j JWS) Compact() string {
+	return string(j.SigningInput()) + "." + base64.RawURLEncoding.EncodeToString(j.Signature)
+}
+
+// Verify checks the JWS is signed with the given algorithm by the key of the public key.
+// The verifier must check signatures of that algorithm.
+func (j JWS) Verify(algorithm string, verifier signingcrypto.Verifier, publicKey []byte) error {
+	if j.Header.Algorithm != algorithm {
+		return ErrAlgorithmMismatch
+	}
+	signature, err := fromJOSESignature(algorithm, j.Signature)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(publicKey, j.SigningInput(), signature)
+}
+
+// ecdsaSize is the size of the coordinates of the curve of ECDSA algorithms, 0 for the others.
+func ecdsaSize(algorithm string) (int, error) {
+	switch algorithm {
+	case AlgorithmRS256, AlgorithmPS256, AlgorithmEdDSA:
+		return 0, nil
+	case AlgorithmES256:
+		return 32, nil
+	case AlgorithmES384:
+		return 48, nil
+	case AlgorithmES512:
+		return 66, nil
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// toJOSESignature turns the ASN.1 ECDSA signatures of the crypto signers into the
+// fixed size R || S concatenation of JWS. Other signatures are kept as is.
+func toJOSESignature(algorithm string, signature []byte) ([]byte, error) {
+	size, err := ecdsaSize(algorithm)
+	if err != nil || size == 0 {
+		return signature, err
+	}
+	return signingcrypto.ConcatECDSASignature(signature, size)
+}
+
+// fromJOSESignature is the inverse of toJOSESignature.
+func fromJOSESignature(algorithm string, signature []byte) ([]byte, error) {
+	size, err := ecdsaSize(algorithm)
+	if err != nil || size == 0 {
+		return signature, err
+	}
+	return signingcrypto.ASN1ECDSASignature(signature, size)
+}
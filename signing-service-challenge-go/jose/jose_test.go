@@ -0,0 +1,132 @@
+package jose_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/jose"
+)
+
+type algorithm struct {
+	algorithm     domain.SigningAlgorithm
+	provider      crypto.Provider
+	signerFactory crypto.SignerFactory
+	verifier      crypto.Verifier
+	jwsAlgorithm  string
+}
+
+var algorithms = map[string]algorithm{
+	"rsa": {
+		domain.SigningAlgorithmRSA, &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}},
+		&crypto.RSASignerFactory{}, &crypto.RSAVerifier{}, jose.AlgorithmRS256,
+	},
+	"rsa-pss": {
+		domain.SigningAlgorithmRSAPSS, &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}},
+		&crypto.RSAPSSSignerFactory{}, &crypto.RSAPSSVerifier{}, jose.AlgorithmPS256,
+	},
+	"ecdsa": {
+		domain.SigningAlgorithmECDSA, &crypto.ECDSAProvider{},
+		&crypto.ECDSASignerFactory{}, &crypto.ECDSAVerifier{}, jose.AlgorithmES384,
+	},
+	"ed25519": {
+		domain.SigningAlgorithmEd25519, &crypto.Ed25519Provider{},
+		&crypto.Ed25519SignerFactory{}, &crypto.Ed25519Verifier{}, jose.AlgorithmEdDSA,
+	},
+}
+
+func signJWS(t *testing.T, a algorithm) (jose.JWS, crypto.KeyPair) {
+	keyPair, err := a.provider.Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	publicKey, err := crypto.ParsePublicKey(keyPair.Public)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	jwsAlgorithm, err := jose.AlgorithmOf(a.algorithm, publicKey)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if jwsAlgorithm != a.jwsAlgorithm {
+		t.Fatal("Expected", a.jwsAlgorithm, "got", jwsAlgorithm)
+	}
+	signer, err := a.signerFactory.Build(context.Background(), keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	header := jose.Header{Algorithm: jwsAlgorithm, KeyID: "device:1", Counter: 7}
+	jws, err := jose.Sign(signer, header, []byte("v2_7_text_ZGF0YQ_bGFzdA"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return jws, keyPair
+}
+
+func Test_Sign_Parse_Verify(t *testing.T) {
+	for name, a := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			jws, keyPair := signJWS(t, a)
+
+			parsed, err := jose.Parse(jws.Compact())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if parsed.Header != jws.Header {
+				t.Fatal("Expected header", jws.Header, "got", parsed.Header)
+			}
+			if string(parsed.Payload) != "v2_7_text_ZGF0YQ_bGFzdA" {
+				t.Fatal("Expected the secured data as payload, got", string(parsed.Payload))
+			}
+			if err := parsed.Verify(a.jwsAlgorithm, a.verifier, keyPair.Public); err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			parsed.Payload = []byte("v2_8_text_ZGF0YQ_bGFzdA")
+			if err := parsed.Verify(a.jwsAlgorithm, a.verifier, keyPair.Public); !errors.Is(err, crypto.ErrInvalidSignature) {
+				t.Fatal("Expected", crypto.ErrInvalidSignature, "got", err)
+			}
+		})
+	}
+}
+
+func Test_Sign_ECDSASignatureIsRS(t *testing.T) {
+	jws, keyPair := signJWS(t, algorithms["ecdsa"])
+
+	if len(jws.Signature) != 96 {
+		t.Fatal("Expected a 96 bytes R || S signature, got", len(jws.Signature), "bytes")
+	}
+	publicKey, err := crypto.ParsePublicKey(keyPair.Public)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	digest := sha512.Sum384(jws.SigningInput())
+	r := new(big.Int).SetBytes(jws.Signature[:48])
+	s := new(big.Int).SetBytes(jws.Signature[48:])
+	if !ecdsa.Verify(publicKey.(*ecdsa.PublicKey), digest[:], r, s) {
+		t.Fatal("Expected a valid ES384 signature")
+	}
+}
+
+func Test_Verify_AlgorithmMismatch(t *testing.T) {
+	jws, keyPair := signJWS(t, algorithms["rsa"])
+
+	err := jws.Verify(jose.AlgorithmPS256, &crypto.RSAPSSVerifier{}, keyPair.Public)
+	if !errors.Is(err, jose.ErrAlgorithmMismatch) {
+		t.Fatal("Expected", jose.ErrAlgorithmMismatch, "got", err)
+	}
+}
+
+func Test_Parse_Malformed(t *testing.T) {
+	for _, compact := range []string{"", "a.b", "!.e30.AA", "e30.!.AA"} {
+		if _, err := jose.Parse(compact); !errors.Is(err, jose.ErrMalformedJWS) {
+			t.Fatal("Expected", jose.ErrMalformedJWS, "for", compact, "got", err)
+		}
+	}
+}
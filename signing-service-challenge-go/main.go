@@ -1,45 +1,541 @@
 package main
 
 import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/api"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/queries"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/config"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/health"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/logging"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/metrics"
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/qr"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/ratelimit"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/receipt"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tsa"
 )
 
-const (
-	ListenAddress = ":8080"
-)
+// Version can be set at build time with -ldflags "-X main.Version=...",
+// otherwise the module version recorded by the Go toolchain is used.
+var Version = ""
 
 func main() {
 
-	logger := slog.Default()
+	version := health.BuildVersion(Version)
+
+	cfg, options, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if err != nil {
+		log.Fatal("Could not load the configuration: ", err)
+	}
+	if options.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal("Could not print the configuration: ", err)
+		}
+		return
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Logging.Format, cfg.Logging.Level)
+	if err != nil {
+		log.Fatal("Could not configure logging: ", err)
+	}
+	slog.SetDefault(logger)
+
+	// Cancelled on shutdown, stopping the server and the background jobs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Tracing.Enabled {
+		exporter, err := tracing.NewOTLPExporter(context.Background(), cfg.Tracing.OTLPEndpoint)
+		if err != nil {
+			log.Fatal("Could not create the OTLP exporter: ", err)
+		}
+		shutdown, err := tracing.Setup(exporter, version)
+		if err != nil {
+			log.Fatal("Could not set up tracing: ", err)
+		}
+		defer shutdown(context.Background())
+	}
+
+	serviceMetrics := metrics.New()
+
+	// Signature chains are also read a page at a time, e.g. for exports
+	store := persistence.NewInMemoryDeviceRepository()
+	deviceRepository := metrics.NewDeviceRepository(serviceMetrics,
+		tracing.NewDeviceRepository(store),
+	)
+	signatureRepository := metrics.NewSignatureRepository(serviceMetrics,
+		tracing.NewSignatureRepository(store),
+	)
 
-	deviceRepository := persistence.NewInMemoryDeviceRepository()
+	supportedAlgorithms, err := algorithms(cfg.Crypto)
+	if err != nil {
+		log.Fatal("Could not configure the signing algorithms: ", err)
+	}
+
+	timestampAuthority, timestampVerifier, err := timestamping(cfg.Timestamping)
+	if err != nil {
+		log.Fatal("Could not configure timestamping: ", err)
+	}
+
+	var transparencyLog *transparency.Log
+	if cfg.Transparency.Enabled {
+		transparencyLog, err = loadTransparencyLog(cfg.Transparency)
+		if err != nil {
+			log.Fatal("Could not configure the transparency log: ", err)
+		}
+		// Serve a tree head, even empty, from the start
+		if _, err := transparencyLog.Publish(); err != nil {
+			log.Fatal("Could not publish the first tree head: ", err)
+		}
+		go transparencyLog.Run(ctx, cfg.Transparency.PublishInterval, func(err error) {
+			slog.Error("Failed to publish a tree head", slog.String("error", err.Error()))
+		})
+	}
+
+	kek, err := keyEncryptionKey(cfg.Crypto)
+	if err != nil {
+		log.Fatal("Could not load the key encryption key: ", err)
+	}
 
 	createDeviceCommandHandler := commands.CreateDeviceCommandHandler{
-		DeviceRepository: deviceRepository,
-		KeyProviderResolver: map[string]crypto.Provider{
-			"rsa":   &crypto.RSAProvider{},
-			"ecdsa": &crypto.ECDSAProvider{},
+		DeviceRepository:    deviceRepository,
+		KeyProviderResolver: map[string]crypto.Provider{},
+		RKSVKeyProvider: &crypto.WrappingProvider{
+			KEK:  kek,
+			Next: &crypto.ECDSAProvider{ECCGenerator: crypto.ECCGenerator{Curve: elliptic.P256()}},
 		},
+		KEK: kek,
+	}
+	if cfg.Certificates.Enabled {
+		certificateAuthority, err := certificateAuthority(cfg.Certificates)
+		if err != nil {
+			log.Fatal("Could not configure the certificate authority: ", err)
+		}
+		createDeviceCommandHandler.CertificateIssuer = certificateAuthority
 	}
-
 	createSignatureCommandHandler := commands.CreateSignatureCommandHandler{
+		DeviceRepository:      deviceRepository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{},
+		MaxRetries:            cfg.Signing.MaxRetries,
+		TimestampAuthority:    timestampAuthority,
+		Observer:              serviceMetrics,
+		TurnoverKeys:          kek,
+	}
+	if transparencyLog != nil {
+		createSignatureCommandHandler.TransparencyLog = transparencyLog
+	}
+	auditDeviceQueryHandler := &queries.AuditDeviceQueryHandler{
+		DeviceRepository:  deviceRepository,
+		VerifierResolver:  map[domain.SigningAlgorithm]crypto.Verifier{},
+		TimestampVerifier: timestampVerifier,
+		TurnoverKeys:      kek,
+	}
+	verifySignatureQueryHandler := &queries.VerifySignatureQueryHandler{
 		DeviceRepository: deviceRepository,
-		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
-			domain.SigningAlgorithmRSA:   &crypto.RSASignerFactory{},
-			domain.SigningAlgorithmECDSA: &crypto.ECDSASignerFactory{},
+		VerifierResolver: auditDeviceQueryHandler.VerifierResolver,
+	}
+	receiptTemplates, err := receiptTemplates(cfg.Receipts)
+	if err != nil {
+		log.Fatal("Could not configure the receipt templates: ", err)
+	}
+	transactionRepository := persistence.NewInMemoryTransactionRepository()
+	expireTransactionsCommandHandler := &commands.ExpireTransactionsCommandHandler{
+		DeviceRepository:      deviceRepository,
+		TransactionRepository: transactionRepository,
+		MaxRetries:            cfg.Signing.MaxRetries,
+		Observer:              serviceMetrics,
+	}
+	go expireTransactionsCommandHandler.Run(ctx, cfg.Transactions.SweepInterval, func(err error) {
+		slog.Error("Failed to expire the timed out transactions", slog.String("error", err.Error()))
+	})
+
+	healthChecker := health.NewChecker("signing-service", version)
+	healthChecker.Register(
+		health.RepositoryCheck(deviceRepository),
+		health.KEKCheck(kek),
+		health.KeyStoreCheck(deviceRepository, kek),
+	)
+	for _, name := range cfg.Crypto.Algorithms {
+		a := supportedAlgorithms[name]
+		// Device private keys are only stored wrapped by the KEK
+		provider := &crypto.WrappingProvider{KEK: kek, Next: a.provider}
+		signerFactory := &crypto.UnwrappingSignerFactory{KEK: kek, Next: a.signerFactory}
+		createDeviceCommandHandler.KeyProviderResolver[name] = metrics.NewProvider(serviceMetrics, name, provider)
+		createSignatureCommandHandler.SignerFactoryResolver[domain.SigningAlgorithm(name)] = tracing.NewSignerFactory(name, signerFactory)
+		auditDeviceQueryHandler.VerifierResolver[domain.SigningAlgorithm(name)] = a.verifier
+		signerCheck, err := health.SignerCheck(ctx, name, provider, signerFactory, a.verifier)
+		if err != nil {
+			log.Fatal("Could not set up the ", name, " signer check: ", err)
+		}
+		healthChecker.Register(signerCheck)
+	}
+
+	serverOptions := []api.ServerOption{
+		api.WithMiddleware(tracing.Middleware, serviceMetrics.Middleware),
+		api.WithMetricsHandler(serviceMetrics.Handler()),
+		api.WithHealthChecker(healthChecker),
+		api.WithAuditDeviceQueryHandler(auditDeviceQueryHandler),
+		api.WithExportDeviceQueryHandler(&queries.ExportDeviceQueryHandler{
+			DeviceRepository:      deviceRepository,
+			SignatureRepository:   signatureRepository,
+			SignerFactoryResolver: createSignatureCommandHandler.SignerFactoryResolver,
+		}),
+		api.WithVerifySignatureQueryHandler(verifySignatureQueryHandler),
+		api.WithGetDeviceQueryHandler(&queries.GetDeviceQueryHandler{DeviceRepository: deviceRepository}),
+		api.WithListDevicesQueryHandler(&queries.ListDevicesQueryHandler{DeviceRepository: deviceRepository}),
+		api.WithTransactions(
+			&commands.StartTransactionCommandHandler{
+				TransactionRepository: transactionRepository,
+				SignatureHandler:      &createSignatureCommandHandler,
+				Timeout:               cfg.Transactions.Timeout,
+			},
+			&commands.TransactionStepCommandHandler{
+				TransactionRepository: transactionRepository,
+				SignatureHandler:      &createSignatureCommandHandler,
+			},
+			&queries.GetTransactionQueryHandler{TransactionRepository: transactionRepository},
+			&queries.ListTransactionsQueryHandler{
+				DeviceRepository:      deviceRepository,
+				TransactionRepository: transactionRepository,
+			},
+		),
+		api.WithClients(
+			&commands.RegisterClientCommandHandler{DeviceRepository: deviceRepository, Observer: serviceMetrics},
+			&commands.DeregisterClientCommandHandler{DeviceRepository: deviceRepository, Observer: serviceMetrics},
+			&queries.ListClientsQueryHandler{DeviceRepository: deviceRepository},
+		),
+		api.WithSignatureReceiptQueryHandler(
+			&queries.GetSignatureReceiptQueryHandler{
+				DeviceRepository: deviceRepository,
+				TemplateResolver: receiptTemplates,
+				DefaultTemplate:  cfg.Receipts.DefaultTemplate,
+			},
+			qrLevels[cfg.Receipts.ErrorCorrection],
+		),
+		api.WithExternalCertification(
+			&commands.CreateCertificateRequestCommandHandler{
+				DeviceRepository:      deviceRepository,
+				SignerFactoryResolver: createSignatureCommandHandler.SignerFactoryResolver,
+			},
+			&commands.ImportCertificateCommandHandler{
+				DeviceRepository: deviceRepository,
+				MaxRetries:       cfg.Signing.MaxRetries,
+				Observer:         serviceMetrics,
+			},
+		),
+		api.WithTimeouts(api.Timeouts{
+			ReadHeader: cfg.Server.ReadHeaderTimeout,
+			Read:       cfg.Server.ReadTimeout,
+			Write:      cfg.Server.WriteTimeout,
+			Idle:       cfg.Server.IdleTimeout,
+		}),
+	}
+	if cfg.RateLimit.Enabled {
+		serverOptions = append(serverOptions, api.WithRateLimiters(
+			ratelimit.NewInMemoryLimiter(cfg.RateLimit.PerClient.Rate, cfg.RateLimit.PerClient.Burst),
+			ratelimit.NewInMemoryLimiter(cfg.RateLimit.PerDevice.Rate, cfg.RateLimit.PerDevice.Burst),
+		))
+	}
+	if transparencyLog != nil {
+		serverOptions = append(serverOptions, api.WithTransparencyLog(
+			&queries.GetTreeHeadQueryHandler{Log: transparencyLog},
+			&queries.GetInclusionProofQueryHandler{Log: transparencyLog},
+			&queries.GetConsistencyProofQueryHandler{Log: transparencyLog},
+		))
+	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := loadTLSConfig(cfg.TLS)
+		if err != nil {
+			log.Fatal("Could not configure TLS: ", err)
+		}
+		serverOptions = append(serverOptions, api.WithTLSConfig(tlsConfig))
+	}
+
+	server := api.NewServer(cfg.Server.ListenAddress, logger, createDeviceCommandHandler, createSignatureCommandHandler, serverOptions...)
+
+	if err := server.Run(ctx); err != nil {
+		log.Fatal("Could not run the server on ", cfg.Server.ListenAddress, ": ", err)
+	}
+}
+
+// algorithm bundles what the service needs to support a signing algorithm.
+type algorithm struct {
+	provider      crypto.Provider
+	signerFactory crypto.SignerFactory
+	verifier      crypto.Verifier
+}
+
+// algorithms lists the signing algorithms the service can be configured with.
+func algorithms(cfg config.CryptoConfig) (map[string]algorithm, error) {
+	curve, err := crypto.CurveByName(cfg.ECDSACurve)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]algorithm{
+		string(domain.SigningAlgorithmRSA): {
+			provider:      &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: cfg.RSAKeySize}},
+			signerFactory: &crypto.RSASignerFactory{},
+			verifier:      &crypto.RSAVerifier{},
 		},
+		string(domain.SigningAlgorithmECDSA): {
+			provider:      &crypto.ECDSAProvider{ECCGenerator: crypto.ECCGenerator{Curve: curve}},
+			signerFactory: &crypto.ECDSASignerFactory{},
+			verifier:      &crypto.ECDSAVerifier{},
+		},
+		string(domain.SigningAlgorithmRSAPSS): {
+			provider:      &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: cfg.RSAKeySize}},
+			signerFactory: &crypto.RSAPSSSignerFactory{},
+			verifier:      &crypto.RSAPSSVerifier{},
+		},
+		string(domain.SigningAlgorithmEd25519): {
+			provider:      &crypto.Ed25519Provider{},
+			signerFactory: &crypto.Ed25519SignerFactory{},
+			verifier:      &crypto.Ed25519Verifier{},
+		},
+	}, nil
+}
+
+func keyEncryptionKey(cfg config.CryptoConfig) (*crypto.KeyEncryptionKey, error) {
+	if cfg.KEKFile == "" {
+		slog.Warn("No crypto.kek_file given, the device private keys are wrapped with a throwaway key encryption key")
+		return crypto.GenerateKeyEncryptionKey()
+	}
+	encoded, err := os.ReadFile(cfg.KEKFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("%s must hold a base64 encoded key: %w", cfg.KEKFile, err)
+	}
+	return crypto.NewKeyEncryptionKey(key)
+}
+
+func loadTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		caBytes, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caBytes) {
+			return nil, errors.New("no certificates found in " + cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// timestamping builds the authority timestamping the signatures and the verifier
+// checking its tokens, both nil when timestamping is disabled.
+func timestamping(cfg config.TimestampingConfig) (tsa.Authority, *tsa.Verifier, error) {
+	roots := x509.NewCertPool()
+	if cfg.CAFile != "" {
+		caBytes, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !roots.AppendCertsFromPEM(caBytes) {
+			return nil, nil, errors.New("no certificates found in " + cfg.CAFile)
+		}
+	}
+
+	switch cfg.Mode {
+	case config.TimestampingModeLocal:
+		authority, err := localAuthority(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		roots.AddCert(authority.Certificate())
+		return authority, &tsa.Verifier{Roots: roots}, nil
+	case config.TimestampingModeRemote:
+		client := &tsa.Client{
+			URL:        cfg.URL,
+			HTTPClient: &http.Client{Timeout: cfg.Timeout},
+			Roots:      roots,
+		}
+		return client, &tsa.Verifier{Roots: roots}, nil
+	}
+	return nil, nil, nil
+}
+
+func localAuthority(cfg config.TimestampingConfig) (*tsa.LocalAuthority, error) {
+	var authority *tsa.LocalAuthority
+	if cfg.CertFile == "" {
+		slog.Warn("No timestamping.cert_file given, the built-in timestamp authority uses a throwaway identity")
+		generated, err := tsa.GenerateLocalAuthority()
+		if err != nil {
+			return nil, err
+		}
+		authority = generated
+	} else {
+		keyPair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keyPair.PrivateKey.(stdcrypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported timestamp authority key")
+		}
+		authority, err = tsa.NewLocalAuthority(certificate, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	policy, err := parseOID(cfg.Policy)
+	if err != nil {
+		return nil, err
 	}
+	authority.Policy = policy
+	return authority, nil
+}
 
-	server := api.NewServer(ListenAddress, logger, createDeviceCommandHandler, createSignatureCommandHandler)
+func parseOID(value string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+	for _, arc := range strings.Split(value, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", value)
+		}
+		oid = append(oid, n)
+	}
+	return oid, nil
+}
 
-	if err := server.Run(); err != nil {
-		log.Fatal("Could not start server on ", ListenAddress)
+func certificateAuthority(cfg config.CertificatesConfig) (*pki.CertificateAuthority, error) {
+	var authority *pki.CertificateAuthority
+	if cfg.CACertFile == "" {
+		slog.Warn("No certificates.ca_cert_file given, the device certificates are issued by a throwaway CA")
+		generated, err := pki.GenerateCertificateAuthority()
+		if err != nil {
+			return nil, err
+		}
+		authority = generated
+	} else {
+		keyPair, err := tls.LoadX509KeyPair(cfg.CACertFile, cfg.CAKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certificates := make([]*x509.Certificate, 0, len(keyPair.Certificate))
+		for _, der := range keyPair.Certificate {
+			certificate, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, err
+			}
+			certificates = append(certificates, certificate)
+		}
+		key, ok := keyPair.PrivateKey.(stdcrypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported certificate authority key")
+		}
+		authority, err = pki.NewCertificateAuthority(certificates[0], key, certificates[1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	authority.Validity = cfg.Validity
+	return authority, nil
+}
+
+func loadTransparencyLog(cfg config.TransparencyConfig) (*transparency.Log, error) {
+	if cfg.KeyFile == "" {
+		slog.Warn("No transparency.key_file given, the tree heads of the transparency log are signed with a throwaway key")
+		return transparency.GenerateLog()
+	}
+	keyBytes, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found in " + cfg.KeyFile)
+	}
+	var key any
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(stdcrypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported transparency log key")
+	}
+	return transparency.NewLog(signer)
+}
+
+var qrLevels = map[string]qr.Level{
+	"L": qr.LevelL,
+	"M": qr.LevelM,
+	"Q": qr.LevelQ,
+	"H": qr.LevelH,
+}
+
+// receiptTemplates resolves the built-in receipt templates along with the configured ones,
+// which can't override them, and checks the default template is one of them.
+func receiptTemplates(cfg config.ReceiptsConfig) (map[string]receipt.Template, error) {
+	templates := map[string]receipt.Template{
+		receipt.DefaultTemplateName: receipt.DefaultTemplate,
+		receipt.RKSVTemplateName:    receipt.RKSVTemplate,
+	}
+	for name, layout := range cfg.Templates {
+		if _, ok := templates[name]; ok {
+			return nil, fmt.Errorf("template %q: built-in templates can't be overridden", name)
+		}
+		template, err := receipt.NewTextTemplate(name, layout)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", name, err)
+		}
+		templates[name] = template
+	}
+	if _, ok := templates[cfg.DefaultTemplate]; cfg.DefaultTemplate != "" && !ok {
+		return nil, fmt.Errorf("default template %q is not a known template", cfg.DefaultTemplate)
 	}
+	return templates, nil
 }
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+)
+
+// Provider decorates a crypto.Provider to time key pair generation.
+type Provider struct {
+	next      crypto.Provider
+	algorithm string
+	metrics   *Metrics
+}
+
+// NewProvider wraps the given provider, labelling its metrics with the given algorithm.
+func NewProvider(metrics *Metrics, algorithm string, next crypto.Provider) *Provider {
+	return &Provider{
+		next:      next,
+		algorithm: algorithm,
+		metrics:   metrics,
+	}
+}
+
+func (p *Provider) Provide(ctx context.Context) (crypto.KeyPair, error) {
+	start := time.Now()
+	keyPair, err := p.next.Provide(ctx)
+	if err == nil {
+		p.metrics.keyGenerationDuration.WithLabelValues(p.algorithm).Observe(time.Since(start).Seconds())
+	}
+	return keyPair, err
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "signing_service"
+
+// Metrics holds the Prometheus collectors exposed by the service.
+// It is meant to be shared by the decorators of this package.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+
+	signaturesCreated     *prometheus.CounterVec
+	deviceConflicts       prometheus.Counter
+	deviceRetries         prometheus.Counter
+	keyGenerationDuration *prometheus.HistogramVec
+
+	repositoryDuration *prometheus.HistogramVec
+}
+
+// New creates and registers all the service collectors in a dedicated registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests handled, by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests, by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		signaturesCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signatures_created_total",
+			Help:      "Number of signatures created, by algorithm.",
+		}, []string{"algorithm"}),
+		deviceConflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "device_conflicts_total",
+			Help:      "Number of optimistic concurrency conflicts on device updates, e.g. while creating signatures.",
+		}),
+		deviceRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "device_retries_total",
+			Help:      "Number of device updates, e.g. signature creations, attempted again after a conflict.",
+		}),
+		keyGenerationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "key_generation_duration_seconds",
+			Help:      "Duration of key pair generation, by algorithm.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"algorithm"}),
+		repositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "repository",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of repository operations, by repository, operation and outcome.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"repository", "operation", "outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.signaturesCreated,
+		m.deviceConflicts,
+		m.deviceRetries,
+		m.keyGenerationDuration,
+		m.repositoryDuration,
+	)
+
+	return m
+}
+
+// SignaturesCreated counts the signatures persisted on a device, see commands.Observer.
+func (m *Metrics) SignaturesCreated(algorithm domain.SigningAlgorithm, count int) {
+	m.signaturesCreated.WithLabelValues(string(algorithm)).Add(float64(count))
+}
+
+// Retried counts a command attempted again after a concurrent update of a device, see commands.Observer.
+func (m *Metrics) Retried() {
+	m.deviceRetries.Inc()
+}
+
+// Handler returns the HTTP handler exposing the collected metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,138 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/application/commands"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/metrics"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/go-chi/chi"
+)
+
+// scrape returns the text exposition of the metrics.
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return string(body)
+}
+
+func expectSamples(t *testing.T, exposition string, samples ...string) {
+	for _, sample := range samples {
+		if !strings.Contains(exposition, sample+"\n") {
+			t.Fatal("Expected sample", sample, "got", exposition)
+		}
+	}
+}
+
+// conflictingRepository fails the first update of a device as if it had been updated concurrently.
+type conflictingRepository struct {
+	domain.DeviceRepository
+	conflicted bool
+}
+
+func (r *conflictingRepository) Update(ctx context.Context, device domain.Device, expectedVersion int) error {
+	if !r.conflicted {
+		r.conflicted = true
+		return domain.ErrDeviceVersionMismatch
+	}
+	return r.DeviceRepository.Update(ctx, device, expectedVersion)
+}
+
+func Test_DeviceRepository_SignatureConflict(t *testing.T) {
+	m := metrics.New()
+	repository := metrics.NewDeviceRepository(m, &conflictingRepository{DeviceRepository: persistence.NewInMemoryDeviceRepository()})
+
+	createDeviceCommandHandler := commands.CreateDeviceCommandHandler{
+		DeviceRepository:    repository,
+		KeyProviderResolver: map[string]crypto.Provider{"ed25519": metrics.NewProvider(m, "ed25519", &crypto.Ed25519Provider{})},
+	}
+	createDevice, err := commands.NewCreateDeviceCommand("ed25519", "", "", "", "", false)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := createDeviceCommandHandler.Handle(context.Background(), createDevice)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	createSignatureCommandHandler := commands.CreateSignatureCommandHandler{
+		DeviceRepository: repository,
+		SignerFactoryResolver: map[domain.SigningAlgorithm]crypto.SignerFactory{
+			domain.SigningAlgorithmEd25519: &crypto.Ed25519SignerFactory{},
+		},
+		Observer: m,
+	}
+	createSignature, err := commands.NewCreateSignatureCommand(device.ID(), "", commands.SignaturePayload{Data: []byte("data_to_be_signed")}, "")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := createSignatureCommandHandler.Handle(context.Background(), createSignature); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	expectSamples(t, scrape(t, m),
+		`signing_service_signatures_created_total{algorithm="ed25519"} 1`,
+		`signing_service_device_conflicts_total 1`,
+		`signing_service_device_retries_total 1`,
+		`signing_service_devices{algorithm="ed25519"} 1`,
+		`signing_service_key_generation_duration_seconds_count{algorithm="ed25519"} 1`,
+		`signing_service_repository_operation_duration_seconds_count{operation="update",outcome="error",repository="device"} 1`,
+		`signing_service_repository_operation_duration_seconds_count{operation="update",outcome="success",repository="device"} 1`,
+		`signing_service_repository_operation_duration_seconds_count{operation="find_by_id",outcome="success",repository="device"} 2`,
+	)
+}
+
+func Test_Metrics_Middleware(t *testing.T) {
+	m := metrics.New()
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Get("/devices/{deviceID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/devices/device_id_0", "/devices/device_id_1", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expectSamples(t, scrape(t, m),
+		`signing_service_http_requests_total{method="GET",route="/devices/{deviceID}",status="404"} 2`,
+		`signing_service_http_request_duration_seconds_count{method="GET",route="/devices/{deviceID}",status="404"} 2`,
+		`signing_service_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	)
+}
+
+func Test_SignatureRepository_ListSignatures(t *testing.T) {
+	m := metrics.New()
+	store := persistence.NewInMemoryDeviceRepository()
+	device, err := domain.NewDevice("device_id_0", "ed25519", "device_label_0", []byte("public_key_0"), []byte("private_key_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := store.Save(context.Background(), device); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	repository := metrics.NewSignatureRepository(m, store)
+
+	if _, err := repository.ListSignatures(context.Background(), device.ID(), 0, 10); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := repository.ListSignatures(context.Background(), "unknown", 0, 10); err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+
+	expectSamples(t, scrape(t, m),
+		`signing_service_repository_operation_duration_seconds_count{operation="list_signatures",outcome="success",repository="signature"} 1`,
+		`signing_service_repository_operation_duration_seconds_count{operation="list_signatures",outcome="error",repository="signature"} 1`,
+	)
+}
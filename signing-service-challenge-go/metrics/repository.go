@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const deviceCountTimeout = 5 * time.Second
+
+// DeviceRepository decorates a domain.DeviceRepository to time its operations, and to count
+// the concurrent update conflicts. It also reports the number of stored devices per algorithm when scraped.
+type DeviceRepository struct {
+	next    domain.DeviceRepository
+	metrics *Metrics
+	devices *prometheus.Desc
+}
+
+// NewDeviceRepository wraps the given repository and registers its device count collector.
+func NewDeviceRepository(metrics *Metrics, next domain.DeviceRepository) *DeviceRepository {
+	r := &DeviceRepository{
+		next:    next,
+		metrics: metrics,
+		devices: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "devices"),
+			"Number of signature devices, by algorithm.",
+			[]string{"algorithm"}, nil,
+		),
+	}
+	metrics.registry.MustRegister(r)
+	return r
+}
+
+func (r *DeviceRepository) Save(ctx context.Context, d domain.Device) (err error) {
+	defer r.observe("save", time.Now(), &err)
+	return r.next.Save(ctx, d)
+}
+
+func (r *DeviceRepository) Update(ctx context.Context, d domain.Device, expectedVersion int) (err error) {
+	defer r.observe("update", time.Now(), &err)
+	err = r.next.Update(ctx, d, expectedVersion)
+	if errors.Is(err, domain.ErrDeviceVersionMismatch) {
+		r.metrics.deviceConflicts.Inc()
+	}
+	return err
+}
+
+func (r *DeviceRepository) FindByID(ctx context.Context, id string) (d domain.Device, err error) {
+	defer r.observe("find_by_id", time.Now(), &err)
+	return r.next.FindByID(ctx, id)
+}
+
+func (r *DeviceRepository) ListAll(ctx context.Context) (d []domain.Device, err error) {
+	defer r.observe("list_all", time.Now(), &err)
+	return r.next.ListAll(ctx)
+}
+
+func (r *DeviceRepository) observe(operation string, start time.Time, err *error) {
+	r.metrics.observeRepository("device", operation, start, *err)
+}
+
+// Describe implements prometheus.Collector.
+func (r *DeviceRepository) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.devices
+}
+
+// Collect implements prometheus.Collector.
+// TODO: replace with a dedicated count query once a relational backend exists.
+func (r *DeviceRepository) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), deviceCountTimeout)
+	defer cancel()
+
+	devices, err := r.next.ListAll(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(r.devices, err)
+		return
+	}
+
+	counts := make(map[domain.SigningAlgorithm]int)
+	for _, device := range devices {
+		counts[device.Algorithm()]++
+	}
+	for algorithm, count := range counts {
+		ch <- prometheus.MustNewConstMetric(r.devices, prometheus.GaugeValue, float64(count), string(algorithm))
+	}
+}
+
+// SignatureRepository decorates a domain.SignatureRepository to time its reads.
+type SignatureRepository struct {
+	next    domain.SignatureRepository
+	metrics *Metrics
+}
+
+// NewSignatureRepository wraps the given repository.
+func NewSignatureRepository(metrics *Metrics, next domain.SignatureRepository) *SignatureRepository {
+	return &SignatureRepository{next: next, metrics: metrics}
+}
+
+func (r *SignatureRepository) ListSignatures(ctx context.Context, deviceID string, fromCounter int, limit int) (s []domain.Signature, err error) {
+	defer func(start time.Time) {
+		r.metrics.observeRepository("signature", "list_signatures", start, err)
+	}(time.Now())
+	return r.next.ListSignatures(ctx, deviceID, fromCounter, limit)
+}
+
+// observeRepository times an operation of the given repository, by outcome.
+func (m *Metrics) observeRepository(repository string, operation string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	m.repositoryDuration.WithLabelValues(repository, operation, outcome).Observe(time.Since(start).Seconds())
+}
@@ -2,6 +2,8 @@ package persistence
 
 import (
 	"context"
+	"slices"
+	"sort"
 	"sync"
 
 	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
@@ -19,6 +21,10 @@ func NewInMemoryDeviceRepository() *InMemoryDeviceRepository {
 }
 
 func (r *InMemoryDeviceRepository) Save(ctx context.Context, device domain.Device) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
@@ -30,6 +36,12 @@ func (r *InMemoryDeviceRepository) Update(ctx context.Context, device domain.Dev
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
+	// Checked while holding the lock so that a request cancelled while
+	// waiting for it never commits a new signature counter value.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	existingDevice, ok := r.data[device.ID()]
 	if !ok {
 		return domain.ErrDeviceNotFound
@@ -43,6 +55,10 @@ func (r *InMemoryDeviceRepository) Update(ctx context.Context, device domain.Dev
 }
 
 func (r *InMemoryDeviceRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Device{}, err
+	}
+
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 
@@ -54,6 +70,10 @@ func (r *InMemoryDeviceRepository) FindByID(ctx context.Context, id string) (dom
 }
 
 func (r *InMemoryDeviceRepository) ListAll(ctx context.Context) ([]domain.Device, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.lock.RLock()
 	defer r.lock.RUnlock()
 
@@ -64,3 +84,100 @@ func (r *InMemoryDeviceRepository) ListAll(ctx context.Context) ([]domain.Device
 	}
 	return result, nil
 }
+
+// ListSignatures implements domain.SignatureRepository. The page is copied out of the
+// stored device, whose signatures are indexed by their counter.
+func (r *InMemoryDeviceRepository) ListSignatures(ctx context.Context, deviceID string, fromCounter int, limit int) ([]domain.Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	device, ok := r.data[deviceID]
+	if !ok {
+		return nil, domain.ErrDeviceNotFound
+	}
+	signatures := device.Signatures()
+	first := min(max(fromCounter, 0), len(signatures))
+	last := min(first+max(limit, 0), len(signatures))
+	return slices.Clone(signatures[first:last]), nil
+}
+
+type InMemoryTransactionRepository struct {
+	data map[string]domain.Transaction
+	lock sync.RWMutex
+}
+
+func NewInMemoryTransactionRepository() *InMemoryTransactionRepository {
+	return &InMemoryTransactionRepository{
+		data: make(map[string]domain.Transaction),
+	}
+}
+
+func (r *InMemoryTransactionRepository) Save(ctx context.Context, transaction domain.Transaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.data[transaction.ID()] = transaction
+	return nil
+}
+
+func (r *InMemoryTransactionRepository) Update(ctx context.Context, transaction domain.Transaction, expectedVersion int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	existingTransaction, ok := r.data[transaction.ID()]
+	if !ok || existingTransaction.DeviceID() != transaction.DeviceID() {
+		return domain.ErrTransactionNotFound
+	}
+	if existingTransaction.Version() != expectedVersion {
+		return domain.ErrTransactionVersionMismatch
+	}
+
+	r.data[transaction.ID()] = transaction
+	return nil
+}
+
+func (r *InMemoryTransactionRepository) FindByID(ctx context.Context, deviceID, id string) (domain.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return domain.Transaction{}, err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	transaction, ok := r.data[id]
+	if !ok || transaction.DeviceID() != deviceID {
+		return domain.Transaction{}, domain.ErrTransactionNotFound
+	}
+	return transaction, nil
+}
+
+func (r *InMemoryTransactionRepository) ListByDevice(ctx context.Context, deviceID string) ([]domain.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	// TODO: index the transactions by device
+	var result []domain.Transaction
+	for _, transaction := range r.data {
+		if transaction.DeviceID() == deviceID {
+			result = append(result, transaction)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Number() < result[j].Number() })
+	return result, nil
+}
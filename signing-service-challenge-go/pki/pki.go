@@ -0,0 +1,193 @@
+// Package pki issues X.509 certificates binding the device keys to their identity.
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"time"
+
+	signingcrypto "github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/google/uuid"
+)
+
+// DefaultValidity is the lifetime of device certificates unless configured otherwise.
+const DefaultValidity = 3 * 365 * 24 * time.Hour
+
+var (
+	ErrNotCertificateAuthority = errors.New("certificate is not a CA")
+	ErrKeyMismatch             = errors.New("key does not match the certificate")
+)
+
+var maxSerialNumber = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// Certificate is a DER encoded certificate along with the DER encoded
+// certificates of its issuers, starting with the direct one.
+type Certificate struct {
+	Leaf  []byte
+	Chain [][]byte
+}
+
+// Issuer certifies the public keys of devices.
+type Issuer interface {
+	Issue(ctx context.Context, device domain.Device) (Certificate, error)
+}
+
+// CertificateAuthority is the internal CA issuing certificates to the devices.
+type CertificateAuthority struct {
+	certificate *x509.Certificate
+	key         crypto.Signer
+	chain       []*x509.Certificate
+	// Validity of the issued certificates, DefaultValidity if unset.
+	// They never outlive the CA certificate.
+	Validity time.Duration
+	// Clock is optional, domain.SystemClock if unset.
+	Clock domain.Clock
+}
+
+// NewCertificateAuthority creates a CA issuing certificates with the given key.
+// The chain holds the certificates of the issuers of the CA certificate, if any.
+func NewCertificateAuthority(certificate *x509.Certificate, key crypto.Signer, chain []*x509.Certificate) (*CertificateAuthority, error) {
+	if !certificate.IsCA || certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, ErrNotCertificateAuthority
+	}
+	if err := checkKey(certificate, key.Public()); err != nil {
+		return nil, err
+	}
+	return &CertificateAuthority{
+		certificate: certificate,
+		key:         key,
+		chain:       chain,
+	}, nil
+}
+
+// GenerateCertificateAuthority creates a CA with a fresh key and a self-signed certificate.
+// The certificates it issues can only be verified as long as its certificate is kept.
+func GenerateCertificateAuthority() (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, maxSerialNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "Signing Service Device CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCertificateAuthority(certificate, key, nil)
+}
+
+// Certificate is the certificate of the CA.
+func (a *CertificateAuthority) Certificate() *x509.Certificate {
+	return a.certificate
+}
+
+// Issue certifies the public key of a device. The device ID is the subject serial
+// number and a urn:uuid URI SAN, its label (or ID when unlabeled) the common name.
+func (a *CertificateAuthority) Issue(ctx context.Context, device domain.Device) (Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return Certificate{}, err
+	}
+	publicKey, err := signingcrypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return Certificate{}, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, maxSerialNumber)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	now := a.clock().Now()
+	notAfter := now.Add(a.validity())
+	if notAfter.After(a.certificate.NotAfter) {
+		notAfter = a.certificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject(device),
+		URIs:                  deviceURIs(device),
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		BasicConstraintsValid: true,
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, a.certificate, publicKey, a.key)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	chain := make([][]byte, 0, len(a.chain)+1)
+	for _, certificate := range append([]*x509.Certificate{a.certificate}, a.chain...) {
+		chain = append(chain, certificate.Raw)
+	}
+	return Certificate{Leaf: leaf, Chain: chain}, nil
+}
+
+// subject identifies a device in its certificates and certificate requests.
+func subject(device domain.Device) pkix.Name {
+	commonName := device.Label()
+	if commonName == "" {
+		commonName = device.ID()
+	}
+	return pkix.Name{
+		CommonName:   commonName,
+		SerialNumber: device.ID(),
+	}
+}
+
+func deviceURIs(device domain.Device) []*url.URL {
+	id, err := uuid.Parse(device.ID())
+	if err != nil {
+		return nil
+	}
+	return []*url.URL{{Scheme: "urn", Opaque: "uuid:" + id.String()}}
+}
+
+func (a *CertificateAuthority) validity() time.Duration {
+	if a.Validity == 0 {
+		return DefaultValidity
+	}
+	return a.Validity
+}
+
+func (a *CertificateAuthority) clock() domain.Clock {
+	if a.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return a.Clock
+}
+
+func checkKey(certificate *x509.Certificate, publicKey crypto.PublicKey) error {
+	key, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !key.Equal(certificate.PublicKey) {
+		return ErrKeyMismatch
+	}
+	return nil
+}
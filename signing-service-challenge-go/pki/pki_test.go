@@ -0,0 +1,84 @@
+package pki_test
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/x509"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+)
+
+const deviceID = "3b241101-e2bb-4255-8caf-4136c566a962"
+
+func newTestDevice(t *testing.T, label string) domain.Device {
+	provider := &crypto.ECDSAProvider{ECCGenerator: crypto.ECCGenerator{Curve: elliptic.P256()}}
+	keyPair, err := provider.Provide(context.Background())
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device, err := domain.NewDevice(deviceID, string(domain.SigningAlgorithmECDSA), label, keyPair.Public, keyPair.Private)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return device
+}
+
+func Test_CertificateAuthority_Issue(t *testing.T) {
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device := newTestDevice(t, "Till 1")
+
+	certificate, err := authority.Issue(context.Background(), device)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if len(certificate.Chain) != 1 {
+		t.Fatal("Expected the CA certificate as chain, got", len(certificate.Chain), "certificates")
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Leaf)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		t.Fatal("Expected the certificate to chain to the CA, got", err)
+	}
+	if leaf.Subject.CommonName != "Till 1" {
+		t.Fatal("Expected common name Till 1, got", leaf.Subject.CommonName)
+	}
+	if leaf.Subject.SerialNumber != deviceID {
+		t.Fatal("Expected serial number", deviceID, "got", leaf.Subject.SerialNumber)
+	}
+	if len(leaf.URIs) != 1 || leaf.URIs[0].String() != "urn:uuid:"+deviceID {
+		t.Fatal("Expected the urn:uuid SAN of the device, got", leaf.URIs)
+	}
+	if leaf.NotAfter.After(authority.Certificate().NotAfter) {
+		t.Fatal("Expected the certificate not to outlive the CA, got", leaf.NotAfter)
+	}
+}
+
+func Test_CertificateAuthority_Issue_Unlabeled(t *testing.T) {
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	certificate, err := authority.Issue(context.Background(), newTestDevice(t, ""))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Leaf)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if leaf.Subject.CommonName != deviceID {
+		t.Fatal("Expected common name", deviceID, "got", leaf.Subject.CommonName)
+	}
+}
@@ -0,0 +1,182 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	signingcrypto "github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+var (
+	ErrUnsupportedKey     = errors.New("unsupported device key")
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	ErrInvalidChain       = errors.New("certificate chain does not link up")
+	ErrCertificateExpired = errors.New("certificate outside its validity period")
+)
+
+var (
+	oidExtensionRequest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+	oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// certificationRequest is the PKCS #10 CertificationRequest (RFC 2986).
+type certificationRequest struct {
+	Info               asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type certificationRequestInfo struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type extensionRequest struct {
+	Type   asn1.ObjectIdentifier
+	Values [][]pkix.Extension `asn1:"set"`
+}
+
+// CreateCertificateRequest creates a DER encoded PKCS #10 request to certify the device key,
+// with the same subject and SAN the internal CA would use. The request is signed by the
+// device signer, which must hash as the crypto signers of the device algorithm do.
+func CreateCertificateRequest(device domain.Device, signer signingcrypto.Signer) ([]byte, error) {
+	publicKey, err := signingcrypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	signatureAlgorithm, err := signatureAlgorithmOf(device.Algorithm(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyInfo, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	name, err := asn1.Marshal(subject(device).ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+
+	info := certificationRequestInfo{
+		Subject:   asn1.RawValue{FullBytes: name},
+		PublicKey: asn1.RawValue{FullBytes: publicKeyInfo},
+	}
+	if uris := deviceURIs(device); len(uris) > 0 {
+		generalNames := make([]asn1.RawValue, 0, len(uris))
+		for _, uri := range uris {
+			generalNames = append(generalNames, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte(uri.String())})
+		}
+		subjectAltName, err := asn1.Marshal(generalNames)
+		if err != nil {
+			return nil, err
+		}
+		attribute, err := asn1.Marshal(extensionRequest{
+			Type:   oidExtensionRequest,
+			Values: [][]pkix.Extension{{{Id: oidExtensionSubjectAltName, Value: subjectAltName}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		info.Attributes = []asn1.RawValue{{FullBytes: attribute}}
+	}
+	encodedInfo, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signer.Sign(encodedInfo)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(certificationRequest{
+		Info:               asn1.RawValue{FullBytes: encodedInfo},
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
+
+// signatureAlgorithmOf identifies the signatures of the crypto signers of the algorithm for the given key.
+func signatureAlgorithmOf(algorithm domain.SigningAlgorithm, publicKey interface{}) (pkix.AlgorithmIdentifier, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm == domain.SigningAlgorithmRSAPSS {
+			// As the RSA-PSS signers of the crypto package: SHA-256 with a 32 bytes salt
+			return cms.PSSAlgorithm(crypto.SHA256)
+		}
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+		case 384:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, nil
+		default:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA512}, nil
+		}
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, nil
+	}
+	return pkix.AlgorithmIdentifier{}, ErrUnsupportedKey
+}
+
+// CheckCertificate checks a DER encoded certificate certifies the device key, and that
+// each certificate of the chain, if any, issued the previous one. All of them must be
+// valid at the given time.
+func CheckCertificate(device domain.Device, certificate []byte, chain [][]byte, now time.Time) error {
+	leaf, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return errors.Join(ErrInvalidCertificate, err)
+	}
+	publicKey, err := signingcrypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return err
+	}
+	if err := checkKey(leaf, publicKey); err != nil {
+		return err
+	}
+	if err := checkValidity(leaf, now); err != nil {
+		return err
+	}
+
+	issued := leaf
+	for _, der := range chain {
+		issuer, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.Join(ErrInvalidCertificate, err)
+		}
+		if err := issued.CheckSignatureFrom(issuer); err != nil {
+			return errors.Join(ErrInvalidChain, err)
+		}
+		if err := checkValidity(issuer, now); err != nil {
+			return err
+		}
+		issued = issuer
+	}
+	return nil
+}
+
+func checkValidity(certificate *x509.Certificate, now time.Time) error {
+	if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+		return fmt.Errorf("%w: %q valid from %v to %v", ErrCertificateExpired, certificate.Subject.CommonName,
+			certificate.NotBefore.UTC(), certificate.NotAfter.UTC())
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package pki_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/pki"
+)
+
+func Test_CreateCertificateRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		algorithm     domain.SigningAlgorithm
+		provider      crypto.Provider
+		signerFactory crypto.SignerFactory
+	}{
+		{"rsa", domain.SigningAlgorithmRSA, &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}}, &crypto.RSASignerFactory{}},
+		{"ecdsa", domain.SigningAlgorithmECDSA, &crypto.ECDSAProvider{}, &crypto.ECDSASignerFactory{}},
+		{"rsa-pss", domain.SigningAlgorithmRSAPSS, &crypto.RSAProvider{RSAGenerator: crypto.RSAGenerator{KeySize: 1024}}, &crypto.RSAPSSSignerFactory{}},
+		{"ed25519", domain.SigningAlgorithmEd25519, &crypto.Ed25519Provider{}, &crypto.Ed25519SignerFactory{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyPair, err := test.provider.Provide(context.Background())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			device, err := domain.NewDevice(deviceID, string(test.algorithm), "Till 1", keyPair.Public, keyPair.Private)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			signer, err := test.signerFactory.Build(context.Background(), device.PrivateKey())
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+
+			der, err := pki.CreateCertificateRequest(device, signer)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			request, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if err := request.CheckSignature(); err != nil {
+				t.Fatal("Expected the request to be signed by the device, got", err)
+			}
+			if request.Subject.CommonName != "Till 1" || request.Subject.SerialNumber != deviceID {
+				t.Fatal("Expected the device in the subject, got", request.Subject)
+			}
+			if len(request.URIs) != 1 || request.URIs[0].String() != "urn:uuid:"+deviceID {
+				t.Fatal("Expected the urn:uuid SAN of the device, got", request.URIs)
+			}
+		})
+	}
+}
+
+func Test_CheckCertificate(t *testing.T) {
+	authority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	device := newTestDevice(t, "Till 1")
+	certificate, err := authority.Issue(context.Background(), device)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if err := pki.CheckCertificate(device, certificate.Leaf, certificate.Chain, time.Now()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	otherDevice := newTestDevice(t, "Till 2")
+	if err := pki.CheckCertificate(otherDevice, certificate.Leaf, nil, time.Now()); !errors.Is(err, pki.ErrKeyMismatch) {
+		t.Fatal("Expected", pki.ErrKeyMismatch, "got", err)
+	}
+
+	otherAuthority, err := pki.GenerateCertificateAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	wrongChain := [][]byte{otherAuthority.Certificate().Raw}
+	if err := pki.CheckCertificate(device, certificate.Leaf, wrongChain, time.Now()); !errors.Is(err, pki.ErrInvalidChain) {
+		t.Fatal("Expected", pki.ErrInvalidChain, "got", err)
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Leaf)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	for _, at := range []time.Time{leaf.NotBefore.Add(-time.Minute), leaf.NotAfter.Add(time.Minute)} {
+		if err := pki.CheckCertificate(device, certificate.Leaf, certificate.Chain, at); !errors.Is(err, pki.ErrCertificateExpired) {
+			t.Fatal("Expected", pki.ErrCertificateExpired, "at", at, "got", err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+var ErrUnreadable = errors.New("unreadable QR code")
+
+// Decode reads back the data of a byte mode QR code rendered by Code.Image: upright, with
+// square modules and its quiet zone. Errors are detected, not corrected, so that it reads
+// what was rendered rather than scanned.
+func Decode(img image.Image) ([]byte, error) {
+	c, err := readModules(img)
+	if err != nil {
+		return nil, err
+	}
+	mask, err := c.readFormatBits()
+	if err != nil {
+		return nil, err
+	}
+
+	// Mark the function modules, whose values were read already
+	modules := c.modules
+	c.modules = newCode(c.Version, c.Level).modules
+	c.drawFunctionPatterns()
+	c.modules = modules
+	c.Mask = mask
+	c.applyMask(mask)
+
+	data, err := removeErrorCorrection(c.readCodewords(), c.Version, c.Level)
+	if err != nil {
+		return nil, err
+	}
+	return decodeData(data, c.Version)
+}
+
+// readModules samples the center of the modules of a code rendered by Code.Image.
+func readModules(img image.Image) (*Code, error) {
+	bounds := img.Bounds()
+	dark := func(x, y int) bool {
+		return color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y < 0x80
+	}
+
+	// The top left module is the corner of a finder pattern, right after the quiet zone
+	corner := 0
+	for corner < bounds.Dx() && corner < bounds.Dy() && !dark(corner, corner) {
+		corner++
+	}
+	if corner == 0 || corner%QuietZone != 0 {
+		return nil, fmt.Errorf("%w: no quiet zone", ErrUnreadable)
+	}
+	scale := corner / QuietZone
+	size := bounds.Dx()/scale - 2*QuietZone
+	version := (size - 17) / 4
+	if bounds.Dx() != bounds.Dy() || bounds.Dx()%scale != 0 || (size-17)%4 != 0 || version < minVersion || version > maxVersion {
+		return nil, fmt.Errorf("%w: unexpected image size %v", ErrUnreadable, bounds.Size())
+	}
+
+	c := newCode(version, LevelL)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c.modules[y][x] = dark((x+QuietZone)*scale+scale/2, (y+QuietZone)*scale+scale/2)
+		}
+	}
+	return c, nil
+}
+
+// readFormatBits reads the first copy of the format information, see drawFormatBits.
+// It sets the level of the code and returns its mask.
+func (c *Code) readFormatBits() (int, error) {
+	var bits int
+	read := func(x, y int, i int) {
+		if c.modules[y][x] {
+			bits |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(8, i, i)
+	}
+	read(8, 7, 6)
+	read(8, 8, 7)
+	read(7, 8, 8)
+	for i := 9; i < 15; i++ {
+		read(14-i, 8, i)
+	}
+	bits ^= 0x5412
+
+	data := bits >> 10
+	remainder := data
+	for i := 0; i < 10; i++ {
+		remainder = remainder<<1 ^ (remainder>>9)*0x537
+	}
+	if remainder&0x3FF != bits&0x3FF {
+		return 0, fmt.Errorf("%w: invalid format information", ErrUnreadable)
+	}
+	for level, levelBits := range formatLevelBits {
+		if levelBits == data>>3 {
+			c.Level = Level(level)
+		}
+	}
+	return data & 7, nil
+}
+
+// readCodewords reads the data modules in the order of drawCodewords.
+func (c *Code) readCodewords() []byte {
+	codewords := make([]byte, rawDataModules(c.Version)/8)
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vertical := 0; vertical < c.size; vertical++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vertical
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vertical
+				}
+				if c.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				if c.modules[y][x] {
+					codewords[i>>3] |= 1 << (7 - i&7)
+				}
+				i++
+			}
+		}
+	}
+	return codewords
+}
+
+// removeErrorCorrection undoes addErrorCorrection, checking the error correction codewords of every block.
+func removeErrorCorrection(codewords []byte, version int, level Level) ([]byte, error) {
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	blockECCLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := rawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	for j := range blocks {
+		blocks[j] = make([]byte, shortBlockLen+1)
+	}
+	k := 0
+	for i := 0; i <= shortBlockLen; i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				block[i] = codewords[k]
+				k++
+			}
+		}
+	}
+
+	divisor := reedSolomonDivisor(blockECCLen)
+	data := make([]byte, 0, dataCodewords(version, level))
+	for j, block := range blocks {
+		dataLen := shortBlockLen - blockECCLen
+		if j >= numShortBlocks {
+			dataLen++
+		}
+		if !bytes.Equal(reedSolomonRemainder(block[:dataLen], divisor), block[shortBlockLen+1-blockECCLen:]) {
+			return nil, fmt.Errorf("%w: corrupted block %d", ErrUnreadable, j)
+		}
+		data = append(data, block[:dataLen]...)
+	}
+	return data, nil
+}
+
+// decodeData reads the byte mode segment of the data codewords, see encodeData.
+func decodeData(data []byte, version int) ([]byte, error) {
+	position := 0
+	read := func(n int) int {
+		value := 0
+		for i := 0; i < n; i++ {
+			value = value<<1 | int(data[position>>3]>>(7-position&7)&1)
+			position++
+		}
+		return value
+	}
+
+	countBits := characterCountBits(version)
+	if read(4) != 0b0100 {
+		return nil, fmt.Errorf("%w: not in byte mode", ErrUnreadable)
+	}
+	count := read(countBits)
+	if 4+countBits+8*count > 8*len(data) {
+		return nil, fmt.Errorf("%w: segment longer than the code", ErrUnreadable)
+	}
+	decoded := make([]byte, count)
+	for i := range decoded {
+		decoded[i] = byte(read(8))
+	}
+	return decoded, nil
+}
@@ -0,0 +1,161 @@
+package qr_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/qr"
+)
+
+func Test_Encode_Capacity(t *testing.T) {
+	// Byte mode capacities of the standard
+	tests := []struct {
+		level    qr.Level
+		version  int
+		capacity int
+	}{
+		{qr.LevelL, 1, 17},
+		{qr.LevelM, 1, 14},
+		{qr.LevelQ, 1, 11},
+		{qr.LevelH, 1, 7},
+		{qr.LevelM, 10, 213},
+		{qr.LevelL, 40, 2953},
+		{qr.LevelM, 40, 2331},
+		{qr.LevelH, 40, 1273},
+	}
+	for _, test := range tests {
+		code, err := qr.Encode(bytes.Repeat([]byte("a"), test.capacity), test.level)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if code.Version != test.version {
+			t.Fatal("Expected version", test.version, "for", test.capacity, "bytes, got", code.Version)
+		}
+		if code.Size() != 4*test.version+17 {
+			t.Fatal("Expected size", 4*test.version+17, "got", code.Size())
+		}
+
+		code, err = qr.Encode(bytes.Repeat([]byte("a"), test.capacity+1), test.level)
+		if test.version == 40 {
+			if !errors.Is(err, qr.ErrDataTooLong) {
+				t.Fatal("Expected", qr.ErrDataTooLong, "got", err)
+			}
+			continue
+		}
+		if err != nil || code.Version != test.version+1 {
+			t.Fatal("Expected version", test.version+1, "for", test.capacity+1, "bytes, got", code, err)
+		}
+	}
+}
+
+func Test_Encode_FinderPatterns(t *testing.T) {
+	code, err := qr.Encode([]byte("V1;device_id_0;0"), qr.LevelM)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	last := code.Size() - 1
+	for _, corner := range [][2]int{{0, 0}, {last - 6, 0}, {0, last - 6}} {
+		for i := 0; i < 7; i++ {
+			// The outer ring of the finder patterns is dark, and the ring inside it light
+			if !code.Dark(corner[0]+i, corner[1]) || !code.Dark(corner[0], corner[1]+i) {
+				t.Fatal("Expected a dark outer ring at", corner)
+			}
+			if i > 0 && i < 6 && code.Dark(corner[0]+i, corner[1]+1) {
+				t.Fatal("Expected a light inner ring at", corner)
+			}
+		}
+	}
+}
+
+func Test_Code_PNG(t *testing.T) {
+	code, err := qr.Encode([]byte("V1;device_id_0;0"), qr.LevelM)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	encoded, err := code.PNG(2)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	side := (code.Size() + 2*qr.QuietZone) * 2
+	if img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Fatal("Expected a", side, "pixels image, got", img.Bounds())
+	}
+	// Top left module of the code, after the quiet zone
+	if r, _, _, _ := img.At(qr.QuietZone*2, qr.QuietZone*2).RGBA(); r != 0 {
+		t.Fatal("Expected a dark pixel, got", r)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Fatal("Expected a light quiet zone")
+	}
+}
+
+func Test_Code_SVG(t *testing.T) {
+	code, err := qr.Encode([]byte("V1;device_id_0;0"), qr.LevelM)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	svg := string(code.SVG())
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 33 33"`) || !strings.HasSuffix(svg, "</svg>") {
+		t.Fatal("Expected a 33 modules SVG, got", svg)
+	}
+	// The top row of the top left finder pattern
+	if !strings.Contains(svg, "M4 4h7v1h-7z") {
+		t.Fatal("Expected the top left finder pattern, got", svg)
+	}
+}
+
+func Test_Decode_RoundTrip(t *testing.T) {
+	// Single and multiple blocks, with and without version information
+	for _, length := range []int{0, 17, 100, 500, 2000} {
+		for _, level := range []qr.Level{qr.LevelL, qr.LevelM, qr.LevelQ, qr.LevelH} {
+			data := make([]byte, length)
+			for i := range data {
+				data[i] = byte(i * 7)
+			}
+			code, err := qr.Encode(data, level)
+			if errors.Is(err, qr.ErrDataTooLong) {
+				continue
+			}
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			encoded, err := code.PNG(3)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			img, err := png.Decode(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			decoded, err := qr.Decode(img)
+			if err != nil {
+				t.Fatal("Expected no error for", length, "bytes at level", level, "got", err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Fatal("Expected", length, "bytes at level", level, "to round trip, got", len(decoded), "bytes")
+			}
+		}
+	}
+}
+
+func Test_Decode_Corrupted(t *testing.T) {
+	code, err := qr.Encode([]byte("V1;device_id_0;0"), qr.LevelM)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	img := code.Image(1).(*image.Paletted)
+	// Flip the bottom right module, the first data module
+	last := qr.QuietZone + code.Size() - 1
+	img.SetColorIndex(last, last, 1-img.ColorIndexAt(last, last))
+	if _, err := qr.Decode(img); !errors.Is(err, qr.ErrUnreadable) {
+		t.Fatal("Expected", qr.ErrUnreadable, "got", err)
+	}
+}
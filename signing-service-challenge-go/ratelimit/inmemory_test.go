@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_InMemoryLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewInMemoryLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		decision, err := limiter.Allow(context.Background(), "key_0")
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if !decision.Allowed {
+			t.Fatal("Expected request", i, "to be allowed")
+		}
+		if decision.Remaining != 2-i {
+			t.Fatal("Expected remaining to be", 2-i, "got", decision.Remaining)
+		}
+	}
+
+	decision, _ := limiter.Allow(context.Background(), "key_0")
+	if decision.Allowed {
+		t.Fatal("Expected request to be refused once the burst is exhausted")
+	}
+	if decision.RetryAfter != 500*time.Millisecond {
+		t.Fatal("Expected retry after to be 500ms, got", decision.RetryAfter)
+	}
+
+	decision, _ = limiter.Allow(context.Background(), "key_1")
+	if !decision.Allowed {
+		t.Fatal("Expected other keys not to be limited")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	decision, _ = limiter.Allow(context.Background(), "key_0")
+	if !decision.Allowed {
+		t.Fatal("Expected request to be allowed after the bucket was refilled")
+	}
+}
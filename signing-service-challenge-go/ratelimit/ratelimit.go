@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	Allowed bool
+	// Limit is the number of requests allowed in a burst.
+	Limit int
+	// Remaining is the number of requests still allowed right now.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero if allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether the requests identified by a key are allowed.
+// Implementations backed by a shared store allow limits to apply across instances.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Decision, error)
+}
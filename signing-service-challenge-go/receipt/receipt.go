@@ -0,0 +1,143 @@
+// Package receipt lays out the payload of the QR codes printed on receipts. Layouts are
+// templates, so that the formats of different countries can be plugged in.
+package receipt
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+// DefaultTemplateName is the name of DefaultTemplate.
+const DefaultTemplateName = "default"
+
+// DefaultLayout lists the fields of a signature separated by semicolons, binary ones in base64:
+// V1;<device_id>;<counter>;<created_at>;<algorithm>;<public_key_fingerprint>;<signature>
+const DefaultLayout = "V1;{{.DeviceID}};{{.Counter}};{{rfc3339 .CreatedAt}};{{.Algorithm}};{{base64 .PublicKeyFingerprint}};{{base64 .Signature}}"
+
+// RKSVTemplateName is the name of RKSVTemplate.
+const RKSVTemplateName = "rksv"
+
+// RKSVLayout is the machine-readable code of the Austrian RKSV receipts, see domain.SecuredDataVersionRKSV.
+const RKSVLayout = "{{.MachineReadableCode}}"
+
+var ErrEmptyPayload = errors.New("empty receipt payload")
+
+// DefaultTemplate lays out DefaultLayout.
+var DefaultTemplate Template = mustTextTemplate(DefaultTemplateName, DefaultLayout)
+
+// RKSVTemplate lays out RKSVLayout, an empty payload for other signatures.
+var RKSVTemplate Template = mustTextTemplate(RKSVTemplateName, RKSVLayout)
+
+// Data is what receipt payloads are made of: a signature and the device that made it.
+type Data struct {
+	DeviceID    string
+	SignatureID string
+	Counter     int
+	CreatedAt   time.Time
+	Algorithm   domain.SigningAlgorithm
+	Format      domain.SignatureFormat
+	Signature   []byte
+	SignedData  string
+	// Envelope is the JWS, CMS or COSE_Sign1 envelope of the signature, nil for raw ones.
+	Envelope []byte
+	// PublicKey is the DER encoded SubjectPublicKeyInfo of the device key.
+	PublicKey []byte
+	// PublicKeyFingerprint is the SHA-256 digest of PublicKey.
+	PublicKeyFingerprint []byte
+	// MachineReadableCode is the RKSV code of the signature, empty for other secured data formats.
+	MachineReadableCode string
+}
+
+// NewData gathers the data of a signature of the device.
+func NewData(device domain.Device, signature domain.Signature) (Data, error) {
+	publicKey, err := crypto.ParsePublicKey(device.PublicKey())
+	if err != nil {
+		return Data{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return Data{}, err
+	}
+	fingerprint := sha256.Sum256(der)
+	var machineReadableCode string
+	if signature.SecuredDataVersion() == domain.SecuredDataVersionRKSV {
+		if machineReadableCode, err = signature.MachineReadableCode(); err != nil {
+			return Data{}, err
+		}
+	}
+
+	return Data{
+		DeviceID:             device.ID(),
+		SignatureID:          signature.ID(),
+		Counter:              signature.Counter(),
+		CreatedAt:            signature.CreatedAt(),
+		Algorithm:            signature.Algorithm(),
+		Format:               signature.Format(),
+		Signature:            signature.Value(),
+		SignedData:           signature.RawData(),
+		Envelope:             signature.Envelope(),
+		PublicKey:            der,
+		PublicKeyFingerprint: fingerprint[:],
+		MachineReadableCode:  machineReadableCode,
+	}, nil
+}
+
+// Template lays out the payload of a receipt.
+type Template interface {
+	Payload(data Data) (string, error)
+}
+
+// TextTemplate is a layout written as a text/template over Data, with the functions:
+//   - base64, base64url and hex encode bytes.
+//   - rfc3339 formats a time in UTC with millisecond precision, unix and unixMillis as an epoch.
+type TextTemplate struct {
+	template *template.Template
+}
+
+var templateFunctions = template.FuncMap{
+	"base64":    base64.StdEncoding.EncodeToString,
+	"base64url": base64.RawURLEncoding.EncodeToString,
+	"hex":       hex.EncodeToString,
+	"rfc3339": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	},
+	"unix":       func(t time.Time) int64 { return t.Unix() },
+	"unixMillis": func(t time.Time) int64 { return t.UnixMilli() },
+}
+
+// NewTextTemplate parses a layout, see TextTemplate.
+func NewTextTemplate(name string, layout string) (*TextTemplate, error) {
+	parsed, err := template.New(name).Funcs(templateFunctions).Option("missingkey=error").Parse(layout)
+	if err != nil {
+		return nil, err
+	}
+	return &TextTemplate{template: parsed}, nil
+}
+
+func mustTextTemplate(name string, layout string) *TextTemplate {
+	t, err := NewTextTemplate(name, layout)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *TextTemplate) Payload(data Data) (string, error) {
+	var payload strings.Builder
+	if err := t.template.Execute(&payload, data); err != nil {
+		return "", err
+	}
+	if payload.Len() == 0 {
+		return "", ErrEmptyPayload
+	}
+	return payload.String(), nil
+}
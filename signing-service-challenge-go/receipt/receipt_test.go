@@ -0,0 +1,55 @@
+package receipt_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/receipt"
+)
+
+func Test_TextTemplate_Payload(t *testing.T) {
+	data := receipt.Data{
+		DeviceID:  "device_id_0",
+		Counter:   3,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.FixedZone("CET", 3600)),
+		Signature: []byte{0xfb, 0xff},
+	}
+
+	tests := []struct {
+		layout   string
+		expected string
+	}{
+		{"{{.DeviceID}}_{{.Counter}}", "device_id_0_3"},
+		{"{{rfc3339 .CreatedAt}}", "2024-01-02T02:04:05.006Z"},
+		{"{{unix .CreatedAt}}", "1704161045"},
+		{"{{base64 .Signature}} {{base64url .Signature}} {{hex .Signature}}", "+/8= -_8 fbff"},
+	}
+	for _, test := range tests {
+		template, err := receipt.NewTextTemplate("test", test.layout)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		payload, err := template.Payload(data)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if payload != test.expected {
+			t.Fatal("Expected", test.expected, "got", payload)
+		}
+	}
+}
+
+func Test_TextTemplate_Payload_Errors(t *testing.T) {
+	if _, err := receipt.NewTextTemplate("test", "{{.Unknown}"); err == nil {
+		t.Fatal("Expected a parse error, got nil")
+	}
+
+	template, err := receipt.NewTextTemplate("test", "{{if .Envelope}}{{base64 .Envelope}}{{end}}")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := template.Payload(receipt.Data{}); !errors.Is(err, receipt.ErrEmptyPayload) {
+		t.Fatal("Expected", receipt.ErrEmptyPayload, "got", err)
+	}
+}
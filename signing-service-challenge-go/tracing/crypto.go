@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/crypto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SignerFactory decorates a crypto.SignerFactory to trace signer creation
+// and the signatures made by the built signers.
+type SignerFactory struct {
+	next      crypto.SignerFactory
+	algorithm string
+}
+
+// NewSignerFactory wraps the given factory, tagging its spans with the given algorithm.
+func NewSignerFactory(algorithm string, next crypto.SignerFactory) *SignerFactory {
+	return &SignerFactory{
+		next:      next,
+		algorithm: algorithm,
+	}
+}
+
+func (f *SignerFactory) Build(ctx context.Context, privateKey []byte) (crypto.Signer, error) {
+	ctx, span := tracer().Start(ctx, "SignerFactory.Build",
+		trace.WithAttributes(attribute.String(AttributeAlgorithm, f.algorithm)),
+	)
+	defer span.End()
+
+	signer, err := f.next.Build(ctx, privateKey)
+	if err != nil {
+		RecordError(span, err)
+		return nil, err
+	}
+
+	return &Signer{
+		// Signer.Sign takes no context, so the one of the build is kept
+		// to parent its spans.
+		ctx:       ctx,
+		next:      signer,
+		algorithm: f.algorithm,
+	}, nil
+}
+
+// Signer decorates a crypto.Signer to trace its signatures.
+type Signer struct {
+	ctx       context.Context
+	next      crypto.Signer
+	algorithm string
+}
+
+func (s *Signer) Sign(dataToBeSigned []byte) ([]byte, error) {
+	_, span := tracer().Start(s.ctx, "Signer.Sign",
+		trace.WithAttributes(
+			attribute.String(AttributeAlgorithm, s.algorithm),
+			attribute.Int("signing.data.size", len(dataToBeSigned)),
+		),
+	)
+	defer span.End()
+
+	signature, err := s.next.Sign(dataToBeSigned)
+	if err != nil {
+		RecordError(span, err)
+	}
+	return signature, err
+}
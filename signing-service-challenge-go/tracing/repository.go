@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeviceRepository decorates a domain.DeviceRepository to trace its operations.
+type DeviceRepository struct {
+	next domain.DeviceRepository
+}
+
+// NewDeviceRepository wraps the given repository.
+func NewDeviceRepository(next domain.DeviceRepository) *DeviceRepository {
+	return &DeviceRepository{next: next}
+}
+
+func (r *DeviceRepository) Save(ctx context.Context, d domain.Device) error {
+	ctx, span := startRepositorySpan(ctx, "DeviceRepository.Save",
+		attribute.String(AttributeDeviceID, d.ID()),
+		attribute.String(AttributeAlgorithm, string(d.Algorithm())),
+	)
+	defer span.End()
+
+	err := r.next.Save(ctx, d)
+	if err != nil {
+		RecordError(span, err)
+	}
+	return err
+}
+
+func (r *DeviceRepository) Update(ctx context.Context, d domain.Device, expectedVersion int) error {
+	ctx, span := startRepositorySpan(ctx, "DeviceRepository.Update",
+		attribute.String(AttributeDeviceID, d.ID()),
+		attribute.String(AttributeAlgorithm, string(d.Algorithm())),
+		attribute.Int("signing.device.expected_version", expectedVersion),
+	)
+	defer span.End()
+
+	err := r.next.Update(ctx, d, expectedVersion)
+	if err != nil {
+		RecordError(span, err)
+	}
+	return err
+}
+
+func (r *DeviceRepository) FindByID(ctx context.Context, id string) (domain.Device, error) {
+	ctx, span := startRepositorySpan(ctx, "DeviceRepository.FindByID", attribute.String(AttributeDeviceID, id))
+	defer span.End()
+
+	device, err := r.next.FindByID(ctx, id)
+	if err != nil {
+		RecordError(span, err)
+		return device, err
+	}
+	span.SetAttributes(attribute.String(AttributeAlgorithm, string(device.Algorithm())))
+	return device, nil
+}
+
+func (r *DeviceRepository) ListAll(ctx context.Context) ([]domain.Device, error) {
+	ctx, span := startRepositorySpan(ctx, "DeviceRepository.ListAll")
+	defer span.End()
+
+	devices, err := r.next.ListAll(ctx)
+	if err != nil {
+		RecordError(span, err)
+		return devices, err
+	}
+	span.SetAttributes(attribute.Int("signing.devices.count", len(devices)))
+	return devices, nil
+}
+
+// SignatureRepository decorates a domain.SignatureRepository to trace its reads.
+type SignatureRepository struct {
+	next domain.SignatureRepository
+}
+
+// NewSignatureRepository wraps the given repository.
+func NewSignatureRepository(next domain.SignatureRepository) *SignatureRepository {
+	return &SignatureRepository{next: next}
+}
+
+func (r *SignatureRepository) ListSignatures(ctx context.Context, deviceID string, fromCounter int, limit int) ([]domain.Signature, error) {
+	ctx, span := startRepositorySpan(ctx, "SignatureRepository.ListSignatures",
+		attribute.String(AttributeDeviceID, deviceID),
+		attribute.Int("signing.signatures.from_counter", fromCounter),
+		attribute.Int("signing.signatures.limit", limit),
+	)
+	defer span.End()
+
+	signatures, err := r.next.ListSignatures(ctx, deviceID, fromCounter, limit)
+	if err != nil {
+		RecordError(span, err)
+		return signatures, err
+	}
+	span.SetAttributes(attribute.Int("signing.signatures.count", len(signatures)))
+	return signatures, nil
+}
+
+func startRepositorySpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+}
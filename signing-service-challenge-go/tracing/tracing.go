@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "signing-service"
+
+	instrumentationName = "github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+)
+
+// Span attribute keys shared by the decorators of this package.
+const (
+	AttributeDeviceID   = "signing.device.id"
+	AttributeAlgorithm  = "signing.algorithm"
+	AttributeRetryCount = "signing.retry_count"
+	// AttributeTransactionNumber is the number of a transaction among those of its device.
+	AttributeTransactionNumber = "signing.transaction.number"
+	// AttributeClientID is the client of the device a request is made on behalf of.
+	AttributeClientID = "signing.client.id"
+)
+
+// NewOTLPExporter creates an exporter sending spans over OTLP/HTTP to the given endpoint URL.
+// When empty, the endpoint and headers are read from the standard OTEL_EXPORTER_OTLP_* environment variables.
+func NewOTLPExporter(ctx context.Context, endpointURL string) (sdktrace.SpanExporter, error) {
+	var options []otlptracehttp.Option
+	if endpointURL != "" {
+		options = append(options, otlptracehttp.WithEndpointURL(endpointURL))
+	}
+	return otlptracehttp.New(ctx, options...)
+}
+
+// NewStdoutExporter creates an exporter writing spans as JSON to w, meant for tests and debugging.
+func NewStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// Setup installs a global tracer provider exporting to the given exporter and the
+// W3C trace context propagator. The returned function flushes and stops the provider.
+func Setup(exporter sdktrace.SpanExporter, version string) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// tracer returns the tracer of this package from the global provider,
+// so that decorators created before Setup still honour it.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// RecordError records err on the span and marks the span as failed.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
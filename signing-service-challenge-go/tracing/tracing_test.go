@@ -0,0 +1,107 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/persistence"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tracing"
+	"github.com/go-chi/chi"
+)
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+	}
+	Attributes []struct {
+		Key   string
+		Value struct {
+			Value interface{}
+		}
+	}
+}
+
+func (s exportedSpan) attribute(key string) interface{} {
+	for _, attribute := range s.Attributes {
+		if attribute.Key == key {
+			return attribute.Value.Value
+		}
+	}
+	return nil
+}
+
+func decodeSpans(t *testing.T, output *bytes.Buffer) map[string]exportedSpan {
+	spans := make(map[string]exportedSpan)
+	decoder := json.NewDecoder(output)
+	for {
+		var span exportedSpan
+		err := decoder.Decode(&span)
+		if errors.Is(err, io.EOF) {
+			return spans
+		}
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		spans[span.Name] = span
+	}
+}
+
+func Test_Middleware_PropagatesTraceContext(t *testing.T) {
+	var output bytes.Buffer
+	exporter, err := tracing.NewStdoutExporter(&output)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	shutdown, err := tracing.Setup(exporter, "test")
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	repository := tracing.NewDeviceRepository(persistence.NewInMemoryDeviceRepository())
+	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Get("/devices/{deviceID}", func(w http.ResponseWriter, r *http.Request) {
+		_, err := repository.FindByID(r.Context(), chi.URLParam(r, "deviceID"))
+		if !errors.Is(err, domain.ErrDeviceNotFound) {
+			t.Error("Expected error to be", domain.ErrDeviceNotFound, "got", err)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	request := httptest.NewRequest(http.MethodGet, "/devices/device_id_0", nil)
+	request.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	spans := decodeSpans(t, &output)
+
+	serverSpan, ok := spans["GET /devices/{deviceID}"]
+	if !ok {
+		t.Fatal("Expected a server span, got", spans)
+	}
+	if serverSpan.SpanContext.TraceID != traceID {
+		t.Fatal("Expected trace id to be", traceID, "got", serverSpan.SpanContext.TraceID)
+	}
+
+	repositorySpan, ok := spans["DeviceRepository.FindByID"]
+	if !ok {
+		t.Fatal("Expected a repository span, got", spans)
+	}
+	if repositorySpan.SpanContext.TraceID != traceID {
+		t.Fatal("Expected trace id to be", traceID, "got", repositorySpan.SpanContext.TraceID)
+	}
+	if repositorySpan.attribute(tracing.AttributeDeviceID) != "device_id_0" {
+		t.Fatal("Expected device id attribute to be device_id_0, got", repositorySpan.attribute(tracing.AttributeDeviceID))
+	}
+}
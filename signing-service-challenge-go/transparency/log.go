@@ -0,0 +1,304 @@
+// Package transparency appends the signatures of all the devices to a Merkle tree log in the
+// style of Certificate Transparency (RFC 6962 and RFC 9162). The log periodically publishes
+// signed tree heads, and proves the inclusion of signatures and the consistency of its heads,
+// so that a signature can't be removed or altered without the log contradicting its own heads.
+package transparency
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+var (
+	ErrNoTreeHead          = errors.New("no tree head published yet")
+	ErrSignatureNotLogged  = errors.New("signature not found in the log")
+	ErrNotYetIncluded      = errors.New("signature not included in the tree head yet")
+	ErrUnsupportedLogKey   = errors.New("unsupported log key")
+	ErrInvalidTreeHeadSign = errors.New("invalid tree head signature")
+)
+
+// The tree heads are signed as the TreeHeadSignature structure of RFC 6962, section 3.5.
+const (
+	treeHeadVersion       = 0 // v1
+	treeHeadSignatureType = 1 // tree_hash
+)
+
+// SignedTreeHead commits the log to its first TreeSize signatures.
+type SignedTreeHead struct {
+	TreeSize  int
+	Timestamp time.Time
+	RootHash  []byte
+	// Signature of the log key over the tree head, see SigningInput.
+	Signature []byte
+}
+
+// SigningInput is what the log key signs: the TreeHeadSignature structure of RFC 6962,
+// version, signature type, timestamp in milliseconds, tree size and root hash.
+func (h SignedTreeHead) SigningInput() []byte {
+	input := make([]byte, 0, 2+8+8+sha256.Size)
+	input = append(input, treeHeadVersion, treeHeadSignatureType)
+	input = binary.BigEndian.AppendUint64(input, uint64(h.Timestamp.UnixMilli()))
+	input = binary.BigEndian.AppendUint64(input, uint64(h.TreeSize))
+	return append(input, h.RootHash...)
+}
+
+// Verify checks the tree head was signed by the given log key.
+func (h SignedTreeHead) Verify(publicKey crypto.PublicKey) error {
+	input := h.SigningInput()
+	digest := sha256.Sum256(input)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], h.Signature) {
+			return ErrInvalidTreeHeadSign
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], h.Signature) != nil {
+			return ErrInvalidTreeHeadSign
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, input, h.Signature) {
+			return ErrInvalidTreeHeadSign
+		}
+	default:
+		return ErrUnsupportedLogKey
+	}
+	return nil
+}
+
+// InclusionProof proves a signature is one of the leaves of the tree of TreeSize signatures.
+type InclusionProof struct {
+	LeafIndex int
+	TreeSize  int
+	LeafHash  []byte
+	RootHash  []byte
+	AuditPath [][]byte
+}
+
+// LeafData is the leaf of the log for a signature:
+// <device_id>_<signature_id>_<counter>_<created_at_unix_millis>_<signed_data_base64>_<signature_base64>
+func LeafData(signature domain.Signature) []byte {
+	return []byte(signature.DeviceID() + "_" + signature.ID() + "_" + strconv.Itoa(signature.Counter()) + "_" +
+		strconv.FormatInt(signature.CreatedAt().UnixMilli(), 10) + "_" +
+		base64.StdEncoding.EncodeToString([]byte(signature.RawData())) + "_" +
+		base64.StdEncoding.EncodeToString(signature.Value()))
+}
+
+// Log is an in-memory transparency log of signatures. It's safe for concurrent use.
+type Log struct {
+	key crypto.Signer
+	// Clock is optional, domain.SystemClock if unset.
+	Clock domain.Clock
+
+	mu   sync.RWMutex
+	tree tree
+	// leaves are the indexes of the leaves of the signatures by signature ID.
+	leaves map[string]int
+	// heads are the published tree heads, oldest first.
+	heads []SignedTreeHead
+}
+
+// NewLog creates an empty log signing its tree heads with the given ECDSA, RSA or Ed25519 key.
+func NewLog(key crypto.Signer) (*Log, error) {
+	switch key.Public().(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, ErrUnsupportedLogKey
+	}
+	return &Log{
+		key:    key,
+		leaves: map[string]int{},
+	}, nil
+}
+
+// GenerateLog creates an empty log with a fresh ECDSA P-256 key. Its tree heads can
+// only be verified as long as the log is kept.
+func GenerateLog() (*Log, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewLog(key)
+}
+
+// PublicKey is the key verifying the tree heads of the log.
+func (l *Log) PublicKey() crypto.PublicKey {
+	return l.key.Public()
+}
+
+// LogID identifies the log as in RFC 6962: the SHA-256 digest of its DER encoded public key.
+func (l *Log) LogID() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(l.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(der)
+	return digest[:], nil
+}
+
+// Appender is what the signing side needs from a log.
+type Appender interface {
+	Append(signatures ...domain.Signature)
+}
+
+// Append adds signatures to the log, in order. Signatures already logged are skipped.
+func (l *Log) Append(signatures ...domain.Signature) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, signature := range signatures {
+		if _, ok := l.leaves[signature.ID()]; ok {
+			continue
+		}
+		l.leaves[signature.ID()] = l.tree.size()
+		l.tree.append(LeafHash(LeafData(signature)))
+	}
+}
+
+// Size is the number of signatures in the log, published in a tree head or not.
+func (l *Log) Size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.tree.size()
+}
+
+// Publish signs and publishes a tree head of all the signatures logged so far.
+func (l *Log) Publish() (SignedTreeHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.tree.size()
+	rootHash, err := l.tree.rootHash(size)
+	if err != nil {
+		return SignedTreeHead{}, err
+	}
+	head := SignedTreeHead{
+		TreeSize:  size,
+		Timestamp: l.clock().Now().UTC().Truncate(time.Millisecond),
+		RootHash:  rootHash,
+	}
+	if head.Signature, err = l.sign(head.SigningInput()); err != nil {
+		return SignedTreeHead{}, err
+	}
+	l.heads = append(l.heads, head)
+	return head, nil
+}
+
+func (l *Log) sign(input []byte) ([]byte, error) {
+	if _, ok := l.key.Public().(ed25519.PublicKey); ok {
+		return l.key.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(input)
+	return l.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// Run publishes a tree head every interval until ctx is done, skipping
+// the intervals in which nothing was logged.
+func (l *Log) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if head, err := l.LatestTreeHead(); err == nil && head.TreeSize == l.Size() {
+				continue
+			}
+			if _, err := l.Publish(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// LatestTreeHead is the last published tree head.
+func (l *Log) LatestTreeHead() (SignedTreeHead, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.heads) == 0 {
+		return SignedTreeHead{}, ErrNoTreeHead
+	}
+	return l.heads[len(l.heads)-1], nil
+}
+
+// InclusionProof proves a signature is in the tree of the given size, which can't exceed
+// the size of the latest tree head. A zero size stands for the latest tree head.
+func (l *Log) InclusionProof(signatureID string, treeSize int) (InclusionProof, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	treeSize, err := l.publishedSize(treeSize)
+	if err != nil {
+		return InclusionProof{}, err
+	}
+	index, ok := l.leaves[signatureID]
+	if !ok {
+		return InclusionProof{}, ErrSignatureNotLogged
+	}
+	if index >= treeSize {
+		return InclusionProof{}, ErrNotYetIncluded
+	}
+	auditPath, err := l.tree.inclusionProof(index, treeSize)
+	if err != nil {
+		return InclusionProof{}, err
+	}
+	rootHash, err := l.tree.rootHash(treeSize)
+	if err != nil {
+		return InclusionProof{}, err
+	}
+	return InclusionProof{
+		LeafIndex: index,
+		TreeSize:  treeSize,
+		LeafHash:  l.tree.levels[0][index],
+		RootHash:  rootHash,
+		AuditPath: auditPath,
+	}, nil
+}
+
+// ConsistencyProof proves the tree of the first size is a prefix of the tree of the second
+// size, which can't exceed the size of the latest tree head.
+func (l *Log) ConsistencyProof(first, second int) ([][]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if _, err := l.publishedSize(second); err != nil {
+		return nil, err
+	}
+	return l.tree.consistencyProof(first, second)
+}
+
+// publishedSize checks a tree size is covered by the latest tree head, standing for its size if zero.
+func (l *Log) publishedSize(size int) (int, error) {
+	if len(l.heads) == 0 {
+		return 0, ErrNoTreeHead
+	}
+	latest := l.heads[len(l.heads)-1].TreeSize
+	if size == 0 {
+		return latest, nil
+	}
+	if size < 0 || size > latest {
+		return 0, ErrInvalidTreeSize
+	}
+	return size, nil
+}
+
+func (l *Log) clock() domain.Clock {
+	if l.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return l.Clock
+}
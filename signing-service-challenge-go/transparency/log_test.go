@@ -0,0 +1,166 @@
+package transparency_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+)
+
+// newSignatures creates count signatures of a device, chained as the device would.
+func newSignatures(t *testing.T, count int) []domain.Signature {
+	device, err := domain.NewDevice("device_id_0", "rsa", "device_label_0", []byte("public_key_0"), []byte("private_key_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatures := make([]domain.Signature, 0, count)
+	for i := 0; i < count; i++ {
+		payload, err := domain.NewTextPayload("data_to_be_signed_" + strconv.Itoa(i))
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		enrichedData, err := device.EnrichData(payload, "", time.Now(), nil)
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signature, err := device.NewSignature("signature_id_"+strconv.Itoa(i), enrichedData, []byte("signature_"+strconv.Itoa(i)), time.Now())
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if err := device.AddSignature(signature); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures
+}
+
+func Test_Log_Proofs(t *testing.T) {
+	log, err := transparency.GenerateLog()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if _, err := log.LatestTreeHead(); !errors.Is(err, transparency.ErrNoTreeHead) {
+		t.Fatal("Expected error to be", transparency.ErrNoTreeHead, "got", err)
+	}
+
+	// Publish a tree head after every signature, proving every signature and head so far each time
+	signatures := newSignatures(t, 33)
+	var heads []transparency.SignedTreeHead
+	for i, signature := range signatures {
+		log.Append(signature)
+		head, err := log.Publish()
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if head.TreeSize != i+1 {
+			t.Fatal("Expected tree size", i+1, "got", head.TreeSize)
+		}
+		if err := head.Verify(log.PublicKey()); err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		heads = append(heads, head)
+
+		for j := 0; j <= i; j++ {
+			proof, err := log.InclusionProof(signatures[j].ID(), 0)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if !bytes.Equal(proof.LeafHash, transparency.LeafHash(transparency.LeafData(signatures[j]))) {
+				t.Fatal("Expected the leaf hash of", signatures[j].ID(), "got", proof.LeafHash)
+			}
+			if err := transparency.VerifyInclusion(proof.LeafHash, proof.LeafIndex, proof.TreeSize, proof.AuditPath, head.RootHash); err != nil {
+				t.Fatal("Expected no error for leaf", j, "of", i+1, "got", err)
+			}
+
+			consistency, err := log.ConsistencyProof(heads[j].TreeSize, head.TreeSize)
+			if err != nil {
+				t.Fatal("Expected no error, got", err)
+			}
+			if err := transparency.VerifyConsistency(heads[j].TreeSize, head.TreeSize, consistency, heads[j].RootHash, head.RootHash); err != nil {
+				t.Fatal("Expected no error from", j+1, "to", i+1, "got", err)
+			}
+		}
+	}
+
+	// Proofs don't hold for other data
+	proof, err := log.InclusionProof(signatures[5].ID(), 20)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := transparency.VerifyInclusion(proof.LeafHash, proof.LeafIndex, proof.TreeSize, proof.AuditPath, heads[20].RootHash); !errors.Is(err, transparency.ErrInvalidProof) {
+		t.Fatal("Expected error to be", transparency.ErrInvalidProof, "got", err)
+	}
+	otherLeaf := transparency.LeafHash([]byte("other_leaf"))
+	if err := transparency.VerifyInclusion(otherLeaf, proof.LeafIndex, proof.TreeSize, proof.AuditPath, proof.RootHash); !errors.Is(err, transparency.ErrInvalidProof) {
+		t.Fatal("Expected error to be", transparency.ErrInvalidProof, "got", err)
+	}
+	consistency, err := log.ConsistencyProof(7, 20)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := transparency.VerifyConsistency(7, 20, consistency, heads[7].RootHash, heads[19].RootHash); !errors.Is(err, transparency.ErrInvalidProof) {
+		t.Fatal("Expected error to be", transparency.ErrInvalidProof, "got", err)
+	}
+}
+
+func Test_Log_Errors(t *testing.T) {
+	log, err := transparency.GenerateLog()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatures := newSignatures(t, 3)
+	log.Append(signatures[:2]...)
+	head, err := log.Publish()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	// Appending the same signature again doesn't log it twice
+	log.Append(signatures...)
+	if log.Size() != 3 {
+		t.Fatal("Expected size", 3, "got", log.Size())
+	}
+
+	if _, err := log.InclusionProof(signatures[2].ID(), 0); !errors.Is(err, transparency.ErrNotYetIncluded) {
+		t.Fatal("Expected error to be", transparency.ErrNotYetIncluded, "got", err)
+	}
+	if _, err := log.InclusionProof("signature_id_unknown", 0); !errors.Is(err, transparency.ErrSignatureNotLogged) {
+		t.Fatal("Expected error to be", transparency.ErrSignatureNotLogged, "got", err)
+	}
+	if _, err := log.InclusionProof(signatures[0].ID(), 3); !errors.Is(err, transparency.ErrInvalidTreeSize) {
+		t.Fatal("Expected error to be", transparency.ErrInvalidTreeSize, "got", err)
+	}
+	if _, err := log.ConsistencyProof(0, 2); !errors.Is(err, transparency.ErrInvalidTreeSize) {
+		t.Fatal("Expected error to be", transparency.ErrInvalidTreeSize, "got", err)
+	}
+
+	head.TreeSize = 3
+	if err := head.Verify(log.PublicKey()); !errors.Is(err, transparency.ErrInvalidTreeHeadSign) {
+		t.Fatal("Expected error to be", transparency.ErrInvalidTreeHeadSign, "got", err)
+	}
+}
+
+func Test_NewLog_Ed25519(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	log, err := transparency.NewLog(key)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	log.Append(newSignatures(t, 1)...)
+	head, err := log.Publish()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if err := head.Verify(log.PublicKey()); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
@@ -0,0 +1,223 @@
+package transparency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// Hashes of the Merkle trees of RFC 6962, section 2.1. Leaves and nodes are prefixed
+// differently, so that a node can't be passed off as a leaf.
+const (
+	leafHashPrefix = 0x00
+	nodeHashPrefix = 0x01
+)
+
+var (
+	ErrInvalidTreeSize  = errors.New("invalid tree size")
+	ErrInvalidLeafIndex = errors.New("invalid leaf index")
+	ErrInvalidProof     = errors.New("invalid proof")
+)
+
+// LeafHash is the hash of a leaf of the tree: SHA-256(0x00 || data).
+func LeafHash(data []byte) []byte {
+	digest := sha256.Sum256(append([]byte{leafHashPrefix}, data...))
+	return digest[:]
+}
+
+// nodeHash is the hash of an inner node of the tree: SHA-256(0x01 || left || right).
+func nodeHash(left, right []byte) []byte {
+	input := make([]byte, 0, 1+len(left)+len(right))
+	input = append(input, nodeHashPrefix)
+	input = append(input, left...)
+	input = append(input, right...)
+	digest := sha256.Sum256(input)
+	return digest[:]
+}
+
+// emptyRootHash is the root hash of the empty tree, the SHA-256 digest of nothing.
+func emptyRootHash() []byte {
+	digest := sha256.Sum256(nil)
+	return digest[:]
+}
+
+// tree is an append-only Merkle tree. It keeps the hashes of all its complete subtrees,
+// levels[k][i] being the root of the 2^k leaves starting at leaf i*2^k, so that appending
+// a leaf and computing roots and proofs only take a logarithmic number of hashes.
+// It isn't safe for concurrent use.
+type tree struct {
+	levels [][][]byte
+}
+
+func (t *tree) size() int {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return len(t.levels[0])
+}
+
+// append adds a leaf given its hash, completing the subtrees it closes.
+func (t *tree) append(leafHash []byte) {
+	hash := leafHash
+	for level := 0; ; level++ {
+		if level == len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+		t.levels[level] = append(t.levels[level], hash)
+		count := len(t.levels[level])
+		if count%2 == 1 {
+			return
+		}
+		hash = nodeHash(t.levels[level][count-2], t.levels[level][count-1])
+	}
+}
+
+// rootHash is the root hash of the tree of its first size leaves, MTH(D[0:size]).
+func (t *tree) rootHash(size int) ([]byte, error) {
+	if size < 0 || size > t.size() {
+		return nil, ErrInvalidTreeSize
+	}
+	if size == 0 {
+		return emptyRootHash(), nil
+	}
+	return t.subtreeHash(0, size), nil
+}
+
+// subtreeHash is MTH(D[start:end]) of a non-empty range, which RFC 6962 splits at
+// the largest power of two below its size: the left part is always a complete subtree.
+func (t *tree) subtreeHash(start, end int) []byte {
+	size := end - start
+	if size&(size-1) == 0 && start%size == 0 {
+		return t.levels[bits.TrailingZeros(uint(size))][start/size]
+	}
+	k := splitPoint(size)
+	return nodeHash(t.subtreeHash(start, start+k), t.subtreeHash(start+k, end))
+}
+
+// inclusionProof is the audit path of a leaf in the tree of the first size leaves, PATH(index, D[0:size]).
+func (t *tree) inclusionProof(index, size int) ([][]byte, error) {
+	if size <= 0 || size > t.size() {
+		return nil, ErrInvalidTreeSize
+	}
+	if index < 0 || index >= size {
+		return nil, ErrInvalidLeafIndex
+	}
+	return t.path(index, 0, size), nil
+}
+
+func (t *tree) path(index, start, end int) [][]byte {
+	size := end - start
+	if size == 1 {
+		return [][]byte{}
+	}
+	k := splitPoint(size)
+	if index < k {
+		return append(t.path(index, start, start+k), t.subtreeHash(start+k, end))
+	}
+	return append(t.path(index-k, start+k, end), t.subtreeHash(start, start+k))
+}
+
+// consistencyProof proves the tree of the first first leaves is a prefix of the tree
+// of the first second leaves, PROOF(first, D[0:second]).
+func (t *tree) consistencyProof(first, second int) ([][]byte, error) {
+	if first <= 0 || first > second || second > t.size() {
+		return nil, ErrInvalidTreeSize
+	}
+	return t.subproof(first, 0, second, true), nil
+}
+
+func (t *tree) subproof(m, start, end int, complete bool) [][]byte {
+	size := end - start
+	if m == size {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{t.subtreeHash(start, end)}
+	}
+	k := splitPoint(size)
+	if m <= k {
+		return append(t.subproof(m, start, start+k, complete), t.subtreeHash(start+k, end))
+	}
+	return append(t.subproof(m-k, start+k, end, false), t.subtreeHash(start, start+k))
+}
+
+// splitPoint is the largest power of two smaller than size, which must be at least 2.
+func splitPoint(size int) int {
+	return 1 << (bits.Len(uint(size-1)) - 1)
+}
+
+// VerifyInclusion checks the audit path of the leaf at index in the tree of the given size
+// and root hash, with the algorithm of RFC 9162, section 2.1.3.2.
+func VerifyInclusion(leafHash []byte, index, size int, proof [][]byte, rootHash []byte) error {
+	if index < 0 || index >= size {
+		return ErrInvalidLeafIndex
+	}
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn%2 == 1 || fn == sn {
+			hash = nodeHash(p, hash)
+			for fn%2 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else {
+			hash = nodeHash(hash, p)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 || !bytes.Equal(hash, rootHash) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency checks the proof that the tree of size first and root hash firstRoot
+// is a prefix of the tree of size second and root hash secondRoot, with the algorithm of
+// RFC 9162, section 2.1.4.2.
+func VerifyConsistency(first, second int, proof [][]byte, firstRoot, secondRoot []byte) error {
+	if first <= 0 || first > second {
+		return ErrInvalidTreeSize
+	}
+	if first == second {
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrInvalidProof
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return ErrInvalidProof
+	}
+	// A first tree which is a complete subtree is its own first node
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn%2 == 1 {
+		fn, sn = fn>>1, sn>>1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn%2 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn%2 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrInvalidProof
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package transparency_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strconv"
+	"testing"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/transparency"
+)
+
+// referenceRootHash is MTH(D[n]) as written in RFC 6962, section 2.1.
+func referenceRootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		digest := sha256.Sum256(nil)
+		return digest[:]
+	case 1:
+		return transparency.LeafHash(leaves[0])
+	}
+	k := 1
+	for k<<1 < len(leaves) {
+		k <<= 1
+	}
+	digest := sha256.Sum256(append(append([]byte{0x01}, referenceRootHash(leaves[:k])...), referenceRootHash(leaves[k:])...))
+	return digest[:]
+}
+
+func Test_Log_RootHash(t *testing.T) {
+	log, err := transparency.GenerateLog()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	signatures := newSignatures(t, 20)
+	leaves := [][]byte{}
+	for i := 0; i <= len(signatures); i++ {
+		head, err := log.Publish()
+		if err != nil {
+			t.Fatal("Expected no error, got", err)
+		}
+		if expected := referenceRootHash(leaves); !bytes.Equal(head.RootHash, expected) {
+			t.Fatal("Expected root hash", expected, "for size "+strconv.Itoa(i)+", got", head.RootHash)
+		}
+		if i < len(signatures) {
+			log.Append(signatures[i])
+			leaves = append(leaves, transparency.LeafData(signatures[i]))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+)
+
+const maxTimestampResponseSize = 1 << 20
+
+// Client requests timestamp tokens to a remote authority over HTTP (RFC 3161, section 3.4).
+type Client struct {
+	URL string
+	// Roots are the authorities trusted to issue the tokens. Tokens of others are rejected.
+	Roots *x509.CertPool
+	// HTTPClient is optional, http.DefaultClient if unset.
+	HTTPClient *http.Client
+}
+
+func (c *Client) Timestamp(ctx context.Context, message []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, maxSerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	imprint := newImprint(message)
+	body, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: imprint,
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", timestampRequestMediaType)
+	response, err := c.httpClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp authority answered %s", response.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(response.Body, maxTimestampResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp timeStampResp
+	if rest, err := asn1.Unmarshal(reply, &resp); err != nil || len(rest) > 0 {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	if resp.Status.Status != statusGranted && resp.Status.Status != statusGrantedWithMods {
+		return nil, fmt.Errorf("%w: status %d %s", ErrRequestRejected, resp.Status.Status, strings.Join(resp.Status.StatusString, ", "))
+	}
+	token := resp.TimeStampToken.FullBytes
+
+	// Make sure the token answers this very request before storing it
+	signedData, err := cms.Parse(token)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidToken, err)
+	}
+	info, err := parseTSTInfo(signedData.Content)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	if _, err := (&Verifier{Roots: c.Roots}).Verify(token, message); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
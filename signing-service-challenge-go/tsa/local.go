@@ -0,0 +1,233 @@
+package tsa
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/domain"
+)
+
+// DefaultPolicy is the policy of the tokens issued by a LocalAuthority unless
+// configured otherwise. It's the example policy of OpenSSL, real deployments
+// should use an identifier of their own.
+var DefaultPolicy = asn1.ObjectIdentifier{1, 2, 3, 4, 1}
+
+var (
+	oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	maxSerialNumber         = new(big.Int).Lsh(big.NewInt(1), 64)
+)
+
+const maxTimestampRequestSize = 64 << 10
+
+// LocalAuthority is a built-in timestamp authority, for tests and
+// deployments without access to an external one.
+type LocalAuthority struct {
+	certificate *x509.Certificate
+	key         crypto.Signer
+	// Policy of the issued tokens, DefaultPolicy if unset.
+	Policy asn1.ObjectIdentifier
+	// Clock is optional, domain.SystemClock if unset.
+	Clock domain.Clock
+}
+
+// NewLocalAuthority creates an authority issuing tokens signed with the given key.
+// The certificate must be allowed to issue timestamps.
+func NewLocalAuthority(certificate *x509.Certificate, key crypto.Signer) (*LocalAuthority, error) {
+	if !hasTimeStampingUsage(certificate) {
+		return nil, errors.New("certificate is not allowed to issue timestamps")
+	}
+	publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certificate.PublicKey) {
+		return nil, errors.New("key does not match the certificate")
+	}
+	return &LocalAuthority{
+		certificate: certificate,
+		key:         key,
+	}, nil
+}
+
+// GenerateLocalAuthority creates an authority with a fresh key and a self-signed certificate.
+// Its tokens can only be verified as long as the certificate is kept.
+func GenerateLocalAuthority() (*LocalAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, maxSerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	// RFC 3161 requires the extended key usage to be critical, which crypto/x509 doesn't do
+	extKeyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageTimeStamping})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "Signing Service Local Timestamp Authority"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionExtKeyUsage, Critical: true, Value: extKeyUsage},
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLocalAuthority(certificate, key)
+}
+
+// Certificate is the certificate verifying the tokens of the authority.
+func (a *LocalAuthority) Certificate() *x509.Certificate {
+	return a.certificate
+}
+
+func (a *LocalAuthority) Timestamp(ctx context.Context, message []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.issue(newImprint(message), nil)
+}
+
+// ServeHTTP answers RFC 3161 timestamp requests sent over HTTP.
+func (a *LocalAuthority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Content-Type") != timestampRequestMediaType {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTimestampRequestSize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	response, err := asn1.Marshal(a.respond(body))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", timestampReplyMediaType)
+	w.Write(response)
+}
+
+func (a *LocalAuthority) respond(body []byte) timeStampResp {
+	var request timeStampReq
+	if rest, err := asn1.Unmarshal(body, &request); err != nil || len(rest) > 0 || request.Version != 1 {
+		return rejection(failureBadDataFormat)
+	}
+	hash, err := imprintHash(request.MessageImprint)
+	if err != nil || len(request.MessageImprint.HashedMessage) != hash.Size() {
+		return rejection(failureBadAlgorithm)
+	}
+	if request.ReqPolicy != nil && !request.ReqPolicy.Equal(a.policy()) {
+		return rejection(failureBadRequest)
+	}
+
+	token, err := a.issue(request.MessageImprint, request.Nonce)
+	if err != nil {
+		return rejection(failureSystemFailure)
+	}
+	// The certificate is always included, certReq is ignored
+	return timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	}
+}
+
+func (a *LocalAuthority) issue(imprint messageImprint, nonce *big.Int) ([]byte, error) {
+	serialNumber, err := rand.Int(rand.Reader, maxSerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         a.policy(),
+		MessageImprint: imprint,
+		SerialNumber:   serialNumber,
+		GenTime:        marshalGeneralizedTime(a.clock().Now()),
+		Nonce:          nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	certificateHash := sha256.Sum256(a.certificate.Raw)
+	hash := crypto.SHA256
+	if _, ok := a.key.Public().(ed25519.PublicKey); ok {
+		hash = crypto.SHA512
+	}
+	return cms.Sign(info, keySigner{key: a.key, hash: hash}, cms.SignOptions{
+		ContentType: oidContentTypeTSTInfo,
+		Certificate: a.certificate,
+		Hash:        hash,
+		SignedAttributes: []cms.Attribute{{
+			Type:  oidAttributeSigningCertV2,
+			Value: signingCertificateV2{Certs: []essCertIDv2{{CertHash: certificateHash[:]}}},
+		}},
+	})
+}
+
+func (a *LocalAuthority) policy() asn1.ObjectIdentifier {
+	if a.Policy == nil {
+		return DefaultPolicy
+	}
+	return a.Policy
+}
+
+func (a *LocalAuthority) clock() domain.Clock {
+	if a.Clock == nil {
+		return domain.SystemClock{}
+	}
+	return a.Clock
+}
+
+func rejection(failure int) timeStampResp {
+	failInfo := asn1.BitString{Bytes: make([]byte, failure/8+1), BitLength: failure + 1}
+	failInfo.Bytes[failure/8] |= 0x80 >> (failure % 8)
+	return timeStampResp{
+		Status: pkiStatusInfo{Status: statusRejection, FailInfo: failInfo},
+	}
+}
+
+// keySigner adapts a standard library key to cms.Signer.
+type keySigner struct {
+	key  crypto.Signer
+	hash crypto.Hash
+}
+
+func (s keySigner) Sign(data []byte) ([]byte, error) {
+	if _, ok := s.key.Public().(ed25519.PublicKey); ok {
+		return s.key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := s.hash.New()
+	digest.Write(data)
+	return s.key.Sign(rand.Reader, digest.Sum(nil), s.hash)
+}
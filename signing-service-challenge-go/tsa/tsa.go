@@ -0,0 +1,315 @@
+// Package tsa obtains and verifies RFC 3161 timestamp tokens, which prove
+// that some data existed at a given time.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+)
+
+var (
+	oidContentTypeTSTInfo          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidAttributeSigningCert        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidAttributeSigningCertV2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidDigestSHA256                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512                = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidExtKeyUsageTimeStamping     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+	generalizedTimeWithoutFraction = "20060102150405"
+)
+
+var (
+	ErrInvalidToken      = errors.New("invalid timestamp token")
+	ErrImprintMismatch   = errors.New("timestamp token does not cover the message")
+	ErrUntrustedToken    = errors.New("timestamp token is not signed by a trusted authority")
+	ErrRequestRejected   = errors.New("timestamp request rejected")
+	ErrUnsupportedDigest = errors.New("unsupported message imprint digest")
+)
+
+// Authority issues timestamp tokens.
+type Authority interface {
+	// Timestamp returns a DER encoded RFC 3161 TimeStampToken over the SHA-256 digest of message.
+	Timestamp(ctx context.Context, message []byte) ([]byte, error)
+}
+
+const (
+	statusGranted             = 0
+	statusGrantedWithMods     = 1
+	statusRejection           = 2
+	failureBadAlgorithm       = 0
+	failureBadRequest         = 2
+	failureBadDataFormat      = 5
+	failureSystemFailure      = 25
+	timestampRequestMediaType = "application/timestamp-query"
+	timestampReplyMediaType   = "application/timestamp-reply"
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	// GenTime is kept raw as encoding/asn1 rejects fractional seconds
+	GenTime    asn1.RawValue
+	Accuracy   accuracy         `asn1:"optional"`
+	Ordering   bool             `asn1:"optional"`
+	Nonce      *big.Int         `asn1:"optional"`
+	TSA        asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+type essCertIDv2 struct {
+	// The hash algorithm defaults to SHA-256 and is omitted
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificateV2 struct {
+	Certs    []essCertIDv2
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// essCertID identifies the certificate of the authority by its SHA-1 hash (RFC 2634).
+type essCertID struct {
+	CertHash     []byte
+	IssuerSerial asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificate struct {
+	Certs    []essCertID
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// Timestamp is the content of a verified timestamp token.
+type Timestamp struct {
+	Time         time.Time
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	// Authority is the certificate of the authority which signed the token.
+	Authority *x509.Certificate
+}
+
+// Verifier checks timestamp tokens.
+type Verifier struct {
+	// Roots are the trusted authorities. Tokens are rejected when nil.
+	Roots *x509.CertPool
+}
+
+// Verify checks that token is a valid timestamp token over message.
+func (v *Verifier) Verify(token []byte, message []byte) (Timestamp, error) {
+	signedData, err := cms.Parse(token)
+	if err != nil {
+		return Timestamp{}, errors.Join(ErrInvalidToken, err)
+	}
+	if !signedData.ContentType.Equal(oidContentTypeTSTInfo) || signedData.Content == nil {
+		return Timestamp{}, fmt.Errorf("%w: missing TSTInfo", ErrInvalidToken)
+	}
+	if err := signedData.Verify(nil); err != nil {
+		return Timestamp{}, errors.Join(ErrInvalidToken, err)
+	}
+
+	info, err := parseTSTInfo(signedData.Content)
+	if err != nil {
+		return Timestamp{}, err
+	}
+	if err := checkImprint(info.MessageImprint, message); err != nil {
+		return Timestamp{}, err
+	}
+	genTime, err := parseGeneralizedTime(info.GenTime)
+	if err != nil {
+		return Timestamp{}, err
+	}
+
+	authority, err := signedData.Signer()
+	if err != nil {
+		return Timestamp{}, errors.Join(ErrInvalidToken, err)
+	}
+	if !hasTimeStampingUsage(authority) {
+		return Timestamp{}, fmt.Errorf("%w: certificate not allowed to issue timestamps", ErrUntrustedToken)
+	}
+	if err := checkSigningCertificate(signedData, authority); err != nil {
+		return Timestamp{}, err
+	}
+	if v.Roots == nil {
+		return Timestamp{}, fmt.Errorf("%w: no trusted authorities", ErrUntrustedToken)
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range signedData.Certificates {
+		intermediates.AddCert(certificate)
+	}
+	_, err = authority.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   genTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return Timestamp{}, errors.Join(ErrUntrustedToken, err)
+	}
+
+	return Timestamp{
+		Time:         genTime,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Authority:    authority,
+	}, nil
+}
+
+// checkSigningCertificate checks the token binds the certificate of the authority which signed it,
+// through the ESS signing certificate attribute required by RFC 3161: the first certificate it
+// identifies must be the one of the signer.
+func checkSigningCertificate(signedData *cms.SignedData, authority *x509.Certificate) error {
+	var digest, certHash []byte
+
+	var v2 signingCertificateV2
+	err := signedData.UnmarshalAttribute(oidAttributeSigningCertV2, &v2)
+	switch {
+	case err == nil:
+		if len(v2.Certs) == 0 {
+			return fmt.Errorf("%w: empty signing certificate attribute", ErrInvalidToken)
+		}
+		hash := crypto.SHA256
+		if v2.Certs[0].HashAlgorithm.Algorithm != nil {
+			if hash, err = imprintHash(messageImprint{HashAlgorithm: v2.Certs[0].HashAlgorithm}); err != nil {
+				return err
+			}
+		}
+		h := hash.New()
+		h.Write(authority.Raw)
+		digest, certHash = h.Sum(nil), v2.Certs[0].CertHash
+	case errors.Is(err, cms.ErrAttributeNotFound):
+		var v1 signingCertificate
+		if err := signedData.UnmarshalAttribute(oidAttributeSigningCert, &v1); err != nil {
+			return errors.Join(ErrInvalidToken, err)
+		}
+		if len(v1.Certs) == 0 {
+			return fmt.Errorf("%w: empty signing certificate attribute", ErrInvalidToken)
+		}
+		sum := sha1.Sum(authority.Raw)
+		digest, certHash = sum[:], v1.Certs[0].CertHash
+	default:
+		return errors.Join(ErrInvalidToken, err)
+	}
+
+	if !bytes.Equal(digest, certHash) {
+		return fmt.Errorf("%w: signing certificate attribute does not match the signer", ErrInvalidToken)
+	}
+	return nil
+}
+
+func parseTSTInfo(der []byte) (tstInfo, error) {
+	var info tstInfo
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil || len(rest) > 0 {
+		return tstInfo{}, errors.Join(ErrInvalidToken, err)
+	}
+	return info, nil
+}
+
+func newImprint(message []byte) messageImprint {
+	digest := crypto.SHA256.New()
+	digest.Write(message)
+	return messageImprint{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidDigestSHA256},
+		HashedMessage: digest.Sum(nil),
+	}
+}
+
+func imprintHash(imprint messageImprint) (crypto.Hash, error) {
+	switch oid := imprint.HashAlgorithm.Algorithm; {
+	case oid.Equal(oidDigestSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidDigestSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidDigestSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, ErrUnsupportedDigest
+}
+
+func checkImprint(imprint messageImprint, message []byte) error {
+	hash, err := imprintHash(imprint)
+	if err != nil {
+		return err
+	}
+	digest := hash.New()
+	digest.Write(message)
+	if !bytes.Equal(digest.Sum(nil), imprint.HashedMessage) {
+		return ErrImprintMismatch
+	}
+	return nil
+}
+
+func hasTimeStampingUsage(certificate *x509.Certificate) bool {
+	for _, usage := range certificate.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageTimeStamping {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalGeneralizedTime encodes t in UTC with millisecond precision, without trailing zeros as DER requires.
+func marshalGeneralizedTime(t time.Time) asn1.RawValue {
+	return asn1.RawValue{
+		Tag:   asn1.TagGeneralizedTime,
+		Bytes: []byte(t.UTC().Format(generalizedTimeWithoutFraction + ".999Z")),
+	}
+}
+
+func parseGeneralizedTime(raw asn1.RawValue) (time.Time, error) {
+	value := string(raw.Bytes)
+	if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagGeneralizedTime || !strings.HasSuffix(value, "Z") {
+		return time.Time{}, fmt.Errorf("%w: invalid generation time %q", ErrInvalidToken, value)
+	}
+	// time.Parse accepts fractional seconds after the seconds field
+	t, err := time.Parse(generalizedTimeWithoutFraction, strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return time.Time{}, errors.Join(ErrInvalidToken, err)
+	}
+	return t.UTC(), nil
+}
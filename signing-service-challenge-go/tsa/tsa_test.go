@@ -0,0 +1,223 @@
+package tsa_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/cms"
+	"github.com/gdelafuente/fiskaly-coding-challenges/signing-service-challenge-go/tsa"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func newTestAuthority(t *testing.T) (*tsa.LocalAuthority, *x509.CertPool) {
+	authority, err := tsa.GenerateLocalAuthority()
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.Certificate())
+	return authority, roots
+}
+
+func Test_LocalAuthority_Timestamp_Verify(t *testing.T) {
+	authority, roots := newTestAuthority(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	authority.Clock = fixedClock{now}
+
+	token, err := authority.Timestamp(context.Background(), []byte("signature_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	timestamp, err := (&tsa.Verifier{Roots: roots}).Verify(token, []byte("signature_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	if !timestamp.Time.Equal(now) {
+		t.Fatal("Expected time to be", now, "got", timestamp.Time)
+	}
+	if !timestamp.Policy.Equal(tsa.DefaultPolicy) {
+		t.Fatal("Expected policy to be", tsa.DefaultPolicy, "got", timestamp.Policy)
+	}
+}
+
+func Test_Verifier_Verify_OtherMessage_Error(t *testing.T) {
+	authority, roots := newTestAuthority(t)
+
+	token, err := authority.Timestamp(context.Background(), []byte("signature_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	_, err = (&tsa.Verifier{Roots: roots}).Verify(token, []byte("signature_1"))
+	if err == nil || !errors.Is(err, tsa.ErrImprintMismatch) {
+		t.Fatal("Expected error to be", tsa.ErrImprintMismatch, "got", err)
+	}
+}
+
+func Test_Verifier_Verify_UntrustedAuthority_Error(t *testing.T) {
+	authority, _ := newTestAuthority(t)
+	_, otherRoots := newTestAuthority(t)
+
+	token, err := authority.Timestamp(context.Background(), []byte("signature_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	_, err = (&tsa.Verifier{Roots: otherRoots}).Verify(token, []byte("signature_0"))
+	if err == nil || !errors.Is(err, tsa.ErrUntrustedToken) {
+		t.Fatal("Expected error to be", tsa.ErrUntrustedToken, "got", err)
+	}
+}
+
+func Test_Client_Timestamp_OK(t *testing.T) {
+	authority, roots := newTestAuthority(t)
+	server := httptest.NewServer(authority)
+	defer server.Close()
+
+	client := &tsa.Client{URL: server.URL, HTTPClient: server.Client(), Roots: roots}
+	token, err := client.Timestamp(context.Background(), []byte("signature_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	if _, err := (&tsa.Verifier{Roots: roots}).Verify(token, []byte("signature_0")); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+}
+
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) Sign(data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+}
+
+func newTimeStampingCertificate(t *testing.T, key *ecdsa.PrivateKey, serialNumber int64) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: "tsa"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return certificate
+}
+
+// newSignedToken builds a timestamp token over message signed with certificate, whose
+// ESS signing certificate attribute identifies essCertificate.
+func newSignedToken(t *testing.T, key *ecdsa.PrivateKey, certificate *x509.Certificate, essCertificate *x509.Certificate, message []byte) []byte {
+	type messageImprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	type tstInfo struct {
+		Version        int
+		Policy         asn1.ObjectIdentifier
+		MessageImprint messageImprint
+		SerialNumber   *big.Int
+		GenTime        time.Time `asn1:"generalized"`
+	}
+	type essCertIDv2 struct {
+		CertHash []byte
+	}
+	type signingCertificateV2 struct {
+		Certs []essCertIDv2
+	}
+
+	hashedMessage := sha256.Sum256(message)
+	info, err := asn1.Marshal(tstInfo{
+		Version: 1,
+		Policy:  tsa.DefaultPolicy,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}},
+			HashedMessage: hashedMessage[:],
+		},
+		SerialNumber: big.NewInt(1),
+		GenTime:      time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	certificateHash := sha256.Sum256(essCertificate.Raw)
+	token, err := cms.Sign(info, ecdsaSigner{key: key}, cms.SignOptions{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4},
+		Certificate: certificate,
+		Hash:        crypto.SHA256,
+		SignedAttributes: []cms.Attribute{{
+			Type:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47},
+			Value: signingCertificateV2{Certs: []essCertIDv2{{CertHash: certificateHash[:]}}},
+		}},
+	})
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	return token
+}
+
+func Test_Verifier_Verify_SigningCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+	certificate := newTimeStampingCertificate(t, key, 1)
+	// Same subject and key, yet another certificate
+	otherCertificate := newTimeStampingCertificate(t, key, 2)
+	roots := x509.NewCertPool()
+	roots.AddCert(certificate)
+	verifier := &tsa.Verifier{Roots: roots}
+
+	token := newSignedToken(t, key, certificate, certificate, []byte("signature_0"))
+	if _, err := verifier.Verify(token, []byte("signature_0")); err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	token = newSignedToken(t, key, certificate, otherCertificate, []byte("signature_0"))
+	_, err = verifier.Verify(token, []byte("signature_0"))
+	if err == nil || !errors.Is(err, tsa.ErrInvalidToken) {
+		t.Fatal("Expected error to be", tsa.ErrInvalidToken, "got", err)
+	}
+}
+
+func Test_Verifier_Verify_NoRoots_Error(t *testing.T) {
+	authority, _ := newTestAuthority(t)
+
+	token, err := authority.Timestamp(context.Background(), []byte("signature_0"))
+	if err != nil {
+		t.Fatal("Expected no error, got", err)
+	}
+
+	_, err = (&tsa.Verifier{}).Verify(token, []byte("signature_0"))
+	if err == nil || !errors.Is(err, tsa.ErrUntrustedToken) {
+		t.Fatal("Expected error to be", tsa.ErrUntrustedToken, "got", err)
+	}
+}